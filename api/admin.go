@@ -30,9 +30,10 @@ type temporaryFilesView struct {
 }
 
 type renderAgentViewElement struct {
-	Count      int      `json:"count"`
-	Enabled    bool     `json:"enabled"`
-	ActiveWork []string `json:"activeWork"`
+	Count      int           `json:"count"`
+	Enabled    bool          `json:"enabled"`
+	ActiveWork []string      `json:"activeWork"`
+	Pool       []interface{} `json:"pool,omitempty"`
 }
 
 type renderAgentsView struct {
@@ -105,7 +106,7 @@ func (blueprint *adminBlueprint) placeholdersHandler(res http.ResponseWriter, re
 func (blueprint *adminBlueprint) renderAgentsHandler(res http.ResponseWriter, req *http.Request) {
 	view := new(renderAgentsView)
 	view.RenderAgents = make(map[string]renderAgentViewElement)
-	for _, name := range common.RenderAgents {
+	for _, name := range blueprint.agentManager.RenderAgentNames() {
 		view.RenderAgents[name] = blueprint.newRenderAgentViewElement(name)
 	}
 
@@ -121,7 +122,7 @@ func (blueprint *adminBlueprint) renderAgentsHandler(res http.ResponseWriter, re
 
 func (blueprint *adminBlueprint) newRenderAgentViewElement(name string) renderAgentViewElement {
 	enabled, count, activeWork := blueprint.agentManager.ActiveWorkForRenderAgent(name)
-	return renderAgentViewElement{count, enabled, activeWork}
+	return renderAgentViewElement{count, enabled, activeWork, blueprint.agentManager.RenderAgentStatus(name)}
 }
 
 func (blueprint *adminBlueprint) errorsHandler(res http.ResponseWriter, req *http.Request) {
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"github.com/bmizerany/pat"
 	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/render"
 	"github.com/ngerakines/preview/util"
 	"github.com/rcrowley/go-metrics"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,10 +26,13 @@ type assetBlueprint struct {
 	generatedAssetStorageManager common.GeneratedAssetStorageManager
 	templateManager              common.TemplateManager
 	placeholderManager           common.PlaceholderManager
+	renderAgentManager           *render.RenderAgentManager
+	syncRenderTimeout            time.Duration
+	retryAfter                   int
 	s3Client                     common.S3Client
 	signatureManager             SignatureManager
 	localAssetStoragePath        string
-	templatesBySize              map[string]string
+	templatesBySize              map[string][]string
 
 	requestsMeter               metrics.Meter
 	malformedRequestsMeter      metrics.Meter
@@ -54,7 +59,10 @@ func NewAssetBlueprint(
 	templateManager common.TemplateManager,
 	placeholderManager common.PlaceholderManager,
 	s3Client common.S3Client,
-	signatureManager SignatureManager) *assetBlueprint {
+	signatureManager SignatureManager,
+	renderAgentManager *render.RenderAgentManager,
+	syncRenderTimeout int,
+	retryAfter int) *assetBlueprint {
 
 	blueprint := new(assetBlueprint)
 	blueprint.base = "/asset"
@@ -65,6 +73,9 @@ func NewAssetBlueprint(
 	blueprint.localAssetStoragePath = localAssetStoragePath
 	blueprint.s3Client = s3Client
 	blueprint.signatureManager = signatureManager
+	blueprint.renderAgentManager = renderAgentManager
+	blueprint.syncRenderTimeout = time.Duration(syncRenderTimeout) * time.Second
+	blueprint.retryAfter = retryAfter
 
 	blueprint.requestsMeter = metrics.NewMeter()
 	blueprint.malformedRequestsMeter = metrics.NewMeter()
@@ -80,14 +91,14 @@ func NewAssetBlueprint(
 		panic(err)
 	}
 
-	blueprint.templatesBySize = make(map[string]string)
+	blueprint.templatesBySize = make(map[string][]string)
 
-	legacyTemplates, err := blueprint.templateManager.FindByIds(common.LegacyDefaultTemplates)
+	legacyTemplates, err := blueprint.templateManager.FindByIds(common.PlaceholderSizeTemplates)
 	if err == nil {
 		for _, legacyTemplate := range legacyTemplates {
 			placeholderSize, err := common.GetFirstAttribute(legacyTemplate, common.TemplateAttributePlaceholderSize)
 			if err == nil {
-				blueprint.templatesBySize[placeholderSize] = legacyTemplate.Id
+				blueprint.templatesBySize[placeholderSize] = append(blueprint.templatesBySize[placeholderSize], legacyTemplate.Id)
 			}
 		}
 	}
@@ -96,6 +107,7 @@ func NewAssetBlueprint(
 }
 
 func (blueprint *assetBlueprint) AddRoutes(p *pat.PatternServeMux) {
+	p.Get(blueprint.base+"/:id/:template/:page/:file", http.HandlerFunc(blueprint.assetFileHandler))
 	p.Get(blueprint.base+"/:id/:template/:page", http.HandlerFunc(blueprint.assetHandler))
 }
 
@@ -106,6 +118,18 @@ func (blueprint *assetBlueprint) assetHandler(res http.ResponseWriter, req *http
 	templateAlias := req.URL.Query().Get(":template")
 	page := req.URL.Query().Get(":page")
 
+	pending := blueprint.pagePending(assetId, templateAlias, page)
+	if blueprint.waitRequested(req) {
+		if blueprint.waitForRender(assetId, templateAlias, page) {
+			pending = false
+		} else {
+			res.Header().Set("Retry-After", strconv.Itoa(blueprint.retryAfter))
+		}
+	}
+	if pending {
+		res.Header().Set("X-Preview-Status", "pending")
+	}
+
 	action, path := blueprint.getAsset(assetId, templateAlias, page)
 	switch action {
 	case assetActionServeFile:
@@ -137,46 +161,155 @@ func (blueprint *assetBlueprint) assetHandler(res http.ResponseWriter, req *http
 	http.NotFound(res, req)
 }
 
-func (blueprint *assetBlueprint) getAsset(fileId, placeholderSize, page string) (assetAction, string) {
+// assetFileHandler serves the files stored next to a local generated asset, such as the variant playlists and segments of HLS streams and the thumbnail tracks of sprite sheets.
+func (blueprint *assetBlueprint) assetFileHandler(res http.ResponseWriter, req *http.Request) {
+	blueprint.requestsMeter.Mark(1)
+
+	assetId := req.URL.Query().Get(":id")
+	templateAlias := req.URL.Query().Get(":template")
+	page := req.URL.Query().Get(":page")
+	file := req.URL.Query().Get(":file")
+
+	for _, generatedAsset := range blueprint.findGeneratedAssets(assetId, templateAlias, page) {
+		if !util.IsLocalUrl(generatedAsset.Location) {
+			continue
+		}
+		fullPath := filepath.Join(blueprint.localAssetStoragePath, generatedAsset.Location[8:])
+		stem := strings.TrimSuffix(filepath.Base(fullPath), filepath.Ext(fullPath))
+		if file != filepath.Base(file) || !strings.HasPrefix(file, stem) {
+			blueprint.malformedRequestsMeter.Mark(1)
+			http.NotFound(res, req)
+			return
+		}
+		path := filepath.Join(filepath.Dir(fullPath), file)
+		if util.CanLoadFile(path) {
+			// Files without an extension, such as sprite sheets referenced by thumbnail tracks, are sniffed by ServeFile.
+			if filepath.Ext(path) != "" {
+				res.Header().Set("Content-Type", common.ContentType(path))
+			}
+			http.ServeFile(res, req, path)
+			return
+		}
+	}
+	blueprint.emptyRequestsMeter.Mark(1)
+	http.NotFound(res, req)
+}
 
+// findGeneratedAssets returns the generated assets of a source asset for a placeholder size or template id and a page.
+func (blueprint *assetBlueprint) findGeneratedAssets(fileId, placeholderSize, page string) []*common.GeneratedAsset {
 	generatedAssets, err := blueprint.generatedAssetStorageManager.FindBySourceAssetId(fileId)
-	if err != nil {
+	if err != nil || len(generatedAssets) == 0 {
 		blueprint.unknownGeneratedAssetsMeter.Mark(1)
-		return assetAction404, ""
+		return make([]*common.GeneratedAsset, 0, 0)
 	}
-	if len(generatedAssets) == 0 {
-		blueprint.unknownGeneratedAssetsMeter.Mark(1)
+	return blueprint.matchGeneratedAssets(generatedAssets, placeholderSize, page)
+}
+
+// matchGeneratedAssets returns the generated assets for a placeholder size or template id and a page.
+func (blueprint *assetBlueprint) matchGeneratedAssets(generatedAssets []*common.GeneratedAsset, placeholderSize, page string) []*common.GeneratedAsset {
+	results := make([]*common.GeneratedAsset, 0, 0)
+	templateIds, hasTemplateIds := blueprint.templatesBySize[placeholderSize]
+	if !hasTemplateIds {
+		templateIds = []string{placeholderSize}
+	}
+	for _, generatedAsset := range generatedAssets {
+		if util.Contains(templateIds, generatedAsset.TemplateId) && generatedAssetPage(generatedAsset) == page {
+			results = append(results, generatedAsset)
+		}
+	}
+	return results
+}
+
+// generatedAssetPage returns the page of a generated asset. Generated assets without a page attribute are of page 0.
+func generatedAssetPage(generatedAsset *common.GeneratedAsset) string {
+	page, _ := common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributePage)
+	if len(page) == 0 {
+		return "0"
 	}
+	return page
+}
 
-	templateId, hasTemplateId := blueprint.templatesBySize[placeholderSize]
-	if !hasTemplateId {
-		templateId = placeholderSize
+// pagePending returns true if the page of a multi-page source asset has not been rendered yet. Pages that were not rendered when the source asset was processed are rendered when they are first requested, which is when no generated asset of any template exists for the page.
+func (blueprint *assetBlueprint) pagePending(fileId, placeholderSize, page string) bool {
+	pageNumber, err := strconv.Atoi(page)
+	if err != nil || pageNumber < 1 {
+		return false
+	}
+	generatedAssets, err := blueprint.generatedAssetStorageManager.FindBySourceAssetId(fileId)
+	if err != nil {
+		return false
 	}
+	hasPage := false
 	for _, generatedAsset := range generatedAssets {
-		pageVal, _ := common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributePage)
-		if len(pageVal) == 0 {
-			pageVal = "0"
-		}
-		pageMatch := pageVal == page
-		if generatedAsset.TemplateId == templateId && pageMatch {
-			surl := generatedAsset.GetAttribute("streamingUrl")
-			if len(surl) > 0 && len(surl[0]) > 0 {
-				return assetActionVideoURL, surl[0]
-			}
-			if util.IsLocalUrl(generatedAsset.Location) {
-				fullPath := filepath.Join(blueprint.localAssetStoragePath, generatedAsset.Location[8:])
-				if util.CanLoadFile(fullPath) {
-					return assetActionServeFile, fullPath
-				}
-				placeholder := blueprint.placeholderManager.Url(fileId, placeholderSize)
-				if util.CanLoadFile(placeholder.Path) {
-					return assetActionServeFile, placeholder.Path
+		if generatedAssetPage(generatedAsset) == page {
+			hasPage = true
+			break
+		}
+	}
+	if !hasPage {
+		return blueprint.renderAgentManager.RequestPage(fileId, pageNumber)
+	}
+	for _, generatedAsset := range blueprint.matchGeneratedAssets(generatedAssets, placeholderSize, page) {
+		switch generatedAsset.Status {
+		case common.GeneratedAssetStatusWaiting, common.GeneratedAssetStatusScheduled, common.GeneratedAssetStatusProcessing:
+			return true
+		}
+	}
+	return false
+}
+
+// waitRequested returns true if the request opts in to waiting for the generated asset to be rendered with the wait query string parameter or the X-Preview-Wait header.
+func (blueprint *assetBlueprint) waitRequested(req *http.Request) bool {
+	if blueprint.syncRenderTimeout <= 0 {
+		return false
+	}
+	for _, value := range []string{req.URL.Query().Get("wait"), req.Header.Get("X-Preview-Wait")} {
+		wait, err := strconv.ParseBool(value)
+		if err == nil && wait {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForRender raises the priority of the unfinished generated assets for a placeholder size or template id and a page and waits for them to finish until the sync render timeout is reached. It returns false if they were not finished in time.
+func (blueprint *assetBlueprint) waitForRender(fileId, placeholderSize, page string) bool {
+	generatedAssets := blueprint.findGeneratedAssets(fileId, placeholderSize, page)
+	for _, generatedAsset := range generatedAssets {
+		blueprint.renderAgentManager.Prioritize(generatedAsset.Id)
+	}
+	deadline := time.Now().Add(blueprint.syncRenderTimeout)
+	for _, generatedAsset := range generatedAssets {
+		if !blueprint.renderAgentManager.WaitForGeneratedAsset(generatedAsset.Id, deadline.Sub(time.Now())) {
+			return false
+		}
+	}
+	return true
+}
+
+func (blueprint *assetBlueprint) getAsset(fileId, placeholderSize, page string) (assetAction, string) {
+	for _, generatedAsset := range blueprint.findGeneratedAssets(fileId, placeholderSize, page) {
+		surl := generatedAsset.GetAttribute("streamingUrl")
+		if len(surl) > 0 && len(surl[0]) > 0 {
+			return assetActionVideoURL, surl[0]
+		}
+		if util.IsLocalUrl(generatedAsset.Location) {
+			fullPath := filepath.Join(blueprint.localAssetStoragePath, generatedAsset.Location[8:])
+			if util.CanLoadFile(fullPath) {
+				// HLS playlists are redirected to the asset file URL so that the playlists and segments they reference resolve next to them.
+				if strings.HasSuffix(fullPath, ".m3u8") {
+					return assetActionRedirect, strings.Join([]string{blueprint.base, fileId, placeholderSize, page, filepath.Base(fullPath)}, "/")
 				}
+				return assetActionServeFile, fullPath
 			}
-			if util.IsS3Url(generatedAsset.Location) {
-				return assetActionS3Proxy, generatedAsset.Location
+			placeholder := blueprint.placeholderManager.Url(fileId, placeholderSize)
+			if util.CanLoadFile(placeholder.Path) {
+				return assetActionServeFile, placeholder.Path
 			}
 		}
+		if util.IsS3Url(generatedAsset.Location) {
+			return assetActionS3Proxy, generatedAsset.Location
+		}
 	}
 
 	placeholder := blueprint.placeholderManager.Url(fileId, placeholderSize)
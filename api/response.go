@@ -1,5 +1,9 @@
 package api
 
+import (
+	"github.com/ngerakines/preview/common"
+)
+
 type previewInfoCollection struct {
 	FileId string     `json:"file_id"`
 	Page   int32      `json:"-"`
@@ -17,6 +21,7 @@ type imageInfo struct {
 	IsFinal       bool   `json:"isFinal"`
 	IsPlaceholder bool   `json:"isPlaceholder"`
 	Page          int32  `json:"-"`
+	renderPreviewView
 }
 
 type previewInfoResponse struct {
@@ -34,10 +39,11 @@ type multipagePreviewView struct {
 }
 
 type pageView struct {
-	Jumbo  *pageInfoView `json:"jumbo"`
-	Large  *pageInfoView `json:"large"`
-	Medium *pageInfoView `json:"medium"`
-	Small  *pageInfoView `json:"small"`
+	SheetName string        `json:"sheetName,omitempty"`
+	Jumbo     *pageInfoView `json:"jumbo"`
+	Large     *pageInfoView `json:"large"`
+	Medium    *pageInfoView `json:"medium"`
+	Small     *pageInfoView `json:"small"`
 }
 
 type pageInfoView struct {
@@ -46,4 +52,55 @@ type pageInfoView struct {
 	Height  int32  `json:"height"`
 	Expires int64  `json:"expires"`
 	Status  string `json:"status"`
+	renderPreviewView
+}
+
+// renderPreviewView contains what clients need to paint a stand-in for a render before it is loaded.
+type renderPreviewView struct {
+	BlurHash       string   `json:"blurHash,omitempty"`
+	DominantColors []string `json:"dominantColors,omitempty"`
+	Lqip           string   `json:"lqip,omitempty"`
+}
+
+type metadataView struct {
+	FileId       string   `json:"fileId"`
+	Type         string   `json:"type"`
+	Extracted    bool     `json:"extracted"`
+	Width        int32    `json:"width,omitempty"`
+	Height       int32    `json:"height,omitempty"`
+	Orientation  int32    `json:"orientation,omitempty"`
+	CameraMake   string   `json:"cameraMake,omitempty"`
+	CameraModel  string   `json:"cameraModel,omitempty"`
+	CaptureTime  string   `json:"captureTime,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+	ColorProfile string   `json:"colorProfile,omitempty"`
+
+	Title           string   `json:"title,omitempty"`
+	Author          string   `json:"author,omitempty"`
+	Subject         string   `json:"subject,omitempty"`
+	Creator         string   `json:"creator,omitempty"`
+	Producer        string   `json:"producer,omitempty"`
+	Created         string   `json:"created,omitempty"`
+	Modified        string   `json:"modified,omitempty"`
+	Pages           int32    `json:"pages,omitempty"`
+	PageWidth       float64  `json:"pageWidth,omitempty"`
+	PageHeight      float64  `json:"pageHeight,omitempty"`
+	Encrypted       bool     `json:"encrypted,omitempty"`
+	EncryptionFlags []string `json:"encryptionFlags,omitempty"`
+
+	Attachments []string `json:"attachments,omitempty"`
+
+	AlternativeThumbnail string `json:"alternativeThumbnail,omitempty"`
+}
+
+type archiveView struct {
+	FileId         string                `json:"fileId"`
+	Type           string                `json:"type"`
+	Listed         bool                  `json:"listed"`
+	Format         string                `json:"format,omitempty"`
+	TotalSize      int64                 `json:"totalSize"`
+	Truncated      bool                  `json:"truncated"`
+	SkippedEntries int                   `json:"skippedEntries"`
+	Entries        []common.ArchiveEntry `json:"entries"`
 }
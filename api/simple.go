@@ -28,6 +28,8 @@ type simpleBlueprint struct {
 	supportedFileTypes           map[string]int64
 	generatePreviewRequestsMeter metrics.Meter
 	previewInfoRequestsMeter     metrics.Meter
+	metadataRequestsMeter        metrics.Meter
+	archiveRequestsMeter         metrics.Meter
 }
 
 type templateTuple struct {
@@ -60,8 +62,12 @@ func NewSimpleBlueprint(
 
 	blueprint.generatePreviewRequestsMeter = metrics.NewMeter()
 	blueprint.previewInfoRequestsMeter = metrics.NewMeter()
+	blueprint.metadataRequestsMeter = metrics.NewMeter()
+	blueprint.archiveRequestsMeter = metrics.NewMeter()
 	registry.Register("simpleApi.generatePreviewRequests", blueprint.generatePreviewRequestsMeter)
 	registry.Register("simpleApi.previewInfoRequests", blueprint.previewInfoRequestsMeter)
+	registry.Register("simpleApi.metadataRequests", blueprint.metadataRequestsMeter)
+	registry.Register("simpleApi.archiveRequests", blueprint.archiveRequestsMeter)
 
 	return blueprint, nil
 }
@@ -73,6 +79,8 @@ func (blueprint *simpleBlueprint) AddRoutes(p *pat.PatternServeMux) {
 	p.Get(blueprint.buildUrl("/v1/preview/:fileid"), http.HandlerFunc(blueprint.previewInfoHandler))
 	p.Get(blueprint.buildUrl("/v2/preview/"), http.HandlerFunc(blueprint.multipagePreviewInfoHandler))
 	p.Get(blueprint.buildUrl("/v2/preview/:fileid"), http.HandlerFunc(blueprint.multipagePreviewInfoHandler))
+	p.Get(blueprint.buildUrl("/v2/metadata/:fileid"), http.HandlerFunc(blueprint.metadataHandler))
+	p.Get(blueprint.buildUrl("/v2/archive/:fileid"), http.HandlerFunc(blueprint.archiveHandler))
 }
 
 func (blueprint *simpleBlueprint) generatePreviewHandler(res http.ResponseWriter, req *http.Request) {
@@ -123,7 +131,7 @@ func (blueprint *simpleBlueprint) multipagePreviewInfoHandler(res http.ResponseW
 	blueprint.previewInfoRequestsMeter.Mark(1)
 
 	fileIds := blueprint.parseFileIds(req)
-	previewInfo, err := blueprint.multipagePreviewInfoRequest(fileIds)
+	previewInfo, err := blueprint.multipagePreviewInfoRequest(fileIds, blueprint.parsePages(req))
 	if err != nil {
 		http.Error(res, http.StatusText(500), 500)
 		return
@@ -178,6 +186,20 @@ func (blueprint *simpleBlueprint) parseFileIds(req *http.Request) []string {
 	return results
 }
 
+// parsePages returns the pages listed in the page query string parameters. Pages that were not rendered when the file was processed are rendered when they are requested.
+func (blueprint *simpleBlueprint) parsePages(req *http.Request) []int {
+	results := make([]int, 0, 0)
+	for _, value := range req.URL.Query()["page"] {
+		for _, pageValue := range strings.Split(value, ",") {
+			page, err := strconv.Atoi(strings.TrimSpace(pageValue))
+			if err == nil {
+				results = append(results, page)
+			}
+		}
+	}
+	return results
+}
+
 func (blueprint *simpleBlueprint) getSourceAssetType(sourceAsset *common.SourceAsset) string {
 	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
 	if err == nil {
@@ -187,7 +209,7 @@ func (blueprint *simpleBlueprint) getSourceAssetType(sourceAsset *common.SourceA
 }
 
 func (blueprint *simpleBlueprint) legacyTemplates() (map[string]templateTuple, error) {
-	legacyTemplates, err := blueprint.templateManager.FindByIds(common.LegacyDefaultTemplates)
+	legacyTemplates, err := blueprint.templateManager.FindByIds(common.PlaceholderSizeTemplates)
 	if err != nil {
 		return nil, err
 	}
@@ -347,9 +369,9 @@ func (blueprint *simpleBlueprint) getPreviewImage(generatedAsset *common.Generat
 		signedUrl, expires := blueprint.signUrl(blueprint.scrubUrl(generatedAsset, placeholderSize))
 		width, height, err := blueprint.getImageSize(generatedAsset)
 		if err != nil {
-			return &imageInfo{signedUrl, 200, 200, expires, true, false, page}
+			return &imageInfo{signedUrl, 200, 200, expires, true, false, page, newRenderPreviewView(generatedAsset)}
 		}
-		return &imageInfo{signedUrl, width, height, expires, true, false, page}
+		return &imageInfo{signedUrl, width, height, expires, true, false, page, newRenderPreviewView(generatedAsset)}
 	}
 	if strings.HasPrefix(generatedAsset.Status, common.GeneratedAssetStatusFailed) {
 		// NKG: If the job failed, then before we return the placeholder, we set the "isFinal" field.
@@ -387,7 +409,16 @@ func (blueprint *simpleBlueprint) getImageSize(ga *common.GeneratedAsset) (int32
 func (blueprint *simpleBlueprint) getPlaceholder(fileType, placeholderSize string, page int32) *imageInfo {
 	placeholder := blueprint.placeholderManager.Url(fileType, placeholderSize)
 	signedUrl, expires := blueprint.signUrl(blueprint.edgeContentHost + "/static" + placeholder.Url)
-	return &imageInfo{signedUrl, int32(placeholder.Width), int32(placeholder.Height), expires, false, true, page}
+	return &imageInfo{signedUrl, int32(placeholder.Width), int32(placeholder.Height), expires, false, true, page, renderPreviewView{}}
+}
+
+// newRenderPreviewView returns the blur hash, dominant colours and low quality image placeholder of a generated asset.
+func newRenderPreviewView(generatedAsset *common.GeneratedAsset) renderPreviewView {
+	view := renderPreviewView{}
+	view.BlurHash, _ = common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributeBlurHash)
+	view.DominantColors = generatedAsset.GetAttribute(common.GeneratedAssetAttributeDominantColors)
+	view.Lqip, _ = common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributeLqip)
+	return view
 }
 
 func (blueprint *simpleBlueprint) getFileType(sourceAssets []*common.SourceAsset) string {
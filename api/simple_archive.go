@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ngerakines/preview/common"
+	"log"
+	"net/http"
+	"time"
+)
+
+func (blueprint *simpleBlueprint) archiveHandler(res http.ResponseWriter, req *http.Request) {
+	blueprint.archiveRequestsMeter.Mark(1)
+
+	fileId := req.URL.Query().Get(":fileid")
+	sourceAssets, err := blueprint.sourceAssetStorageManager.FindBySourceAssetId(fileId)
+	if err != nil {
+		http.Error(res, http.StatusText(404), 404)
+		return
+	}
+	var sourceAsset *common.SourceAsset
+	for _, candidate := range sourceAssets {
+		if candidate.IdType == common.SourceAssetTypeOrigin {
+			sourceAsset = candidate
+		}
+	}
+	if sourceAsset == nil {
+		http.Error(res, http.StatusText(404), 404)
+		return
+	}
+
+	listing, err := json.Marshal(newArchiveView(fileId, blueprint.getSourceAssetType(sourceAsset), blueprint.archiveListing(fileId)))
+	if err != nil {
+		http.Error(res, http.StatusText(500), 500)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	http.ServeContent(res, req, "", time.Now(), bytes.NewReader(listing))
+}
+
+// archiveListing reads the listing of an archive from the generated asset of the archive listing template. It returns nil until the archive has been listed by the archive render agent, or when it could not be listed.
+func (blueprint *simpleBlueprint) archiveListing(fileId string) *common.ArchiveListing {
+	generatedAssets, err := blueprint.generatedAssetStorageManager.FindBySourceAssetId(fileId)
+	if err != nil {
+		return nil
+	}
+	for _, generatedAsset := range generatedAssets {
+		if generatedAsset.TemplateId != common.ArchiveListingTemplateId || generatedAsset.Status != common.GeneratedAssetStatusComplete {
+			continue
+		}
+		payload, err := blueprint.renderAgentManager.ReadGeneratedAsset(generatedAsset)
+		if err != nil {
+			log.Println("error reading archive listing", err)
+			return nil
+		}
+		listing, err := common.NewArchiveListingFromJson(payload)
+		if err != nil {
+			log.Println("error decoding archive listing", err)
+			return nil
+		}
+		return listing
+	}
+	return nil
+}
+
+// newArchiveView builds the archive response from the listing of an archive. Without a listing, only the file id and type are known.
+func newArchiveView(fileId, fileType string, listing *common.ArchiveListing) *archiveView {
+	view := &archiveView{FileId: fileId, Type: fileType, Entries: make([]common.ArchiveEntry, 0)}
+	if listing == nil {
+		return view
+	}
+	view.Listed = true
+	view.Format = listing.Format
+	view.TotalSize = listing.TotalSize
+	view.Truncated = listing.Truncated
+	view.SkippedEntries = listing.SkippedEntries
+	if listing.Entries != nil {
+		view.Entries = listing.Entries
+	}
+	return view
+}
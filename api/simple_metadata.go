@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ngerakines/preview/common"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (blueprint *simpleBlueprint) metadataHandler(res http.ResponseWriter, req *http.Request) {
+	blueprint.metadataRequestsMeter.Mark(1)
+
+	fileId := req.URL.Query().Get(":fileid")
+	sourceAssets, err := blueprint.sourceAssetStorageManager.FindBySourceAssetId(fileId)
+	if err != nil {
+		http.Error(res, http.StatusText(404), 404)
+		return
+	}
+	var sourceAsset, pdfSourceAsset *common.SourceAsset
+	for _, candidate := range sourceAssets {
+		switch candidate.IdType {
+		case common.SourceAssetTypeOrigin:
+			sourceAsset = candidate
+		case common.SourceAssetTypePdf:
+			pdfSourceAsset = candidate
+		}
+	}
+	if sourceAsset == nil {
+		http.Error(res, http.StatusText(404), 404)
+		return
+	}
+
+	metadata, err := json.Marshal(newMetadataView(fileId, sourceAsset, pdfSourceAsset, blueprint.getSourceAssetType(sourceAsset)))
+	if err != nil {
+		http.Error(res, http.StatusText(500), 500)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	http.ServeContent(res, req, "", time.Now(), bytes.NewReader(metadata))
+}
+
+// newMetadataView builds the metadata response from the attributes of a source asset. Until the metadata has been extracted by a render agent, only the file id and type are known. The document metadata of office documents is read from the pdf source asset they were converted into, which may be nil. The ids of the source assets of the attachments of email messages are included once they have been registered, as is the id of the template of an alternative thumbnail, such as the cover art of an audio file.
+func newMetadataView(fileId string, sourceAsset, pdfSourceAsset *common.SourceAsset, fileType string) *metadataView {
+	view := &metadataView{FileId: fileId, Type: fileType}
+	view.Extracted = sourceAsset.HasAttribute(common.SourceAssetAttributeMetadataExtracted)
+	view.Width = int32Attribute(sourceAsset, common.SourceAssetAttributeImageWidth)
+	view.Height = int32Attribute(sourceAsset, common.SourceAssetAttributeImageHeight)
+	view.Orientation = int32Attribute(sourceAsset, common.SourceAssetAttributeOrientation)
+	view.CameraMake, _ = common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeCameraMake)
+	view.CameraModel, _ = common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeCameraModel)
+	view.CaptureTime, _ = common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeCaptureTime)
+	view.ColorProfile, _ = common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeColorProfile)
+
+	latitude, latitudeErr := floatAttribute(sourceAsset, common.SourceAssetAttributeGpsLatitude)
+	longitude, longitudeErr := floatAttribute(sourceAsset, common.SourceAssetAttributeGpsLongitude)
+	if latitudeErr == nil && longitudeErr == nil {
+		view.Latitude = &latitude
+		view.Longitude = &longitude
+	}
+
+	documentSourceAsset := sourceAsset
+	if !view.Extracted && pdfSourceAsset != nil && pdfSourceAsset.HasAttribute(common.SourceAssetAttributeMetadataExtracted) {
+		documentSourceAsset = pdfSourceAsset
+		view.Extracted = true
+	}
+	view.Title, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentTitle)
+	view.Author, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentAuthor)
+	view.Subject, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentSubject)
+	view.Creator, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentCreator)
+	view.Producer, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentProducer)
+	view.Created, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentCreated)
+	view.Modified, _ = common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeDocumentModified)
+	view.Pages = int32Attribute(documentSourceAsset, common.SourceAssetAttributePages)
+	view.PageWidth, _ = floatAttribute(documentSourceAsset, common.SourceAssetAttributePageWidth)
+	view.PageHeight, _ = floatAttribute(documentSourceAsset, common.SourceAssetAttributePageHeight)
+	encrypted, _ := common.GetFirstAttribute(documentSourceAsset, common.SourceAssetAttributeEncrypted)
+	view.Encrypted = encrypted == "true"
+	view.EncryptionFlags = documentSourceAsset.GetAttribute(common.SourceAssetAttributeEncryptionFlags)
+	view.Attachments = sourceAsset.GetAttribute(common.SourceAssetAttributeAttachments)
+	view.AlternativeThumbnail, _ = common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeAlternativeThumbnail)
+	return view
+}
+
+func int32Attribute(sourceAsset *common.SourceAsset, key string) int32 {
+	rawValue, err := common.GetFirstAttribute(sourceAsset, key)
+	if err != nil {
+		return 0
+	}
+	value, err := strconv.ParseInt(rawValue, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(value)
+}
+
+func floatAttribute(sourceAsset *common.SourceAsset, key string) (float64, error) {
+	rawValue, err := common.GetFirstAttribute(sourceAsset, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(rawValue, 64)
+}
@@ -8,7 +8,7 @@ import (
 	"strings"
 )
 
-func (blueprint *simpleBlueprint) multipagePreviewInfoRequest(fileIds []string) ([]byte, error) {
+func (blueprint *simpleBlueprint) multipagePreviewInfoRequest(fileIds []string, pages []int) ([]byte, error) {
 	responseCollection := make(map[string]*multipagePreviewView)
 
 	templates, err := blueprint.legacyTemplates()
@@ -17,6 +17,9 @@ func (blueprint *simpleBlueprint) multipagePreviewInfoRequest(fileIds []string)
 	}
 
 	for _, fileId := range fileIds {
+		for _, page := range pages {
+			blueprint.renderAgentManager.RequestPage(fileId, page)
+		}
 		view := blueprint.composeMultipagePreviewView(fileId, templates)
 		responseCollection[fileId] = view
 	}
@@ -51,6 +54,10 @@ func (blueprint *simpleBlueprint) composeMultipagePreviewView(fileId string, tem
 	for page, pagedGeneratedAssets := range pagedGeneratedAssetSet {
 		pv := new(pageView)
 		for _, generatedAsset := range pagedGeneratedAssets {
+			sheetName, err := common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributeSheetName)
+			if err == nil {
+				pv.SheetName = sheetName
+			}
 			templateTuple, hasTemplateTuple := templates[generatedAsset.TemplateId]
 			if hasTemplateTuple {
 				switch templateTuple.placeholderSize {
@@ -69,6 +76,24 @@ func (blueprint *simpleBlueprint) composeMultipagePreviewView(fileId string, tem
 		view.Pages[fmt.Sprintf("%d", page)] = pv
 	}
 
+	// Pages that are rendered when they are requested are pending until then.
+	previewPages := blueprint.renderAgentManager.PreviewPages(fileId)
+	if int32(previewPages) > view.PageCount {
+		view.PageCount = int32(previewPages)
+	}
+	for page := 1; page < previewPages; page++ {
+		if _, hasPage := pagedGeneratedAssetSet[int32(page)]; hasPage {
+			continue
+		}
+		pv := new(pageView)
+		blueprint.fillMultipagePlaceholders(pv, fileType)
+		pv.Small.Status = "pending"
+		pv.Medium.Status = "pending"
+		pv.Large.Status = "pending"
+		pv.Jumbo.Status = "pending"
+		view.Pages[fmt.Sprintf("%d", page)] = pv
+	}
+
 	return view
 }
 
@@ -78,7 +103,9 @@ func (blueprint *simpleBlueprint) composePageInfoView(generatedAsset *common.Gen
 		signedUrl, expires := blueprint.signUrl(blueprint.scrubUrl(generatedAsset, placeholderSize))
 		width, height, err := blueprint.getImageSize(generatedAsset)
 		if err == nil {
-			return newPageInfoView(signedUrl, width, height, expires, "complete")
+			view := newPageInfoView(signedUrl, width, height, expires, "complete")
+			view.renderPreviewView = newRenderPreviewView(generatedAsset)
+			return view
 		}
 	}
 	if strings.HasPrefix(generatedAsset.Status, common.GeneratedAssetStatusFailed) {
@@ -4,7 +4,6 @@ import (
 	"github.com/bmizerany/pat"
 	"github.com/codegangsta/negroni"
 	"github.com/etix/stoppableListener"
-	"github.com/jherman3/zencoder"
 	"github.com/ngerakines/preview/api"
 	"github.com/ngerakines/preview/common"
 	"github.com/ngerakines/preview/config"
@@ -39,7 +38,6 @@ type AppContext struct {
 	negroni                      *negroni.Negroni
 	cassandraManager             *common.CassandraManager
 	mysqlManager                 *common.MysqlManager
-	zencoder                     *zencoder.Zencoder
 }
 
 func NewApp(appConfig *config.AppConfig) (*AppContext, error) {
@@ -60,12 +58,6 @@ func NewApp(appConfig *config.AppConfig) (*AppContext, error) {
 	if err != nil {
 		return nil, err
 	}
-	if appConfig.VideoRenderAgent.Enabled {
-		err = app.initZencoder()
-		if err != nil {
-			return nil, err
-		}
-	}
 	err = app.initRenderers()
 	if err != nil {
 		return nil, err
@@ -194,27 +186,15 @@ func (app *AppContext) initStorage() error {
 func (app *AppContext) initRenderers() error {
 	// NKG: This is where the RendererManager is constructed and renderers
 	// are configured and enabled through it.
-	app.agentManager = render.NewRenderAgentManager(app.registry, app.sourceAssetStorageManager, app.generatedAssetStorageManager, app.templateManager, app.temporaryFileManager, app.uploader, app.appConfig.Common.WorkDispatcherEnabled, app.zencoder, app.appConfig.VideoRenderAgent.ZencoderS3Bucket, app.appConfig.VideoRenderAgent.ZencoderNotificationUrl, app.appConfig.DocumentRenderAgent.SupportedFileTypes, app.appConfig.ImageMagickRenderAgent.SupportedFileTypes, app.appConfig.VideoRenderAgent.SupportedFileTypes)
-	app.agentManager.SetRenderAgentInfo(common.RenderAgentImageMagick, app.appConfig.ImageMagickRenderAgent.Enabled, app.appConfig.ImageMagickRenderAgent.Count)
-	app.agentManager.SetRenderAgentInfo(common.RenderAgentDocument, app.appConfig.DocumentRenderAgent.Enabled, app.appConfig.DocumentRenderAgent.Count)
-	app.agentManager.SetRenderAgentInfo(common.RenderAgentVideo, app.appConfig.VideoRenderAgent.Enabled, app.appConfig.VideoRenderAgent.Count)
-
-	if app.appConfig.ImageMagickRenderAgent.Enabled {
-		for i := 0; i < app.appConfig.ImageMagickRenderAgent.Count; i++ {
-			app.agentManager.AddImageMagickRenderAgent(app.downloader, app.uploader, 5)
-		}
-	}
-	if app.appConfig.DocumentRenderAgent.Enabled {
-		for i := 0; i < app.appConfig.DocumentRenderAgent.Count; i++ {
-			app.agentManager.AddDocumentRenderAgent(app.downloader, app.uploader, app.appConfig.DocumentRenderAgent.BasePath, 5)
-		}
-	}
-	if app.appConfig.VideoRenderAgent.Enabled {
-		for i := 0; i < app.appConfig.VideoRenderAgent.Count; i++ {
-			app.agentManager.AddVideoRenderAgent(5)
-		}
+	renderAgentConfigs, err := render.NewRenderAgentConfigs(app.appConfig)
+	if err != nil {
+		return err
 	}
-	return nil
+	app.agentManager = render.NewRenderAgentManager(app.registry, app.sourceAssetStorageManager, app.generatedAssetStorageManager, app.templateManager, app.temporaryFileManager, app.uploader, app.appConfig.Common.WorkDispatcherEnabled, renderAgentConfigs)
+	app.agentManager.SetPageLimits(app.appConfig.Pages.EagerPages, app.appConfig.Pages.MaxPages)
+	app.agentManager.SetWatermarkBasePath(app.appConfig.Common.PlaceholderBasePath)
+	app.agentManager.SetFileTypeDetection(app.appConfig.FileTypes.Detect, app.appConfig.FileTypes.RejectMismatches)
+	return app.agentManager.StartRenderAgents(app.downloader, app.uploader, 5)
 }
 
 func (app *AppContext) initApis() error {
@@ -241,7 +221,7 @@ func (app *AppContext) initApis() error {
 	app.apiBlueprint = api.NewApiBlueprint(app.appConfig.SimpleApi.BaseUrl, app.agentManager, app.generatedAssetStorageManager, app.sourceAssetStorageManager, app.registry, s3Client)
 	app.apiBlueprint.AddRoutes(p)
 
-	app.assetBlueprint = api.NewAssetBlueprint(app.registry, app.appConfig.Common.LocalAssetStoragePath, app.sourceAssetStorageManager, app.generatedAssetStorageManager, app.templateManager, app.placeholderManager, s3Client, app.signatureManager)
+	app.assetBlueprint = api.NewAssetBlueprint(app.registry, app.appConfig.Common.LocalAssetStoragePath, app.sourceAssetStorageManager, app.generatedAssetStorageManager, app.templateManager, app.placeholderManager, s3Client, app.signatureManager, app.agentManager, app.appConfig.AssetApi.SyncRenderTimeout, app.appConfig.AssetApi.RetryAfter)
 	app.assetBlueprint.AddRoutes(p)
 
 	app.adminBlueprint = api.NewAdminBlueprint(app.registry, app.appConfig, app.placeholderManager, app.temporaryFileManager, app.agentManager)
@@ -259,17 +239,6 @@ func (app *AppContext) initApis() error {
 	return nil
 }
 
-func (app *AppContext) initZencoder() error {
-	apikey := app.appConfig.VideoRenderAgent.ZencoderKey
-	app.zencoder = zencoder.NewZencoder(apikey)
-	_, err := app.zencoder.GetAccount()
-	if err != nil {
-		log.Println("Invalid Zencoder key")
-		return common.ErrorNotImplemented
-	}
-	return nil
-}
-
 func (app *AppContext) Stop() {
 	panic("ok")
 	app.agentManager.Stop()
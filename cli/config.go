@@ -51,6 +51,8 @@ func GetCommand(arguments map[string]interface{}) string {
 		return "renderV2"
 	} else if getConfigBool(arguments, "verify") {
 		return "verify"
+	} else if getConfigBool(arguments, "rasterizeSvg") {
+		return "rasterizeSvg"
 	}
 	return "daemon"
 }
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"github.com/ngerakines/preview/render"
+	"log"
+	"os"
+	"strconv"
+)
+
+// RasterizeSvgCommand draws an svg document onto a png image of a given size. It is run in a child process by the svg render agent so that documents that take too long or use too much memory to rasterize can be killed.
+type RasterizeSvgCommand struct {
+	width       string
+	height      string
+	source      string
+	destination string
+}
+
+func NewRasterizeSvgCommand(arguments map[string]interface{}) PreviewCliCommand {
+	command := new(RasterizeSvgCommand)
+	command.width = getConfigString(arguments, "<width>")
+	command.height = getConfigString(arguments, "<height>")
+	command.source = getConfigString(arguments, "<source>")
+	command.destination = getConfigString(arguments, "<destination>")
+	return command
+}
+
+func (command *RasterizeSvgCommand) Execute() {
+	width, err := strconv.Atoi(command.width)
+	if err != nil {
+		log.Println("Invalid width", command.width)
+		os.Exit(1)
+	}
+	height, err := strconv.Atoi(command.height)
+	if err != nil {
+		log.Println("Invalid height", command.height)
+		os.Exit(1)
+	}
+	err = render.RasterizeSvgFile(command.source, command.destination, width, height)
+	if err != nil {
+		log.Println("Error rasterizing svg", err)
+		os.Exit(1)
+	}
+}
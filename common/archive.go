@@ -0,0 +1,32 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// ArchiveEntry is a file or directory of an archive.
+type ArchiveEntry struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Directory bool   `json:"directory,omitempty"`
+	Modified  string `json:"modified,omitempty"`
+}
+
+// ArchiveListing contains the entries of an archive. Entries with unsafe paths, such as absolute paths or paths leaving the archive, and links are left out and counted as skipped. Only the first entries of archives with more entries than the configured limit are listed, and the listing is marked as truncated.
+type ArchiveListing struct {
+	Format         string         `json:"format"`
+	Entries        []ArchiveEntry `json:"entries"`
+	TotalSize      int64          `json:"totalSize"`
+	Truncated      bool           `json:"truncated"`
+	SkippedEntries int            `json:"skippedEntries"`
+}
+
+// NewArchiveListingFromJson returns the archive listing stored as the generated asset of the archive listing template.
+func NewArchiveListingFromJson(payload []byte) (*ArchiveListing, error) {
+	var listing ArchiveListing
+	err := json.Unmarshal(payload, &listing)
+	if err != nil {
+		return nil, err
+	}
+	return &listing, nil
+}
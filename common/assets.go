@@ -70,18 +70,106 @@ var (
 	SourceAssetAttributeSource = "source"
 	// SourceAssetAttributeType is a constant for the type attribute that can be set for source assets.
 	SourceAssetAttributeType = "type"
+	// SourceAssetAttributeDeclaredType is a constant for the declaredType attribute, the file type given when the preview was requested, that is set for source assets when file types are detected.
+	SourceAssetAttributeDeclaredType = "declaredType"
+	// SourceAssetAttributeDetectedType is a constant for the detectedType attribute, the file type detected from the contents of the file, that is set for source assets when file types are detected.
+	SourceAssetAttributeDetectedType = "detectedType"
 	// SourceAssetAttributeSize is a constant for the size attribute that can be set for source assets.
 	SourceAssetAttributeSize = "size"
 	// SourceAssetAttributePages is a constant for the pages attribute that can be set for source assets.
 	SourceAssetAttributePages = "pages"
+	// SourceAssetAttributeHash is a constant for the hash attribute, the hex encoded sha1 hash of the contents of the source file, that is set for source assets.
+	SourceAssetAttributeHash = "hash"
+	// SourceAssetAttributePreviewPages is a constant for the previewPages attribute, the number of pages of a multi-page source asset that previews are rendered for, that can be set for source assets.
+	SourceAssetAttributePreviewPages = "previewPages"
+	// SourceAssetAttributeAlternativeThumbnail is a constant for the alternativeThumbnail attribute, the id of a template whose generated asset can be shown instead of the default thumbnails, such as the cover art of an audio file, that is set for source assets.
+	SourceAssetAttributeAlternativeThumbnail = "alternativeThumbnail"
+	// SourceAssetAttributeAttachments is a constant for the attachments attribute, the ids of the source assets created for the attachments of an email message, that is set for source assets.
+	SourceAssetAttributeAttachments = "attachments"
+	// SourceAssetAttributeAttachmentDepth is a constant for the attachmentDepth attribute, the number of email messages an attachment is nested in, that is set for source assets.
+	SourceAssetAttributeAttachmentDepth = "attachmentDepth"
+	// SourceAssetAttributeAttachmentLimit is a constant for the attachmentLimit attribute, the number of attachments that may still be registered for an email message attached to another one and the messages attached to it, that is set for source assets.
+	SourceAssetAttributeAttachmentLimit = "attachmentLimit"
+	// SourceAssetAttributeMetadataExtracted is a constant for the metadataExtracted attribute, "true" once the metadata of an image or document has been read, that is set for source assets.
+	SourceAssetAttributeMetadataExtracted = "metadataExtracted"
+	// SourceAssetAttributeImageWidth is a constant for the imageWidth attribute, the width of an image as displayed, that is set for source assets.
+	SourceAssetAttributeImageWidth = "imageWidth"
+	// SourceAssetAttributeImageHeight is a constant for the imageHeight attribute, the height of an image as displayed, that is set for source assets.
+	SourceAssetAttributeImageHeight = "imageHeight"
+	// SourceAssetAttributeOrientation is a constant for the orientation attribute, the EXIF orientation from 1 to 8, that is set for source assets.
+	SourceAssetAttributeOrientation = "orientation"
+	// SourceAssetAttributeCameraMake is a constant for the cameraMake attribute that is set for source assets.
+	SourceAssetAttributeCameraMake = "cameraMake"
+	// SourceAssetAttributeCameraModel is a constant for the cameraModel attribute that is set for source assets.
+	SourceAssetAttributeCameraModel = "cameraModel"
+	// SourceAssetAttributeCaptureTime is a constant for the captureTime attribute, in RFC 3339 format, that is set for source assets.
+	SourceAssetAttributeCaptureTime = "captureTime"
+	// SourceAssetAttributeGpsLatitude is a constant for the gpsLatitude attribute, in decimal degrees, that is set for source assets.
+	SourceAssetAttributeGpsLatitude = "gpsLatitude"
+	// SourceAssetAttributeGpsLongitude is a constant for the gpsLongitude attribute, in decimal degrees, that is set for source assets.
+	SourceAssetAttributeGpsLongitude = "gpsLongitude"
+	// SourceAssetAttributeColorProfile is a constant for the colorProfile attribute, the description of an embedded ICC profile, that is set for source assets.
+	SourceAssetAttributeColorProfile = "colorProfile"
+	// SourceAssetAttributeDocumentTitle is a constant for the documentTitle attribute that is set for source assets.
+	SourceAssetAttributeDocumentTitle = "documentTitle"
+	// SourceAssetAttributeDocumentAuthor is a constant for the documentAuthor attribute that is set for source assets.
+	SourceAssetAttributeDocumentAuthor = "documentAuthor"
+	// SourceAssetAttributeDocumentSubject is a constant for the documentSubject attribute that is set for source assets.
+	SourceAssetAttributeDocumentSubject = "documentSubject"
+	// SourceAssetAttributeDocumentCreator is a constant for the documentCreator attribute, the application that created the original document, that is set for source assets.
+	SourceAssetAttributeDocumentCreator = "documentCreator"
+	// SourceAssetAttributeDocumentProducer is a constant for the documentProducer attribute, the application that produced the pdf, that is set for source assets.
+	SourceAssetAttributeDocumentProducer = "documentProducer"
+	// SourceAssetAttributeDocumentCreated is a constant for the documentCreated attribute, in RFC 3339 format when possible, that is set for source assets.
+	SourceAssetAttributeDocumentCreated = "documentCreated"
+	// SourceAssetAttributeDocumentModified is a constant for the documentModified attribute, in RFC 3339 format when possible, that is set for source assets.
+	SourceAssetAttributeDocumentModified = "documentModified"
+	// SourceAssetAttributePageWidth is a constant for the pageWidth attribute, the width of the first page in points, that is set for source assets.
+	SourceAssetAttributePageWidth = "pageWidth"
+	// SourceAssetAttributePageHeight is a constant for the pageHeight attribute, the height of the first page in points, that is set for source assets.
+	SourceAssetAttributePageHeight = "pageHeight"
+	// SourceAssetAttributeEncrypted is a constant for the encrypted attribute, "true" or "false", that is set for source assets.
+	SourceAssetAttributeEncrypted = "encrypted"
+	// SourceAssetAttributeEncryptionFlags is a constant for the encryptionFlags attribute, the permissions of an encrypted document such as "print:yes" and "copy:no", that is set for source assets.
+	SourceAssetAttributeEncryptionFlags = "encryptionFlags"
 
 	// GeneratedAssetAttributePage is a constant for the page attribute that can be set for generated assets.
 	GeneratedAssetAttributePage = "page"
+	// GeneratedAssetAttributeFrameCount is a constant for the frameCount attribute that is set for generated assets of animated templates.
+	GeneratedAssetAttributeFrameCount = "frameCount"
+	// GeneratedAssetAttributeDuration is a constant for the duration attribute, in milliseconds, that is set for generated assets of animated templates.
+	GeneratedAssetAttributeDuration = "duration"
+	// GeneratedAssetAttributeSampleRate is a constant for the sampleRate attribute, in hertz, that is set for generated assets of audio files.
+	GeneratedAssetAttributeSampleRate = "sampleRate"
+	// GeneratedAssetAttributeChannels is a constant for the channels attribute that is set for generated assets of audio files.
+	GeneratedAssetAttributeChannels = "channels"
+	// GeneratedAssetAttributeCoverArt is a constant for the coverArt attribute, "true" when an audio file has embedded cover art, that is set for generated assets of audio files.
+	GeneratedAssetAttributeCoverArt = "coverArt"
+	// GeneratedAssetAttributeSheetName is a constant for the sheetName attribute that is set for the generated assets of each page of a spreadsheet.
+	GeneratedAssetAttributeSheetName = "sheetName"
+	// GeneratedAssetAttributeVttUrl is a constant for the vttUrl attribute, the URL of the WebVTT thumbnail track, that is set for generated assets of sprite sheet templates.
+	GeneratedAssetAttributeVttUrl = "vttUrl"
+	// GeneratedAssetAttributeTextLayer is a constant for the textLayer attribute, "true" when optical character recognition was skipped because the page already has text, that is set for generated assets of ocr templates.
+	GeneratedAssetAttributeTextLayer = "textLayer"
+	// GeneratedAssetAttributeWordCount is a constant for the wordCount attribute, the number of recognized words, that is set for generated assets of ocr templates.
+	GeneratedAssetAttributeWordCount = "wordCount"
+	// GeneratedAssetAttributeBlurHash is a constant for the blurHash attribute, the BlurHash of the rendered image, that is set for generated assets of image templates.
+	GeneratedAssetAttributeBlurHash = "blurHash"
+	// GeneratedAssetAttributeDominantColors is a constant for the dominantColors attribute, the most common colours of the rendered image, that is set for generated assets of image templates.
+	GeneratedAssetAttributeDominantColors = "dominantColors"
+	// GeneratedAssetAttributeLqip is a constant for the lqip attribute, a tiny base64 encoded jpeg data URI of the rendered image, that is set for generated assets of image templates.
+	GeneratedAssetAttributeLqip = "lqip"
 
 	// SourceAssetTypeOrigin is a constant that represents origin types for source assets.
 	SourceAssetTypeOrigin = "origin"
 	// SourceAssetTypePdf is a constant that represents a generated PDF type for source assets.
 	SourceAssetTypePdf = "pdf"
+	// SourceAssetTypePosterFrame is a constant that represents a still frame taken from a video for source assets.
+	SourceAssetTypePosterFrame = "posterFrame"
+	// SourceAssetTypeSheets is a constant that represents the cells of the sheets of a spreadsheet, stored as JSON, for source assets.
+	SourceAssetTypeSheets = "sheets"
+	// SourceAssetTypeEmail is a constant that represents the headers, body and attachment list of an email message, stored as JSON, for source assets.
+	SourceAssetTypeEmail = "email"
 )
 
 // NewSourceAsset creates a new source asset, filling in default values for everything but the id, type and location.
@@ -155,6 +243,33 @@ func (sa *SourceAsset) AddAttribute(name string, value []string) Attribute {
 	return attribute
 }
 
+// mergeAttributes adds the attributes whose keys are not already attributes of the source asset, returning true when any were added.
+func (sa *SourceAsset) mergeAttributes(attributes []Attribute) bool {
+	merged := false
+	for _, attribute := range attributes {
+		if !sa.HasAttribute(attribute.Key) {
+			sa.Attributes = append(sa.Attributes, attribute)
+			merged = true
+		}
+	}
+	return merged
+}
+
+// copy returns a source asset with the same values and its own list of attributes.
+func (sa *SourceAsset) copy() *SourceAsset {
+	sourceAsset := *sa
+	sourceAsset.Attributes = make([]Attribute, len(sa.Attributes))
+	copy(sourceAsset.Attributes, sa.Attributes)
+	return &sourceAsset
+}
+
+func (ga *GeneratedAsset) copy() *GeneratedAsset {
+	generatedAsset := *ga
+	generatedAsset.Attributes = make([]Attribute, len(ga.Attributes))
+	copy(generatedAsset.Attributes, ga.Attributes)
+	return &generatedAsset
+}
+
 func (sa *SourceAsset) HasAttribute(name string) bool {
 	for _, attribute := range sa.Attributes {
 		if attribute.Key == name {
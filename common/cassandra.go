@@ -7,6 +7,9 @@ import (
 	"time"
 )
 
+// maxAddAttributesAttempts is the number of times the conditional update of the attributes of a source asset is attempted before giving up.
+const maxAddAttributesAttempts = 10
+
 type CassandraManager struct {
 	cluster *gocql.ClusterConfig
 }
@@ -23,8 +26,10 @@ CREATE INDEX IF NOT EXISTS ON generated_assets (status);
 CREATE INDEX IF NOT EXISTS ON generated_assets (template_id);
 CREATE TABLE IF NOT EXISTS source_assets (id varchar, type varchar, message blob, PRIMARY KEY (id, type));
 CREATE INDEX IF NOT EXISTS ON source_assets (type);
+CREATE TABLE IF NOT EXISTS source_asset_hashes (hash varchar, id varchar, type varchar, PRIMARY KEY (hash, id, type));
 
 TRUNCATE source_assets;
+TRUNCATE source_asset_hashes;
 TRUNCATE generated_assets;
 TRUNCATE active_generated_assets;
 TRUNCATE waiting_generated_assets;
@@ -96,6 +101,85 @@ func (sasm *cassandraSourceAssetStorageManager) Store(sourceAsset *SourceAsset)
 		return err
 	}
 
+	return sasm.storeHash(session, sourceAsset)
+}
+
+func (sasm *cassandraSourceAssetStorageManager) Update(sourceAsset *SourceAsset) error {
+	sourceAsset.UpdatedAt = time.Now().UnixNano()
+	sourceAsset.UpdatedBy = sasm.nodeId
+	payload, err := sourceAsset.Serialize()
+	if err != nil {
+		log.Println("Error serializing source asset:", err)
+		return err
+	}
+	session, err := sasm.cassandraManager.cluster.CreateSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.Query(`UPDATE `+sasm.keyspace+`.source_assets SET message = ? WHERE id = ? AND type = ?`, payload, sourceAsset.Id, sourceAsset.IdType).Exec()
+	if err != nil {
+		log.Println("Error updating source asset:", err)
+		return err
+	}
+
+	return sasm.storeHash(session, sourceAsset)
+}
+
+// AddAttributes reads the stored source asset and writes it back with the attributes added using a conditional update, retrying when the source asset was updated by something else in the meantime.
+func (sasm *cassandraSourceAssetStorageManager) AddAttributes(id, idType string, attributes []Attribute) (*SourceAsset, error) {
+	session, err := sasm.cassandraManager.cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	for attempt := 0; attempt < maxAddAttributesAttempts; attempt++ {
+		var message []byte
+		err = session.Query(`SELECT message FROM `+sasm.keyspace+`.source_assets WHERE id = ? AND type = ?`, id, idType).Consistency(gocql.Quorum).Scan(&message)
+		if err != nil {
+			log.Println("Error reading source asset:", err)
+			return nil, err
+		}
+		sourceAsset, err := newSourceAssetFromJson(message)
+		if err != nil {
+			return nil, err
+		}
+		if !sourceAsset.mergeAttributes(attributes) {
+			return sourceAsset, nil
+		}
+		sourceAsset.UpdatedAt = time.Now().UnixNano()
+		sourceAsset.UpdatedBy = sasm.nodeId
+		payload, err := sourceAsset.Serialize()
+		if err != nil {
+			log.Println("Error serializing source asset:", err)
+			return nil, err
+		}
+		var currentMessage []byte
+		applied, err := session.Query(`UPDATE `+sasm.keyspace+`.source_assets SET message = ? WHERE id = ? AND type = ? IF message = ?`, payload, id, idType, message).ScanCAS(&currentMessage)
+		if err != nil {
+			log.Println("Error updating source asset:", err)
+			return nil, err
+		}
+		if applied {
+			return sourceAsset, sasm.storeHash(session, sourceAsset)
+		}
+	}
+	return nil, ErrorSourceAssetCouldNotBeUpdated
+}
+
+// storeHash indexes a source asset by the hash of its contents so that it can be found with FindByHash.
+func (sasm *cassandraSourceAssetStorageManager) storeHash(session *gocql.Session, sourceAsset *SourceAsset) error {
+	hash, err := GetFirstAttribute(sourceAsset, SourceAssetAttributeHash)
+	if err != nil {
+		return nil
+	}
+	err = session.Query(`INSERT INTO `+sasm.keyspace+`.source_asset_hashes (hash, id, type) VALUES (?, ?, ?)`, hash, sourceAsset.Id, sourceAsset.IdType).Exec()
+	if err != nil {
+		log.Println("Error persisting source asset hash:", err)
+		return err
+	}
 	return nil
 }
 
@@ -126,6 +210,35 @@ func (sasm *cassandraSourceAssetStorageManager) FindBySourceAssetId(id string) (
 	return results, nil
 }
 
+func (sasm *cassandraSourceAssetStorageManager) FindByHash(hash string) ([]*SourceAsset, error) {
+	results := make([]*SourceAsset, 0, 0)
+
+	session, err := sasm.cassandraManager.cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	iter := session.Query(`SELECT id, type FROM `+sasm.keyspace+`.source_asset_hashes WHERE hash = ?`, hash).Consistency(gocql.One).Iter()
+	var sourceAssetId, sourceAssetType string
+	for iter.Scan(&sourceAssetId, &sourceAssetType) {
+		var message []byte
+		err := session.Query(`SELECT message FROM `+sasm.keyspace+`.source_assets WHERE id = ? AND type = ?`, sourceAssetId, sourceAssetType).Consistency(gocql.One).Scan(&message)
+		if err != nil {
+			continue
+		}
+		sourceAsset, err := newSourceAssetFromJson(message)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, sourceAsset)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (gasm *cassandraGeneratedAssetStorageManager) Store(generatedAsset *GeneratedAsset) error {
 	log.Println("About to store generatedAsset", generatedAsset)
 	generatedAsset.CreatedBy = gasm.nodeId
@@ -36,6 +36,19 @@ var (
 	ErrorCouldNotSerializeSourceAssets    = codederror.NewCodedError([]string{"PRV", "COM"}, 29, "Could not serialze source assets.")
 	ErrorCouldNotSerializeGeneratedAssets = codederror.NewCodedError([]string{"PRV", "COM"}, 30, "Could not serialze generated assets.")
 	ErrorCouldNotDetermineRenderDensity   = codederror.NewCodedError([]string{"PRV", "COM"}, 31, "Could not determine density from template")
+	ErrorCouldNotDecodeAudio              = codederror.NewCodedError([]string{"PRV", "COM"}, 32, "Could not decode audio.")
+	ErrorCouldNotReadSpreadsheet          = codederror.NewCodedError([]string{"PRV", "COM"}, 34, "Could not read spreadsheet.")
+	ErrorUnsafeSvg                        = codederror.NewCodedError([]string{"PRV", "COM"}, 35, "The svg document references external content or is too complex.")
+	ErrorRenderTimedOut                   = codederror.NewCodedError([]string{"PRV", "COM"}, 36, "Rendering took too long.")
+	ErrorSourceAssetCouldNotBeUpdated     = codederror.NewCodedError([]string{"PRV", "COM"}, 37, "Source asset could not be updated.")
+	ErrorCouldNotExtractDocumentText      = codederror.NewCodedError([]string{"PRV", "COM"}, 38, "Could not extract document text.")
+	ErrorCouldNotRecognizeText            = codederror.NewCodedError([]string{"PRV", "COM"}, 39, "Could not recognize text.")
+	ErrorCouldNotApplyWatermark           = codederror.NewCodedError([]string{"PRV", "COM"}, 40, "Could not apply the template watermark.")
+	ErrorFileTypeMismatch                 = codederror.NewCodedError([]string{"PRV", "COM"}, 41, "The contents of the file do not match its file type.")
+	ErrorCouldNotReadArchive              = codederror.NewCodedError([]string{"PRV", "COM"}, 42, "Could not read archive.")
+	ErrorArchiveTooLarge                  = codederror.NewCodedError([]string{"PRV", "COM"}, 43, "The archive is too large to preview.")
+	ErrorCouldNotReadEmail                = codederror.NewCodedError([]string{"PRV", "COM"}, 44, "Could not read email message.")
+	ErrorSpreadsheetTooLarge              = codederror.NewCodedError([]string{"PRV", "COM"}, 45, "The spreadsheet is too large to preview.")
 
 	AllErrors = []codederror.CodedError{
 		ErrorNotImplemented,
@@ -68,6 +81,19 @@ var (
 		ErrorCouldNotSerializeSourceAssets,
 		ErrorCouldNotSerializeGeneratedAssets,
 		ErrorCouldNotDetermineRenderDensity,
+		ErrorCouldNotDecodeAudio,
+		ErrorCouldNotReadSpreadsheet,
+		ErrorUnsafeSvg,
+		ErrorRenderTimedOut,
+		ErrorSourceAssetCouldNotBeUpdated,
+		ErrorCouldNotExtractDocumentText,
+		ErrorCouldNotRecognizeText,
+		ErrorCouldNotApplyWatermark,
+		ErrorFileTypeMismatch,
+		ErrorCouldNotReadArchive,
+		ErrorArchiveTooLarge,
+		ErrorCouldNotReadEmail,
+		ErrorSpreadsheetTooLarge,
 	}
 )
 
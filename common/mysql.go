@@ -16,8 +16,10 @@ CREATE TABLE IF NOT EXISTS generated_assets (id varchar(80), source varchar(255)
 CREATE TABLE IF NOT EXISTS active_generated_assets (id varchar(80) PRIMARY KEY);
 CREATE TABLE IF NOT EXISTS waiting_generated_assets (id varchar(80), source varchar(80), template varchar(80), PRIMARY KEY(template, id, source));
 CREATE TABLE IF NOT EXISTS source_assets (id varchar(80), type varchar(80), message blob, PRIMARY KEY (id, type));
+CREATE TABLE IF NOT EXISTS source_asset_hashes (hash varchar(80), id varchar(80), type varchar(80), PRIMARY KEY (hash, id, type));
 
 TRUNCATE source_assets;
+TRUNCATE source_asset_hashes;
 TRUNCATE generated_assets;
 TRUNCATE active_generated_assets;
 TRUNCATE waiting_generated_assets;
@@ -84,6 +86,82 @@ func (sasm *mysqlSourceAssetStorageManager) Store(sourceAsset *SourceAsset) erro
 		return err
 	}
 
+	return sasm.storeHash(db, sourceAsset)
+}
+
+func (sasm *mysqlSourceAssetStorageManager) Update(sourceAsset *SourceAsset) error {
+	sourceAsset.UpdatedAt = time.Now().UnixNano()
+	sourceAsset.UpdatedBy = sasm.nodeId
+	payload, err := sourceAsset.Serialize()
+	if err != nil {
+		log.Println("Error serializing source asset:", err)
+		return err
+	}
+	db := sasm.manager.db()
+
+	_, err = db.Exec("UPDATE source_assets SET message = ? WHERE id = ? AND type = ?", payload, sourceAsset.Id, sourceAsset.IdType)
+	if err != nil {
+		log.Println("Could not update source_assets", err)
+		return err
+	}
+
+	return sasm.storeHash(db, sourceAsset)
+}
+
+// AddAttributes reads the stored source asset with a locking read and writes it back with the attributes added in the same transaction.
+func (sasm *mysqlSourceAssetStorageManager) AddAttributes(id, idType string, attributes []Attribute) (*SourceAsset, error) {
+	db := sasm.manager.db()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var message []byte
+	err = tx.QueryRow("SELECT message FROM source_assets WHERE id = ? AND type = ? FOR UPDATE", id, idType).Scan(&message)
+	if err != nil {
+		log.Println("Could not read source_assets", err)
+		return nil, err
+	}
+	sourceAsset, err := newSourceAssetFromJson(message)
+	if err != nil {
+		return nil, err
+	}
+	if !sourceAsset.mergeAttributes(attributes) {
+		return sourceAsset, nil
+	}
+	sourceAsset.UpdatedAt = time.Now().UnixNano()
+	sourceAsset.UpdatedBy = sasm.nodeId
+	payload, err := sourceAsset.Serialize()
+	if err != nil {
+		log.Println("Error serializing source asset:", err)
+		return nil, err
+	}
+	_, err = tx.Exec("UPDATE source_assets SET message = ? WHERE id = ? AND type = ?", payload, id, idType)
+	if err != nil {
+		log.Println("Could not update source_assets", err)
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return sourceAsset, sasm.storeHash(db, sourceAsset)
+}
+
+// storeHash indexes a source asset by the hash of its contents so that it can be found with FindByHash.
+func (sasm *mysqlSourceAssetStorageManager) storeHash(db *sql.DB, sourceAsset *SourceAsset) error {
+	hash, err := GetFirstAttribute(sourceAsset, SourceAssetAttributeHash)
+	if err != nil {
+		return nil
+	}
+	_, err = db.Exec("INSERT IGNORE INTO source_asset_hashes (hash, id, type) VALUES (?, ?, ?)", hash, sourceAsset.Id, sourceAsset.IdType)
+	if err != nil {
+		log.Println("Could not update source_asset_hashes", err)
+		return err
+	}
 	return nil
 }
 
@@ -110,6 +188,30 @@ func (sasm *mysqlSourceAssetStorageManager) FindBySourceAssetId(id string) ([]*S
 	return results, nil
 }
 
+func (sasm *mysqlSourceAssetStorageManager) FindByHash(hash string) ([]*SourceAsset, error) {
+	db := sasm.manager.db()
+
+	rows, err := db.Query("SELECT source_assets.message FROM source_asset_hashes JOIN source_assets ON source_assets.id = source_asset_hashes.id AND source_assets.type = source_asset_hashes.type WHERE source_asset_hashes.hash = ?", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make([]*SourceAsset, 0, 0)
+
+	for rows.Next() {
+		var message []byte
+		err := rows.Scan(&message)
+		if err == nil {
+			sourceAsset, err := newSourceAssetFromJson(message)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, sourceAsset)
+		}
+	}
+	return results, rows.Err()
+}
+
 func (gasm *mysqlGeneratedAssetStorageManager) Store(generatedAsset *GeneratedAsset) error {
 	log.Println("About to store generatedAsset", generatedAsset)
 	generatedAsset.CreatedBy = gasm.nodeId
@@ -1,8 +1,17 @@
 package common
 
 var (
-	RenderAgentImageMagick = "renderAgentImageMagick"
-	RenderAgentDocument    = "renderAgentDocument"
-	RenderAgentVideo       = "renderAgentVideo"
-	RenderAgents           = []string{RenderAgentImageMagick, RenderAgentDocument, RenderAgentVideo}
+	RenderAgentImageMagick  = "renderAgentImageMagick"
+	RenderAgentDocument     = "renderAgentDocument"
+	RenderAgentVideo        = "renderAgentVideo"
+	RenderAgentNativeImage  = "renderAgentNativeImage"
+	RenderAgentFfmpeg       = "renderAgentFfmpeg"
+	RenderAgentAudio        = "renderAgentAudio"
+	RenderAgentText         = "renderAgentText"
+	RenderAgentSpreadsheet  = "renderAgentSpreadsheet"
+	RenderAgentSvg          = "renderAgentSvg"
+	RenderAgentDocumentText = "renderAgentDocumentText"
+	RenderAgentOcr          = "renderAgentOcr"
+	RenderAgentArchive      = "renderAgentArchive"
+	RenderAgentEmail        = "renderAgentEmail"
 )
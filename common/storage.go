@@ -2,12 +2,17 @@ package common
 
 import (
 	"log"
+	"sync"
 	"time"
 )
 
 type SourceAssetStorageManager interface {
 	Store(sourceAsset *SourceAsset) error
+	Update(sourceAsset *SourceAsset) error
+	// AddAttributes adds attributes to a stored source asset without replacing the attributes stored by anything else, returning the stored source asset. Attributes with the same key as an attribute the stored source asset already has are not added.
+	AddAttributes(id, idType string, attributes []Attribute) (*SourceAsset, error)
 	FindBySourceAssetId(id string) ([]*SourceAsset, error)
+	FindByHash(hash string) ([]*SourceAsset, error)
 }
 
 type GeneratedAssetStorageManager interface {
@@ -27,11 +32,13 @@ type TemplateManager interface {
 
 type inMemorySourceAssetStorageManager struct {
 	sourceAssets []*SourceAsset
+	mu           sync.RWMutex
 }
 
 type inMemoryGeneratedAssetStorageManager struct {
 	generatedAssets []*GeneratedAsset
 	templateManager TemplateManager
+	mu              sync.RWMutex
 }
 
 type inMemoryTemplateManager struct {
@@ -39,11 +46,16 @@ type inMemoryTemplateManager struct {
 }
 
 func NewSourceAssetStorageManager() SourceAssetStorageManager {
-	return &inMemorySourceAssetStorageManager{make([]*SourceAsset, 0, 0)}
+	sasm := new(inMemorySourceAssetStorageManager)
+	sasm.sourceAssets = make([]*SourceAsset, 0, 0)
+	return sasm
 }
 
 func NewGeneratedAssetStorageManager(templateManager TemplateManager) GeneratedAssetStorageManager {
-	return &inMemoryGeneratedAssetStorageManager{make([]*GeneratedAsset, 0, 0), templateManager}
+	gasm := new(inMemoryGeneratedAssetStorageManager)
+	gasm.generatedAssets = make([]*GeneratedAsset, 0, 0)
+	gasm.templateManager = templateManager
+	return gasm
 }
 
 func NewTemplateManager() TemplateManager {
@@ -53,46 +65,155 @@ func NewTemplateManager() TemplateManager {
 	tm.Store(DefaultTemplateLarge)
 	tm.Store(DefaultTemplateMedium)
 	tm.Store(DefaultTemplateSmall)
+	tm.Store(NativeImageTemplateJumbo)
+	tm.Store(NativeImageTemplateLarge)
+	tm.Store(NativeImageTemplateMedium)
+	tm.Store(NativeImageTemplateSmall)
+	tm.Store(NativeImagePngTemplateJumbo)
+	tm.Store(NativeImagePngTemplateLarge)
+	tm.Store(NativeImagePngTemplateMedium)
+	tm.Store(NativeImagePngTemplateSmall)
+	tm.Store(NativeImageWebpTemplateJumbo)
+	tm.Store(NativeImageWebpTemplateLarge)
+	tm.Store(NativeImageWebpTemplateMedium)
+	tm.Store(NativeImageWebpTemplateSmall)
+	tm.Store(NativeImageAvifTemplateJumbo)
+	tm.Store(NativeImageAvifTemplateLarge)
+	tm.Store(NativeImageAvifTemplateMedium)
+	tm.Store(NativeImageAvifTemplateSmall)
+	tm.Store(NativeImageSquareTemplate512)
+	tm.Store(NativeImageSquareTemplate256)
+	tm.Store(NativeImageSquareTemplate128)
+	tm.Store(NativeImageAnimatedGifTemplate)
+	tm.Store(NativeImageAnimatedWebpTemplate)
 	tm.Store(DocumentConversionTemplate)
+	tm.Store(DocumentTextTemplate)
+	tm.Store(OcrTemplate)
 	tm.Store(VideoConversionTemplate)
+	tm.Store(FfmpegVideoConversionTemplate)
+	tm.Store(VideoPosterFrameTemplate)
+	tm.Store(VideoSpriteSheetTemplate)
+	tm.Store(AudioWaveformTemplateJumbo)
+	tm.Store(AudioWaveformTemplateLarge)
+	tm.Store(AudioWaveformTemplateMedium)
+	tm.Store(AudioWaveformTemplateSmall)
+	tm.Store(AudioCoverArtTemplate)
+	tm.Store(TextTemplateJumbo)
+	tm.Store(TextTemplateLarge)
+	tm.Store(TextTemplateMedium)
+	tm.Store(TextTemplateSmall)
+	tm.Store(SpreadsheetTemplateJumbo)
+	tm.Store(SpreadsheetTemplateLarge)
+	tm.Store(SpreadsheetTemplateMedium)
+	tm.Store(SpreadsheetTemplateSmall)
+	tm.Store(SpreadsheetConversionTemplate)
+	tm.Store(SvgTemplateJumbo)
+	tm.Store(SvgTemplateLarge)
+	tm.Store(SvgTemplateMedium)
+	tm.Store(SvgTemplateSmall)
+	tm.Store(ArchiveTemplateJumbo)
+	tm.Store(ArchiveTemplateLarge)
+	tm.Store(ArchiveTemplateMedium)
+	tm.Store(ArchiveTemplateSmall)
+	tm.Store(ArchiveListingTemplate)
+	tm.Store(EmailTemplateJumbo)
+	tm.Store(EmailTemplateLarge)
+	tm.Store(EmailTemplateMedium)
+	tm.Store(EmailTemplateSmall)
+	tm.Store(EmailConversionTemplate)
+	tm.Store(EmailAttachmentTemplate)
 	return tm
 }
 
 func (sasm *inMemorySourceAssetStorageManager) Store(sourceAsset *SourceAsset) error {
-	sasm.sourceAssets = append(sasm.sourceAssets, sourceAsset)
+	sasm.mu.Lock()
+	defer sasm.mu.Unlock()
+	sasm.sourceAssets = append(sasm.sourceAssets, sourceAsset.copy())
 	return nil
 }
 
+func (sasm *inMemorySourceAssetStorageManager) Update(givenSourceAsset *SourceAsset) error {
+	sasm.mu.Lock()
+	defer sasm.mu.Unlock()
+	for index, sourceAsset := range sasm.sourceAssets {
+		if sourceAsset.Id == givenSourceAsset.Id && sourceAsset.IdType == givenSourceAsset.IdType {
+			updatedSourceAsset := sourceAsset.copy()
+			updatedSourceAsset.Attributes = givenSourceAsset.copy().Attributes
+			updatedSourceAsset.UpdatedAt = time.Now().UnixNano()
+			sasm.sourceAssets[index] = updatedSourceAsset
+			return nil
+		}
+	}
+	return ErrorSourceAssetCouldNotBeUpdated
+}
+
+func (sasm *inMemorySourceAssetStorageManager) AddAttributes(id, idType string, attributes []Attribute) (*SourceAsset, error) {
+	sasm.mu.Lock()
+	defer sasm.mu.Unlock()
+	for index, sourceAsset := range sasm.sourceAssets {
+		if sourceAsset.Id == id && sourceAsset.IdType == idType {
+			updatedSourceAsset := sourceAsset.copy()
+			if updatedSourceAsset.mergeAttributes(attributes) {
+				updatedSourceAsset.UpdatedAt = time.Now().UnixNano()
+				sasm.sourceAssets[index] = updatedSourceAsset
+			}
+			return updatedSourceAsset.copy(), nil
+		}
+	}
+	return nil, ErrorSourceAssetCouldNotBeUpdated
+}
+
 func (sasm *inMemorySourceAssetStorageManager) FindBySourceAssetId(id string) ([]*SourceAsset, error) {
+	sasm.mu.RLock()
+	defer sasm.mu.RUnlock()
 	results := make([]*SourceAsset, 0, 0)
 	for _, sourceAsset := range sasm.sourceAssets {
 		if sourceAsset.Id == id {
-			results = append(results, sourceAsset)
+			results = append(results, sourceAsset.copy())
+		}
+	}
+	return results, nil
+}
+
+func (sasm *inMemorySourceAssetStorageManager) FindByHash(hash string) ([]*SourceAsset, error) {
+	sasm.mu.RLock()
+	defer sasm.mu.RUnlock()
+	results := make([]*SourceAsset, 0, 0)
+	for _, sourceAsset := range sasm.sourceAssets {
+		sourceAssetHash, err := GetFirstAttribute(sourceAsset, SourceAssetAttributeHash)
+		if err == nil && sourceAssetHash == hash {
+			results = append(results, sourceAsset.copy())
 		}
 	}
 	return results, nil
 }
 
 func (gasm *inMemoryGeneratedAssetStorageManager) Store(generatedAsset *GeneratedAsset) error {
-	gasm.generatedAssets = append(gasm.generatedAssets, generatedAsset)
+	gasm.mu.Lock()
+	defer gasm.mu.Unlock()
+	gasm.generatedAssets = append(gasm.generatedAssets, generatedAsset.copy())
 	return nil
 }
 
 func (gasm *inMemoryGeneratedAssetStorageManager) FindById(id string) (*GeneratedAsset, error) {
+	gasm.mu.RLock()
+	defer gasm.mu.RUnlock()
 	for _, generatedAsset := range gasm.generatedAssets {
 		if generatedAsset.Id == id {
-			return generatedAsset, nil
+			return generatedAsset.copy(), nil
 		}
 	}
 	return nil, ErrorNoGeneratedAssetsFoundForId
 }
 
 func (gasm *inMemoryGeneratedAssetStorageManager) FindByIds(ids []string) ([]*GeneratedAsset, error) {
+	gasm.mu.RLock()
+	defer gasm.mu.RUnlock()
 	results := make([]*GeneratedAsset, 0, 0)
 	for _, generatedAsset := range gasm.generatedAssets {
 		for _, id := range ids {
 			if generatedAsset.Id == id {
-				results = append(results, generatedAsset)
+				results = append(results, generatedAsset.copy())
 			}
 		}
 	}
@@ -100,10 +221,12 @@ func (gasm *inMemoryGeneratedAssetStorageManager) FindByIds(ids []string) ([]*Ge
 }
 
 func (gasm *inMemoryGeneratedAssetStorageManager) FindBySourceAssetId(id string) ([]*GeneratedAsset, error) {
+	gasm.mu.RLock()
+	defer gasm.mu.RUnlock()
 	results := make([]*GeneratedAsset, 0, 0)
 	for _, generatedAsset := range gasm.generatedAssets {
 		if generatedAsset.SourceAssetId == id {
-			results = append(results, generatedAsset)
+			results = append(results, generatedAsset.copy())
 		}
 	}
 	return results, nil
@@ -112,6 +235,8 @@ func (gasm *inMemoryGeneratedAssetStorageManager) FindBySourceAssetId(id string)
 func (gasm *inMemoryGeneratedAssetStorageManager) FindWorkForService(serviceName string, workCount int) ([]*GeneratedAsset, error) {
 	templates, _ := gasm.templateManager.FindByRenderService(serviceName)
 	log.Println("templates for", serviceName, ":", templates)
+	gasm.mu.Lock()
+	defer gasm.mu.Unlock()
 	results := make([]*GeneratedAsset, 0, 0)
 	for _, generatedAsset := range gasm.generatedAssets {
 		for _, template := range templates {
@@ -119,7 +244,7 @@ func (gasm *inMemoryGeneratedAssetStorageManager) FindWorkForService(serviceName
 				if generatedAsset.Status == GeneratedAssetStatusWaiting {
 					generatedAsset.Status = GeneratedAssetStatusScheduled
 					generatedAsset.UpdatedAt = time.Now().UnixNano()
-					results = append(results, generatedAsset)
+					results = append(results, generatedAsset.copy())
 				}
 				if len(results) >= workCount {
 					return results, nil
@@ -140,11 +265,16 @@ func buildGeneratedAssetIds(generatedAssets []*GeneratedAsset) []string {
 }
 
 func (gasm *inMemoryGeneratedAssetStorageManager) Update(givenGeneratedAsset *GeneratedAsset) error {
-	for _, generatedAsset := range gasm.generatedAssets {
+	gasm.mu.Lock()
+	defer gasm.mu.Unlock()
+	for index, generatedAsset := range gasm.generatedAssets {
 		if generatedAsset.Id == givenGeneratedAsset.Id {
-			generatedAsset.Status = givenGeneratedAsset.Status
-			generatedAsset.Attributes = givenGeneratedAsset.Attributes
-			generatedAsset.UpdatedAt = time.Now().UnixNano()
+			updatedGeneratedAsset := generatedAsset.copy()
+			updatedGeneratedAsset.Status = givenGeneratedAsset.Status
+			updatedGeneratedAsset.Attributes = make([]Attribute, len(givenGeneratedAsset.Attributes))
+			copy(updatedGeneratedAsset.Attributes, givenGeneratedAsset.Attributes)
+			updatedGeneratedAsset.UpdatedAt = time.Now().UnixNano()
+			gasm.generatedAssets[index] = updatedGeneratedAsset
 			return nil
 		}
 
@@ -1,7 +1,9 @@
 package common
 
 import (
+	"fmt"
 	_ "github.com/ngerakines/testutils"
+	"sync"
 	"testing"
 )
 
@@ -33,3 +35,108 @@ func TestInMemorySourceAssetStorage(t *testing.T) {
 		return
 	}
 }
+
+func TestInMemorySourceAssetUpdate(t *testing.T) {
+	sasm := NewSourceAssetStorageManager()
+
+	sourceAsset, err := NewSourceAsset("0C5F1D0E-3B3C-4D6E-9E55-1B7A2D4F8C90", SourceAssetTypeOrigin)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	err = sasm.Update(sourceAsset)
+	if err == nil {
+		t.Error("Expected an error updating an unknown source asset")
+		return
+	}
+	err = sasm.Store(sourceAsset)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	updatedSourceAsset, err := NewSourceAsset("0C5F1D0E-3B3C-4D6E-9E55-1B7A2D4F8C90", SourceAssetTypeOrigin)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	updatedSourceAsset.AddAttribute(SourceAssetAttributeMetadataExtracted, []string{"true"})
+	err = sasm.Update(updatedSourceAsset)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	results, err := sasm.FindBySourceAssetId("0C5F1D0E-3B3C-4D6E-9E55-1B7A2D4F8C90")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(results) != 1 || !results[0].HasAttribute(SourceAssetAttributeMetadataExtracted) {
+		t.Errorf("Expected the source asset to be updated: (%+v)", results)
+	}
+}
+
+func TestInMemorySourceAssetFindByHash(t *testing.T) {
+	sasm := NewSourceAssetStorageManager()
+
+	for _, id := range []string{"6F2A9C1E-8B47-4D3A-A5E0-9C1B7D2E4F86", "B81D4E6A-2C95-4F07-8E3B-5A9D0C7F1E24"} {
+		sourceAsset, err := NewSourceAsset(id, SourceAssetTypeOrigin)
+		if err != nil {
+			t.Errorf("Unexpected error returned: %s", err)
+			return
+		}
+		sourceAsset.AddAttribute(SourceAssetAttributeHash, []string{"da39a3ee5e6b4b0d3255bfef95601890afd80709"})
+		sasm.Store(sourceAsset)
+	}
+	otherSourceAsset, _ := NewSourceAsset("3C7E0B5D-9A12-4E68-B4F1-2D8A6C0E9B57", SourceAssetTypeOrigin)
+	sasm.Store(otherSourceAsset)
+
+	results, err := sasm.FindByHash("da39a3ee5e6b4b0d3255bfef95601890afd80709")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(results) != 2 {
+		t.Error("Two results expected:", len(results))
+	}
+	results, _ = sasm.FindByHash("unknown")
+	if len(results) != 0 {
+		t.Error("No results expected:", len(results))
+	}
+}
+
+func TestInMemorySourceAssetAddAttributes(t *testing.T) {
+	sasm := NewSourceAssetStorageManager()
+
+	_, err := sasm.AddAttributes("5D8B2E7F-1A39-4C06-9E4B-7F2C0A6D3B18", SourceAssetTypeOrigin, []Attribute{Attribute{Key: SourceAssetAttributeHash, Value: []string{"a"}}})
+	if err == nil {
+		t.Error("Expected an error updating an unknown source asset")
+		return
+	}
+
+	sourceAsset, _ := NewSourceAsset("5D8B2E7F-1A39-4C06-9E4B-7F2C0A6D3B18", SourceAssetTypeOrigin)
+	sasm.Store(sourceAsset)
+
+	var wg sync.WaitGroup
+	for index := 0; index < 10; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			sasm.AddAttributes(sourceAsset.Id, sourceAsset.IdType, []Attribute{Attribute{Key: fmt.Sprintf("attribute%d", index), Value: []string{"true"}}})
+		}(index)
+	}
+	wg.Wait()
+
+	storedSourceAsset, err := sasm.AddAttributes(sourceAsset.Id, sourceAsset.IdType, []Attribute{Attribute{Key: "attribute0", Value: []string{"false"}}})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(storedSourceAsset.Attributes) != 10 || storedSourceAsset.GetAttribute("attribute0")[0] != "true" {
+		t.Errorf("Expected every attribute to be stored once: (%+v)", storedSourceAsset.Attributes)
+	}
+	if len(sourceAsset.Attributes) != 0 {
+		t.Errorf("Expected the stored source asset to be a copy: (%+v)", sourceAsset.Attributes)
+	}
+}
@@ -63,6 +63,655 @@ var (
 		},
 	}
 
+	NativeImageTemplates = []string{
+		"b8a3c00d-8dce-4c93-974c-4ca44a4c39b1",
+		"5fa65788-c498-45cd-9851-3e488240c47f",
+		"d89eb64a-2ca3-4fec-8de9-8da81ef3ba4e",
+		"9a0fab7e-b53f-47e6-baa2-2b1a5da8f6db",
+	}
+	NativeImageTemplateJumbo = &Template{
+		"b8a3c00d-8dce-4c93-974c-4ca44a4c39b1",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	NativeImageTemplateLarge = &Template{
+		"5fa65788-c498-45cd-9851-3e488240c47f",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	NativeImageTemplateMedium = &Template{
+		"d89eb64a-2ca3-4fec-8de9-8da81ef3ba4e",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	NativeImageTemplateSmall = &Template{
+		"9a0fab7e-b53f-47e6-baa2-2b1a5da8f6db",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	// The png, webp and avif templates are not created for source assets by default and must be requested by id.
+	NativeImagePngTemplates = []string{
+		"6e021ac2-25e1-48c9-9c15-3fc53a46b613",
+		"3d9b2fac-b565-40ab-b7bc-104c8dd1cf97",
+		"98113cbb-faa8-4f71-81e4-827747b70407",
+		"31ab6fb7-3e71-4c49-8ff7-bece67cc41d7",
+	}
+	NativeImagePngTemplateJumbo = &Template{
+		"6e021ac2-25e1-48c9-9c15-3fc53a46b613",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	NativeImagePngTemplateLarge = &Template{
+		"3d9b2fac-b565-40ab-b7bc-104c8dd1cf97",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	NativeImagePngTemplateMedium = &Template{
+		"98113cbb-faa8-4f71-81e4-827747b70407",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	NativeImagePngTemplateSmall = &Template{
+		"31ab6fb7-3e71-4c49-8ff7-bece67cc41d7",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	NativeImageWebpTemplates = []string{
+		"be803f8e-f3f4-46b0-bc6c-cb154adc30d0",
+		"50f8b3a7-66b6-4985-936a-e72652104a3a",
+		"23a0365f-c1c9-401b-8d76-baeec7eb96dc",
+		"7634f104-34c0-4e60-90aa-befc0670a2b8",
+	}
+	NativeImageWebpTemplateJumbo = &Template{
+		"be803f8e-f3f4-46b0-bc6c-cb154adc30d0",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"webp"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	NativeImageWebpTemplateLarge = &Template{
+		"50f8b3a7-66b6-4985-936a-e72652104a3a",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"webp"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	NativeImageWebpTemplateMedium = &Template{
+		"23a0365f-c1c9-401b-8d76-baeec7eb96dc",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"webp"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	NativeImageWebpTemplateSmall = &Template{
+		"7634f104-34c0-4e60-90aa-befc0670a2b8",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"webp"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	NativeImageAvifTemplates = []string{
+		"ceb2c854-821f-4c5e-b1fe-ac67857cb4fa",
+		"4ac3a5b4-3667-40d4-88fb-63ebabaa35d2",
+		"8ff3b332-e014-4023-9c5d-69f81bb43e9d",
+		"9e49892d-81eb-4c5b-a4b8-2fb32fe11bba",
+	}
+	NativeImageAvifTemplateJumbo = &Template{
+		"ceb2c854-821f-4c5e-b1fe-ac67857cb4fa",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"avif"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	NativeImageAvifTemplateLarge = &Template{
+		"4ac3a5b4-3667-40d4-88fb-63ebabaa35d2",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"avif"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	NativeImageAvifTemplateMedium = &Template{
+		"8ff3b332-e014-4023-9c5d-69f81bb43e9d",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"avif"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	NativeImageAvifTemplateSmall = &Template{
+		"9e49892d-81eb-4c5b-a4b8-2fb32fe11bba",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"avif"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	// The square templates create exact size tiles and must be requested by id.
+	NativeImageSquareTemplates = []string{
+		"a7a99dc2-c57a-447b-bc39-5a8527cc56d9",
+		"11912535-915b-4fd6-a5a6-915dfc49311f",
+		"0c809219-3ca2-4a38-849e-bf96e8327c4a",
+	}
+	NativeImageSquareTemplate512 = &Template{
+		"a7a99dc2-c57a-447b-bc39-5a8527cc56d9",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"512"}},
+			Attribute{TemplateAttributeHeight, []string{"512"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributeFit, []string{TemplateFitEntropy}},
+		},
+	}
+	NativeImageSquareTemplate256 = &Template{
+		"11912535-915b-4fd6-a5a6-915dfc49311f",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"256"}},
+			Attribute{TemplateAttributeHeight, []string{"256"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributeFit, []string{TemplateFitEntropy}},
+		},
+	}
+	NativeImageSquareTemplate128 = &Template{
+		"0c809219-3ca2-4a38-849e-bf96e8327c4a",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"128"}},
+			Attribute{TemplateAttributeHeight, []string{"128"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributeFit, []string{TemplateFitEntropy}},
+		},
+	}
+
+	// The animated templates create animated images from animated source images and must be requested by id.
+	NativeImageAnimatedTemplates = []string{
+		"2e829978-62cb-4536-8ec5-c816ddef68c3",
+		"24c261ae-ce50-4288-b2d0-5916bb4dfc5a",
+	}
+	NativeImageAnimatedGifTemplate = &Template{
+		"2e829978-62cb-4536-8ec5-c816ddef68c3",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"gif"}},
+			Attribute{TemplateAttributeAnimated, []string{"true"}},
+			Attribute{TemplateAttributeMaxFrames, []string{"150"}},
+			Attribute{TemplateAttributeMaxDuration, []string{"15000"}},
+			Attribute{TemplateAttributeMaxFileSize, []string{"2097152"}},
+		},
+	}
+	NativeImageAnimatedWebpTemplate = &Template{
+		"24c261ae-ce50-4288-b2d0-5916bb4dfc5a",
+		RenderAgentNativeImage,
+		"B2D4",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"webp"}},
+			Attribute{TemplateAttributeAnimated, []string{"true"}},
+			Attribute{TemplateAttributeMaxFrames, []string{"150"}},
+			Attribute{TemplateAttributeMaxDuration, []string{"15000"}},
+			Attribute{TemplateAttributeMaxFileSize, []string{"2097152"}},
+		},
+	}
+
+	AudioWaveformTemplates = []string{
+		"c3f1e6a2-5b0d-4e8f-9a47-1d2b6c8e0f31",
+		"7d4a9b10-2e6c-4f53-8b1d-9e0a3c5f7b62",
+		"f0b85c37-91a4-4d2e-a6c8-3b7e1d9f4a05",
+		"2a6e0d94-c8b3-47f1-9e25-6d1f8a3b7c40",
+	}
+	AudioWaveformTemplateJumbo = &Template{
+		"c3f1e6a2-5b0d-4e8f-9a47-1d2b6c8e0f31",
+		RenderAgentAudio,
+		"9C3E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+			Attribute{TemplateAttributeBackground, []string{"#ffffff"}},
+			Attribute{TemplateAttributeForeground, []string{"#3a7bd5"}},
+		},
+	}
+	AudioWaveformTemplateLarge = &Template{
+		"7d4a9b10-2e6c-4f53-8b1d-9e0a3c5f7b62",
+		RenderAgentAudio,
+		"9C3E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+			Attribute{TemplateAttributeBackground, []string{"#ffffff"}},
+			Attribute{TemplateAttributeForeground, []string{"#3a7bd5"}},
+		},
+	}
+	AudioWaveformTemplateMedium = &Template{
+		"f0b85c37-91a4-4d2e-a6c8-3b7e1d9f4a05",
+		RenderAgentAudio,
+		"9C3E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+			Attribute{TemplateAttributeBackground, []string{"#ffffff"}},
+			Attribute{TemplateAttributeForeground, []string{"#3a7bd5"}},
+		},
+	}
+	AudioWaveformTemplateSmall = &Template{
+		"2a6e0d94-c8b3-47f1-9e25-6d1f8a3b7c40",
+		RenderAgentAudio,
+		"9C3E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+			Attribute{TemplateAttributeBackground, []string{"#ffffff"}},
+			Attribute{TemplateAttributeForeground, []string{"#3a7bd5"}},
+		},
+	}
+
+	AudioCoverArtTemplate = &Template{
+		"8E51B7C2-64DA-4F0E-B93A-D02C7F19E6A4",
+		RenderAgentAudio,
+		"9C3E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributeBackground, []string{"#ffffff"}},
+			Attribute{TemplateAttributeForeground, []string{"#3a7bd5"}},
+		},
+	}
+	AudioCoverArtTemplateId = "8E51B7C2-64DA-4F0E-B93A-D02C7F19E6A4"
+
+	TextTemplates = []string{
+		"5d1c7a3e-0f92-4b68-a4e1-8c3b2d6f9e07",
+		"e8b04f21-7c3d-4a96-b5f2-1a9d6c0e3b48",
+		"31a7c9e5-d4b2-48f0-9c6e-7b5a2f1d8e93",
+		"9f6d2b84-1e5a-4c37-8d09-c2e7a4b6f150",
+	}
+	TextTemplateJumbo = &Template{
+		"5d1c7a3e-0f92-4b68-a4e1-8c3b2d6f9e07",
+		RenderAgentText,
+		"7E1C",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	TextTemplateLarge = &Template{
+		"e8b04f21-7c3d-4a96-b5f2-1a9d6c0e3b48",
+		RenderAgentText,
+		"7E1C",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	TextTemplateMedium = &Template{
+		"31a7c9e5-d4b2-48f0-9c6e-7b5a2f1d8e93",
+		RenderAgentText,
+		"7E1C",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	TextTemplateSmall = &Template{
+		"9f6d2b84-1e5a-4c37-8d09-c2e7a4b6f150",
+		RenderAgentText,
+		"7E1C",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	SpreadsheetTemplates = []string{
+		"47c2e9d1-8b3a-4f65-a0d7-5e9b1c3f2a86",
+		"b6e1f4a0-3d7c-4925-8e4b-0a2c9d5f7e13",
+		"0d8a5c72-e6f1-43b9-b2d4-9c7e3a1f6b58",
+		"e29b7f03-4a6d-4c18-9f5e-3b8d0c2a7e64",
+	}
+	SpreadsheetTemplateJumbo = &Template{
+		"47c2e9d1-8b3a-4f65-a0d7-5e9b1c3f2a86",
+		RenderAgentSpreadsheet,
+		"5B8E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	SpreadsheetTemplateLarge = &Template{
+		"b6e1f4a0-3d7c-4925-8e4b-0a2c9d5f7e13",
+		RenderAgentSpreadsheet,
+		"5B8E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	SpreadsheetTemplateMedium = &Template{
+		"0d8a5c72-e6f1-43b9-b2d4-9c7e3a1f6b58",
+		RenderAgentSpreadsheet,
+		"5B8E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	SpreadsheetTemplateSmall = &Template{
+		"e29b7f03-4a6d-4c18-9f5e-3b8d0c2a7e64",
+		RenderAgentSpreadsheet,
+		"5B8E",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	SpreadsheetConversionTemplate = &Template{
+		"D3A6F1B8-2C49-4E7D-A05B-6E8C1F4D2B97",
+		RenderAgentSpreadsheet,
+		"5B8E",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"json"}},
+		},
+	}
+	SpreadsheetConversionTemplateId = "D3A6F1B8-2C49-4E7D-A05B-6E8C1F4D2B97"
+
+	SvgTemplates = []string{
+		"8a3f6c1e-5d92-4b07-a4e8-2f1c9b7d6e35",
+		"c5e27d90-1b4a-4f83-9e6c-d0a3b8f2c714",
+		"6b9d4e2f-a731-4c5e-8f20-93e1c6a5b7d8",
+		"f1d08a6c-3e5b-47a9-b2c4-5a7e9d1f0c63",
+	}
+	SvgTemplateJumbo = &Template{
+		"8a3f6c1e-5d92-4b07-a4e8-2f1c9b7d6e35",
+		RenderAgentSvg,
+		"2D7A",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	SvgTemplateLarge = &Template{
+		"c5e27d90-1b4a-4f83-9e6c-d0a3b8f2c714",
+		RenderAgentSvg,
+		"2D7A",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	SvgTemplateMedium = &Template{
+		"6b9d4e2f-a731-4c5e-8f20-93e1c6a5b7d8",
+		RenderAgentSvg,
+		"2D7A",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	SvgTemplateSmall = &Template{
+		"f1d08a6c-3e5b-47a9-b2c4-5a7e9d1f0c63",
+		RenderAgentSvg,
+		"2D7A",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	ArchiveTemplates = []string{
+		"3e7b1d94-6c2a-4f58-b0e3-8d5a9c17f26b",
+		"a9c4e0f7-2b13-4d86-9f5e-1c7b3a8d0e42",
+		"5d2f8b6e-9a41-4c07-b3d8-e6f0a1c92b57",
+		"e0b7a3c5-4f96-4e21-8c1d-7a9f2b5e3d08",
+	}
+	ArchiveTemplateJumbo = &Template{
+		"3e7b1d94-6c2a-4f58-b0e3-8d5a9c17f26b",
+		RenderAgentArchive,
+		"A5C3",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	ArchiveTemplateLarge = &Template{
+		"a9c4e0f7-2b13-4d86-9f5e-1c7b3a8d0e42",
+		RenderAgentArchive,
+		"A5C3",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	ArchiveTemplateMedium = &Template{
+		"5d2f8b6e-9a41-4c07-b3d8-e6f0a1c92b57",
+		RenderAgentArchive,
+		"A5C3",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	ArchiveTemplateSmall = &Template{
+		"e0b7a3c5-4f96-4e21-8c1d-7a9f2b5e3d08",
+		RenderAgentArchive,
+		"A5C3",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+	// ArchiveListingTemplate stores the entries of an archive as JSON, served by the archive API.
+	ArchiveListingTemplate = &Template{
+		"4b9d2e70-8f16-4c3a-b5e8-0a7c6d1f9e23",
+		RenderAgentArchive,
+		"A5C3",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"json"}},
+		},
+	}
+	ArchiveListingTemplateId = "4b9d2e70-8f16-4c3a-b5e8-0a7c6d1f9e23"
+
+	EmailTemplates = []string{
+		"7c2e9a41-b6d3-4f08-95e1-a3d8c0f62b74",
+		"d41f6b83-2a9c-4e57-b0d6-8e3a7c5f1920",
+		"0b8e5d27-f3a1-4c96-a7e2-6d9c4b1f8a35",
+		"a6f3c0e9-7d24-4b81-9c5a-2e0b8d6f4713",
+	}
+	EmailTemplateJumbo = &Template{
+		"7c2e9a41-b6d3-4f08-95e1-a3d8c0f62b74",
+		RenderAgentEmail,
+		"E3A1",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"1040"}},
+			Attribute{TemplateAttributeHeight, []string{"780"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeJumbo}},
+		},
+	}
+	EmailTemplateLarge = &Template{
+		"d41f6b83-2a9c-4e57-b0d6-8e3a7c5f1920",
+		RenderAgentEmail,
+		"E3A1",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"520"}},
+			Attribute{TemplateAttributeHeight, []string{"390"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeLarge}},
+		},
+	}
+	EmailTemplateMedium = &Template{
+		"0b8e5d27-f3a1-4c96-a7e2-6d9c4b1f8a35",
+		RenderAgentEmail,
+		"E3A1",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"500"}},
+			Attribute{TemplateAttributeHeight, []string{"376"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeMedium}},
+		},
+	}
+	EmailTemplateSmall = &Template{
+		"a6f3c0e9-7d24-4b81-9c5a-2e0b8d6f4713",
+		RenderAgentEmail,
+		"E3A1",
+		[]Attribute{
+			Attribute{TemplateAttributeWidth, []string{"250"}},
+			Attribute{TemplateAttributeHeight, []string{"188"}},
+			Attribute{TemplateAttributeOutput, []string{"png"}},
+			Attribute{TemplateAttributePlaceholderSize, []string{PlaceholderSizeSmall}},
+		},
+	}
+
+	EmailConversionTemplate = &Template{
+		"5F2B8E61-C7D4-4A39-8E0B-1D6A9F3C7E52",
+		RenderAgentEmail,
+		"E3A1",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"json"}},
+		},
+	}
+	EmailConversionTemplateId = "5F2B8E61-C7D4-4A39-8E0B-1D6A9F3C7E52"
+
+	// EmailAttachmentTemplate is used to build the locations that the attachments of email messages are uploaded to. The page of the location is the index of the attachment.
+	EmailAttachmentTemplate = &Template{
+		"B8D04C7A-3E95-4F12-A6C8-9E7F2B5D0A14",
+		RenderAgentEmail,
+		"E3A1",
+		[]Attribute{},
+	}
+	EmailAttachmentTemplateId = "B8D04C7A-3E95-4F12-A6C8-9E7F2B5D0A14"
+
+	// PlaceholderSizeTemplates contains the ids of all of the templates that produce the jumbo, large, medium and small previews of a page.
+	PlaceholderSizeTemplates = joinTemplateIds(LegacyDefaultTemplates, NativeImageTemplates, AudioWaveformTemplates, TextTemplates, SpreadsheetTemplates, SvgTemplates, ArchiveTemplates, EmailTemplates)
+
 	DocumentConversionTemplate = &Template{
 		"9B17C6CE-7B09-4FD5-92AD-D85DD218D6D7",
 		RenderAgentDocument,
@@ -73,6 +722,29 @@ var (
 	}
 	DocumentConversionTemplateId = "9B17C6CE-7B09-4FD5-92AD-D85DD218D6D7"
 
+	DocumentTextTemplate = &Template{
+		"2E4B7C19-6A3D-4F80-B15E-9D72C8A04F36",
+		RenderAgentDocumentText,
+		"D0C7",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"txt"}},
+		},
+	}
+	DocumentTextTemplateId = "2E4B7C19-6A3D-4F80-B15E-9D72C8A04F36"
+
+	OcrTemplate = &Template{
+		"7C3E1A95-4D2B-4F68-8E07-B1A9C5D3F246",
+		RenderAgentOcr,
+		"0C12",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"json"}},
+			Attribute{TemplateAttributeLanguages, []string{"eng"}},
+			Attribute{TemplateAttributeDensity, []string{"300"}},
+			Attribute{TemplateAttributeOcrSource, []string{TemplateOcrSourcePage}},
+		},
+	}
+	OcrTemplateId = "7C3E1A95-4D2B-4F68-8E07-B1A9C5D3F246"
+
 	VideoConversionTemplate = &Template{
 		"4128966B-9F69-4E56-AD5C-1FDB3C24F910",
 		RenderAgentVideo,
@@ -83,6 +755,40 @@ var (
 	}
 	VideoConversionTemplateId = "4128966B-9F69-4E56-AD5C-1FDB3C24F910"
 
+	FfmpegVideoConversionTemplate = &Template{
+		"B954398A-242C-4F0B-986D-8AD478F5C81F",
+		RenderAgentFfmpeg,
+		"F4E6",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"m3u8"}},
+		},
+	}
+	FfmpegVideoConversionTemplateId = "B954398A-242C-4F0B-986D-8AD478F5C81F"
+
+	VideoPosterFrameTemplate = &Template{
+		"9BD73D1A-8717-4DA3-9B52-001AA98D3F39",
+		RenderAgentFfmpeg,
+		"F4E6",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+		},
+	}
+	VideoPosterFrameTemplateId = "9BD73D1A-8717-4DA3-9B52-001AA98D3F39"
+
+	VideoSpriteSheetTemplate = &Template{
+		"6F2E9C41-0B7D-4A58-8E13-C5D27A9B3F60",
+		RenderAgentFfmpeg,
+		"F4E6",
+		[]Attribute{
+			Attribute{TemplateAttributeOutput, []string{"jpg"}},
+			Attribute{TemplateAttributeWidth, []string{"160"}},
+			Attribute{TemplateAttributeInterval, []string{"10"}},
+			Attribute{TemplateAttributeColumns, []string{"10"}},
+			Attribute{TemplateAttributeMaxFrames, []string{"100"}},
+		},
+	}
+	VideoSpriteSheetTemplateId = "6F2E9C41-0B7D-4A58-8E13-C5D27A9B3F60"
+
 	// TemplateAttributeHeight is a constant for the height attribute that can be set for templates.
 	TemplateAttributeHeight = "height"
 	// TemplateAttributeWidth is a constant for the width attribute that can be set for templates.
@@ -93,6 +799,73 @@ var (
 	TemplateAttributePlaceholderSize = "placeholderSize"
 	// TemplateAttributeDensity is the density by which ImageMagick samples the image.
 	TemplateAttributeDensity = "density"
+	// TemplateAttributeFit is a constant for the fit attribute that determines how images are resized to the template width and height.
+	TemplateAttributeFit = "fit"
+	// TemplateAttributeBackground is a constant for the background attribute, a "#rrggbb" or "#rrggbbaa" colour used to pad and flatten images.
+	TemplateAttributeBackground = "background"
+	// TemplateAttributeForeground is a constant for the foreground attribute, a "#rrggbb" or "#rrggbbaa" colour used to draw waveforms and watermark text.
+	TemplateAttributeForeground = "foreground"
+	// TemplateAttributeWatermarkImage is a constant for the watermarkImage attribute, the name of an image file in the placeholder directory that is stamped onto renders.
+	TemplateAttributeWatermarkImage = "watermarkImage"
+	// TemplateAttributeWatermarkText is a constant for the watermarkText attribute, text that is stamped onto renders when the template has no watermark image.
+	TemplateAttributeWatermarkText = "watermarkText"
+	// TemplateAttributeWatermarkPosition is a constant for the watermarkPosition attribute that determines where the watermark is stamped.
+	TemplateAttributeWatermarkPosition = "watermarkPosition"
+	// TemplateAttributeWatermarkOpacity is a constant for the watermarkOpacity attribute, the opacity of the watermark between 0 and 1.
+	TemplateAttributeWatermarkOpacity = "watermarkOpacity"
+	// TemplateAttributeWatermarkScale is a constant for the watermarkScale attribute, the width of the watermark as a fraction of the width of the render.
+	TemplateAttributeWatermarkScale = "watermarkScale"
+
+	// TemplateAttributeAnimated is a constant for the animated attribute. When "true", animated source images create animated images.
+	TemplateAttributeAnimated = "animated"
+	// TemplateAttributeMaxFrames is a constant for the maxFrames attribute that limits the number of frames of animated images.
+	TemplateAttributeMaxFrames = "maxFrames"
+	// TemplateAttributeMaxDuration is a constant for the maxDuration attribute that limits the duration, in milliseconds, of animated images.
+	TemplateAttributeMaxDuration = "maxDuration"
+	// TemplateAttributeMaxFileSize is a constant for the maxFileSize attribute that limits the size, in bytes, of animated images.
+	TemplateAttributeMaxFileSize = "maxFileSize"
+
+	// TemplateAttributeInterval is a constant for the interval attribute, in seconds, between the video frames of sprite sheets.
+	TemplateAttributeInterval = "interval"
+	// TemplateAttributeColumns is a constant for the columns attribute that determines the number of frames in each row of sprite sheets.
+	TemplateAttributeColumns = "columns"
+	// TemplateAttributeStripMetadata is a constant for the stripMetadata attribute. When "true", EXIF, XMP and other metadata are removed from generated images.
+	TemplateAttributeStripMetadata = "stripMetadata"
+	// TemplateAttributeTimeout is a constant for the timeout attribute, the number of seconds the external processes rendering the template may take, overriding the render agent timeout.
+	TemplateAttributeTimeout = "timeout"
+	// TemplateAttributeLanguages is a constant for the languages attribute, the tesseract language codes such as "eng" and "deu" used to recognize text.
+	TemplateAttributeLanguages = "languages"
+	// TemplateAttributeOcrSource is a constant for the ocrSource attribute that determines which image of a page text is recognized in.
+	TemplateAttributeOcrSource = "ocrSource"
+
+	// TemplateOcrSourcePage recognizes text in the page itself, rasterized at the template density.
+	TemplateOcrSourcePage = "page"
+	// TemplateOcrSourcePreview recognizes text in the jumbo preview of the page when it has been rendered, falling back to the page.
+	TemplateOcrSourcePreview = "preview"
+
+	// TemplateWatermarkPositionCenter stamps the watermark in the center of renders.
+	TemplateWatermarkPositionCenter = "center"
+	// TemplateWatermarkPositionTopLeft stamps the watermark in the top left corner of renders.
+	TemplateWatermarkPositionTopLeft = "topLeft"
+	// TemplateWatermarkPositionTopRight stamps the watermark in the top right corner of renders.
+	TemplateWatermarkPositionTopRight = "topRight"
+	// TemplateWatermarkPositionBottomLeft stamps the watermark in the bottom left corner of renders.
+	TemplateWatermarkPositionBottomLeft = "bottomLeft"
+	// TemplateWatermarkPositionBottomRight stamps the watermark in the bottom right corner of renders.
+	TemplateWatermarkPositionBottomRight = "bottomRight"
+	// TemplateWatermarkPositionTile repeats the watermark across renders.
+	TemplateWatermarkPositionTile = "tile"
+
+	// TemplateFitContain scales images to fit within the template width and height.
+	TemplateFitContain = "contain"
+	// TemplateFitCover scales images to cover the template width and height and crops the center to the exact dimensions.
+	TemplateFitCover = "cover"
+	// TemplateFitPad scales images to fit within the template width and height and pads them with the background colour to the exact dimensions.
+	TemplateFitPad = "pad"
+	// TemplateFitEntropy scales images to cover the template width and height and crops to the region with the most detail.
+	TemplateFitEntropy = "entropy"
+	// TemplateFitEdge scales images to cover the template width and height and crops to the region with the strongest edges.
+	TemplateFitEdge = "edge"
 )
 
 func (template *Template) AddAttribute(name string, value []string) Attribute {
@@ -118,3 +891,12 @@ func (template *Template) GetAttribute(key string) []string {
 	}
 	return []string{}
 }
+
+// joinTemplateIds returns a new slice with the template ids of every group in order.
+func joinTemplateIds(groups ...[]string) []string {
+	templateIds := make([]string, 0, 0)
+	for _, group := range groups {
+		templateIds = append(templateIds, group...)
+	}
+	return templateIds
+}
@@ -49,7 +49,7 @@ func (uploader *s3Uploader) Upload(destination, path string) error {
 		// where path will begin with a `/` character.
 		parts := strings.SplitN(usableData, "/", 2)
 		log.Println("parts", parts)
-		object, err := uploader.s3Client.NewObject(parts[1], parts[0], "application/octet-stream")
+		object, err := uploader.s3Client.NewObject(parts[1], parts[0], ContentType(path))
 		if err != nil {
 			log.Println("Could not create object", err)
 			return err
@@ -76,8 +76,7 @@ func (uploader *s3Uploader) Url(sourceAsset *SourceAsset, template *Template, pa
 	if template.Id == DocumentConversionTemplateId {
 		return fmt.Sprintf("s3://%s/%s-pdf", bucket, sourceAsset.Id)
 	}
-	placeholderSize := template.GetAttribute(TemplateAttributePlaceholderSize)[0]
-	return fmt.Sprintf("s3://%s/%s-%s-%d", bucket, sourceAsset.Id, placeholderSize, page)
+	return fmt.Sprintf("s3://%s/%s-%s-%d%s", bucket, sourceAsset.Id, templateName(template), page, outputExtension(template))
 }
 
 func (uploader *localUploader) Upload(destination, existingFile string) error {
@@ -102,6 +101,52 @@ func (uploader *localUploader) Url(sourceAsset *SourceAsset, template *Template,
 	if template.Id == DocumentConversionTemplateId {
 		return fmt.Sprintf("local:///%s/pdf", sourceAsset.Id)
 	}
-	placeholderSize := template.GetAttribute(TemplateAttributePlaceholderSize)[0]
-	return fmt.Sprintf("local:///%s/%s/%d", sourceAsset.Id, placeholderSize, page)
+	return fmt.Sprintf("local:///%s/%s/%d%s", sourceAsset.Id, templateName(template), page, outputExtension(template))
+}
+
+// templateName returns the placeholder size of a template, or the template id for templates without one.
+func templateName(template *Template) string {
+	placeholderSize, err := GetFirstAttribute(template, TemplateAttributePlaceholderSize)
+	if err != nil {
+		return template.Id
+	}
+	return placeholderSize
+}
+
+// outputExtension returns the file extension used for generated assets of templates that do not produce jpg images, allowing templates of the same placeholder size to be stored side by side.
+func outputExtension(template *Template) string {
+	output, err := GetFirstAttribute(template, TemplateAttributeOutput)
+	if err != nil || output == "jpg" || output == "jpeg" {
+		return ""
+	}
+	return "." + output
+}
+
+// ContentType returns the content type of a file based on its extension.
+func ContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".avif":
+		return "image/avif"
+	case ".pdf":
+		return "application/pdf"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".vtt":
+		return "text/vtt"
+	case ".json":
+		return "application/json"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
 }
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestLocalUploaderUrl(t *testing.T) {
+	uploader := NewLocalUploader("/tmp")
+	sourceAsset, err := NewSourceAsset("4A7C6B9A-1C4B-4B77-A0C9-2D0A1D4BE1E5", SourceAssetTypeOrigin)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	url := uploader.Url(sourceAsset, DefaultTemplateJumbo, 0)
+	if url != "local:///4A7C6B9A-1C4B-4B77-A0C9-2D0A1D4BE1E5/jumbo/0" {
+		t.Errorf("Unexpected url: %s", url)
+	}
+
+	url = uploader.Url(sourceAsset, NativeImageWebpTemplateJumbo, 2)
+	if url != "local:///4A7C6B9A-1C4B-4B77-A0C9-2D0A1D4BE1E5/jumbo/2.webp" {
+		t.Errorf("Unexpected url: %s", url)
+	}
+
+	url = uploader.Url(sourceAsset, NativeImageSquareTemplate256, 0)
+	if url != "local:///4A7C6B9A-1C4B-4B77-A0C9-2D0A1D4BE1E5/"+NativeImageSquareTemplate256.Id+"/0" {
+		t.Errorf("Unexpected url: %s", url)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	expected := map[string]string{
+		"/tmp/a-b.jpg":  "image/jpeg",
+		"/tmp/a-b.PNG":  "image/png",
+		"/tmp/a-b.webp": "image/webp",
+		"/tmp/a-b.avif": "image/avif",
+		"/tmp/a-b.vtt":  "text/vtt",
+		"/tmp/a-b.txt":  "text/plain; charset=utf-8",
+		"/tmp/a-b":      "application/octet-stream",
+	}
+	for path, contentType := range expected {
+		if ContentType(path) != contentType {
+			t.Errorf("Unexpected content type for %s: %s", path, ContentType(path))
+		}
+	}
+}
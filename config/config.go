@@ -13,6 +13,22 @@ type appConfigError struct {
 	message string
 }
 
+// RenderAgentConfig contains the keys shared by every render agent configuration section.
+type RenderAgentConfig struct {
+	Enabled            bool     `json:"enabled"`
+	Count              int      `json:"count"`
+	BasePath           string   `json:"basePath"`
+	SupportedFileTypes []string `json:"supportedFileTypes"`
+	// Timeout is the number of seconds an external process run by the render agent may take before it is killed.
+	Timeout int `json:"timeout"`
+	// MaxMemory is the number of megabytes of address space available to each external process run by the render agent.
+	MaxMemory int `json:"maxMemory"`
+	// MaxCpuTime is the number of seconds of cpu time available to each external process run by the render agent.
+	MaxCpuTime int `json:"maxCpuTime"`
+	// Raw is the unparsed configuration section, allowing render agents to read their own keys.
+	Raw json.RawMessage `json:"-"`
+}
+
 type AppConfig struct {
 	Source string `json:"-"`
 
@@ -38,28 +54,6 @@ type AppConfig struct {
 		MysqlDatabase     string   `json:"mysqlDatabase"`
 	} `json:"storage"`
 
-	ImageMagickRenderAgent struct {
-		Enabled            bool     `json:"enabled"`
-		Count              int      `json:"count"`
-		SupportedFileTypes []string `json:"supportedFileTypes"`
-	} `json:"imageMagickRenderAgent"`
-
-	DocumentRenderAgent struct {
-		Enabled            bool     `json:"enabled"`
-		Count              int      `json:"count"`
-		BasePath           string   `json:"basePath"`
-		SupportedFileTypes []string `json:"supportedFileTypes"`
-	} `json:"documentRenderAgent"`
-
-	VideoRenderAgent struct {
-		Enabled                 bool     `json:"enabled"`
-		Count                   int      `json:"count"`
-		ZencoderKey             string   `json:"zencoderKey"`
-		ZencoderS3Bucket        string   `json:"zencoderS3Bucket"`
-		ZencoderNotificationUrl string   `json:"zencoderNotificationUrl"`
-		SupportedFileTypes      []string `json:"supportedFileTypes"`
-	} `json:"videoRenderAgent"`
-
 	SimpleApi struct {
 		Enabled     bool   `json:"enabled"`
 		EdgeBaseUrl string `json:"edgeBaseUrl"`
@@ -67,7 +61,9 @@ type AppConfig struct {
 	} `json:"simpleApi"`
 
 	AssetApi struct {
-		Enabled bool `json:"enabled"`
+		Enabled           bool `json:"enabled"`
+		SyncRenderTimeout int  `json:"syncRenderTimeout"`
+		RetryAfter        int  `json:"retryAfter"`
 	} `json:"assetApi"`
 
 	Uploader struct {
@@ -83,6 +79,16 @@ type AppConfig struct {
 		UrlCompatMode bool     `json:"urlCompatMode"`
 	} `json:"s3"`
 
+	Pages struct {
+		EagerPages int            `json:"eagerPages"`
+		MaxPages   map[string]int `json:"maxPages"`
+	} `json:"pages"`
+
+	FileTypes struct {
+		Detect           bool `json:"detect"`
+		RejectMismatches bool `json:"rejectMismatches"`
+	} `json:"fileTypes"`
+
 	Downloader struct {
 		BasePath    string   `json:"basePath"`
 		TramEnabled bool     `json:"tramEnabled"`
@@ -112,6 +118,32 @@ func NewAppConfig(data []byte) (*AppConfig, error) {
 	return &appConfig, nil
 }
 
+// RenderAgentSection returns the render agent configuration section with the given name. When the section is not present, a disabled configuration is returned.
+func (appConfig *AppConfig) RenderAgentSection(section string) (*RenderAgentConfig, error) {
+	var sections map[string]json.RawMessage
+	err := json.Unmarshal([]byte(appConfig.Source), &sections)
+	if err != nil {
+		return nil, err
+	}
+	renderAgentConfig := new(RenderAgentConfig)
+	raw, hasSection := sections[section]
+	if !hasSection {
+		renderAgentConfig.Raw = json.RawMessage("{}")
+		return renderAgentConfig, nil
+	}
+	err = json.Unmarshal(raw, renderAgentConfig)
+	if err != nil {
+		return nil, err
+	}
+	renderAgentConfig.Raw = raw
+	return renderAgentConfig, nil
+}
+
+// Decode unmarshals the raw render agent configuration section into the given value.
+func (renderAgentConfig *RenderAgentConfig) Decode(value interface{}) error {
+	return json.Unmarshal(renderAgentConfig.Raw, value)
+}
+
 func (err appConfigError) Error() string {
 	return err.message
 }
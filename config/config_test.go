@@ -77,11 +77,25 @@ func TestBasicConfig(t *testing.T) {
 		t.Error("appConfig.Storage().CassandraNodes()", cassandraNodes)
 	}
 
-	if appConfig.ImageMagickRenderAgent.Enabled != true {
-		t.Error("Invalid default for appConfig.ImageMagickRenderAgent().Enabled()", appConfig.ImageMagickRenderAgent.Enabled)
+	imageMagickRenderAgent, err := appConfig.RenderAgentSection("imageMagickRenderAgent")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if imageMagickRenderAgent.Enabled != true {
+		t.Error("Invalid default for appConfig.RenderAgentSection(imageMagickRenderAgent).Enabled", imageMagickRenderAgent.Enabled)
+	}
+	if len(imageMagickRenderAgent.SupportedFileTypes) != 1 {
+		t.Error("Invalid count for appConfig.RenderAgentSection(imageMagickRenderAgent).SupportedFileTypes", len(imageMagickRenderAgent.SupportedFileTypes))
+	}
+
+	videoRenderAgent, err := appConfig.RenderAgentSection("videoRenderAgent")
+	if err != nil {
+		t.Error(err.Error())
+		return
 	}
-	if len(appConfig.ImageMagickRenderAgent.SupportedFileTypes) != 1 {
-		t.Error("Invalid count for appConfig.ImageMagickRenderAgent().SupportedFileTypes()", len(appConfig.ImageMagickRenderAgent.SupportedFileTypes))
+	if videoRenderAgent.Enabled != false {
+		t.Error("Invalid default for appConfig.RenderAgentSection(videoRenderAgent).Enabled", videoRenderAgent.Enabled)
 	}
 
 	if appConfig.SimpleApi.Enabled != true {
@@ -40,6 +40,9 @@ func buildDefaultConfig(basePathFunc basePath) []byte {
    "documentRenderAgent":{
       "enabled":true,
       "count":16,
+      "timeout":120,
+      "maxConversions":100,
+      "healthCheckInterval":30,
       "basePath":"` + basePathFunc("documentRenderAgentTmp") + `",
       "supportedFileTypes":["doc", "docx", "ppt", "pptx"]
    },
@@ -48,10 +51,95 @@ func buildDefaultConfig(basePathFunc basePath) []byte {
       "count":16,
       "supportedFileTypes":["mp4"]
    },
+   "ffmpegRenderAgent":{
+      "enabled":false,
+      "count":4,
+      "timeout":1800,
+      "basePath":"` + basePathFunc("ffmpegRenderAgentTmp") + `",
+      "supportedFileTypes":["mp4", "mov", "webm"]
+   },
+   "audioRenderAgent":{
+      "enabled":true,
+      "count":4,
+      "timeout":120,
+      "supportedFileTypes":["mp3", "wav", "ogg", "flac"]
+   },
+   "spreadsheetRenderAgent":{
+      "enabled":true,
+      "count":4,
+      "timeout":120,
+      "basePath":"` + basePathFunc("spreadsheetRenderAgentTmp") + `",
+      "supportedFileTypes":["xls", "xlsx", "ods", "csv"]
+   },
+   "svgRenderAgent":{
+      "enabled":true,
+      "count":4,
+      "maxNodes":10000,
+      "renderTimeout":10,
+      "supportedFileTypes":["svg"]
+   },
+   "archiveRenderAgent":{
+      "enabled":true,
+      "count":4,
+      "maxEntries":1000,
+      "maxSize":1024,
+      "maxThumbnailSize":20,
+      "maxCompressionRatio":100,
+      "thumbnails":4,
+      "supportedFileTypes":["zip", "tar", "tgz"]
+   },
+   "emailRenderAgent":{
+      "enabled":true,
+      "count":4,
+      "timeout":120,
+      "basePath":"` + basePathFunc("emailRenderAgentTmp") + `",
+      "linesPerPage":60,
+      "maxPages":10,
+      "maxAttachments":20,
+      "maxAttachmentSize":25,
+      "maxAttachmentDepth":3,
+      "supportedFileTypes":["eml", "msg"]
+   },
+   "documentTextRenderAgent":{
+      "enabled":true,
+      "count":4,
+      "timeout":60,
+      "supportedFileTypes":["pdf"]
+   },
+   "ocrRenderAgent":{
+      "enabled":false,
+      "count":2,
+      "timeout":300,
+      "maxMemory":1024,
+      "minTextCharacters":20,
+      "supportedFileTypes":["pdf"]
+   },
+   "textRenderAgent":{
+      "enabled":true,
+      "count":8,
+      "linesPerPage":60,
+      "maxPages":10,
+      "supportedFileTypes":["txt", "md", "json", "xml", "yaml", "yml", "go", "py", "js", "java", "c", "h", "cpp", "rb", "sh", "sql", "html", "css"]
+   },
+   "nativeImageRenderAgent":{
+      "enabled":true,
+      "count":16,
+      "supportedFileTypes":["jpg", "jpeg", "png", "gif", "bmp", "tiff", "webp"]
+   },
    "imageMagickRenderAgent":{
       "enabled":true,
       "count":16,
-      "supportedFileTypes":["jpg", "jpeg", "png", "gif", "pdf"]
+      "timeout":60,
+      "maxMemory":2048,
+      "resourceLimits":{
+         "memory":"256MiB",
+         "map":"512MiB",
+         "disk":"1GiB",
+         "area":"128MP",
+         "width":"16KP",
+         "height":"16KP"
+      },
+      "supportedFileTypes":["pdf"]
    },
    "simpleApi":{
       "enabled":true,
@@ -59,11 +147,28 @@ func buildDefaultConfig(basePathFunc basePath) []byte {
       "edgeBaseUrl":"http://localhost:8080"
    },
    "assetApi":{
-      "enabled":true
+      "enabled":true,
+      "syncRenderTimeout":10,
+      "retryAfter":5
    },
    "uploader":{
       "engine":"local"
    },
+   "pages":{
+      "eagerPages":10,
+      "maxPages":{
+         "pdf":500,
+         "doc":500,
+         "docx":500,
+         "ppt":200,
+         "pptx":200,
+         "txt":200
+      }
+   },
+   "fileTypes":{
+      "detect":true,
+      "rejectMismatches":false
+   },
    "downloader":{
       "basePath":"` + basePathFunc("cache") + `",
       "tramEnabled": false
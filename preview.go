@@ -17,6 +17,7 @@ Usage: preview [--help --version --config=<file>]
        preview render [--verbose... --verify] <host> <file>...
        preview renderV2 [--verbose...] <host> (--template <templateId>)... <file>...
        preview verify [--verbose... --config=<file> --timeout=<timeout>] <host> <filepath>
+       preview rasterizeSvg <width> <height> <source> <destination>
 
 Options:
   --help           Show this screen.
@@ -45,6 +46,10 @@ Options:
 		{
 			command = cli.NewVerifyCommand(arguments)
 		}
+	case "rasterizeSvg":
+		{
+			command = cli.NewRasterizeSvgCommand(arguments)
+		}
 	}
 	command.Execute()
 }
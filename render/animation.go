@@ -0,0 +1,272 @@
+package render
+
+import (
+	"bufio"
+	"errors"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"image"
+	"image/gif"
+	"io"
+	"os"
+	"strconv"
+)
+
+// animationMaxPixels is the largest canvas, in pixels, of animated images that are decoded. The first frame of larger animations is rendered instead.
+const animationMaxPixels = 4096 * 4096
+
+// errAnimationLimitExceeded is returned when an animated image exceeds the limits of the template. The first frame is rendered instead.
+var errAnimationLimitExceeded = errors.New("animation limit exceeded")
+
+// errMalformedGif is returned when the blocks of a gif image cannot be read.
+var errMalformedGif = errors.New("malformed gif")
+
+// animationLimits contains the limits of animated images created for a template. A limit of zero is unbounded.
+type animationLimits struct {
+	maxFrames   int
+	maxDuration int
+	maxFileSize int64
+}
+
+// newAnimationLimits returns the limits of a template that creates animated images, or nil when the template does not create animated images.
+func newAnimationLimits(template *common.Template) (*animationLimits, error) {
+	animated, err := common.GetFirstAttribute(template, common.TemplateAttributeAnimated)
+	if err != nil || animated != "true" {
+		return nil, nil
+	}
+
+	limits := new(animationLimits)
+	limits.maxFrames, err = intTemplateAttribute(template, common.TemplateAttributeMaxFrames)
+	if err != nil {
+		return nil, err
+	}
+	limits.maxDuration, err = intTemplateAttribute(template, common.TemplateAttributeMaxDuration)
+	if err != nil {
+		return nil, err
+	}
+	maxFileSize, err := intTemplateAttribute(template, common.TemplateAttributeMaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	limits.maxFileSize = int64(maxFileSize)
+	return limits, nil
+}
+
+// animate resizes every frame of an animated gif and encodes the frames to the destination as a gif or animated webp image. It returns the bounds, frame count and duration in milliseconds of the animation. When the source has a single frame or the animation exceeds the limits, errAnimationLimitExceeded is returned. The limits are checked before the frames are decoded. The gif2webp command is run within the process limits.
+func animate(processLimits *processLimits, source, destination, output string, fit *imageFit, limits *animationLimits) (image.Rectangle, int, int, error) {
+	reader, err := os.Open(source)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	defer reader.Close()
+
+	config, err := gif.DecodeConfig(reader)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	_, err = reader.Seek(0, 0)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	frameCount, duration, err := gifFrames(reader)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	if config.Width*config.Height > animationMaxPixels || frameCount < 2 || (limits.maxFrames > 0 && frameCount > limits.maxFrames) || (limits.maxDuration > 0 && duration > limits.maxDuration) {
+		return image.Rectangle{}, frameCount, duration, errAnimationLimitExceeded
+	}
+
+	_, err = reader.Seek(0, 0)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	animation, err := gif.DecodeAll(reader)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+
+	resized := resizeAnimation(animation, fit)
+
+	gifDestination := destination
+	if output == "webp" {
+		gifDestination = destination + ".gif"
+		defer os.Remove(gifDestination)
+	}
+
+	writer, err := os.Create(gifDestination)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	err = gif.EncodeAll(writer, resized)
+	writer.Close()
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+
+	if output == "webp" {
+		err = runLimitedCommand(processLimits, "gif2webp", "-quiet", "-q", "80", "-mixed", gifDestination, "-o", destination)
+		if err != nil {
+			return image.Rectangle{}, 0, 0, err
+		}
+	}
+
+	fileSize, err := util.FileSize(destination)
+	if err != nil {
+		return image.Rectangle{}, 0, 0, err
+	}
+	if limits.maxFileSize > 0 && fileSize > limits.maxFileSize {
+		return image.Rectangle{}, frameCount, duration, errAnimationLimitExceeded
+	}
+
+	return resized.Image[0].Bounds(), frameCount, duration, nil
+}
+
+// gifFrames reads the blocks of a gif image without decoding its frames and returns the number of frames and the duration of the animation in milliseconds.
+func gifFrames(source io.Reader) (int, int, error) {
+	reader := bufio.NewReader(source)
+	header := make([]byte, 13)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return 0, 0, err
+	}
+	if string(header[:3]) != "GIF" {
+		return 0, 0, errMalformedGif
+	}
+	if header[10]&0x80 != 0 {
+		err = skipBytes(reader, 3*(1<<(header[10]&0x07+1)))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	frameCount, duration := 0, 0
+	for {
+		introducer, err := reader.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		switch introducer {
+		case 0x21:
+			label, err := reader.ReadByte()
+			if err != nil {
+				return 0, 0, err
+			}
+			if label == 0xF9 {
+				control := make([]byte, 5)
+				_, err = io.ReadFull(reader, control)
+				if err != nil {
+					return 0, 0, err
+				}
+				duration += (int(control[2]) | int(control[3])<<8) * 10
+			}
+			err = skipSubBlocks(reader)
+			if err != nil {
+				return 0, 0, err
+			}
+		case 0x2C:
+			descriptor := make([]byte, 9)
+			_, err = io.ReadFull(reader, descriptor)
+			if err != nil {
+				return 0, 0, err
+			}
+			if descriptor[8]&0x80 != 0 {
+				err = skipBytes(reader, 3*(1<<(descriptor[8]&0x07+1)))
+				if err != nil {
+					return 0, 0, err
+				}
+			}
+			// The minimum code size of the image data precedes its sub-blocks.
+			err = skipBytes(reader, 1)
+			if err != nil {
+				return 0, 0, err
+			}
+			err = skipSubBlocks(reader)
+			if err != nil {
+				return 0, 0, err
+			}
+			frameCount++
+		case 0x3B:
+			return frameCount, duration, nil
+		default:
+			return 0, 0, errMalformedGif
+		}
+	}
+}
+
+func skipBytes(reader *bufio.Reader, count int) error {
+	_, err := reader.Discard(count)
+	return err
+}
+
+// skipSubBlocks skips data sub-blocks up to and including the block terminator.
+func skipSubBlocks(reader *bufio.Reader) error {
+	for {
+		size, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		err = skipBytes(reader, int(size))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// resizeAnimation composes each frame of an animation onto the frames before it, according to the disposal method of the frames, and resizes the composed frames.
+func resizeAnimation(animation *gif.GIF, fit *imageFit) *gif.GIF {
+	canvasBounds := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+	if canvasBounds.Empty() {
+		canvasBounds = animation.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(canvasBounds)
+
+	resized := new(gif.GIF)
+	resized.LoopCount = animation.LoopCount
+	resized.Image = make([]*image.Paletted, 0, len(animation.Image))
+	resized.Delay = make([]int, 0, len(animation.Image))
+	resized.Disposal = make([]byte, 0, len(animation.Image))
+
+	for index, frame := range animation.Image {
+		disposal := byte(0)
+		if index < len(animation.Disposal) {
+			disposal = animation.Disposal[index]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvasBounds)
+			draw.Draw(previous, canvasBounds, canvas, canvasBounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		fitted := fit.apply(canvas)
+		paletted := image.NewPaletted(fitted.Bounds(), frame.Palette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), fitted, fitted.Bounds().Min)
+
+		resized.Image = append(resized.Image, paletted)
+		resized.Delay = append(resized.Delay, animation.Delay[index])
+		resized.Disposal = append(resized.Disposal, gif.DisposalNone)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			draw.Draw(canvas, canvasBounds, previous, canvasBounds.Min, draw.Src)
+		}
+	}
+
+	return resized
+}
+
+func intTemplateAttribute(template *common.Template, key string) (int, error) {
+	rawValue, err := common.GetFirstAttribute(template, key)
+	if err != nil {
+		return 0, nil
+	}
+	return strconv.Atoi(rawValue)
+}
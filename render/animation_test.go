@@ -0,0 +1,121 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestAnimation(t *testing.T, path string, frames int) {
+	animation := new(gif.GIF)
+	for index := 0; index < frames; index++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 200, 100), palette.Plan9)
+		for x := 0; x < 200; x++ {
+			frame.Set(x, index*10, color.White)
+		}
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 50)
+	}
+	writer, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	err = gif.EncodeAll(writer, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGifFrames(t *testing.T) {
+	directory, err := ioutil.TempDir("", "animation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	source := filepath.Join(directory, "source.gif")
+	writeTestAnimation(t, source, 3)
+	reader, err := os.Open(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	frameCount, duration, err := gifFrames(reader)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if frameCount != 3 || duration != 1500 {
+		t.Errorf("Unexpected frame count or duration: %d %d", frameCount, duration)
+	}
+
+	_, _, err = gifFrames(strings.NewReader("GIF89a"))
+	if err == nil {
+		t.Error("Expected an error for a truncated gif.")
+	}
+}
+
+func TestAnimate(t *testing.T) {
+	directory, err := ioutil.TempDir("", "animation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	source := filepath.Join(directory, "source.gif")
+	destination := filepath.Join(directory, "destination.gif")
+	writeTestAnimation(t, source, 3)
+
+	fit, err := newImageFit(newFitTemplate(common.TemplateFitContain, "100", "100"), "gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds, frameCount, duration, err := animate(nil, source, destination, "gif", fit, &animationLimits{maxFrames: 10})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if frameCount != 3 || duration != 1500 {
+		t.Errorf("Unexpected frame count or duration: %d %d", frameCount, duration)
+	}
+	if bounds.Dx() != 100 || bounds.Dy() != 50 {
+		t.Errorf("Unexpected bounds: %s", bounds)
+	}
+
+	reader, err := os.Open(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	animation, err := gif.DecodeAll(reader)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(animation.Image) != 3 {
+		t.Errorf("Unexpected number of frames: %d", len(animation.Image))
+	}
+
+	_, _, _, err = animate(nil, source, destination, "gif", fit, &animationLimits{maxFrames: 2})
+	if err != errAnimationLimitExceeded {
+		t.Errorf("Expected the frame limit to be exceeded: %s", err)
+	}
+	_, _, _, err = animate(nil, source, destination, "gif", fit, &animationLimits{maxDuration: 1000})
+	if err != errAnimationLimitExceeded {
+		t.Errorf("Expected the duration limit to be exceeded: %s", err)
+	}
+	_, _, _, err = animate(nil, source, destination, "gif", fit, &animationLimits{maxFileSize: 10})
+	if err != errAnimationLimitExceeded {
+		t.Errorf("Expected the file size limit to be exceeded: %s", err)
+	}
+}
@@ -0,0 +1,606 @@
+package render
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultArchiveMaxEntries          = 1000
+	defaultArchiveMaxSize             = 1024
+	defaultArchiveMaxThumbnailSize    = 20
+	defaultArchiveMaxCompressionRatio = 100
+	defaultArchiveThumbnails          = 4
+	// archiveMaxThumbnailPixels is the largest number of pixels an image in an archive can have to be drawn as a thumbnail.
+	archiveMaxThumbnailPixels = 25000000
+	// archiveThumbnailCell is the size, in pixels, of each cell of the thumbnail grid before the preview is resized to the template.
+	archiveThumbnailCell   = 256
+	archiveThumbnailMargin = 8
+	// archiveTreeLines is the number of lines of the file tree drawn when an archive has no images to preview.
+	archiveTreeLines = 40
+)
+
+// errArchiveTooLarge is returned when the entries of an archive are larger than the configured maximum size.
+var errArchiveTooLarge = errors.New("archive is too large")
+
+// archiveDirectoryColour is the colour directories are drawn with in file trees.
+var archiveDirectoryColour = color.RGBA{0x1f, 0x5f, 0xbf, 0xff}
+
+// archiveRenderAgent lists the entries of zip and tar archives without extracting them to disk. Previews are a grid of thumbnails of the first images in the archive or, when there are none, a tree of the archive's files. The listing is stored as a generated asset of its own so that it can be served by the archive API.
+type archiveRenderAgent struct {
+	baseRenderAgent
+	limits        archiveLimits
+	processLimits *processLimits
+}
+
+// archiveLimits contains the limits that archives are read with. Sizes are in bytes.
+type archiveLimits struct {
+	maxEntries          int
+	maxSize             int64
+	maxThumbnailSize    int64
+	maxCompressionRatio int64
+	thumbnails          int
+}
+
+type archiveRenderAgentFactory struct{}
+
+type archiveRenderAgentConfig struct {
+	MaxEntries          int   `json:"maxEntries"`
+	MaxSize             int64 `json:"maxSize"`
+	MaxThumbnailSize    int64 `json:"maxThumbnailSize"`
+	MaxCompressionRatio int64 `json:"maxCompressionRatio"`
+	Thumbnails          int   `json:"thumbnails"`
+}
+
+func (factory *archiveRenderAgentFactory) Name() string {
+	return common.RenderAgentArchive
+}
+
+func (factory *archiveRenderAgentFactory) ConfigSection() string {
+	return "archiveRenderAgent"
+}
+
+func (factory *archiveRenderAgentFactory) TemplateIds() []string {
+	return append([]string{common.ArchiveListingTemplateId}, common.ArchiveTemplates...)
+}
+
+func (factory *archiveRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var archiveConfig archiveRenderAgentConfig
+	err := context.Config.Decode(&archiveConfig)
+	if err != nil {
+		return nil, err
+	}
+	limits := newArchiveLimits()
+	if archiveConfig.MaxEntries > 0 {
+		limits.maxEntries = archiveConfig.MaxEntries
+	}
+	if archiveConfig.MaxSize > 0 {
+		limits.maxSize = archiveConfig.MaxSize * 1024 * 1024
+	}
+	if archiveConfig.MaxThumbnailSize > 0 {
+		limits.maxThumbnailSize = archiveConfig.MaxThumbnailSize * 1024 * 1024
+	}
+	if archiveConfig.MaxCompressionRatio > 0 {
+		limits.maxCompressionRatio = archiveConfig.MaxCompressionRatio
+	}
+	if archiveConfig.Thumbnails > 0 {
+		limits.thumbnails = archiveConfig.Thumbnails
+	}
+	return newArchiveRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, limits, newProcessLimits(context.Config), context.WorkChannel), nil
+}
+
+func newArchiveLimits() archiveLimits {
+	return archiveLimits{
+		maxEntries:          defaultArchiveMaxEntries,
+		maxSize:             defaultArchiveMaxSize * 1024 * 1024,
+		maxThumbnailSize:    defaultArchiveMaxThumbnailSize * 1024 * 1024,
+		maxCompressionRatio: defaultArchiveMaxCompressionRatio,
+		thumbnails:          defaultArchiveThumbnails,
+	}
+}
+
+func newArchiveRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	limits archiveLimits,
+	processLimits *processLimits,
+	workChannel RenderAgentWorkChannel) RenderAgent {
+
+	renderAgent := new(archiveRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentArchive, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.limits = limits
+	renderAgent.processLimits = processLimits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *archiveRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	if template.Id == common.ArchiveListingTemplateId {
+		renderAgent.renderListing(generatedAsset, sourceAsset, statusCallback)
+		return
+	}
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	listing, thumbnails, err := readArchive(sourceFile.Path(), renderAgent.limits)
+	if err != nil {
+		log.Println("error reading archive", err)
+		statusCallback <- generatedAssetUpdate{archiveError(err), nil}
+		return
+	}
+
+	destination := sourceFile.Path() + "-" + template.Id + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	renderAgent.metrics.ConvertTime.Time(func() {
+		var preview image.Image
+		if len(thumbnails) > 0 {
+			preview = drawArchiveThumbnails(thumbnails)
+		} else {
+			preview, err = drawArchiveTree(listing)
+			if err != nil {
+				return
+			}
+		}
+		resized := fit.apply(preview)
+		bounds = resized.Bounds()
+		err = encodeImage(renderAgent.processLimits.forTemplate(template), resized, destination, output)
+	})
+	if err != nil {
+		log.Println("error drawing archive preview", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+	}
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// renderListing stores the listing of an archive as JSON. No thumbnails are decoded for the listing.
+func (renderAgent *archiveRenderAgent) renderListing(generatedAsset *common.GeneratedAsset, sourceAsset *common.SourceAsset, statusCallback chan generatedAssetUpdate) {
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	limits := renderAgent.limits
+	limits.thumbnails = 0
+	var listing *common.ArchiveListing
+	renderAgent.metrics.ConvertTime.Time(func() {
+		listing, _, err = readArchive(sourceFile.Path(), limits)
+	})
+	if err != nil {
+		log.Println("error reading archive", err)
+		statusCallback <- generatedAssetUpdate{archiveError(err), nil}
+		return
+	}
+
+	payload, err := json.Marshal(listing)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+	destination := sourceFile.Path() + "-" + generatedAsset.TemplateId + ".json"
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+	err = ioutil.WriteFile(destination, payload, 0644)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("fileSize", []string{strconv.Itoa(len(payload))}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// archiveError returns the failed status of a generated asset for an error reading an archive.
+func archiveError(err error) string {
+	if err == errArchiveTooLarge {
+		return common.NewGeneratedAssetError(common.ErrorArchiveTooLarge)
+	}
+	return common.NewGeneratedAssetError(common.ErrorCouldNotReadArchive)
+}
+
+// readArchive lists the entries of a zip, tar or gzip compressed tar archive and decodes the first images in it as thumbnails. Zip archives whose entries are larger than the maximum size are refused before anything is decompressed. Tar archives are read as a stream and are refused once more than the maximum size has been read from them.
+func readArchive(source string, limits archiveLimits) (*common.ArchiveListing, []image.Image, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header, _ := reader.Peek(4)
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return readZipArchive(source, limits)
+	case bytes.HasPrefix(header, []byte{0x1F, 0x8B}):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gzipReader.Close()
+		return readTarArchive(gzipReader, "tgz", limits)
+	}
+	return readTarArchive(reader, "tar", limits)
+}
+
+func readZipArchive(source string, limits archiveLimits) (*common.ArchiveListing, []image.Image, error) {
+	archive, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+
+	var declaredSize uint64
+	for _, entry := range archive.File {
+		declaredSize += entry.UncompressedSize64
+		if declaredSize > uint64(limits.maxSize) {
+			return nil, nil, errArchiveTooLarge
+		}
+	}
+
+	listing := &common.ArchiveListing{Format: "zip", Entries: make([]common.ArchiveEntry, 0)}
+	thumbnails := make([]image.Image, 0, limits.thumbnails)
+	for _, entry := range archive.File {
+		name, safe := cleanArchivePath(entry.Name)
+		if !safe || entry.Mode()&os.ModeSymlink != 0 {
+			listing.SkippedEntries++
+			continue
+		}
+		if len(listing.Entries) >= limits.maxEntries {
+			listing.Truncated = true
+			break
+		}
+		directory := entry.FileInfo().IsDir()
+		size := int64(entry.UncompressedSize64)
+		listing.Entries = append(listing.Entries, newArchiveEntry(name, size, directory, entry.Modified))
+		listing.TotalSize += size
+
+		if directory || len(thumbnails) >= limits.thumbnails || !isArchiveImage(name) || size > limits.maxThumbnailSize {
+			continue
+		}
+		if entry.CompressedSize64 == 0 || entry.UncompressedSize64/entry.CompressedSize64 > uint64(limits.maxCompressionRatio) {
+			continue
+		}
+		entryReader, err := entry.Open()
+		if err != nil {
+			continue
+		}
+		thumbnail, err := readArchiveThumbnail(entryReader, limits.maxThumbnailSize)
+		entryReader.Close()
+		if err == nil {
+			thumbnails = append(thumbnails, thumbnail)
+		}
+	}
+	return listing, thumbnails, nil
+}
+
+func readTarArchive(reader io.Reader, format string, limits archiveLimits) (*common.ArchiveListing, []image.Image, error) {
+	limitedReader := &archiveSizeReader{reader, limits.maxSize}
+	archive := tar.NewReader(limitedReader)
+
+	listing := &common.ArchiveListing{Format: format, Entries: make([]common.ArchiveEntry, 0)}
+	thumbnails := make([]image.Image, 0, limits.thumbnails)
+	var declaredSize int64
+	for {
+		entry, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if limitedReader.remaining < 0 {
+				return nil, nil, errArchiveTooLarge
+			}
+			return nil, nil, err
+		}
+		declaredSize += entry.Size
+		if declaredSize > limits.maxSize {
+			return nil, nil, errArchiveTooLarge
+		}
+
+		name, safe := cleanArchivePath(entry.Name)
+		directory := entry.Typeflag == tar.TypeDir
+		if !safe || (!directory && entry.Typeflag != tar.TypeReg && entry.Typeflag != tar.TypeRegA) {
+			listing.SkippedEntries++
+			continue
+		}
+		if len(listing.Entries) >= limits.maxEntries {
+			listing.Truncated = true
+			break
+		}
+		listing.Entries = append(listing.Entries, newArchiveEntry(name, entry.Size, directory, entry.ModTime))
+		listing.TotalSize += entry.Size
+
+		if directory || len(thumbnails) >= limits.thumbnails || !isArchiveImage(name) || entry.Size > limits.maxThumbnailSize {
+			continue
+		}
+		thumbnail, err := readArchiveThumbnail(archive, limits.maxThumbnailSize)
+		if err == nil {
+			thumbnails = append(thumbnails, thumbnail)
+		}
+	}
+	return listing, thumbnails, nil
+}
+
+// archiveSizeReader returns an error once more than a number of bytes have been read from the underlying reader.
+type archiveSizeReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (reader *archiveSizeReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.remaining -= int64(n)
+	if reader.remaining < 0 {
+		return n, errArchiveTooLarge
+	}
+	return n, err
+}
+
+func newArchiveEntry(name string, size int64, directory bool, modified time.Time) common.ArchiveEntry {
+	entry := common.ArchiveEntry{Path: name, Size: size, Directory: directory}
+	if directory {
+		entry.Size = 0
+	}
+	if !modified.IsZero() {
+		entry.Modified = modified.UTC().Format(time.RFC3339)
+	}
+	return entry
+}
+
+// cleanArchivePath returns the cleaned path of an archive entry and whether it is safe to show. Absolute paths, paths with drive letters or null characters and paths that leave the archive are not safe.
+func cleanArchivePath(name string) (string, bool) {
+	name = strings.Replace(name, "\\", "/", -1)
+	if name == "" || strings.Contains(name, "\x00") || strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	if len(name) >= 2 && name[1] == ':' {
+		return "", false
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+	return cleaned, true
+}
+
+func isArchiveImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp":
+		return true
+	}
+	return false
+}
+
+// readArchiveThumbnail decodes an image from an archive entry and shrinks it to the size of a thumbnail. Images larger than the maximum size, whether or not their header says so, and images with too many pixels are not decoded.
+func readArchiveThumbnail(reader io.Reader, maxSize int64) (image.Image, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errArchiveTooLarge
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > archiveMaxThumbnailPixels {
+		return nil, fmt.Errorf("image is %dx%d", config.Width, config.Height)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return resizeImage(decoded, archiveThumbnailCell, archiveThumbnailCell, color.White), nil
+}
+
+// drawArchiveThumbnails draws the thumbnails centered in the cells of a square grid on a white background.
+func drawArchiveThumbnails(thumbnails []image.Image) image.Image {
+	columns := int(math.Ceil(math.Sqrt(float64(len(thumbnails)))))
+	rows := (len(thumbnails) + columns - 1) / columns
+	cell := archiveThumbnailCell + archiveThumbnailMargin
+	canvas := image.NewRGBA(image.Rect(0, 0, columns*cell+archiveThumbnailMargin, rows*cell+archiveThumbnailMargin))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.ZP, draw.Src)
+
+	for index, thumbnail := range thumbnails {
+		bounds := thumbnail.Bounds()
+		x := archiveThumbnailMargin + (index%columns)*cell + (archiveThumbnailCell-bounds.Dx())/2
+		y := archiveThumbnailMargin + (index/columns)*cell + (archiveThumbnailCell-bounds.Dy())/2
+		draw.Draw(canvas, image.Rect(x, y, x+bounds.Dx(), y+bounds.Dy()), thumbnail, bounds.Min, draw.Over)
+	}
+	return canvas
+}
+
+// drawArchiveTree draws the entries of the listing as an indented tree, with directories that have no entries of their own in the archive added above their contents.
+func drawArchiveTree(listing *common.ArchiveListing) (image.Image, error) {
+	lines := archiveTreeLinesFor(listing)
+	runs := make([][]textRun, 0, len(lines))
+	for _, line := range lines {
+		if runes := []rune(line.text); len(runes) > textColumns {
+			line.text = string(runes[:textColumns])
+		}
+		runs = append(runs, []textRun{line})
+	}
+	return drawTextPage(runs, archiveTreeLines)
+}
+
+func archiveTreeLinesFor(listing *common.ArchiveListing) []textRun {
+	entries := make([]common.ArchiveEntry, len(listing.Entries))
+	copy(entries, listing.Entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	lines := make([]textRun, 0, archiveTreeLines)
+	listed := make(map[string]bool)
+	remaining := len(entries)
+	for _, entry := range entries {
+		parts := strings.Split(entry.Path, "/")
+		for depth := 1; depth < len(parts); depth++ {
+			directory := strings.Join(parts[:depth], "/")
+			if !listed[directory] {
+				listed[directory] = true
+				lines = append(lines, textRun{strings.Repeat("  ", depth-1) + parts[depth-1] + "/", archiveDirectoryColour})
+			}
+		}
+		if entry.Directory {
+			if !listed[entry.Path] {
+				listed[entry.Path] = true
+				lines = append(lines, textRun{strings.Repeat("  ", len(parts)-1) + parts[len(parts)-1] + "/", archiveDirectoryColour})
+			}
+		} else {
+			lines = append(lines, textRun{strings.Repeat("  ", len(parts)-1) + parts[len(parts)-1] + "  " + formatArchiveSize(entry.Size), color.Black})
+		}
+		remaining--
+		if len(lines) >= archiveTreeLines-1 {
+			break
+		}
+	}
+	switch {
+	case listing.Truncated:
+		lines = append(lines, textRun{"… and more", color.Gray{0x80}})
+	case remaining > 0:
+		lines = append(lines, textRun{fmt.Sprintf("… and %d more", remaining), color.Gray{0x80}})
+	}
+	return lines
+}
+
+// formatArchiveSize returns a size in bytes in the largest unit that keeps it at least one.
+func formatArchiveSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,244 @@
+package render
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTarFile(path string, headers []*tar.Header, compress bool) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var archive *tar.Writer
+	if compress {
+		gzipWriter := gzip.NewWriter(file)
+		defer gzipWriter.Close()
+		archive = tar.NewWriter(gzipWriter)
+	} else {
+		archive = tar.NewWriter(file)
+	}
+	for _, header := range headers {
+		err = archive.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			_, err = archive.Write(bytes.Repeat([]byte("a"), int(header.Size)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
+
+func testPng() string {
+	canvas := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	canvas.Set(0, 0, color.Black)
+	var buffer bytes.Buffer
+	png.Encode(&buffer, canvas)
+	return buffer.String()
+}
+
+func TestCleanArchivePath(t *testing.T) {
+	safe := map[string]string{
+		"a.txt":          "a.txt",
+		"docs/":          "docs",
+		"docs/./b.txt":   "docs/b.txt",
+		"docs\\c.txt":    "docs/c.txt",
+		"docs/../d.txt":  "d.txt",
+		"docs//e/f.txt":  "docs/e/f.txt",
+		"docs/g..h.txt":  "docs/g..h.txt",
+		"..docs/i.txt":   "..docs/i.txt",
+		"docs/j.txt/../": "docs",
+	}
+	for name, expected := range safe {
+		cleaned, ok := cleanArchivePath(name)
+		if !ok || cleaned != expected {
+			t.Errorf("Unexpected path for %s: %s %v", name, cleaned, ok)
+		}
+	}
+
+	for _, name := range []string{"", "/etc/passwd", "../a.txt", "docs/../../a.txt", "..\\a.txt", "C:\\a.txt", "c:a.txt", "a\x00.txt", ".", "./"} {
+		if _, ok := cleanArchivePath(name); ok {
+			t.Errorf("Expected %q to be unsafe", name)
+		}
+	}
+}
+
+func TestReadZipArchive(t *testing.T) {
+	directory, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	source := filepath.Join(directory, "test.zip")
+	err = writeZipFile(source, map[string]string{
+		"docs/readme.txt": "hello",
+		"images/a.png":    testPng(),
+		"images/b.png":    "not an image",
+		"../escape.txt":   "outside",
+		"/etc/passwd":     "root",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	listing, thumbnails, err := readArchive(source, newArchiveLimits())
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if listing.Format != "zip" || len(listing.Entries) != 3 || listing.SkippedEntries != 2 || listing.Truncated {
+		t.Errorf("Unexpected listing: %+v", listing)
+	}
+	if listing.TotalSize != int64(len("hello")+len(testPng())+len("not an image")) {
+		t.Errorf("Unexpected total size: %d", listing.TotalSize)
+	}
+	if len(thumbnails) != 1 || thumbnails[0].Bounds().Dx() != 20 {
+		t.Errorf("Unexpected thumbnails: %d", len(thumbnails))
+	}
+
+	limits := newArchiveLimits()
+	limits.maxEntries = 2
+	listing, _, err = readArchive(source, limits)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(listing.Entries) != 2 || !listing.Truncated {
+		t.Errorf("Expected a truncated listing: %+v", listing)
+	}
+
+	limits = newArchiveLimits()
+	limits.maxSize = 10
+	_, _, err = readArchive(source, limits)
+	if err != errArchiveTooLarge {
+		t.Errorf("Expected the archive to be too large: %v", err)
+	}
+}
+
+func TestReadZipArchiveCompressionRatio(t *testing.T) {
+	directory, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	source := filepath.Join(directory, "bomb.zip")
+	err = writeZipFile(source, map[string]string{"bomb.png": testPng() + strings.Repeat("\x00", 1024*1024)})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	listing, thumbnails, err := readArchive(source, newArchiveLimits())
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(listing.Entries) != 1 || len(thumbnails) != 0 {
+		t.Errorf("Expected the highly compressed entry to be listed without a thumbnail: %d %d", len(listing.Entries), len(thumbnails))
+	}
+}
+
+func TestReadTarArchive(t *testing.T) {
+	directory, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	modified := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	headers := []*tar.Header{
+		&tar.Header{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modified},
+		&tar.Header{Name: "docs/readme.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5, ModTime: modified},
+		&tar.Header{Name: "docs/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777, ModTime: modified},
+		&tar.Header{Name: "../../escape.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 3, ModTime: modified},
+		&tar.Header{Name: "large.bin", Typeflag: tar.TypeReg, Mode: 0644, Size: 4096, ModTime: modified},
+	}
+
+	for _, compress := range []bool{false, true} {
+		source := filepath.Join(directory, "test.tar")
+		format := "tar"
+		if compress {
+			source = filepath.Join(directory, "test.tgz")
+			format = "tgz"
+		}
+		err = writeTarFile(source, headers, compress)
+		if err != nil {
+			t.Errorf("Unexpected error returned: %s", err)
+			return
+		}
+
+		listing, _, err := readArchive(source, newArchiveLimits())
+		if err != nil {
+			t.Errorf("Unexpected error returned: %s", err)
+			return
+		}
+		if listing.Format != format || len(listing.Entries) != 3 || listing.SkippedEntries != 2 || listing.TotalSize != 4101 {
+			t.Errorf("Unexpected listing: %+v", listing)
+		}
+		if !listing.Entries[0].Directory || listing.Entries[0].Path != "docs" || listing.Entries[1].Modified != "2015-03-01T12:00:00Z" {
+			t.Errorf("Unexpected entries: %+v", listing.Entries)
+		}
+
+		limits := newArchiveLimits()
+		limits.maxSize = 1024
+		_, _, err = readArchive(source, limits)
+		if err != errArchiveTooLarge {
+			t.Errorf("Expected the archive to be too large: %v", err)
+		}
+	}
+}
+
+func TestDrawArchivePreview(t *testing.T) {
+	listing, _, err := readTarArchive(bytes.NewReader(nil), "tar", newArchiveLimits())
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	for index := 0; index < 50; index++ {
+		listing.Entries = append(listing.Entries, newArchiveEntry("src/main/file"+strings.Repeat("x", index)+".go", int64(index*1024), false, time.Time{}))
+	}
+	lines := archiveTreeLinesFor(listing)
+	if len(lines) != archiveTreeLines {
+		t.Errorf("Unexpected number of lines: %d", len(lines))
+	}
+	if lines[0].text != "src/" || lines[1].text != "  main/" || lines[len(lines)-1].text != "… and 13 more" {
+		t.Errorf("Unexpected lines: %s %s %s", lines[0].text, lines[1].text, lines[len(lines)-1].text)
+	}
+	tree, err := drawArchiveTree(listing)
+	if err != nil || tree.Bounds().Dx() == 0 {
+		t.Errorf("Unexpected error returned: %s", err)
+	}
+
+	thumbnails := []image.Image{image.NewRGBA(image.Rect(0, 0, 256, 128)), image.NewRGBA(image.Rect(0, 0, 64, 256)), image.NewRGBA(image.Rect(0, 0, 10, 10))}
+	grid := drawArchiveThumbnails(thumbnails)
+	expected := 2*(archiveThumbnailCell+archiveThumbnailMargin) + archiveThumbnailMargin
+	if grid.Bounds().Dx() != expected || grid.Bounds().Dy() != expected {
+		t.Errorf("Unexpected grid size: %v", grid.Bounds())
+	}
+
+	if formatArchiveSize(512) != "512 B" || formatArchiveSize(1536) != "1.5 KB" {
+		t.Errorf("Unexpected sizes: %s %s", formatArchiveSize(512), formatArchiveSize(1536))
+	}
+}
@@ -0,0 +1,490 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"log"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+const (
+	// waveformSampleRate is the sample rate that audio is resampled to before the peaks of a waveform are measured.
+	waveformSampleRate = 2000
+	// audioPeakColumns is the number of peaks measured when audio is decoded. The peaks of each waveform are reduced from them.
+	audioPeakColumns = 4160
+	// audioPeaksCacheSize is the number of source assets whose peaks are kept so that their audio is decoded once for all of their templates.
+	audioPeaksCacheSize = 16
+)
+
+// audioRenderAgent draws waveform images of audio files and extracts their embedded cover art with the local ffmpeg and ffprobe executables.
+type audioRenderAgent struct {
+	baseRenderAgent
+	limits *processLimits
+}
+
+// decodedAudio holds the peaks of the audio of a source asset once it has been decoded. The done channel is closed when decoding is over.
+type decodedAudio struct {
+	peaks []float64
+	err   error
+	done  chan bool
+}
+
+// audioPeaksCache keeps the peaks of recently decoded audio, shared by all of the audio render agents.
+type audioPeaksCache struct {
+	mu      sync.Mutex
+	entries map[string]*decodedAudio
+	order   []string
+}
+
+var decodedAudioPeaks = newAudioPeaksCache()
+
+type audioRenderAgentFactory struct{}
+
+// audioInfo contains the properties of an audio file reported by ffprobe.
+type audioInfo struct {
+	duration    float64
+	sampleRate  int
+	channels    int
+	hasCoverArt bool
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType   string `json:"codec_type"`
+		SampleRate  string `json:"sample_rate"`
+		Channels    int    `json:"channels"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+func (factory *audioRenderAgentFactory) Name() string {
+	return common.RenderAgentAudio
+}
+
+func (factory *audioRenderAgentFactory) ConfigSection() string {
+	return "audioRenderAgent"
+}
+
+func (factory *audioRenderAgentFactory) TemplateIds() []string {
+	return append(append([]string{}, common.AudioWaveformTemplates...), common.AudioCoverArtTemplateId)
+}
+
+func (factory *audioRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	return newAudioRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.WorkChannel, newProcessLimits(context.Config)), nil
+}
+
+func newAudioRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits) RenderAgent {
+
+	renderAgent := new(audioRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentAudio, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *audioRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	limits := renderAgent.limits.forTemplate(template)
+
+	info, err := probeAudio(limits, sourceFile.Path())
+	if err != nil {
+		log.Println("error probing audio", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotDecodeAudio), nil}
+		return
+	}
+	if info.hasCoverArt && !sourceAsset.HasAttribute(common.SourceAssetAttributeAlternativeThumbnail) {
+		attributes := []common.Attribute{common.Attribute{Key: common.SourceAssetAttributeAlternativeThumbnail, Value: []string{common.AudioCoverArtTemplateId}}}
+		err = addSourceAssetAttributes(renderAgent.sasm, sourceAsset, attributes)
+		if err != nil {
+			log.Println("error storing alternative thumbnail", err)
+		}
+	}
+
+	mark, err := newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	destination := sourceFile.Path() + "-" + template.Id + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	renderAgent.metrics.ConvertTime.Time(func() {
+		// Audio files without cover art get a waveform in its place.
+		if generatedAsset.TemplateId == common.AudioCoverArtTemplateId && info.hasCoverArt {
+			bounds, err = renderAgent.coverArt(limits, sourceFile.Path(), destination, output, template, mark)
+			return
+		}
+		bounds, err = renderAgent.waveform(limits, sourceAsset.Id, sourceFile.Path(), destination, output, template, mark)
+	})
+	if err != nil {
+		log.Println("error rendering audio", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotDecodeAudio), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeDuration, []string{strconv.Itoa(int(info.duration * 1000))}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeSampleRate, []string{strconv.Itoa(info.sampleRate)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeChannels, []string{strconv.Itoa(info.channels)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeCoverArt, []string{strconv.FormatBool(info.hasCoverArt)}),
+	}
+
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// waveform draws the peaks of the audio across the template width, stamps the watermark onto it and encodes the image to the destination. The audio of a source asset is decoded once for all of its waveforms.
+func (renderAgent *audioRenderAgent) waveform(limits *processLimits, sourceAssetId, source, destination, output string, template *common.Template, mark *watermark) (image.Rectangle, error) {
+	width, err := intTemplateAttribute(template, common.TemplateAttributeWidth)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	height, err := intTemplateAttribute(template, common.TemplateAttributeHeight)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if width < 1 || height < 1 {
+		return image.Rectangle{}, common.ErrorCouldNotDetermineRenderSize
+	}
+	background, err := templateColor(template, common.TemplateAttributeBackground, color.White)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	foreground, err := templateColor(template, common.TemplateAttributeForeground, color.Black)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	peaks, err := decodedAudioPeaks.peaks(sourceAssetId, func() ([]float64, error) {
+		samples, err := decodeAudio(limits, source)
+		if err != nil {
+			return nil, err
+		}
+		return audioPeaks(samples, audioPeakColumns), nil
+	})
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	waveformImage := mark.apply(drawWaveform(reducePeaks(peaks, width), width, height, foreground, background))
+	return waveformImage.Bounds(), encodeImage(limits, waveformImage, destination, output)
+}
+
+// coverArt extracts the embedded cover art of the audio, resizes it according to the template fit, stamps the watermark onto it and encodes it to the destination.
+func (renderAgent *audioRenderAgent) coverArt(limits *processLimits, source, destination, output string, template *common.Template, mark *watermark) (image.Rectangle, error) {
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	fit.watermark = mark
+
+	extracted := destination + "-cover.png"
+	extractedTemporaryFile := renderAgent.temporaryFileManager.Create(extracted)
+	defer extractedTemporaryFile.Release()
+
+	err = runLimitedCommand(limits, "ffmpeg", "-y", "-i", source, "-map", "0:v:0", "-frames:v", "1", extracted)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	coverArtImage, err := decodeImageFile(extracted)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	resized := fit.apply(coverArtImage)
+	return resized.Bounds(), encodeImage(limits, resized, destination, output)
+}
+
+// probeAudio returns the duration, sample rate, channels and presence of cover art of an audio file.
+func probeAudio(limits *processLimits, source string) (*audioInfo, error) {
+	_, err := exec.LookPath("ffprobe")
+	if err != nil {
+		log.Println("ffprobe command not found")
+		return nil, err
+	}
+
+	cmd := limits.command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_streams", "-show_format", source)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+
+	err = limits.run(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseAudioInfo(buf.Bytes())
+}
+
+// parseAudioInfo reads the properties of the first audio stream from the JSON output of ffprobe. Video streams that are attached pictures are cover art.
+func parseAudioInfo(data []byte) (*audioInfo, error) {
+	var probe ffprobeOutput
+	err := json.Unmarshal(data, &probe)
+	if err != nil {
+		return nil, err
+	}
+
+	info := new(audioInfo)
+	hasAudio := false
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "audio":
+			if !hasAudio {
+				hasAudio = true
+				info.sampleRate, _ = strconv.Atoi(stream.SampleRate)
+				info.channels = stream.Channels
+			}
+		case "video":
+			if stream.Disposition.AttachedPic == 1 {
+				info.hasCoverArt = true
+			}
+		}
+	}
+	if !hasAudio {
+		return nil, common.ErrorCouldNotDecodeAudio
+	}
+	info.duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	return info, nil
+}
+
+// decodeAudio decodes the first audio stream to mono 16 bit samples at the waveform sample rate.
+func decodeAudio(limits *processLimits, source string) ([]int16, error) {
+	_, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		log.Println("ffmpeg command not found")
+		return nil, err
+	}
+
+	cmd := limits.command("ffmpeg", "-v", "error", "-i", source, "-map", "0:a:0", "-ac", "1", "-ar", strconv.Itoa(waveformSampleRate), "-f", "s16le", "-acodec", "pcm_s16le", "-")
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &errBuf
+
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(errBuf.String())
+		return nil, err
+	}
+
+	samples := make([]int16, buf.Len()/2)
+	err = binary.Read(&buf, binary.LittleEndian, samples)
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// audioPeaks divides the samples into the given number of columns and returns the peak amplitude, between 0 and 1, of each column.
+func audioPeaks(samples []int16, columns int) []float64 {
+	peaks := make([]float64, columns)
+	if len(samples) == 0 {
+		return peaks
+	}
+	for column := 0; column < columns; column++ {
+		start := column * len(samples) / columns
+		end := (column + 1) * len(samples) / columns
+		if end == start {
+			end = start + 1
+		}
+		peak := 0
+		for _, sample := range samples[start:end] {
+			amplitude := int(sample)
+			if amplitude < 0 {
+				amplitude = -amplitude
+			}
+			if amplitude > peak {
+				peak = amplitude
+			}
+		}
+		peaks[column] = float64(peak) / 32768
+	}
+	return peaks
+}
+
+// reducePeaks divides the peaks into the given number of columns and returns the largest peak of each column.
+func reducePeaks(peaks []float64, columns int) []float64 {
+	reduced := make([]float64, columns)
+	if len(peaks) == 0 {
+		return reduced
+	}
+	for column := 0; column < columns; column++ {
+		start := column * len(peaks) / columns
+		end := (column + 1) * len(peaks) / columns
+		if end == start {
+			end = start + 1
+		}
+		for _, peak := range peaks[start:end] {
+			if peak > reduced[column] {
+				reduced[column] = peak
+			}
+		}
+	}
+	return reduced
+}
+
+func newAudioPeaksCache() *audioPeaksCache {
+	cache := new(audioPeaksCache)
+	cache.entries = make(map[string]*decodedAudio)
+	return cache
+}
+
+// peaks returns the peaks of the audio of a source asset, calling decode the first time they are needed. Renders of the same source asset that start while it is being decoded wait for it instead of decoding it again. Failures are not cached.
+func (cache *audioPeaksCache) peaks(id string, decode func() ([]float64, error)) ([]float64, error) {
+	cache.mu.Lock()
+	entry, hasEntry := cache.entries[id]
+	if hasEntry {
+		cache.mu.Unlock()
+		<-entry.done
+		return entry.peaks, entry.err
+	}
+	entry = &decodedAudio{done: make(chan bool)}
+	cache.entries[id] = entry
+	cache.order = append(cache.order, id)
+	if len(cache.order) > audioPeaksCacheSize {
+		if cache.entries[cache.order[0]] != entry {
+			delete(cache.entries, cache.order[0])
+		}
+		cache.order = cache.order[1:]
+	}
+	cache.mu.Unlock()
+
+	entry.peaks, entry.err = decode()
+	close(entry.done)
+	if entry.err != nil {
+		cache.mu.Lock()
+		if cache.entries[id] == entry {
+			delete(cache.entries, id)
+		}
+		cache.mu.Unlock()
+	}
+	return entry.peaks, entry.err
+}
+
+// drawWaveform draws a vertical line for each peak, mirrored around the middle of the image. Silent columns are drawn as a single line so that the waveform is always visible.
+func drawWaveform(peaks []float64, width, height int, foreground, background color.Color) image.Image {
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.ZP, draw.Src)
+
+	middle := height / 2
+	fill := image.NewUniform(foreground)
+	for x, peak := range peaks {
+		if x >= width {
+			break
+		}
+		extent := int(peak * float64(middle))
+		draw.Draw(canvas, image.Rect(x, middle-extent, x+1, middle+extent+1), fill, image.ZP, draw.Over)
+	}
+	return canvas
+}
+
+// templateColor returns the colour of a template attribute, or the default colour when the template does not have the attribute.
+func templateColor(template *common.Template, key string, defaultColor color.Color) (color.Color, error) {
+	value, err := common.GetFirstAttribute(template, key)
+	if err != nil {
+		return defaultColor, nil
+	}
+	return parseColor(value)
+}
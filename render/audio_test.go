@@ -0,0 +1,120 @@
+package render
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+)
+
+func TestParseAudioInfo(t *testing.T) {
+	probe := []byte(`{
+		"streams": [
+			{"codec_type": "audio", "sample_rate": "44100", "channels": 2, "disposition": {"attached_pic": 0}},
+			{"codec_type": "video", "disposition": {"attached_pic": 1}}
+		],
+		"format": {"duration": "12.500000"}
+	}`)
+	info, err := parseAudioInfo(probe)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if info.sampleRate != 44100 || info.channels != 2 || info.duration != 12.5 || !info.hasCoverArt {
+		t.Errorf("Unexpected audio info: %+v", info)
+	}
+
+	_, err = parseAudioInfo([]byte(`{"streams": [{"codec_type": "video"}], "format": {}}`))
+	if err == nil {
+		t.Error("Expected an error for a file without an audio stream.")
+	}
+}
+
+func TestAudioPeaks(t *testing.T) {
+	samples := []int16{0, 100, -16384, 50, 0, 0, 32767, -32768}
+	peaks := audioPeaks(samples, 4)
+	expected := []float64{100.0 / 32768, 16384.0 / 32768, 0, 1}
+	for index, peak := range peaks {
+		if peak != expected[index] {
+			t.Errorf("Unexpected peak for column %d: %f", index, peak)
+		}
+	}
+	if len(audioPeaks(nil, 10)) != 10 {
+		t.Error("Expected a peak for every column of silent audio.")
+	}
+}
+
+func TestReducePeaks(t *testing.T) {
+	peaks := reducePeaks([]float64{0.1, 0.5, 0.2, 0, 1, 0.3}, 3)
+	expected := []float64{0.5, 0.2, 1}
+	for index, peak := range peaks {
+		if peak != expected[index] {
+			t.Errorf("Unexpected peak for column %d: %f", index, peak)
+		}
+	}
+	peaks = reducePeaks([]float64{0.25, 0.75}, 4)
+	expected = []float64{0.25, 0.25, 0.75, 0.75}
+	for index, peak := range peaks {
+		if peak != expected[index] {
+			t.Errorf("Unexpected stretched peak for column %d: %f", index, peak)
+		}
+	}
+	if len(reducePeaks(nil, 10)) != 10 {
+		t.Error("Expected a peak for every column of silent audio.")
+	}
+}
+
+func TestAudioPeaksCache(t *testing.T) {
+	cache := newAudioPeaksCache()
+	decodes := 0
+	decode := func() ([]float64, error) {
+		decodes++
+		return []float64{1}, nil
+	}
+	for i := 0; i < 3; i++ {
+		peaks, err := cache.peaks("a", decode)
+		if err != nil || len(peaks) != 1 {
+			t.Errorf("Unexpected peaks: %v %v", peaks, err)
+		}
+	}
+	if decodes != 1 {
+		t.Errorf("Expected the audio to be decoded once: %d", decodes)
+	}
+
+	failures := 0
+	fail := func() ([]float64, error) {
+		failures++
+		return nil, errors.New("could not decode")
+	}
+	cache.peaks("b", fail)
+	cache.peaks("b", fail)
+	if failures != 2 {
+		t.Errorf("Expected failed decodes not to be cached: %d", failures)
+	}
+
+	for i := 0; i < audioPeaksCacheSize; i++ {
+		cache.peaks(string(rune('c'+i)), decode)
+	}
+	cache.peaks("a", decode)
+	if decodes != audioPeaksCacheSize+2 {
+		t.Errorf("Expected the oldest peaks to be evicted: %d", decodes)
+	}
+}
+
+func TestDrawWaveform(t *testing.T) {
+	waveform := drawWaveform([]float64{0, 1}, 2, 11, color.Black, color.White)
+	if waveform.Bounds().Dx() != 2 || waveform.Bounds().Dy() != 11 {
+		t.Errorf("Unexpected bounds: %s", waveform.Bounds())
+	}
+	r, _, _, _ := waveform.At(0, 0).RGBA()
+	if r != 0xffff {
+		t.Errorf("Expected the background above a silent column: %v", waveform.At(0, 0))
+	}
+	r, _, _, _ = waveform.At(0, 5).RGBA()
+	if r != 0 {
+		t.Errorf("Expected the middle line of a silent column: %v", waveform.At(0, 5))
+	}
+	r, _, _, _ = waveform.At(1, 0).RGBA()
+	if r != 0 {
+		t.Errorf("Expected a full column for a peak of 1: %v", waveform.At(1, 0))
+	}
+}
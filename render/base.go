@@ -0,0 +1,207 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"log"
+	"strconv"
+	"time"
+)
+
+// baseRenderAgent holds the storage managers, channels and listeners that every render agent needs along with the dispatch loop, status commits and source asset lookups they share. Render agents embed it and provide their own renderGeneratedAsset function.
+type baseRenderAgent struct {
+	name                 string
+	metrics              *RenderAgentMetrics
+	sasm                 common.SourceAssetStorageManager
+	gasm                 common.GeneratedAssetStorageManager
+	templateManager      common.TemplateManager
+	agentManager         *RenderAgentManager
+	downloader           common.Downloader
+	uploader             common.Uploader
+	workChannel          RenderAgentWorkChannel
+	statusListeners      []RenderStatusChannel
+	temporaryFileManager common.TemporaryFileManager
+	stop                 chan (chan bool)
+}
+
+func newBaseRenderAgent(
+	name string,
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	workChannel RenderAgentWorkChannel) baseRenderAgent {
+
+	return baseRenderAgent{
+		name:                 name,
+		metrics:              metrics,
+		agentManager:         agentManager,
+		sasm:                 sasm,
+		gasm:                 gasm,
+		templateManager:      templateManager,
+		temporaryFileManager: temporaryFileManager,
+		downloader:           downloader,
+		uploader:             uploader,
+		workChannel:          workChannel,
+		statusListeners:      make([]RenderStatusChannel, 0, 0),
+		stop:                 make(chan (chan bool)),
+	}
+}
+
+// start receives dispatched generated asset ids and renders them one at a time until the render agent is stopped. Prioritized generated assets are rendered before the others.
+func (renderAgent *baseRenderAgent) start(render func(id string)) {
+	priorityChannel := renderAgent.priorityChannel()
+	for {
+		id, ok := receivePriorityWork(priorityChannel)
+		if ok {
+			log.Println("Received priority dispatch message", id)
+			render(id)
+			continue
+		}
+		select {
+		case ch, ok := <-renderAgent.stop:
+			{
+				log.Println("Stopping")
+				if !ok {
+					return
+				}
+				ch <- true
+				return
+			}
+		case id, ok := <-priorityChannel:
+			{
+				if !ok {
+					return
+				}
+				log.Println("Received priority dispatch message", id)
+				render(id)
+			}
+		case id, ok := <-renderAgent.workChannel:
+			{
+				if !ok {
+					return
+				}
+				log.Println("Received dispatch message", id)
+				render(id)
+			}
+		}
+	}
+}
+
+// priorityChannel returns the channel that prioritized work for the render agent is received from, or nil when the render agent has no render agent manager.
+func (renderAgent *baseRenderAgent) priorityChannel() RenderAgentWorkChannel {
+	if renderAgent.agentManager == nil {
+		return nil
+	}
+	return renderAgent.agentManager.priorityChannel(renderAgent.name)
+}
+
+// receivePriorityWork returns a prioritized generated asset id if one is waiting, without blocking.
+func receivePriorityWork(priorityChannel RenderAgentWorkChannel) (string, bool) {
+	select {
+	case id, ok := <-priorityChannel:
+		return id, ok
+	default:
+		return "", false
+	}
+}
+
+func (renderAgent *baseRenderAgent) Stop() {
+	callback := make(chan bool)
+	renderAgent.stop <- callback
+	select {
+	case <-callback:
+	case <-time.After(5 * time.Second):
+	}
+	close(renderAgent.stop)
+}
+
+func (renderAgent *baseRenderAgent) AddStatusListener(listener RenderStatusChannel) {
+	renderAgent.statusListeners = append(renderAgent.statusListeners, listener)
+}
+
+func (renderAgent *baseRenderAgent) Dispatch() RenderAgentWorkChannel {
+	return renderAgent.workChannel
+}
+
+func (renderAgent *baseRenderAgent) getSourceAsset(generatedAsset *common.GeneratedAsset) (*common.SourceAsset, error) {
+	sourceAssets, err := renderAgent.sasm.FindBySourceAssetId(generatedAsset.SourceAssetId)
+	if err != nil {
+		return nil, err
+	}
+	for _, sourceAsset := range sourceAssets {
+		if sourceAsset.IdType == generatedAsset.SourceAssetType {
+			return sourceAsset, nil
+		}
+	}
+	return nil, common.ErrorNoSourceAssetsFoundForId
+}
+
+func (renderAgent *baseRenderAgent) getGeneratedAssetPage(generatedAsset *common.GeneratedAsset) (int, error) {
+	rawPage, err := common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributePage)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(rawPage)
+}
+
+func (renderAgent *baseRenderAgent) tryDownload(urls []string, source string) (common.TemporaryFile, error) {
+	for _, url := range urls {
+		if renderAgent.agentManager != nil {
+			sharedFile := renderAgent.agentManager.claimDownload(url)
+			if sharedFile != nil {
+				return sharedFile, nil
+			}
+		}
+		tempFile, err := renderAgent.downloader.Download(url, source)
+		if err == nil {
+			return tempFile, nil
+		}
+	}
+	return nil, common.ErrorNoDownloadUrlsWork
+}
+
+// commitStatus collects status and attribute updates for a generated asset and, once the returned channel is closed, stores the last status along with every attribute received and notifies the status listeners.
+func (renderAgent *baseRenderAgent) commitStatus(id string, existingAttributes []common.Attribute) chan generatedAssetUpdate {
+	commitChannel := make(chan generatedAssetUpdate, 10)
+
+	go func() {
+		status := common.NewGeneratedAssetError(common.ErrorUnknownError)
+		attributes := make([]common.Attribute, 0, 0)
+		for _, attribute := range existingAttributes {
+			attributes = append(attributes, attribute)
+		}
+		for {
+			select {
+			case message, ok := <-commitChannel:
+				{
+					if !ok {
+						generatedAsset, err := renderAgent.gasm.FindById(id)
+						if err != nil {
+							log.Fatal(err.Error())
+							return
+						}
+						generatedAsset.Status = status
+						generatedAsset.Attributes = attributes
+						renderAgent.gasm.Update(generatedAsset)
+						// Listeners are notified once the status is stored so that waiters read the final status.
+						for _, listener := range renderAgent.statusListeners {
+							listener <- RenderStatus{id, status, renderAgent.name}
+						}
+						return
+					}
+					status = message.status
+					if message.attributes != nil {
+						for _, attribute := range message.attributes {
+							attributes = append(attributes, attribute)
+						}
+					}
+				}
+			}
+		}
+	}()
+	return commitChannel
+}
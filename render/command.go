@@ -0,0 +1,153 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ngerakines/codederror"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// processLimits bound the time and resources of the external processes run by a render agent. Processes are started in their own process group so that everything they start is killed with them when the timeout is reached. A nil processLimits runs processes without limits.
+type processLimits struct {
+	timeout     time.Duration
+	maxMemory   int
+	maxCpuTime  int
+	environment []string
+}
+
+// errProcessTimedOut is returned when an external process is killed for running longer than its timeout.
+var errProcessTimedOut = errors.New("process timed out")
+
+func newProcessLimits(renderAgentConfig *config.RenderAgentConfig) *processLimits {
+	limits := new(processLimits)
+	limits.timeout = time.Duration(renderAgentConfig.Timeout) * time.Second
+	limits.maxMemory = renderAgentConfig.MaxMemory
+	limits.maxCpuTime = renderAgentConfig.MaxCpuTime
+	return limits
+}
+
+// forTemplate returns the limits to use for a template, replacing the timeout with the number of seconds in the "timeout" template attribute when it is set.
+func (limits *processLimits) forTemplate(template *common.Template) *processLimits {
+	rawTimeout, err := common.GetFirstAttribute(template, common.TemplateAttributeTimeout)
+	if err != nil {
+		return limits
+	}
+	timeout, err := strconv.Atoi(rawTimeout)
+	if err != nil || timeout <= 0 {
+		return limits
+	}
+	templateLimits := new(processLimits)
+	if limits != nil {
+		*templateLimits = *limits
+	}
+	templateLimits.timeout = time.Duration(timeout) * time.Second
+	return templateLimits
+}
+
+// withEnvironment returns a copy of the limits that also sets the given "KEY=value" environment variables for processes.
+func (limits *processLimits) withEnvironment(environment ...string) *processLimits {
+	environmentLimits := new(processLimits)
+	if limits != nil {
+		*environmentLimits = *limits
+	}
+	environmentLimits.environment = append(append([]string{}, environmentLimits.environment...), environment...)
+	return environmentLimits
+}
+
+// command creates a command that applies the memory and cpu limits before executing the named program.
+func (limits *processLimits) command(name string, args ...string) *exec.Cmd {
+	if limits == nil {
+		return exec.Command(name, args...)
+	}
+	var cmd *exec.Cmd
+	ulimits := limits.ulimits()
+	if ulimits != "" && canLimitResources() {
+		cmd = exec.Command("/bin/sh", append([]string{"-c", ulimits + `exec "$0" "$@"`, name}, args...)...)
+	} else {
+		cmd = exec.Command(name, args...)
+	}
+	if len(limits.environment) > 0 {
+		cmd.Env = append(os.Environ(), limits.environment...)
+	}
+	return cmd
+}
+
+// ulimits returns the shell commands that set the resource limits of the process, each followed by a semicolon.
+func (limits *processLimits) ulimits() string {
+	var ulimits bytes.Buffer
+	if limits.maxMemory > 0 {
+		ulimits.WriteString(fmt.Sprintf("ulimit -v %d; ", limits.maxMemory*1024))
+	}
+	if limits.maxCpuTime > 0 {
+		ulimits.WriteString(fmt.Sprintf("ulimit -t %d; ", limits.maxCpuTime))
+	}
+	return ulimits.String()
+}
+
+// run starts the command and waits for it to complete. When the timeout is reached, the process group of the command is killed and errProcessTimedOut is returned.
+func (limits *processLimits) run(cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	if limits == nil || limits.timeout <= 0 {
+		return cmd.Wait()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-time.After(limits.timeout):
+		killProcessGroup(cmd)
+		<-done
+		return errProcessTimedOut
+	}
+}
+
+// output runs the command and returns its standard output.
+func (limits *processLimits) output(cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := limits.run(cmd)
+	return stdout.Bytes(), err
+}
+
+// runLimitedCommand runs the named program within the limits, logging its combined output.
+func runLimitedCommand(limits *processLimits, name string, args ...string) error {
+	_, err := exec.LookPath(name)
+	if err != nil {
+		log.Println(name, "command not found")
+		return err
+	}
+
+	cmd := limits.command(name, args...)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	err = limits.run(cmd)
+	log.Println(buf.String())
+	return err
+}
+
+// renderError returns the generated asset error for an error returned while rendering, telling timeouts apart from other failures.
+func renderError(err error, failure codederror.CodedError) string {
+	if err == errProcessTimedOut {
+		return common.NewGeneratedAssetError(common.ErrorRenderTimedOut)
+	}
+	return common.NewGeneratedAssetError(failure)
+}
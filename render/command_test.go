@@ -0,0 +1,114 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessLimitsTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh command not found")
+	}
+	limits := &processLimits{timeout: 200 * time.Millisecond}
+
+	started := time.Now()
+	// The background sleep keeps the output open unless the whole process group is killed.
+	err := limits.run(limits.command("sh", "-c", "sleep 10 & sleep 10"))
+	if err != errProcessTimedOut {
+		t.Errorf("Expected the process to time out: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Process was not killed when the timeout was reached: %s", elapsed)
+	}
+
+	out, err := limits.output(limits.command("echo", "hello"))
+	if err != nil || strings.TrimSpace(string(out)) != "hello" {
+		t.Errorf("Unexpected output: %q %v", out, err)
+	}
+
+	var nilLimits *processLimits
+	out, err = nilLimits.output(nilLimits.command("echo", "hello"))
+	if err != nil || strings.TrimSpace(string(out)) != "hello" {
+		t.Errorf("Unexpected output without limits: %q %v", out, err)
+	}
+}
+
+func TestProcessLimitsForTemplate(t *testing.T) {
+	limits := newProcessLimits(&config.RenderAgentConfig{Timeout: 60, MaxMemory: 512, MaxCpuTime: 30})
+	if limits.timeout != 60*time.Second || limits.maxMemory != 512 || limits.maxCpuTime != 30 {
+		t.Errorf("Unexpected limits: %+v", limits)
+	}
+
+	template := &common.Template{Id: "B2F6D0A4-8C1E-4A37-9E52-7D3C1B9F0A68", Renderer: common.RenderAgentImageMagick}
+	if limits.forTemplate(template) != limits {
+		t.Error("Expected the render agent limits for a template without a timeout")
+	}
+
+	template.AddAttribute(common.TemplateAttributeTimeout, []string{"5"})
+	templateLimits := limits.forTemplate(template)
+	if templateLimits.timeout != 5*time.Second || templateLimits.maxMemory != 512 {
+		t.Errorf("Unexpected template limits: %+v", templateLimits)
+	}
+	if limits.timeout != 60*time.Second {
+		t.Error("Expected the render agent limits to be unchanged")
+	}
+
+	var nilLimits *processLimits
+	if nilLimits.forTemplate(template).timeout != 5*time.Second {
+		t.Error("Expected a template timeout without render agent limits")
+	}
+}
+
+func TestProcessLimitsCommand(t *testing.T) {
+	limits := &processLimits{maxMemory: 256, maxCpuTime: 10}
+	if limits.ulimits() != "ulimit -v 262144; ulimit -t 10; " {
+		t.Errorf("Unexpected ulimits: %q", limits.ulimits())
+	}
+	if (&processLimits{}).ulimits() != "" {
+		t.Error("Expected no ulimits without limits")
+	}
+
+	if canLimitResources() {
+		cmd := limits.command("convert", "a.png", "b.png")
+		expected := []string{"/bin/sh", "-c", `ulimit -v 262144; ulimit -t 10; exec "$0" "$@"`, "convert", "a.png", "b.png"}
+		if !reflect.DeepEqual(cmd.Args, expected) {
+			t.Errorf("Unexpected arguments: %q", cmd.Args)
+		}
+	}
+
+	cmd := limits.withEnvironment("MAGICK_AREA_LIMIT=1MP").command("convert")
+	if cmd.Env[len(cmd.Env)-1] != "MAGICK_AREA_LIMIT=1MP" {
+		t.Errorf("Unexpected environment: %q", cmd.Env)
+	}
+	if len(limits.environment) != 0 {
+		t.Error("Expected the limits to be unchanged")
+	}
+}
+
+func TestImageMagickEnvironment(t *testing.T) {
+	environment := imageMagickEnvironment(map[string]string{"Area": "1MP", "disk": ""})
+	expected := []string{
+		"MAGICK_AREA_LIMIT=1MP",
+		"MAGICK_HEIGHT_LIMIT=16KP",
+		"MAGICK_MAP_LIMIT=512MiB",
+		"MAGICK_MEMORY_LIMIT=256MiB",
+		"MAGICK_WIDTH_LIMIT=16KP",
+	}
+	if !reflect.DeepEqual(environment, expected) {
+		t.Errorf("Unexpected environment: %q", environment)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	if renderError(errProcessTimedOut, common.ErrorCouldNotResizeImage) != common.NewGeneratedAssetError(common.ErrorRenderTimedOut) {
+		t.Error("Expected timeouts to be reported as timeouts")
+	}
+	if renderError(exec.ErrNotFound, common.ErrorCouldNotResizeImage) != common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage) {
+		t.Error("Expected other errors to be reported with the render agent error")
+	}
+}
@@ -8,6 +8,11 @@ type RenderAgent interface {
 	Dispatch() RenderAgentWorkChannel
 }
 
+// RenderAgentStatusReporter is implemented by render agents that manage resources, such as long running worker processes, whose state is reported on the render agents admin resource.
+type RenderAgentStatusReporter interface {
+	Status() interface{}
+}
+
 type RenderAgentWorkChannel chan string
 
 type RenderStatusChannel chan RenderStatus
@@ -1,15 +1,11 @@
 package render
 
 import (
-	"bytes"
-	"fmt"
 	"github.com/ngerakines/preview/common"
 	"github.com/ngerakines/preview/util"
-	"github.com/rcrowley/go-metrics"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,28 +13,57 @@ import (
 )
 
 type documentRenderAgent struct {
-	metrics              *documentRenderAgentMetrics
-	sasm                 common.SourceAssetStorageManager
-	gasm                 common.GeneratedAssetStorageManager
-	templateManager      common.TemplateManager
-	downloader           common.Downloader
-	uploader             common.Uploader
-	workChannel          RenderAgentWorkChannel
-	statusListeners      []RenderStatusChannel
-	temporaryFileManager common.TemporaryFileManager
-	agentManager         *RenderAgentManager
-	tempFileBasePath     string
-	stop                 chan (chan bool)
+	baseRenderAgent
+	tempFileBasePath    string
+	limits              *processLimits
+	officeWorker        *officeWorker
+	healthCheckInterval time.Duration
 }
 
-type documentRenderAgentMetrics struct {
-	workProcessed metrics.Meter
-	convertTime   metrics.Timer
-	fileTypeCount map[string]metrics.Counter
+type documentRenderAgentFactory struct{}
+
+type documentRenderAgentConfig struct {
+	MaxConversions      int `json:"maxConversions"`
+	HealthCheckInterval int `json:"healthCheckInterval"`
+}
+
+func (factory *documentRenderAgentFactory) Name() string {
+	return common.RenderAgentDocument
+}
+
+func (factory *documentRenderAgentFactory) ConfigSection() string {
+	return "documentRenderAgent"
+}
+
+func (factory *documentRenderAgentFactory) TemplateIds() []string {
+	return []string{common.DocumentConversionTemplateId}
+}
+
+func (factory *documentRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var documentConfig documentRenderAgentConfig
+	err := context.Config.Decode(&documentConfig)
+	if err != nil {
+		return nil, err
+	}
+	maxConversions := defaultOfficeMaxConversions
+	if documentConfig.MaxConversions > 0 {
+		maxConversions = documentConfig.MaxConversions
+	}
+	healthCheckInterval := defaultOfficeHealthCheckInterval
+	if documentConfig.HealthCheckInterval > 0 {
+		healthCheckInterval = documentConfig.HealthCheckInterval
+	}
+	limits := newProcessLimits(context.Config)
+	// The listener runs for as long as the render agent, so only the conversions submitted to it are timed.
+	worker, err := newOfficeWorker(context.Config.BasePath, &processLimits{maxMemory: limits.maxMemory}, maxConversions)
+	if err != nil {
+		return nil, err
+	}
+	return newDocumentRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.Config.BasePath, context.WorkChannel, limits, worker, time.Duration(healthCheckInterval)*time.Second), nil
 }
 
 func newDocumentRenderAgent(
-	metrics *documentRenderAgentMetrics,
+	metrics *RenderAgentMetrics,
 	agentManager *RenderAgentManager,
 	sasm common.SourceAssetStorageManager,
 	gasm common.GeneratedAssetStorageManager,
@@ -47,47 +72,40 @@ func newDocumentRenderAgent(
 	downloader common.Downloader,
 	uploader common.Uploader,
 	tempFileBasePath string,
-	workChannel RenderAgentWorkChannel) RenderAgent {
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits,
+	officeWorker *officeWorker,
+	healthCheckInterval time.Duration) RenderAgent {
 
 	renderAgent := new(documentRenderAgent)
-	renderAgent.metrics = metrics
-	renderAgent.agentManager = agentManager
-	renderAgent.sasm = sasm
-	renderAgent.gasm = gasm
-	renderAgent.templateManager = templateManager
-	renderAgent.temporaryFileManager = temporaryFileManager
-	renderAgent.downloader = downloader
-	renderAgent.uploader = uploader
-	renderAgent.workChannel = workChannel
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentDocument, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
 	renderAgent.tempFileBasePath = tempFileBasePath
-	renderAgent.statusListeners = make([]RenderStatusChannel, 0, 0)
-	renderAgent.stop = make(chan (chan bool))
+	renderAgent.limits = limits
+	renderAgent.officeWorker = officeWorker
+	renderAgent.healthCheckInterval = healthCheckInterval
 
 	go renderAgent.start()
 
 	return renderAgent
 }
 
-func newDocumentRenderAgentMetrics(registry metrics.Registry, supportedFileTypes []string) *documentRenderAgentMetrics {
-	documentMetrics := new(documentRenderAgentMetrics)
-	documentMetrics.workProcessed = metrics.NewMeter()
-	documentMetrics.convertTime = metrics.NewTimer()
-
-	documentMetrics.fileTypeCount = make(map[string]metrics.Counter)
-
-	for _, filetype := range supportedFileTypes {
-		documentMetrics.fileTypeCount[filetype] = metrics.NewCounter()
-		registry.Register(fmt.Sprintf("documentRenderAgent.%sCount", filetype), documentMetrics.fileTypeCount[filetype])
+func (renderAgent *documentRenderAgent) start() {
+	err := renderAgent.officeWorker.start()
+	if err != nil {
+		log.Println("error starting libreoffice worker", err)
 	}
+	healthCheck := time.NewTicker(renderAgent.healthCheckInterval)
+	defer healthCheck.Stop()
+	defer renderAgent.officeWorker.close()
 
-	registry.Register("documentRenderAgent.workProcessed", documentMetrics.workProcessed)
-	registry.Register("documentRenderAgent.convertTime", documentMetrics.convertTime)
-
-	return documentMetrics
-}
-
-func (renderAgent *documentRenderAgent) start() {
+	priorityChannel := renderAgent.priorityChannel()
 	for {
+		id, ok := receivePriorityWork(priorityChannel)
+		if ok {
+			log.Println("Received priority dispatch message", id)
+			renderAgent.renderGeneratedAsset(id)
+			continue
+		}
 		select {
 		case ch, ok := <-renderAgent.stop:
 			{
@@ -98,6 +116,18 @@ func (renderAgent *documentRenderAgent) start() {
 				ch <- true
 				return
 			}
+		case <-healthCheck.C:
+			{
+				renderAgent.officeWorker.checkHealth()
+			}
+		case id, ok := <-priorityChannel:
+			{
+				if !ok {
+					return
+				}
+				log.Println("Received priority dispatch message", id)
+				renderAgent.renderGeneratedAsset(id)
+			}
 		case id, ok := <-renderAgent.workChannel:
 			{
 				if !ok {
@@ -110,22 +140,9 @@ func (renderAgent *documentRenderAgent) start() {
 	}
 }
 
-func (renderAgent *documentRenderAgent) Stop() {
-	callback := make(chan bool)
-	renderAgent.stop <- callback
-	select {
-	case <-callback:
-	case <-time.After(5 * time.Second):
-	}
-	close(renderAgent.stop)
-}
-
-func (renderAgent *documentRenderAgent) AddStatusListener(listener RenderStatusChannel) {
-	renderAgent.statusListeners = append(renderAgent.statusListeners, listener)
-}
-
-func (renderAgent *documentRenderAgent) Dispatch() RenderAgentWorkChannel {
-	return renderAgent.workChannel
+// Status returns the state of the LibreOffice worker owned by the render agent.
+func (renderAgent *documentRenderAgent) Status() interface{} {
+	return renderAgent.officeWorker.status()
 }
 
 /*
@@ -142,7 +159,7 @@ func (renderAgent *documentRenderAgent) Dispatch() RenderAgentWorkChannel {
 11. Update the status of the generated asset as complete.
 */
 func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
-	renderAgent.metrics.workProcessed.Mark(1)
+	renderAgent.metrics.WorkProcessed.Mark(1)
 
 	// 1. Get the generated asset
 	generatedAsset, err := renderAgent.gasm.FindById(id)
@@ -166,10 +183,15 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 
 	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
 	if err == nil {
-		renderAgent.metrics.fileTypeCount[fileType].Inc(1)
+		renderAgent.metrics.FileTypeCount[fileType].Inc(1)
 	}
 
-	// 3. Get the template... not needed yet
+	// 3. Get the template, which may only change the time limit of the conversion.
+	limits := renderAgent.limits
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err == nil && len(templates) > 0 {
+		limits = limits.forTemplate(templates[0])
+	}
 
 	// 4. Fetch the source asset file
 	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
@@ -179,6 +201,7 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 		return
 	}
 	defer sourceFile.Release()
+	renderAgent.agentManager.recordContentHash(sourceAsset, sourceFile.Path())
 
 	//      // 5. Create a temporary destination directory.
 	destination, err := renderAgent.createTemporaryDestinationDirectory()
@@ -189,13 +212,18 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
 	defer destinationTemporaryFile.Release()
 
-	renderAgent.metrics.convertTime.Time(func() {
-		err = renderAgent.createPdf(sourceFile.Path(), destination)
-		if err != nil {
-			statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+	renderAgent.metrics.ConvertTime.Time(func() {
+		// Documents with the same contents that have already been converted are copied instead of converted again. The pdf source asset and derived work are still created for the copy.
+		if renderAgent.agentManager.copyPreviousRender(renderAgent.downloader, sourceAsset, generatedAsset, filepath.Join(destination, "document.pdf")) != nil {
 			return
 		}
+		err = renderAgent.createPdf(limits, sourceFile.Path(), destination)
 	})
+	if err != nil {
+		log.Println("error converting document", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotResizeImage), nil}
+		return
+	}
 
 	files, err := renderAgent.getRenderedFiles(destination)
 	if err != nil {
@@ -207,9 +235,9 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 		return
 	}
 
-	pages, err := util.GetPdfPageCount(files[0])
+	info, err := readPdfInfo(limits, files[0])
 	if err != nil {
-		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorNotImplemented), nil}
 		return
 	}
 
@@ -232,7 +260,7 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 	}
 
 	pdfSourceAsset.AddAttribute(common.SourceAssetAttributeSize, []string{strconv.FormatInt(pdfFileSize, 10)})
-	pdfSourceAsset.AddAttribute(common.SourceAssetAttributePages, []string{strconv.Itoa(pages)})
+	pdfSourceAsset.AddAttribute(common.SourceAssetAttributePages, []string{strconv.Itoa(info.pages)})
 	pdfSourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{generatedAsset.Location})
 	pdfSourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{"pdf"})
 	// TODO: Add support for the expiration attribute.
@@ -247,6 +275,15 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 	// Only process first page because imageMagickRenderAgent will automatically create derived work for the other pages
 	renderAgent.agentManager.CreateDerivedWork(pdfSourceAsset, legacyDefaultTemplates, 0, 1)
 
+	// Supplemental render agents, such as the document text render agent, create derived work for the other pages themselves.
+	supplementalTemplateIds := renderAgent.agentManager.supplementalTemplateIds("pdf")
+	if len(supplementalTemplateIds) > 0 {
+		supplementalTemplates, err := renderAgent.templateManager.FindByIds(supplementalTemplateIds)
+		if err == nil {
+			renderAgent.agentManager.CreateDerivedWork(pdfSourceAsset, supplementalTemplates, 0, 1)
+		}
+	}
+
 	/*
 	   // TODO: Have the new source asset and generated assets be created in batch in the storage managers.
 	   for page := 0; page < pages; page++ {
@@ -274,93 +311,12 @@ func (renderAgent *documentRenderAgent) renderGeneratedAsset(id string) {
 	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, nil}
 }
 
-func (renderAgent *documentRenderAgent) getSourceAsset(generatedAsset *common.GeneratedAsset) (*common.SourceAsset, error) {
-	sourceAssets, err := renderAgent.sasm.FindBySourceAssetId(generatedAsset.SourceAssetId)
-	if err != nil {
-		return nil, err
-	}
-	for _, sourceAsset := range sourceAssets {
-		if sourceAsset.IdType == generatedAsset.SourceAssetType {
-			return sourceAsset, nil
-		}
-	}
-	return nil, common.ErrorNoSourceAssetsFoundForId
-}
-
-func (renderAgent *documentRenderAgent) createPdf(source, destination string) error {
-	_, err := exec.LookPath("soffice")
+func (renderAgent *documentRenderAgent) createPdf(limits *processLimits, source, destination string) error {
+	err := renderAgent.officeWorker.convert(limits, "pdf", source, destination)
 	if err != nil {
-		log.Println("soffice command not found")
-		return err
+		log.Println("error converting document", err)
 	}
-
-	// TODO: Make this path configurable.
-	cmd := exec.Command("soffice", "--headless", "--nologo", "--nofirststartwizard", "--convert-to", "pdf", source, "--outdir", destination)
-	log.Println(cmd)
-
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	cmd.Stderr = &buf
-
-	err = cmd.Run()
-	log.Println(buf.String())
-	if err != nil {
-		log.Println("error running command", err)
-		return err
-	}
-
-	return nil
-}
-
-func (renderAgent *documentRenderAgent) tryDownload(urls []string, source string) (common.TemporaryFile, error) {
-	for _, url := range urls {
-		tempFile, err := renderAgent.downloader.Download(url, source)
-		if err == nil {
-			return tempFile, nil
-		}
-	}
-	return nil, common.ErrorNoDownloadUrlsWork
-}
-
-func (renderAgent *documentRenderAgent) commitStatus(id string, existingAttributes []common.Attribute) chan generatedAssetUpdate {
-	commitChannel := make(chan generatedAssetUpdate, 10)
-
-	go func() {
-		status := common.NewGeneratedAssetError(common.ErrorUnknownError)
-		attributes := make([]common.Attribute, 0, 0)
-		for _, attribute := range existingAttributes {
-			attributes = append(attributes, attribute)
-		}
-		for {
-			select {
-			case message, ok := <-commitChannel:
-				{
-					if !ok {
-						for _, listener := range renderAgent.statusListeners {
-							listener <- RenderStatus{id, status, common.RenderAgentDocument}
-						}
-						generatedAsset, err := renderAgent.gasm.FindById(id)
-						if err != nil {
-							panic(err)
-							return
-						}
-						generatedAsset.Status = status
-						generatedAsset.Attributes = attributes
-						log.Println("Updating", generatedAsset)
-						renderAgent.gasm.Update(generatedAsset)
-						return
-					}
-					status = message.status
-					if message.attributes != nil {
-						for _, attribute := range message.attributes {
-							attributes = append(attributes, attribute)
-						}
-					}
-				}
-			}
-		}
-	}()
-	return commitChannel
+	return err
 }
 
 func (renderAgent *documentRenderAgent) createTemporaryDestinationDirectory() (string, error) {
@@ -0,0 +1,377 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/ngerakines/preview/common"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// documentTextRenderAgent reads the metadata of pdf documents and extracts the text of each page into its own generated asset. The text of the pages that are rendered eagerly is extracted in one pass when the first page is rendered; the other pages are extracted when they are requested. It is a supplemental render agent: its template is added to the work of pdf documents and of the pdfs that the document render agent converts office documents into.
+type documentTextRenderAgent struct {
+	baseRenderAgent
+	limits *processLimits
+}
+
+type documentTextRenderAgentFactory struct{}
+
+// pdfDocumentInfo contains the document information reported by pdfinfo.
+type pdfDocumentInfo struct {
+	title           string
+	author          string
+	subject         string
+	creator         string
+	producer        string
+	created         string
+	modified        string
+	pages           int
+	pageWidth       float64
+	pageHeight      float64
+	encrypted       bool
+	encryptionFlags []string
+}
+
+var (
+	pdfInfoPageSize   = regexp.MustCompile(`^([\d.]+) x ([\d.]+) pts`)
+	pdfInfoEncryption = regexp.MustCompile(`^yes \((.*)\)`)
+)
+
+func (factory *documentTextRenderAgentFactory) Name() string {
+	return common.RenderAgentDocumentText
+}
+
+func (factory *documentTextRenderAgentFactory) ConfigSection() string {
+	return "documentTextRenderAgent"
+}
+
+func (factory *documentTextRenderAgentFactory) TemplateIds() []string {
+	return []string{common.DocumentTextTemplateId}
+}
+
+func (factory *documentTextRenderAgentFactory) IsSupplemental() bool {
+	return true
+}
+
+func (factory *documentTextRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	return newDocumentTextRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.WorkChannel, newProcessLimits(context.Config)), nil
+}
+
+func newDocumentTextRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits) RenderAgent {
+
+	renderAgent := new(documentTextRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentDocumentText, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *documentTextRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	limits := renderAgent.limits.forTemplate(template)
+
+	page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+	lastPage := page + 1
+	if page == 0 {
+		info, err := readPdfInfo(limits, sourceFile.Path())
+		if err != nil {
+			log.Println("error reading document information", err)
+			statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotExtractDocumentText), nil}
+			return
+		}
+		renderAgent.recordDocumentMetadata(sourceAsset, info)
+		_, lastPage = renderAgent.agentManager.eagerPageRange(sourceAsset, info.pages)
+		if lastPage < 1 {
+			lastPage = 1
+		}
+	}
+
+	var pageTexts [][]byte
+	renderAgent.metrics.ConvertTime.Time(func() {
+		pageTexts, err = extractPdfText(limits, sourceFile.Path(), page, lastPage)
+	})
+	if err != nil {
+		log.Println("error extracting document text", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotExtractDocumentText), nil}
+		return
+	}
+
+	text := pageTexts[0]
+	err = renderAgent.uploadPageText(sourceFile.Path(), template, page, generatedAsset.Location, text)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	// The text of the pages after the first one that are rendered eagerly was extracted along with it.
+	for index, pageText := range pageTexts[1:] {
+		renderAgent.storePageText(sourceAsset, sourceFile.Path(), template, page+index+1, pageText)
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("fileSize", []string{strconv.Itoa(len(text))}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// uploadPageText writes the text of a page next to the source file and uploads it to the location.
+func (renderAgent *documentTextRenderAgent) uploadPageText(sourcePath string, template *common.Template, page int, location string, text []byte) error {
+	destination := sourcePath + "-" + template.Id + "-" + strconv.Itoa(page) + ".txt"
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	err := ioutil.WriteFile(destination, text, 0644)
+	if err != nil {
+		return err
+	}
+	return renderAgent.uploader.Upload(location, destination)
+}
+
+// storePageText uploads the text of a page and stores the completed generated asset for it, unless the page already has one.
+func (renderAgent *documentTextRenderAgent) storePageText(sourceAsset *common.SourceAsset, sourcePath string, template *common.Template, page int, text []byte) {
+	generatedAssets, err := renderAgent.gasm.FindBySourceAssetId(sourceAsset.Id)
+	if err != nil {
+		log.Println("error finding generated assets", err)
+		return
+	}
+	for _, generatedAsset := range generatedAssets {
+		if generatedAsset.SourceAssetType == sourceAsset.IdType && generatedAsset.TemplateId == template.Id && generatedAssetPage(generatedAsset) == page {
+			return
+		}
+	}
+
+	location := renderAgent.uploader.Url(sourceAsset, template, int32(page))
+	generatedAsset, err := common.NewGeneratedAssetFromSourceAsset(sourceAsset, template.Id, location)
+	if err != nil {
+		log.Println("error creating generated asset from source asset", err)
+		return
+	}
+	generatedAsset.AddAttribute(common.GeneratedAssetAttributePage, []string{strconv.Itoa(page)})
+	err = renderAgent.uploadPageText(sourcePath, template, page, location, text)
+	if err != nil {
+		log.Println("error uploading document text", err)
+		generatedAsset.Status = common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset)
+	} else {
+		generatedAsset.AddAttribute("fileSize", []string{strconv.Itoa(len(text))})
+		generatedAsset.Status = common.GeneratedAssetStatusComplete
+	}
+	renderAgent.gasm.Store(generatedAsset)
+}
+
+// recordDocumentMetadata stores the document information on the source asset the first time the document is processed.
+func (renderAgent *documentTextRenderAgent) recordDocumentMetadata(sourceAsset *common.SourceAsset, info *pdfDocumentInfo) {
+	if sourceAsset.HasAttribute(common.SourceAssetAttributeMetadataExtracted) {
+		return
+	}
+	err := addSourceAssetAttributes(renderAgent.sasm, sourceAsset, info.attributes())
+	if err != nil {
+		log.Println("error storing document metadata", err)
+	}
+}
+
+// readPdfInfo runs pdfinfo with iso dates against a pdf document.
+func readPdfInfo(limits *processLimits, path string) (*pdfDocumentInfo, error) {
+	_, err := exec.LookPath("pdfinfo")
+	if err != nil {
+		log.Println("pdfinfo command not found")
+		return nil, err
+	}
+	out, err := limits.output(limits.command("pdfinfo", "-isodates", path))
+	if err != nil {
+		return nil, err
+	}
+	return parsePdfInfo(string(out)), nil
+}
+
+// parsePdfInfo reads the "Key: value" lines written by pdfinfo. Unknown keys are ignored.
+func parsePdfInfo(output string) *pdfDocumentInfo {
+	info := new(pdfDocumentInfo)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "Title":
+			info.title = value
+		case "Author":
+			info.author = value
+		case "Subject":
+			info.subject = value
+		case "Creator":
+			info.creator = value
+		case "Producer":
+			info.producer = value
+		case "CreationDate":
+			info.created = pdfInfoDate(value)
+		case "ModDate":
+			info.modified = pdfInfoDate(value)
+		case "Pages":
+			info.pages, _ = strconv.Atoi(value)
+		case "Page size":
+			matches := pdfInfoPageSize.FindStringSubmatch(value)
+			if len(matches) == 3 {
+				info.pageWidth, _ = strconv.ParseFloat(matches[1], 64)
+				info.pageHeight, _ = strconv.ParseFloat(matches[2], 64)
+			}
+		case "Encrypted":
+			info.encrypted = strings.HasPrefix(value, "yes")
+			matches := pdfInfoEncryption.FindStringSubmatch(value)
+			if len(matches) == 2 {
+				info.encryptionFlags = strings.Fields(matches[1])
+			}
+		}
+	}
+	return info
+}
+
+// pdfInfoDate normalizes a date written by pdfinfo to RFC 3339, leaving dates in other formats as they are.
+func pdfInfoDate(value string) string {
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return date.Format(time.RFC3339)
+}
+
+// attributes returns the document information that is known as source asset attributes.
+func (info *pdfDocumentInfo) attributes() []common.Attribute {
+	attributes := []common.Attribute{
+		common.Attribute{Key: common.SourceAssetAttributeMetadataExtracted, Value: []string{"true"}},
+	}
+	values := map[string]string{
+		common.SourceAssetAttributeDocumentTitle:    info.title,
+		common.SourceAssetAttributeDocumentAuthor:   info.author,
+		common.SourceAssetAttributeDocumentSubject:  info.subject,
+		common.SourceAssetAttributeDocumentCreator:  info.creator,
+		common.SourceAssetAttributeDocumentProducer: info.producer,
+		common.SourceAssetAttributeDocumentCreated:  info.created,
+		common.SourceAssetAttributeDocumentModified: info.modified,
+	}
+	for name, value := range values {
+		if value != "" {
+			attributes = append(attributes, common.Attribute{Key: name, Value: []string{value}})
+		}
+	}
+	if info.pages > 0 {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributePages, Value: []string{strconv.Itoa(info.pages)}})
+	}
+	if info.pageWidth > 0 && info.pageHeight > 0 {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributePageWidth, Value: []string{strconv.FormatFloat(info.pageWidth, 'f', -1, 64)}})
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributePageHeight, Value: []string{strconv.FormatFloat(info.pageHeight, 'f', -1, 64)}})
+	}
+	attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeEncrypted, Value: []string{strconv.FormatBool(info.encrypted)}})
+	if len(info.encryptionFlags) > 0 {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeEncryptionFlags, Value: info.encryptionFlags})
+	}
+	return attributes
+}
+
+// extractPdfPageText returns the UTF-8 text of a zero based page of a pdf document with its layout preserved.
+func extractPdfPageText(limits *processLimits, path string, page int) ([]byte, error) {
+	pageTexts, err := extractPdfText(limits, path, page, page+1)
+	if err != nil {
+		return nil, err
+	}
+	return pageTexts[0], nil
+}
+
+// extractPdfText returns the UTF-8 text of each of the zero based pages from firstPage up to but not including lastPage of a pdf document with its layout preserved. The text of every page is extracted in a single pdftotext run.
+func extractPdfText(limits *processLimits, path string, firstPage, lastPage int) ([][]byte, error) {
+	_, err := exec.LookPath("pdftotext")
+	if err != nil {
+		log.Println("pdftotext command not found")
+		return nil, err
+	}
+	cmd := limits.command("pdftotext", "-q", "-f", strconv.Itoa(firstPage+1), "-l", strconv.Itoa(lastPage), "-layout", "-enc", "UTF-8", path, "-")
+	log.Println(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(stderr.String())
+		return nil, err
+	}
+	return splitPdfText(stdout.Bytes(), lastPage-firstPage), nil
+}
+
+// splitPdfText splits the output of pdftotext into the text of each page. pdftotext ends every page with a form feed. Missing pages are empty.
+func splitPdfText(text []byte, pages int) [][]byte {
+	pageTexts := bytes.SplitN(text, []byte("\f"), pages+1)
+	if len(pageTexts) > pages {
+		pageTexts = pageTexts[:pages]
+	}
+	for len(pageTexts) < pages {
+		pageTexts = append(pageTexts, []byte{})
+	}
+	return pageTexts
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"github.com/rcrowley/go-metrics"
+	"reflect"
+	"testing"
+)
+
+const testPdfInfo = `Title:          Quarterly Report
+Author:         Jane Doe
+Creator:        Writer
+Producer:       LibreOffice 6.4
+CreationDate:   2020-05-06T07:08:09+02:00
+ModDate:        Wed May  6 07:08:09 2020 CEST
+Tagged:         no
+Pages:          3
+Encrypted:      yes (print:yes copy:no change:no addNotes:no algorithm:AES)
+Page size:      612 x 792 pts (letter)
+Page rot:       0
+File size:      12345 bytes
+PDF version:    1.6
+`
+
+func TestParsePdfInfo(t *testing.T) {
+	info := parsePdfInfo(testPdfInfo)
+	if info.title != "Quarterly Report" || info.author != "Jane Doe" || info.subject != "" || info.creator != "Writer" || info.producer != "LibreOffice 6.4" {
+		t.Errorf("Unexpected document information: %+v", info)
+	}
+	if info.created != "2020-05-06T07:08:09+02:00" || info.modified != "Wed May  6 07:08:09 2020 CEST" {
+		t.Errorf("Unexpected dates: %s %s", info.created, info.modified)
+	}
+	if info.pages != 3 || info.pageWidth != 612 || info.pageHeight != 792 {
+		t.Errorf("Unexpected pages: %d %fx%f", info.pages, info.pageWidth, info.pageHeight)
+	}
+	expectedFlags := []string{"print:yes", "copy:no", "change:no", "addNotes:no", "algorithm:AES"}
+	if !info.encrypted || !reflect.DeepEqual(info.encryptionFlags, expectedFlags) {
+		t.Errorf("Unexpected encryption: %v %q", info.encrypted, info.encryptionFlags)
+	}
+
+	info = parsePdfInfo("Pages:          1\nEncrypted:      no\n")
+	if info.encrypted || len(info.encryptionFlags) != 0 || info.pages != 1 {
+		t.Errorf("Unexpected document information: %+v", info)
+	}
+}
+
+func TestPdfDocumentInfoAttributes(t *testing.T) {
+	sourceAsset, err := common.NewSourceAsset("6C1E8F3A-2B5D-4E7A-9C04-D3B2A1F0E987", common.SourceAssetTypePdf)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	sourceAsset.AddAttribute(common.SourceAssetAttributePages, []string{"3"})
+	sasm := common.NewSourceAssetStorageManager()
+	sasm.Store(sourceAsset)
+	err = addSourceAssetAttributes(sasm, sourceAsset, parsePdfInfo(testPdfInfo).attributes())
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	expected := map[string][]string{
+		common.SourceAssetAttributeMetadataExtracted: []string{"true"},
+		common.SourceAssetAttributeDocumentTitle:     []string{"Quarterly Report"},
+		common.SourceAssetAttributeDocumentCreated:   []string{"2020-05-06T07:08:09+02:00"},
+		common.SourceAssetAttributePages:             []string{"3"},
+		common.SourceAssetAttributePageWidth:         []string{"612"},
+		common.SourceAssetAttributePageHeight:        []string{"792"},
+		common.SourceAssetAttributeEncrypted:         []string{"true"},
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(sourceAsset.GetAttribute(key), value) {
+			t.Errorf("Unexpected %s attribute: %q", key, sourceAsset.GetAttribute(key))
+		}
+	}
+	if sourceAsset.HasAttribute(common.SourceAssetAttributeDocumentSubject) {
+		t.Error("Expected empty values to be skipped")
+	}
+	if len(sourceAsset.GetAttribute(common.SourceAssetAttributeEncryptionFlags)) != 5 {
+		t.Errorf("Unexpected encryption flags: %q", sourceAsset.GetAttribute(common.SourceAssetAttributeEncryptionFlags))
+	}
+}
+
+func TestSupplementalRenderAgentWork(t *testing.T) {
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	uploader := common.NewLocalUploader("")
+
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentDocumentText: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+		common.RenderAgentImageMagick:  &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, common.NewTemporaryFileManager(), uploader, false, renderAgentConfigs)
+
+	rm.CreateWork("3F6A9D12-7E4B-4C85-A1D0-8B2C5E7F9A34", "file:///tmp/report.pdf", "pdf", 12)
+
+	generatedAssets, err := gasm.FindBySourceAssetId("3F6A9D12-7E4B-4C85-A1D0-8B2C5E7F9A34")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(generatedAssets) != 5 {
+		t.Error("Five generated assets expected:", len(generatedAssets))
+		return
+	}
+	textGeneratedAssets := 0
+	for _, generatedAsset := range generatedAssets {
+		if generatedAsset.TemplateId == common.DocumentTextTemplateId {
+			textGeneratedAssets++
+			if generatedAsset.Location != "local:///3F6A9D12-7E4B-4C85-A1D0-8B2C5E7F9A34/"+common.DocumentTextTemplateId+"/0.txt" {
+				t.Errorf("Unexpected location for generated asset: %s", generatedAsset.Location)
+			}
+		}
+	}
+	if textGeneratedAssets != 1 {
+		t.Error("One document text generated asset expected:", textGeneratedAssets)
+	}
+
+	renderAgentConfigs = map[string]*config.RenderAgentConfig{
+		common.RenderAgentDocumentText: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+	}
+	rm = NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, common.NewTemporaryFileManager(), uploader, false, renderAgentConfigs)
+	_, _, err = rm.whichRenderAgent("pdf")
+	if err == nil {
+		t.Error("Expected supplemental render agents not to be routed to")
+	}
+}
+
+func TestSplitPdfText(t *testing.T) {
+	pageTexts := splitPdfText([]byte("first\fsecond\f\f"), 3)
+	if len(pageTexts) != 3 || string(pageTexts[0]) != "first" || string(pageTexts[1]) != "second" || string(pageTexts[2]) != "" {
+		t.Errorf("Unexpected page texts: %q", pageTexts)
+	}
+
+	pageTexts = splitPdfText([]byte("only\f"), 2)
+	if len(pageTexts) != 2 || string(pageTexts[0]) != "only" || len(pageTexts[1]) != 0 {
+		t.Errorf("Unexpected page texts: %q", pageTexts)
+	}
+}
@@ -0,0 +1,835 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultEmailLinesPerPage       = 60
+	defaultEmailMaxPages           = 10
+	defaultEmailMaxAttachments     = 20
+	defaultEmailMaxAttachmentSize  = 25
+	defaultEmailMaxAttachmentDepth = 3
+	// emailMaxPartDepth is the deepest nesting of multipart bodies that is read. Parts nested deeper are ignored.
+	emailMaxPartDepth = 10
+	// emailMaxBodySize is the number of bytes of the text or html body of a message that are read.
+	emailMaxBodySize = 1024 * 1024
+)
+
+// emailHeaders are the headers drawn at the top of the first page of an email message, in order.
+var emailHeaders = []string{"From", "To", "Cc", "Date", "Subject"}
+
+var (
+	emailHeaderColour     = color.RGBA{0x1f, 0x5f, 0xbf, 0xff}
+	emailSeparatorColour  = color.Gray{0xb0}
+	emailAttachmentColour = color.RGBA{0x6f, 0x3f, 0x9f, 0xff}
+)
+
+// emailRenderAgent previews eml messages and, once they have been converted with msgconvert, Outlook msg messages. Messages are converted into a derived source asset containing their headers, body and attachment list, which is drawn as pages of text. Html bodies are reduced to their text, so nothing they reference is loaded. Attachments are uploaded and registered as source assets of their own, so they are previewed like any other file.
+type emailRenderAgent struct {
+	baseRenderAgent
+	tempFileBasePath string
+	limits           emailLimits
+	processLimits    *processLimits
+}
+
+// emailLimits contains the number of lines drawn on each page, the number of pages drawn for each message, the number and size, in bytes, of the attachments registered for each message and how deeply attached messages are nested before their attachments are no longer registered.
+type emailLimits struct {
+	linesPerPage       int
+	maxPages           int
+	maxAttachments     int
+	maxAttachmentSize  int64
+	maxAttachmentDepth int
+}
+
+// emailMessage is the content of derived source assets of email messages.
+type emailMessage struct {
+	Headers     []emailHeader      `json:"headers"`
+	Body        []string           `json:"body"`
+	Attachments []*emailAttachment `json:"attachments"`
+}
+
+type emailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type emailAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	FileId      string `json:"fileId,omitempty"`
+	data        []byte
+}
+
+type emailRenderAgentFactory struct{}
+
+type emailRenderAgentConfig struct {
+	LinesPerPage       int   `json:"linesPerPage"`
+	MaxPages           int   `json:"maxPages"`
+	MaxAttachments     int   `json:"maxAttachments"`
+	MaxAttachmentSize  int64 `json:"maxAttachmentSize"`
+	MaxAttachmentDepth int   `json:"maxAttachmentDepth"`
+}
+
+func (factory *emailRenderAgentFactory) Name() string {
+	return common.RenderAgentEmail
+}
+
+func (factory *emailRenderAgentFactory) ConfigSection() string {
+	return "emailRenderAgent"
+}
+
+func (factory *emailRenderAgentFactory) TemplateIds() []string {
+	return []string{common.EmailConversionTemplateId}
+}
+
+func (factory *emailRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var emailConfig emailRenderAgentConfig
+	err := context.Config.Decode(&emailConfig)
+	if err != nil {
+		return nil, err
+	}
+	limits := newEmailLimits()
+	if emailConfig.LinesPerPage > 0 {
+		limits.linesPerPage = emailConfig.LinesPerPage
+	}
+	if emailConfig.MaxPages > 0 {
+		limits.maxPages = emailConfig.MaxPages
+	}
+	if emailConfig.MaxAttachments > 0 {
+		limits.maxAttachments = emailConfig.MaxAttachments
+	}
+	if emailConfig.MaxAttachmentSize > 0 {
+		limits.maxAttachmentSize = emailConfig.MaxAttachmentSize * 1024 * 1024
+	}
+	if emailConfig.MaxAttachmentDepth > 0 {
+		limits.maxAttachmentDepth = emailConfig.MaxAttachmentDepth
+	}
+	return newEmailRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.Config.BasePath, limits, newProcessLimits(context.Config), context.WorkChannel), nil
+}
+
+func newEmailLimits() emailLimits {
+	return emailLimits{
+		linesPerPage:       defaultEmailLinesPerPage,
+		maxPages:           defaultEmailMaxPages,
+		maxAttachments:     defaultEmailMaxAttachments,
+		maxAttachmentSize:  defaultEmailMaxAttachmentSize * 1024 * 1024,
+		maxAttachmentDepth: defaultEmailMaxAttachmentDepth,
+	}
+}
+
+func newEmailRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	tempFileBasePath string,
+	limits emailLimits,
+	processLimits *processLimits,
+	workChannel RenderAgentWorkChannel) RenderAgent {
+
+	renderAgent := new(emailRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentEmail, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.tempFileBasePath = tempFileBasePath
+	renderAgent.limits = limits
+	renderAgent.processLimits = processLimits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *emailRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	if generatedAsset.TemplateId == common.EmailConversionTemplateId {
+		renderAgent.convert(generatedAsset, sourceAsset, sourceFile, fileType, statusCallback)
+		return
+	}
+	renderAgent.renderPage(generatedAsset, sourceFile, statusCallback)
+}
+
+// convert reads an email message, registers its attachments and stores its headers, body and attachment list as a derived source asset. Pages are created for the message with the email templates.
+func (renderAgent *emailRenderAgent) convert(generatedAsset *common.GeneratedAsset, sourceAsset *common.SourceAsset, sourceFile common.TemporaryFile, fileType string, statusCallback chan generatedAssetUpdate) {
+	processLimits := renderAgent.processLimits
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err == nil && len(templates) > 0 {
+		processLimits = processLimits.forTemplate(templates[0])
+	}
+
+	var message *emailMessage
+	renderAgent.metrics.ConvertTime.Time(func() {
+		message, err = renderAgent.readMessage(processLimits, sourceFile.Path(), fileType)
+	})
+	if err != nil {
+		log.Println("error reading email message", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotReadEmail), nil}
+		return
+	}
+
+	renderAgent.registerAttachments(sourceAsset, message)
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+	destination := sourceFile.Path() + "-" + generatedAsset.TemplateId + ".json"
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+	err = ioutil.WriteFile(destination, data, 0644)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	pages := len(layoutEmail(message, renderAgent.limits))
+	emailSourceAsset, err := common.NewSourceAsset(sourceAsset.Id, common.SourceAssetTypeEmail)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+	emailSourceAsset.AddAttribute(common.SourceAssetAttributeSize, []string{strconv.Itoa(len(data))})
+	emailSourceAsset.AddAttribute(common.SourceAssetAttributePages, []string{strconv.Itoa(pages)})
+	emailSourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{generatedAsset.Location})
+	emailSourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{"json"})
+	renderAgent.sasm.Store(emailSourceAsset)
+
+	emailTemplates, err := renderAgent.templateManager.FindByIds(common.EmailTemplates)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	renderAgent.agentManager.CreateDerivedWork(emailSourceAsset, emailTemplates, 0, 1)
+	if pages > 1 {
+		// Create derived work for the pages after the first one that are rendered eagerly
+		renderAgent.agentManager.CreatePagedWork(emailSourceAsset, emailTemplates, pages)
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("fileSize", []string{strconv.Itoa(len(data))}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// registerAttachments uploads the attachments of a message and creates work for each of them as a source asset of its own. The id of an attachment's source asset is the id of the message's source asset followed by "-attachment-" and the index of the attachment. Attachments are only registered the first time a message is converted, and attachments over the size limit or after the attachment limit are listed but not registered.
+//
+// Attached messages have their attachments registered too, so each attachment carries its depth and the part of the attachment limit that the message does not use is shared between the messages attached to it. Messages nested deeper than the depth limit have no attachments registered, and no more than the attachment limit are registered for a message and every message nested in it.
+func (renderAgent *emailRenderAgent) registerAttachments(sourceAsset *common.SourceAsset, message *emailMessage) {
+	if sourceAsset.HasAttribute(common.SourceAssetAttributeAttachments) {
+		for index, fileId := range sourceAsset.GetAttribute(common.SourceAssetAttributeAttachments) {
+			if index < len(message.Attachments) {
+				message.Attachments[index].FileId = fileId
+			}
+		}
+		return
+	}
+
+	depth, limit := renderAgent.attachmentLimits(sourceAsset)
+	registered := make([]int, 0, 0)
+	messages := 0
+	for index, attachment := range message.Attachments {
+		if attachment.data == nil || len(registered) >= limit {
+			continue
+		}
+		registered = append(registered, index)
+		if isEmailFileType(attachmentFileType(attachment)) {
+			messages++
+		}
+	}
+	nestedLimit := 0
+	if messages > 0 {
+		nestedLimit = (limit - len(registered)) / messages
+	}
+
+	fileIds := make([]string, 0, 0)
+	for _, index := range registered {
+		attachment := message.Attachments[index]
+		fileId := fmt.Sprintf("%s-attachment-%d", sourceAsset.Id, index)
+		url := renderAgent.uploader.Url(sourceAsset, common.EmailAttachmentTemplate, int32(index))
+		err := renderAgent.uploadAttachment(url, attachment.data)
+		if err != nil {
+			log.Println("error uploading attachment", attachment.Name, err)
+			continue
+		}
+		fileType := attachmentFileType(attachment)
+		attachmentLimit := 0
+		if isEmailFileType(fileType) {
+			attachmentLimit = nestedLimit
+		}
+		attributes := []common.Attribute{
+			common.Attribute{Key: common.SourceAssetAttributeAttachmentDepth, Value: []string{strconv.Itoa(depth + 1)}},
+			common.Attribute{Key: common.SourceAssetAttributeAttachmentLimit, Value: []string{strconv.Itoa(attachmentLimit)}},
+		}
+		renderAgent.agentManager.CreateWorkWithAttributes(fileId, url, fileType, attachment.Size, attributes)
+		attachment.FileId = fileId
+		fileIds = append(fileIds, fileId)
+	}
+
+	attributes := []common.Attribute{common.Attribute{Key: common.SourceAssetAttributeAttachments, Value: fileIds}}
+	err := addSourceAssetAttributes(renderAgent.sasm, sourceAsset, attributes)
+	if err != nil {
+		log.Println("error storing attachments", err)
+	}
+}
+
+// attachmentLimits returns how deeply a message is nested in other messages and the number of its attachments that may be registered. Messages that are not attachments have a depth of 0 and the attachment limit of the render agent.
+func (renderAgent *emailRenderAgent) attachmentLimits(sourceAsset *common.SourceAsset) (int, int) {
+	depth, err := strconv.Atoi(firstAttribute(sourceAsset, common.SourceAssetAttributeAttachmentDepth))
+	if err != nil || depth < 1 {
+		return 0, renderAgent.limits.maxAttachments
+	}
+	if depth >= renderAgent.limits.maxAttachmentDepth {
+		return depth, 0
+	}
+	// Attachments detected as messages after they were registered were not given a share of the limit.
+	limit, err := strconv.Atoi(firstAttribute(sourceAsset, common.SourceAssetAttributeAttachmentLimit))
+	if err != nil || limit < 0 {
+		return depth, 0
+	}
+	if limit > renderAgent.limits.maxAttachments {
+		limit = renderAgent.limits.maxAttachments
+	}
+	return depth, limit
+}
+
+func isEmailFileType(fileType string) bool {
+	return fileType == "eml" || fileType == "msg"
+}
+
+func (renderAgent *emailRenderAgent) uploadAttachment(url string, data []byte) error {
+	file, err := ioutil.TempFile(renderAgent.tempFileBasePath, "attachment")
+	if err != nil {
+		return err
+	}
+	temporaryFile := renderAgent.temporaryFileManager.Create(file.Name())
+	defer temporaryFile.Release()
+
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return renderAgent.uploader.Upload(url, file.Name())
+}
+
+// attachmentFileType returns the file type of an attachment from its name or, when its name has no extension, its content type. Attachments of unknown types are given the "bin" file type, which is replaced by the detected file type when file types are detected.
+func attachmentFileType(attachment *emailAttachment) string {
+	fileType := normalizeFileType(path.Ext(attachment.Name))
+	if fileType != "" {
+		return fileType
+	}
+	if attachment.ContentType == "message/rfc822" {
+		return "eml"
+	}
+	extensions, err := mime.ExtensionsByType(attachment.ContentType)
+	if err == nil && len(extensions) > 0 {
+		return normalizeFileType(extensions[0])
+	}
+	return "bin"
+}
+
+// renderPage draws the page of the generated asset and resizes it to the template.
+func (renderAgent *emailRenderAgent) renderPage(generatedAsset *common.GeneratedAsset, sourceFile common.TemporaryFile, statusCallback chan generatedAssetUpdate) {
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	data, err := ioutil.ReadFile(sourceFile.Path())
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	var message emailMessage
+	err = json.Unmarshal(data, &message)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotReadEmail), nil}
+		return
+	}
+
+	pages := layoutEmail(&message, renderAgent.limits)
+	page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+	if page < 0 || page >= len(pages) {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotReadEmail), nil}
+		return
+	}
+
+	destination := sourceFile.Path() + "-" + template.Id + "-" + strconv.Itoa(page) + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	renderAgent.metrics.ConvertTime.Time(func() {
+		var pageImage image.Image
+		pageImage, err = drawTextPage(pages[page], renderAgent.limits.linesPerPage)
+		if err != nil {
+			return
+		}
+		resized := fit.apply(pageImage)
+		bounds = resized.Bounds()
+		err = encodeImage(renderAgent.processLimits.forTemplate(template), resized, destination, output)
+	})
+	if err != nil {
+		log.Println("error drawing email page", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+	}
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// readMessage reads an eml message, converting msg messages into the eml format with msgconvert first.
+func (renderAgent *emailRenderAgent) readMessage(processLimits *processLimits, source, fileType string) (*emailMessage, error) {
+	if strings.ToLower(fileType) == "msg" {
+		destination, err := ioutil.TempDir(renderAgent.tempFileBasePath, "email")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(destination)
+
+		source, err = convertMsgToEml(processLimits, source, destination)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readEmailMessage(file, renderAgent.limits)
+}
+
+// convertMsgToEml converts an Outlook msg message into the eml format with msgconvert and returns the path of the converted file.
+func convertMsgToEml(limits *processLimits, source, destination string) (string, error) {
+	_, err := exec.LookPath("msgconvert")
+	if err != nil {
+		log.Println("msgconvert command not found")
+		return "", err
+	}
+
+	converted := filepath.Join(destination, "message.eml")
+	cmd := limits.command("msgconvert", "--outfile", converted, source)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(buf.String())
+		return "", err
+	}
+	return converted, nil
+}
+
+// readEmailMessage parses an RFC 822 message with a MIME body. The first text/plain part is used as the body, falling back to the text of the first text/html part. Every other part is an attachment, and the contents of attachments no larger than the attachment size limit are kept so that they can be registered.
+func readEmailMessage(reader io.Reader, limits emailLimits) (*emailMessage, error) {
+	parsed, err := mail.ReadMessage(bufio.NewReader(reader))
+	if err != nil {
+		return nil, err
+	}
+
+	message := &emailMessage{Headers: make([]emailHeader, 0), Body: make([]string, 0), Attachments: make([]*emailAttachment, 0)}
+	for _, name := range emailHeaders {
+		value := parsed.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		message.Headers = append(message.Headers, emailHeader{name, decodeEmailHeader(value)})
+	}
+
+	parts := &emailParts{limits: limits, message: message}
+	err = parts.read(textproto.MIMEHeader(parsed.Header), parsed.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	body := parts.plain
+	if strings.TrimSpace(body) == "" && parts.html != "" {
+		body = htmlToText(parts.html)
+	}
+	message.Body = emailBodyLines(body, limits.linesPerPage*limits.maxPages)
+	return message, nil
+}
+
+// emailParts collects the body and attachments of a message as its parts are read.
+type emailParts struct {
+	limits  emailLimits
+	message *emailMessage
+	plain   string
+	html    string
+}
+
+func (parts *emailParts) read(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= emailMaxPartDepth {
+			return nil
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = parts.read(part.Header, part, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	decoded := decodeTransferEncoding(body, header.Get("Content-Transfer-Encoding"))
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := dispositionParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	name = decodeEmailHeader(name)
+
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if isText && disposition != "attachment" && name == "" {
+		text, err := readEmailText(decoded, params["charset"])
+		if err != nil {
+			return err
+		}
+		if mediaType == "text/plain" && parts.plain == "" {
+			parts.plain = text
+		} else if mediaType == "text/html" && parts.html == "" {
+			parts.html = text
+		}
+		return nil
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("attachment-%d", len(parts.message.Attachments)+1)
+		if mediaType == "message/rfc822" {
+			name += ".eml"
+		}
+	}
+	attachment := &emailAttachment{Name: path.Base(strings.Replace(name, "\\", "/", -1)), ContentType: mediaType}
+	data, err := ioutil.ReadAll(io.LimitReader(decoded, parts.limits.maxAttachmentSize+1))
+	if err != nil {
+		return err
+	}
+	attachment.Size = int64(len(data))
+	if attachment.Size > parts.limits.maxAttachmentSize {
+		remaining, err := io.Copy(ioutil.Discard, decoded)
+		if err != nil {
+			return err
+		}
+		attachment.Size += remaining
+	} else {
+		attachment.data = data
+	}
+	parts.message.Attachments = append(parts.message.Attachments, attachment)
+	return nil
+}
+
+func decodeTransferEncoding(reader io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &emailBase64Reader{reader})
+	case "quoted-printable":
+		return quotedprintable.NewReader(reader)
+	}
+	return reader
+}
+
+// emailBase64Reader drops the line breaks and other whitespace that base64 encoded parts are wrapped with.
+type emailBase64Reader struct {
+	reader io.Reader
+}
+
+func (reader *emailBase64Reader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// readEmailText reads up to emailMaxBodySize bytes of a text part as utf-8.
+func readEmailText(reader io.Reader, label string) (string, error) {
+	if label != "" {
+		converted, err := charset.NewReaderLabel(label, reader)
+		if err == nil {
+			reader = converted
+		}
+	}
+	text, err := ioutil.ReadAll(io.LimitReader(reader, emailMaxBodySize))
+	return string(text), err
+}
+
+// decodeEmailHeader decodes the RFC 2047 encoded words of a header value. Values that cannot be decoded are returned as they are.
+func decodeEmailHeader(value string) string {
+	decoder := &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+	decoded, err := decoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// htmlToText returns the text of an html document with block elements on lines of their own. Scripts, styles and the document head are dropped and nothing the document references is loaded.
+func htmlToText(document string) string {
+	var text bytes.Buffer
+	skip := 0
+	newline := func() {
+		if text.Len() > 0 && !bytes.HasSuffix(text.Bytes(), []byte("\n")) {
+			text.WriteString("\n")
+		}
+	}
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head", "title":
+				if tokenType == html.StartTagToken {
+					skip++
+				} else if tokenType == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case "br":
+				text.WriteString("\n")
+			case "p", "div", "tr", "table", "ul", "ol", "blockquote", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "pre":
+				newline()
+				if string(name) == "p" && tokenType == html.EndTagToken {
+					text.WriteString("\n")
+				}
+			case "li":
+				newline()
+				if tokenType == html.StartTagToken {
+					text.WriteString("* ")
+				}
+			case "td", "th":
+				if tokenType == html.EndTagToken {
+					text.WriteString(" ")
+				}
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			raw := string(tokenizer.Text())
+			fields := strings.Fields(raw)
+			if len(fields) == 0 {
+				continue
+			}
+			if text.Len() > 0 && !bytes.HasSuffix(text.Bytes(), []byte("\n")) && !bytes.HasSuffix(text.Bytes(), []byte(" ")) && strings.TrimLeft(raw, " \t\r\n") != raw {
+				text.WriteString(" ")
+			}
+			text.WriteString(strings.Join(fields, " "))
+			if strings.TrimRight(raw, " \t\r\n") != raw {
+				text.WriteString(" ")
+			}
+		}
+	}
+}
+
+// emailBodyLines splits a body into up to maxLines lines with tabs expanded and trailing whitespace removed.
+func emailBodyLines(body string, maxLines int) []string {
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	lines := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimRight(body, "\r\n\t "), "\n") {
+		if len(lines) >= maxLines {
+			break
+		}
+		line = strings.Replace(line, "\t", strings.Repeat(" ", textTabWidth), -1)
+		lines = append(lines, strings.TrimRight(line, " \r"))
+	}
+	return lines
+}
+
+// layoutEmail lays out the headers, body and attachment list of a message as pages of lines. Long lines are wrapped to the page width. At least one page and no more than the page limit are returned.
+func layoutEmail(message *emailMessage, limits emailLimits) [][][]textRun {
+	lines := make([][]textRun, 0)
+	for _, header := range message.Headers {
+		label := header.Name + ": "
+		for index, wrapped := range wrapEmailLine(header.Value, textColumns-len(label)) {
+			if index == 0 {
+				lines = append(lines, []textRun{textRun{label, emailHeaderColour}, textRun{wrapped, color.Black}})
+			} else {
+				lines = append(lines, []textRun{textRun{strings.Repeat(" ", len(label)) + wrapped, color.Black}})
+			}
+		}
+	}
+	lines = append(lines, []textRun{textRun{strings.Repeat("-", textColumns), emailSeparatorColour}})
+
+	for _, line := range message.Body {
+		for _, wrapped := range wrapEmailLine(line, textColumns) {
+			lines = append(lines, []textRun{textRun{wrapped, color.Black}})
+		}
+	}
+
+	if len(message.Attachments) > 0 {
+		lines = append(lines, nil)
+		lines = append(lines, []textRun{textRun{fmt.Sprintf("Attachments (%d)", len(message.Attachments)), emailAttachmentColour}})
+		for _, attachment := range message.Attachments {
+			for _, wrapped := range wrapEmailLine(attachment.Name+"  "+formatArchiveSize(attachment.Size), textColumns-2) {
+				lines = append(lines, []textRun{textRun{"  " + wrapped, color.Black}})
+			}
+		}
+	}
+
+	pages := make([][][]textRun, 0)
+	for start := 0; start < len(lines) && len(pages) < limits.maxPages; start += limits.linesPerPage {
+		end := start + limits.linesPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, lines[start:end])
+	}
+	return pages
+}
+
+// wrapEmailLine splits a line into lines no longer than the width, breaking at the last space when there is one.
+func wrapEmailLine(line string, width int) []string {
+	runes := []rune(line)
+	wrapped := make([]string, 0, 1)
+	for len(runes) > width {
+		split := width
+		for index := width; index > width/2; index-- {
+			if runes[index] == ' ' {
+				split = index
+				break
+			}
+		}
+		wrapped = append(wrapped, strings.TrimRight(string(runes[:split]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[split:]), " "))
+	}
+	return append(wrapped, string(runes))
+}
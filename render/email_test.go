@@ -0,0 +1,274 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEmail = "From: =?UTF-8?Q?Ren=C3=A9e_Example?= <renee@example.com>\r\n" +
+	"To: team@example.com\r\n" +
+	"Subject: =?UTF-8?B?UXVhcnRlcmx5IHJlcG9ydA==?=\r\n" +
+	"Date: Mon, 2 Mar 2015 09:30:00 -0800\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=\"iso-8859-1\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Hello caf=E9,\r\n" +
+	"\tThe report is attached.\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=\"utf-8\"\r\n" +
+	"\r\n" +
+	"<p>Hello</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"ignored.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename*=UTF-8''r%C3%A9port.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\n" +
+	"LjQK\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"Subject: Forwarded\r\n" +
+	"\r\n" +
+	"Forwarded body\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Disposition: attachment; filename=\"../../large.png\"\r\n" +
+	"\r\n" +
+	"0123456789abcdef\r\n" +
+	"--outer--\r\n"
+
+func TestReadEmailMessage(t *testing.T) {
+	limits := newEmailLimits()
+	limits.maxAttachmentSize = 12
+	message, err := readEmailMessage(strings.NewReader(testEmail), limits)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	expectedHeaders := []emailHeader{
+		emailHeader{"From", "Renée Example <renee@example.com>"},
+		emailHeader{"To", "team@example.com"},
+		emailHeader{"Date", "Mon, 2 Mar 2015 09:30:00 -0800"},
+		emailHeader{"Subject", "Quarterly report"},
+	}
+	if !reflect.DeepEqual(message.Headers, expectedHeaders) {
+		t.Errorf("Unexpected headers: %v", message.Headers)
+	}
+	expectedBody := []string{"Hello café,", "    The report is attached."}
+	if !reflect.DeepEqual(message.Body, expectedBody) {
+		t.Errorf("Unexpected body: %q", message.Body)
+	}
+
+	if len(message.Attachments) != 3 {
+		t.Errorf("Unexpected attachments: %v", message.Attachments)
+		return
+	}
+	report := message.Attachments[0]
+	if report.Name != "réport.pdf" || report.ContentType != "application/pdf" || report.Size != 9 || string(report.data) != "%PDF-1.4\n" {
+		t.Errorf("Unexpected attachment: %+v", report)
+	}
+	forwarded := message.Attachments[1]
+	if forwarded.Name != "attachment-2.eml" || forwarded.ContentType != "message/rfc822" || forwarded.Size != 36 || forwarded.data != nil {
+		t.Errorf("Unexpected attachment: %+v", forwarded)
+	}
+	large := message.Attachments[2]
+	if large.Name != "large.png" || large.Size != 16 || large.data != nil {
+		t.Errorf("Unexpected attachment: %+v", large)
+	}
+}
+
+func TestReadEmailMessageHtmlBody(t *testing.T) {
+	email := "Subject: Html\r\nContent-Type: text/html\r\n\r\n<html><head><title>Ignored</title><style>p { color: red; }</style></head>" +
+		"<body><p>First  paragraph with <b>bold</b> text.</p><script>alert(1)</script><ul><li>One</li><li>Two &amp; three</li></ul>Line<br>break<img src=\"http://example.com/a.png\"></body></html>"
+	message, err := readEmailMessage(strings.NewReader(email), newEmailLimits())
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	expectedBody := []string{"First paragraph with bold text.", "", "* One", "* Two & three", "Line", "break"}
+	if !reflect.DeepEqual(message.Body, expectedBody) {
+		t.Errorf("Unexpected body: %q", message.Body)
+	}
+	if len(message.Attachments) != 0 {
+		t.Errorf("Unexpected attachments: %v", message.Attachments)
+	}
+}
+
+func TestLayoutEmail(t *testing.T) {
+	message := &emailMessage{
+		Headers:     []emailHeader{emailHeader{"Subject", strings.Repeat("word ", 30)}},
+		Body:        make([]string, 0),
+		Attachments: []*emailAttachment{&emailAttachment{Name: "report.pdf", Size: 2048}},
+	}
+	for index := 0; index < 30; index++ {
+		message.Body = append(message.Body, "line")
+	}
+	limits := newEmailLimits()
+	limits.linesPerPage = 10
+
+	pages := layoutEmail(message, limits)
+	if len(pages) != 4 || len(pages[3]) != 6 {
+		t.Errorf("Unexpected pages: %d", len(pages))
+		return
+	}
+	if pages[0][0][0].text != "Subject: " || !strings.HasPrefix(pages[0][1][0].text, "         word word") {
+		t.Errorf("Unexpected header lines: %q %q", pages[0][0][1].text, pages[0][1][0].text)
+	}
+	if pages[3][4][0].text != "Attachments (1)" || pages[3][5][0].text != "  report.pdf  2.0 KB" {
+		t.Errorf("Unexpected attachment lines: %v", pages[3])
+	}
+
+	limits.maxPages = 2
+	if len(layoutEmail(message, limits)) != 2 {
+		t.Error("Expected the pages to be limited")
+	}
+	if len(layoutEmail(&emailMessage{}, limits)) != 1 {
+		t.Error("Expected a page for an empty message")
+	}
+}
+
+func TestWrapEmailLine(t *testing.T) {
+	if lines := wrapEmailLine("", 10); !reflect.DeepEqual(lines, []string{""}) {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+	if lines := wrapEmailLine("the quick brown fox", 10); !reflect.DeepEqual(lines, []string{"the quick", "brown fox"}) {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+	if lines := wrapEmailLine("abcdefghijklmnop", 10); !reflect.DeepEqual(lines, []string{"abcdefghij", "klmnop"}) {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+}
+
+func TestAttachmentFileType(t *testing.T) {
+	attachments := map[string]*emailAttachment{
+		"pdf":  &emailAttachment{Name: "Report.PDF", ContentType: "application/octet-stream"},
+		"eml":  &emailAttachment{Name: "attachment-1", ContentType: "message/rfc822"},
+		"png":  &emailAttachment{Name: "image", ContentType: "image/png"},
+		"bin":  &emailAttachment{Name: "data", ContentType: "application/x-unknown-type"},
+		"docx": &emailAttachment{Name: "notes.docx", ContentType: "application/octet-stream"},
+	}
+	for expected, attachment := range attachments {
+		if fileType := attachmentFileType(attachment); fileType != expected {
+			t.Errorf("Unexpected file type for %s: %s", attachment.Name, fileType)
+		}
+	}
+}
+
+func TestEmailRegisterAttachments(t *testing.T) {
+	directory, err := ioutil.TempDir("", "email")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	tfm := common.NewTemporaryFileManager()
+	uploader := common.NewLocalUploader(directory)
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentImageMagick: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, tfm, uploader, false, renderAgentConfigs)
+
+	renderAgent := new(emailRenderAgent)
+	renderAgent.agentManager = rm
+	renderAgent.sasm = sasm
+	renderAgent.uploader = uploader
+	renderAgent.temporaryFileManager = tfm
+	renderAgent.tempFileBasePath = directory
+	renderAgent.limits = newEmailLimits()
+	renderAgent.limits.maxAttachmentSize = 12
+
+	sourceAssetId := "8E3C1A57-4B92-4D06-9F7A-2C5E8B1D3F64"
+	sourceAsset, _ := common.NewSourceAsset(sourceAssetId, common.SourceAssetTypeOrigin)
+	sourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{"eml"})
+	sasm.Store(sourceAsset)
+
+	message, err := readEmailMessage(strings.NewReader(testEmail), renderAgent.limits)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	renderAgent.registerAttachments(sourceAsset, message)
+
+	expectedIds := []string{sourceAssetId + "-attachment-0"}
+	if !reflect.DeepEqual(sourceAsset.GetAttribute(common.SourceAssetAttributeAttachments), expectedIds) {
+		t.Errorf("Unexpected attachments attribute: %v", sourceAsset.GetAttribute(common.SourceAssetAttributeAttachments))
+	}
+	if message.Attachments[0].FileId != expectedIds[0] || message.Attachments[2].FileId != "" {
+		t.Errorf("Unexpected attachment file ids: %v", message.Attachments)
+	}
+
+	attachmentAssets, err := sasm.FindBySourceAssetId(expectedIds[0])
+	if err != nil || len(attachmentAssets) != 1 {
+		t.Errorf("Expected a source asset for the attachment: %v", err)
+		return
+	}
+	url := firstAttribute(attachmentAssets[0], common.SourceAssetAttributeSource)
+	data, err := ioutil.ReadFile(filepath.Join(directory, strings.TrimPrefix(url, "local://")))
+	if err != nil || string(data) != "%PDF-1.4\n" {
+		t.Errorf("Unexpected uploaded attachment at %s: %q %v", url, data, err)
+	}
+	if firstAttribute(attachmentAssets[0], common.SourceAssetAttributeType) != "pdf" {
+		t.Errorf("Unexpected attachment attributes: %v", attachmentAssets[0].Attributes)
+	}
+	if len(findGeneratedAssets(gasm, expectedIds[0])) == 0 {
+		t.Error("Expected work to be created for the attachment")
+	}
+
+	message.Attachments[0].FileId = ""
+	renderAgent.registerAttachments(sourceAsset, message)
+	if message.Attachments[0].FileId != expectedIds[0] {
+		t.Error("Expected the registered attachments to be reused")
+	}
+	sourceAssets, _ := sasm.FindBySourceAssetId(sourceAssetId + "-attachment-1")
+	if len(sourceAssets) != 0 {
+		t.Errorf("Unexpected source asset for an attachment over the size limit: %v", sourceAssets)
+	}
+
+	// Attached messages share the attachment limit of the message they are attached to.
+	renderAgent.limits.maxAttachmentSize = 1024
+	nestedId := "5D1F7B29-8C4E-4A63-B0D5-E29A6C3F8B17"
+	nested, _ := common.NewSourceAsset(nestedId, common.SourceAssetTypeOrigin)
+	nested.AddAttribute(common.SourceAssetAttributeAttachmentDepth, []string{"1"})
+	nested.AddAttribute(common.SourceAssetAttributeAttachmentLimit, []string{"2"})
+	sasm.Store(nested)
+	message, _ = readEmailMessage(strings.NewReader(testEmail), renderAgent.limits)
+	renderAgent.registerAttachments(nested, message)
+	if len(nested.GetAttribute(common.SourceAssetAttributeAttachments)) != 2 {
+		t.Errorf("Expected the attachments to be limited: %v", nested.GetAttribute(common.SourceAssetAttributeAttachments))
+	}
+	attachmentAssets, _ = sasm.FindBySourceAssetId(nestedId + "-attachment-1")
+	if len(attachmentAssets) != 1 || firstAttribute(attachmentAssets[0], common.SourceAssetAttributeAttachmentDepth) != "2" || firstAttribute(attachmentAssets[0], common.SourceAssetAttributeAttachmentLimit) != "0" {
+		t.Errorf("Unexpected attached message: %v", attachmentAssets)
+	}
+
+	renderAgent.limits.maxAttachmentDepth = 2
+	depth, limit := renderAgent.attachmentLimits(attachmentAssets[0])
+	if depth != 2 || limit != 0 {
+		t.Errorf("Expected no attachments to be registered past the depth limit: %d %d", depth, limit)
+	}
+	depth, limit = renderAgent.attachmentLimits(sourceAsset)
+	if depth != 0 || limit != renderAgent.limits.maxAttachments {
+		t.Errorf("Unexpected limits of a message that is not attached: %d %d", depth, limit)
+	}
+}
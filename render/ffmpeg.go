@@ -0,0 +1,669 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hlsAudioBitrate is the bitrate, in kilobits per second, of the audio of every stream of the HLS ladder.
+const hlsAudioBitrate = 96
+
+// hlsRendition describes one stream of the HLS ladder created by the ffmpeg render agent. Videos are scaled to fit within the width and height, keeping their aspect ratio, and are never scaled up. The level is the H.264 level the stream is encoded with and videoCodec is its codec in the form used by the CODECS attribute of HLS playlists.
+type hlsRendition struct {
+	label        string
+	width        int
+	height       int
+	videoBitrate int
+	level        string
+	videoCodec   string
+}
+
+// hlsLadder contains the same streams as the Zencoder settings created by util.BuildZencoderSettings.
+var hlsLadder = []hlsRendition{
+	hlsRendition{"hls_600", 640, 360, 600, "3.1", "avc1.4d401f"},
+	hlsRendition{"hls_1200", 1280, 720, 1200, "4.0", "avc1.4d4028"},
+}
+
+// videoInfo contains the properties of a video reported by ffprobe.
+type videoInfo struct {
+	width    int
+	height   int
+	hasAudio bool
+}
+
+// maxSpriteFrames is the largest number of frames drawn onto a sprite sheet, used when the template has no maxFrames attribute or a larger one.
+const maxSpriteFrames = 400
+
+// defaultPosterFrameOffsets are the offsets, in seconds, of the frames considered for poster frames when no offset is configured. The first frame that is not black is used.
+var defaultPosterFrameOffsets = []float64{1, 3, 5, 10, 30, 0}
+
+// ffmpegRenderAgent transcodes videos into HLS streams with a local ffmpeg executable and uploads the streams with the uploader.
+type ffmpegRenderAgent struct {
+	baseRenderAgent
+	tempFileBasePath   string
+	posterFrameOffsets []float64
+	limits             *processLimits
+}
+
+type ffmpegRenderAgentFactory struct{}
+
+type ffmpegRenderAgentConfig struct {
+	PosterFrameOffset float64 `json:"posterFrameOffset"`
+}
+
+func (factory *ffmpegRenderAgentFactory) Name() string {
+	return common.RenderAgentFfmpeg
+}
+
+func (factory *ffmpegRenderAgentFactory) ConfigSection() string {
+	return "ffmpegRenderAgent"
+}
+
+func (factory *ffmpegRenderAgentFactory) TemplateIds() []string {
+	return []string{common.FfmpegVideoConversionTemplateId, common.VideoPosterFrameTemplateId, common.VideoSpriteSheetTemplateId}
+}
+
+func (factory *ffmpegRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var ffmpegConfig ffmpegRenderAgentConfig
+	err := context.Config.Decode(&ffmpegConfig)
+	if err != nil {
+		return nil, err
+	}
+	posterFrameOffsets := defaultPosterFrameOffsets
+	if ffmpegConfig.PosterFrameOffset > 0 {
+		posterFrameOffsets = []float64{ffmpegConfig.PosterFrameOffset}
+	}
+	return newFfmpegRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.Config.BasePath, posterFrameOffsets, context.WorkChannel, newProcessLimits(context.Config)), nil
+}
+
+func newFfmpegRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	tempFileBasePath string,
+	posterFrameOffsets []float64,
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits) RenderAgent {
+
+	renderAgent := new(ffmpegRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentFfmpeg, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.tempFileBasePath = tempFileBasePath
+	renderAgent.posterFrameOffsets = posterFrameOffsets
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *ffmpegRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if !hasFileTypeCount {
+		log.Println("FfmpegRenderAgent doesn't support filetype", fileType)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoRenderersSupportFileType), nil}
+		return
+	}
+	fileTypeCount.Inc(1)
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	limits := renderAgent.limits
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err == nil && len(templates) > 0 {
+		limits = limits.forTemplate(templates[0])
+	}
+
+	switch generatedAsset.TemplateId {
+	case common.VideoPosterFrameTemplateId:
+		renderAgent.renderPosterFrame(generatedAsset, sourceAsset, sourceFile, limits, statusCallback)
+		return
+	case common.VideoSpriteSheetTemplateId:
+		renderAgent.renderSpriteSheet(generatedAsset, sourceFile, limits, statusCallback)
+		return
+	}
+
+	destination, err := ioutil.TempDir(renderAgent.tempFileBasePath, generatedAsset.Id)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+	defer os.RemoveAll(destination)
+
+	// The playlists and segments are uploaded next to the location of the generated asset, which is the master playlist.
+	locationBase, playlistName := splitLocation(generatedAsset.Location)
+	stem := strings.TrimSuffix(playlistName, ".m3u8")
+
+	renderAgent.metrics.ConvertTime.Time(func() {
+		err = renderAgent.transcode(limits, sourceFile.Path(), destination, stem)
+	})
+	if err != nil {
+		log.Println("error transcoding video", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	files, err := ioutil.ReadDir(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+	for _, file := range files {
+		err = renderAgent.uploader.Upload(locationBase+file.Name(), filepath.Join(destination, file.Name()))
+		if err != nil {
+			statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+			return
+		}
+	}
+
+	newAttributes := make([]common.Attribute, 0, 0)
+	if util.IsS3Url(generatedAsset.Location) {
+		newAttributes = append(newAttributes, generatedAsset.AddAttribute("streamingUrl", []string{util.S3ToHttps(generatedAsset.Location)}))
+	}
+
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// renderPosterFrame creates a poster frame for a video and stores it as a derived source asset. The default templates are rendered from the poster frame, giving videos the same thumbnails as images and documents.
+func (renderAgent *ffmpegRenderAgent) renderPosterFrame(generatedAsset *common.GeneratedAsset, sourceAsset *common.SourceAsset, sourceFile common.TemporaryFile, limits *processLimits, statusCallback chan generatedAssetUpdate) {
+	destination := sourceFile.Path() + "-" + generatedAsset.TemplateId + ".jpg"
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var err error
+	var offset float64
+	renderAgent.metrics.ConvertTime.Time(func() {
+		offset, err = renderAgent.posterFrame(limits, sourceFile.Path(), destination)
+	})
+	if err != nil {
+		log.Println("error creating poster frame", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	posterFrameFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	posterFrameSourceAsset, err := common.NewSourceAsset(sourceAsset.Id, common.SourceAssetTypePosterFrame)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+	posterFrameSourceAsset.AddAttribute(common.SourceAssetAttributeSize, []string{strconv.FormatInt(posterFrameFileSize, 10)})
+	posterFrameSourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{generatedAsset.Location})
+	posterFrameSourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{"jpg"})
+	renderAgent.sasm.Store(posterFrameSourceAsset)
+
+	legacyDefaultTemplates, err := renderAgent.templateManager.FindByIds(common.LegacyDefaultTemplates)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	renderAgent.agentManager.CreateDerivedWork(posterFrameSourceAsset, legacyDefaultTemplates, 0, 1)
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("offset", []string{strconv.FormatFloat(offset, 'f', -1, 64)}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(posterFrameFileSize, 10)}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// posterFrame extracts the frame at the first of the poster frame offsets that is not black to the destination. If every frame is black, the first frame extracted is used. The offset of the frame is returned.
+func (renderAgent *ffmpegRenderAgent) posterFrame(limits *processLimits, source, destination string) (float64, error) {
+	_, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		log.Println("ffmpeg command not found")
+		return 0, err
+	}
+
+	candidates := make([]string, 0, len(renderAgent.posterFrameOffsets))
+	offsets := make([]float64, 0, len(renderAgent.posterFrameOffsets))
+	defer func() {
+		for _, candidate := range candidates {
+			os.Remove(candidate)
+		}
+	}()
+
+	for index, offset := range renderAgent.posterFrameOffsets {
+		candidate := fmt.Sprintf("%s-%d.jpg", destination, index)
+		cmd := limits.command("ffmpeg", "-y", "-ss", strconv.FormatFloat(offset, 'f', -1, 64), "-i", source, "-frames:v", "1", "-q:v", "2", candidate)
+		log.Println(cmd)
+
+		var buf bytes.Buffer
+		cmd.Stdout = &buf
+		cmd.Stderr = &buf
+
+		// Offsets past the end of the video do not create a frame.
+		err = limits.run(cmd)
+		if err == errProcessTimedOut {
+			return 0, err
+		}
+		if err != nil || !util.CanLoadFile(candidate) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+		offsets = append(offsets, offset)
+
+		black, err := isBlackFrame(candidate)
+		if err == nil && !black {
+			return offset, os.Rename(candidate, destination)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return 0, common.ErrorCouldNotResizeImage
+	}
+	return offsets[0], os.Rename(candidates[0], destination)
+}
+
+// isBlackFrame returns true if the average luminance of an image is close to black.
+func isBlackFrame(path string) (bool, error) {
+	frame, err := decodeImageFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	bounds := frame.Bounds()
+	step := bounds.Dx() / 64
+	if step < 1 {
+		step = 1
+	}
+	var total, count uint64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			total += uint64(color.GrayModel.Convert(frame.At(x, y)).(color.Gray).Y)
+			count++
+		}
+	}
+	if count == 0 {
+		return true, nil
+	}
+	return total/count < 16, nil
+}
+
+// renderSpriteSheet creates a sprite sheet of video frames taken at the template interval and a WebVTT thumbnail track mapping time ranges to regions of the sprite sheet. The sprite sheet is uploaded to the location of the generated asset and the track is uploaded next to it with the ".vtt" extension.
+func (renderAgent *ffmpegRenderAgent) renderSpriteSheet(generatedAsset *common.GeneratedAsset, sourceFile common.TemporaryFile, limits *processLimits, statusCallback chan generatedAssetUpdate) {
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil || len(templates) != 1 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	sprite, err := newSpriteSheet(templates[0])
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+
+	destination, err := ioutil.TempDir(renderAgent.tempFileBasePath, generatedAsset.Id)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+	defer os.RemoveAll(destination)
+
+	locationBase, spriteName := splitLocation(generatedAsset.Location)
+	spritePath := filepath.Join(destination, spriteName)
+	trackPath := spritePath + ".vtt"
+
+	var frameCount int
+	renderAgent.metrics.ConvertTime.Time(func() {
+		var frames []string
+		frames, err = sprite.extractFrames(limits, sourceFile.Path(), destination)
+		if err != nil {
+			return
+		}
+		frameCount = len(frames)
+		var tileWidth, tileHeight int
+		tileWidth, tileHeight, err = sprite.compose(frames, spritePath)
+		if err != nil {
+			return
+		}
+		err = ioutil.WriteFile(trackPath, sprite.webVtt(spriteName, frameCount, tileWidth, tileHeight), 0644)
+	})
+	if err != nil {
+		log.Println("error creating sprite sheet", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, spritePath)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+	trackLocation := locationBase + spriteName + ".vtt"
+	err = renderAgent.uploader.Upload(trackLocation, trackPath)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	spriteFileSize, err := util.FileSize(spritePath)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeVttUrl, []string{thumbnailTrackUrl(trackLocation)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeFrameCount, []string{strconv.Itoa(frameCount)}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(spriteFileSize, 10)}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// thumbnailTrackUrl returns the URL that a thumbnail track stored at a location is served from. Tracks uploaded to S3 are served from S3 and local tracks are served from the asset API as a file next to the sprite sheet.
+func thumbnailTrackUrl(location string) string {
+	if util.IsS3Url(location) {
+		return util.S3ToHttps(location)
+	}
+	if util.IsLocalUrl(location) {
+		base, name := splitLocation(location[8:])
+		return "/asset" + base + strings.TrimSuffix(name, ".vtt") + "/" + name
+	}
+	return location
+}
+
+// transcode creates a stream for each rendition of the HLS ladder and a master playlist named after the stem in the destination directory.
+func (renderAgent *ffmpegRenderAgent) transcode(limits *processLimits, source, destination, stem string) error {
+	_, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		log.Println("ffmpeg command not found")
+		return err
+	}
+
+	info, err := probeVideo(limits, source)
+	if err != nil {
+		return err
+	}
+
+	for _, rendition := range hlsLadder {
+		renditionName := stem + "_" + rendition.label
+		width, height := rendition.size(info.width, info.height)
+		bitrate := strconv.Itoa(rendition.videoBitrate) + "k"
+		cmd := limits.command(
+			"ffmpeg", "-y", "-i", source,
+			"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+			"-c:v", "libx264", "-profile:v", "main", "-level", rendition.level, "-b:v", bitrate, "-maxrate", bitrate, "-bufsize", strconv.Itoa(rendition.videoBitrate*2)+"k",
+			"-c:a", "aac", "-b:a", strconv.Itoa(hlsAudioBitrate)+"k", "-ac", "2",
+			"-f", "hls", "-hls_time", "10", "-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(destination, renditionName+"_%05d.ts"),
+			filepath.Join(destination, renditionName+".m3u8"))
+		log.Println(cmd)
+
+		var buf bytes.Buffer
+		cmd.Stdout = &buf
+		cmd.Stderr = &buf
+
+		err = limits.run(cmd)
+		if err != nil {
+			log.Println(buf.String())
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(filepath.Join(destination, stem+".m3u8"), hlsMasterPlaylist(stem, info), 0644)
+}
+
+// size returns the size of a video scaled to fit within the rendition. Both dimensions are even, as required by H.264. Videos of an unknown size are given the size of the rendition.
+func (rendition hlsRendition) size(width, height int) (int, int) {
+	if width < 1 || height < 1 {
+		return rendition.width, rendition.height
+	}
+	scale := math.Min(float64(rendition.width)/float64(width), float64(rendition.height)/float64(height))
+	if scale < 1 {
+		width = int(math.Floor(float64(width)*scale + 0.5))
+		height = int(math.Floor(float64(height)*scale + 0.5))
+	}
+	width, height = width/2*2, height/2*2
+	if width < 2 {
+		width = 2
+	}
+	if height < 2 {
+		height = 2
+	}
+	return width, height
+}
+
+// hlsMasterPlaylist returns the master playlist of the streams of the HLS ladder created for a video, with the bandwidth, resolution and codecs of each stream.
+func hlsMasterPlaylist(stem string, info *videoInfo) []byte {
+	var playlist bytes.Buffer
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range hlsLadder {
+		width, height := rendition.size(info.width, info.height)
+		bandwidth := rendition.videoBitrate
+		codecs := rendition.videoCodec
+		if info.hasAudio {
+			bandwidth += hlsAudioBitrate
+			codecs += ",mp4a.40.2"
+		}
+		playlist.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"\n%s_%s.m3u8\n", bandwidth*1000, width, height, codecs, stem, rendition.label))
+	}
+	return playlist.Bytes()
+}
+
+// probeVideo reads the size of the first video stream of a video and whether it has audio with ffprobe.
+func probeVideo(limits *processLimits, source string) (*videoInfo, error) {
+	_, err := exec.LookPath("ffprobe")
+	if err != nil {
+		log.Println("ffprobe command not found")
+		return nil, err
+	}
+
+	cmd := limits.command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_streams", source)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+
+	err = limits.run(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseVideoInfo(buf.Bytes())
+}
+
+// parseVideoInfo reads the size of the first video stream from the JSON output of ffprobe. Video streams that are attached pictures, such as cover art, are ignored.
+func parseVideoInfo(data []byte) (*videoInfo, error) {
+	var probe ffprobeOutput
+	err := json.Unmarshal(data, &probe)
+	if err != nil {
+		return nil, err
+	}
+
+	info := new(videoInfo)
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if info.width == 0 && stream.Disposition.AttachedPic == 0 {
+				info.width, info.height = stream.Width, stream.Height
+			}
+		case "audio":
+			info.hasAudio = true
+		}
+	}
+	return info, nil
+}
+
+// spriteSheet contains the template attributes of video sprite sheets.
+type spriteSheet struct {
+	tileWidth int
+	interval  int
+	columns   int
+	maxFrames int
+}
+
+func newSpriteSheet(template *common.Template) (*spriteSheet, error) {
+	var err error
+	sprite := new(spriteSheet)
+	sprite.tileWidth, err = intTemplateAttribute(template, common.TemplateAttributeWidth)
+	if err != nil {
+		return nil, err
+	}
+	sprite.interval, err = intTemplateAttribute(template, common.TemplateAttributeInterval)
+	if err != nil {
+		return nil, err
+	}
+	sprite.columns, err = intTemplateAttribute(template, common.TemplateAttributeColumns)
+	if err != nil {
+		return nil, err
+	}
+	sprite.maxFrames, err = intTemplateAttribute(template, common.TemplateAttributeMaxFrames)
+	if err != nil {
+		return nil, err
+	}
+	if sprite.tileWidth < 1 || sprite.interval < 1 || sprite.columns < 1 {
+		return nil, common.ErrorUnableToFindTemplatesById
+	}
+	if sprite.maxFrames < 1 || sprite.maxFrames > maxSpriteFrames {
+		sprite.maxFrames = maxSpriteFrames
+	}
+	return sprite, nil
+}
+
+// extractFrames extracts a frame for every interval of a video into the destination directory and returns the paths of the frames in order.
+func (sprite *spriteSheet) extractFrames(limits *processLimits, source, destination string) ([]string, error) {
+	_, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		log.Println("ffmpeg command not found")
+		return nil, err
+	}
+
+	args := []string{"-y", "-i", source, "-vf", fmt.Sprintf("fps=1/%d,scale=%d:-2", sprite.interval, sprite.tileWidth), "-q:v", "3", "-frames:v", strconv.Itoa(sprite.maxFrames), filepath.Join(destination, "frame_%05d.jpg")}
+	cmd := limits.command("ffmpeg", args...)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(buf.String())
+		return nil, err
+	}
+
+	frames, err := filepath.Glob(filepath.Join(destination, "frame_*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, common.ErrorCouldNotResizeImage
+	}
+	sort.Strings(frames)
+	return sprite.limitFrames(frames), nil
+}
+
+// limitFrames returns no more than the maximum number of frames of the sprite sheet.
+func (sprite *spriteSheet) limitFrames(frames []string) []string {
+	if len(frames) > sprite.maxFrames {
+		return frames[:sprite.maxFrames]
+	}
+	return frames
+}
+
+// compose draws the frames onto a grid with the sprite sheet columns and encodes the grid to the destination as a jpg image. Frames beyond the maximum number of frames are left out. The size of the tiles, taken from the first frame, is returned.
+func (sprite *spriteSheet) compose(frames []string, destination string) (int, int, error) {
+	frames = sprite.limitFrames(frames)
+	var canvas *image.RGBA
+	var tileWidth, tileHeight int
+	for index, frame := range frames {
+		tile, err := decodeImageFile(frame)
+		if err != nil {
+			return 0, 0, err
+		}
+		if canvas == nil {
+			tileWidth, tileHeight = tile.Bounds().Dx(), tile.Bounds().Dy()
+			rows := (len(frames) + sprite.columns - 1) / sprite.columns
+			columns := sprite.columns
+			if len(frames) < columns {
+				columns = len(frames)
+			}
+			canvas = image.NewRGBA(image.Rect(0, 0, columns*tileWidth, rows*tileHeight))
+		}
+		x, y := (index%sprite.columns)*tileWidth, (index/sprite.columns)*tileHeight
+		draw.Draw(canvas, image.Rect(x, y, x+tileWidth, y+tileHeight), tile, tile.Bounds().Min, draw.Src)
+	}
+
+	return tileWidth, tileHeight, encodeImageFile(canvas, destination, "jpg")
+}
+
+// webVtt returns a WebVTT thumbnail track with a cue for each frame of a sprite sheet. The cues reference the sprite sheet by name, relative to the track.
+func (sprite *spriteSheet) webVtt(spriteName string, frameCount, tileWidth, tileHeight int) []byte {
+	var track bytes.Buffer
+	track.WriteString("WEBVTT\n")
+	for index := 0; index < frameCount; index++ {
+		x, y := (index%sprite.columns)*tileWidth, (index/sprite.columns)*tileHeight
+		track.WriteString(fmt.Sprintf("\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", vttTimestamp(index*sprite.interval), vttTimestamp((index+1)*sprite.interval), spriteName, x, y, tileWidth, tileHeight))
+	}
+	return track.Bytes()
+}
+
+func vttTimestamp(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d.000", seconds/3600, (seconds/60)%60, seconds%60)
+}
+
+// splitLocation splits a location into the prefix shared by the files next to it and its file name.
+func splitLocation(location string) (string, string) {
+	index := strings.LastIndex(location, "/")
+	return location[:index+1], location[index+1:]
+}
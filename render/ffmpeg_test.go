@@ -0,0 +1,179 @@
+package render
+
+import (
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFrame(t *testing.T, path string, value uint8) {
+	frame := image.NewGray(image.Rect(0, 0, 160, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 160; x++ {
+			frame.SetGray(x, y, color.Gray{value})
+		}
+	}
+	writer, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	err = jpeg.Encode(writer, frame, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsBlackFrame(t *testing.T) {
+	directory, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	black := filepath.Join(directory, "black.jpg")
+	writeTestFrame(t, black, 4)
+	isBlack, err := isBlackFrame(black)
+	if err != nil || !isBlack {
+		t.Errorf("Expected a black frame: %v %s", isBlack, err)
+	}
+
+	grey := filepath.Join(directory, "grey.jpg")
+	writeTestFrame(t, grey, 128)
+	isBlack, err = isBlackFrame(grey)
+	if err != nil || isBlack {
+		t.Errorf("Expected a frame that is not black: %v %s", isBlack, err)
+	}
+}
+
+func TestSpriteSheet(t *testing.T) {
+	directory, err := ioutil.TempDir("", "sprite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	frames := make([]string, 0, 3)
+	for index := 0; index < 3; index++ {
+		frame := filepath.Join(directory, fmt.Sprintf("frame_%05d.jpg", index+1))
+		writeTestFrame(t, frame, uint8(index*100))
+		frames = append(frames, frame)
+	}
+
+	sprite, err := newSpriteSheet(common.VideoSpriteSheetTemplate)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	sprite.columns = 2
+
+	destination := filepath.Join(directory, "0")
+	tileWidth, tileHeight, err := sprite.compose(frames, destination)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if tileWidth != 160 || tileHeight != 90 {
+		t.Errorf("Unexpected tile size: %d %d", tileWidth, tileHeight)
+	}
+	width, height, err := imageDimensions(nil, destination)
+	if err != nil || width != 320 || height != 180 {
+		t.Errorf("Unexpected sprite sheet size: %d %d %s", width, height, err)
+	}
+
+	expected := "WEBVTT\n" +
+		"\n00:00:00.000 --> 00:00:10.000\n0#xywh=0,0,160,90\n" +
+		"\n00:00:10.000 --> 00:00:20.000\n0#xywh=160,0,160,90\n" +
+		"\n00:00:20.000 --> 00:00:30.000\n0#xywh=0,90,160,90\n"
+	track := string(sprite.webVtt("0", len(frames), tileWidth, tileHeight))
+	if track != expected {
+		t.Errorf("Unexpected thumbnail track: %s", track)
+	}
+
+	sprite.maxFrames = 1
+	_, _, err = sprite.compose(frames, destination)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	width, height, err = imageDimensions(nil, destination)
+	if err != nil || width != 160 || height != 90 {
+		t.Errorf("Unexpected sprite sheet size for one frame: %d %d %s", width, height, err)
+	}
+}
+
+func TestSpriteSheetMaxFrames(t *testing.T) {
+	template := &common.Template{Id: "sprite", Attributes: []common.Attribute{
+		common.Attribute{Key: common.TemplateAttributeWidth, Value: []string{"160"}},
+		common.Attribute{Key: common.TemplateAttributeInterval, Value: []string{"10"}},
+		common.Attribute{Key: common.TemplateAttributeColumns, Value: []string{"10"}},
+	}}
+	sprite, err := newSpriteSheet(template)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if sprite.maxFrames != maxSpriteFrames {
+		t.Errorf("Expected the number of frames to be limited: %d", sprite.maxFrames)
+	}
+	frames := make([]string, maxSpriteFrames+10)
+	if len(sprite.limitFrames(frames)) != maxSpriteFrames {
+		t.Error("Expected the frames to be limited.")
+	}
+}
+
+func TestThumbnailTrackUrl(t *testing.T) {
+	url := thumbnailTrackUrl("local:///4F9E0C62/" + common.VideoSpriteSheetTemplateId + "/0.vtt")
+	if url != "/asset/4F9E0C62/"+common.VideoSpriteSheetTemplateId+"/0/0.vtt" {
+		t.Errorf("Unexpected local thumbnail track url: %s", url)
+	}
+}
+
+func TestHlsRenditionSize(t *testing.T) {
+	rendition := hlsLadder[0]
+	sizes := [][4]int{
+		{1920, 1080, 640, 360},
+		{1080, 1920, 202, 360},
+		{2560, 800, 640, 200},
+		{320, 240, 320, 240},
+		{321, 241, 320, 240},
+		{0, 0, 640, 360},
+	}
+	for _, size := range sizes {
+		width, height := rendition.size(size[0], size[1])
+		if width != size[2] || height != size[3] {
+			t.Errorf("Unexpected size of %dx%d: %dx%d", size[0], size[1], width, height)
+		}
+	}
+}
+
+func TestHlsMasterPlaylist(t *testing.T) {
+	info, err := parseVideoInfo([]byte(`{"streams":[{"codec_type":"video","width":1920,"height":1080},{"codec_type":"audio","sample_rate":"48000","channels":2}]}`))
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	expected := "#EXTM3U\n#EXT-X-VERSION:3\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=696000,RESOLUTION=640x360,CODECS=\"avc1.4d401f,mp4a.40.2\"\nvideo_hls_600.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1296000,RESOLUTION=1280x720,CODECS=\"avc1.4d4028,mp4a.40.2\"\nvideo_hls_1200.m3u8\n"
+	playlist := string(hlsMasterPlaylist("video", info))
+	if playlist != expected {
+		t.Errorf("Unexpected master playlist: %s", playlist)
+	}
+
+	info, err = parseVideoInfo([]byte(`{"streams":[{"codec_type":"video","width":640,"height":480}]}`))
+	if err != nil || info.hasAudio || info.width != 640 || info.height != 480 {
+		t.Errorf("Unexpected video info: %+v %v", info, err)
+		return
+	}
+	if !strings.Contains(string(hlsMasterPlaylist("video", info)), "RESOLUTION=480x360,CODECS=\"avc1.4d401f\"") {
+		t.Errorf("Unexpected master playlist without audio: %s", hlsMasterPlaylist("video", info))
+	}
+}
@@ -0,0 +1,176 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// oleFileType is detected for OLE compound files, the container of the legacy Office formats, which cannot be told apart by their magic bytes.
+	oleFileType = "ole"
+	// sniffLength is the number of bytes at the start of a file that file types are detected from.
+	sniffLength = 512
+)
+
+// fileTypeAliases are declared file types that are the same as a detected file type. A declared alias is kept when the file is of the detected type.
+var fileTypeAliases = map[string][]string{
+	"jpg":       []string{"jpeg", "jpe", "jfif"},
+	"tiff":      []string{"tif"},
+	"mp4":       []string{"m4v", "m4a", "mov"},
+	"mkv":       []string{"mka"},
+	"docx":      []string{"docm", "dotx", "dotm"},
+	"xlsx":      []string{"xlsm", "xltx", "xltm"},
+	"pptx":      []string{"pptm", "potx", "ppsx"},
+	"zip":       []string{"jar", "apk", "epub"},
+	"gz":        []string{"tgz"},
+	"svg":       []string{"xml"},
+	oleFileType: []string{"doc", "dot", "xls", "xlt", "ppt", "pps", "msg", "vsd", "pub"},
+}
+
+// detectFileType returns the file type of a file from its magic bytes and, for zip archives, the entries of the archive. An empty string is returned when the file type cannot be detected, which is the case for plain text formats.
+func detectFileType(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLength)
+	n, _ := io.ReadFull(file, header)
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("%PDF-")):
+		return "pdf"
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif"
+	case len(header) >= 14 && bytes.HasPrefix(header, []byte("BM")) && bytes.Equal(header[6:10], []byte{0, 0, 0, 0}):
+		return "bmp"
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return "tiff"
+	case bytes.HasPrefix(header, []byte("8BPS")):
+		return "psd"
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")):
+		switch string(header[8:12]) {
+		case "WEBP":
+			return "webp"
+		case "WAVE":
+			return "wav"
+		case "AVI ":
+			return "avi"
+		}
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		switch string(header[8:12]) {
+		case "qt  ":
+			return "mov"
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "heim", "heis", "mif1":
+			return "heic"
+		}
+		return "mp4"
+	case bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(header, []byte("webm")) {
+			return "webm"
+		}
+		return "mkv"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "ogg"
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(header, []byte("ID3")), len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return "mp3"
+	case bytes.HasPrefix(header, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}):
+		return oleFileType
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return detectZipFileType(path)
+	case bytes.HasPrefix(header, []byte{0x1F, 0x8B}):
+		return "gz"
+	case bytes.HasPrefix(header, []byte("7z\xBC\xAF\x27\x1C")):
+		return "7z"
+	case bytes.HasPrefix(header, []byte("Rar!\x1A\x07")):
+		return "rar"
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return "tar"
+	}
+
+	text := bytes.TrimSpace(bytes.TrimPrefix(header, []byte("\xEF\xBB\xBF")))
+	if bytes.HasPrefix(text, []byte("<")) && bytes.Contains(text, []byte("<svg")) {
+		return "svg"
+	}
+	return ""
+}
+
+// detectZipFileType returns the file type of a zip archive. Office Open XML and OpenDocument files are zip archives that are told apart by their entries.
+func detectZipFileType(path string) string {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "zip"
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		switch {
+		case entry.Name == "mimetype":
+			mimetype, err := readZipEntry(entry, sniffLength)
+			if err != nil {
+				continue
+			}
+			switch strings.TrimSpace(string(mimetype)) {
+			case "application/vnd.oasis.opendocument.text":
+				return "odt"
+			case "application/vnd.oasis.opendocument.spreadsheet":
+				return "ods"
+			case "application/vnd.oasis.opendocument.presentation":
+				return "odp"
+			case "application/epub+zip":
+				return "epub"
+			}
+		case strings.HasPrefix(entry.Name, "word/"):
+			return "docx"
+		case strings.HasPrefix(entry.Name, "xl/"):
+			return "xlsx"
+		case strings.HasPrefix(entry.Name, "ppt/"):
+			return "pptx"
+		}
+	}
+	return "zip"
+}
+
+func readZipEntry(entry *zip.File, limit int64) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(io.LimitReader(reader, limit))
+}
+
+// resolveFileType returns the file type that a file is rendered as and whether the detected file type does not match the declared file type. The detected file type is used unless it is unknown, the same as the declared file type or one that the declared file type is an alias of. OLE compound files keep their declared file type because the detected file type does not say which legacy Office format they are.
+func resolveFileType(declaredFileType, detectedFileType string) (string, bool) {
+	declaredFileType = normalizeFileType(declaredFileType)
+	if detectedFileType == "" || detectedFileType == declaredFileType {
+		return declaredFileType, false
+	}
+	for _, alias := range fileTypeAliases[detectedFileType] {
+		if alias == declaredFileType {
+			return declaredFileType, false
+		}
+	}
+	if detectedFileType == oleFileType {
+		return declaredFileType, declaredFileType != ""
+	}
+	return detectedFileType, declaredFileType != ""
+}
+
+func normalizeFileType(fileType string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(fileType)), ".")
+}
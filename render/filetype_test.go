@@ -0,0 +1,136 @@
+package render
+
+import (
+	"archive/zip"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeZipFile(path string, entries map[string]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for name, content := range entries {
+		writer, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write([]byte(content))
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func TestDetectFileType(t *testing.T) {
+	directory, err := ioutil.TempDir("", "filetype")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	files := map[string][]byte{
+		"report.pdf":  []byte("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n"),
+		"photo.gif":   []byte("GIF89a\x01\x00\x01\x00"),
+		"legacy.doc":  []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00\x00"),
+		"clip.mov":    []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"),
+		"clip.mp4":    []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"),
+		"song.mp3":    []byte("ID3\x03\x00\x00\x00\x00\x00\x00"),
+		"sound.wav":   []byte("RIFF\x24\x00\x00\x00WAVEfmt "),
+		"icon.svg":    []byte("\xEF\xBB\xBF<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"),
+		"notes.txt":   []byte("Meeting notes\n"),
+		"config.json": []byte("{\"BM\": true}"),
+	}
+	expected := map[string]string{
+		"report.pdf":  "pdf",
+		"photo.gif":   "gif",
+		"legacy.doc":  oleFileType,
+		"clip.mov":    "mov",
+		"clip.mp4":    "mp4",
+		"song.mp3":    "mp3",
+		"sound.wav":   "wav",
+		"icon.svg":    "svg",
+		"notes.txt":   "",
+		"config.json": "",
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(directory, name), content, 0644)
+		if err != nil {
+			t.Errorf("Unexpected error returned: %s", err)
+			return
+		}
+	}
+
+	err = encodeImageFile(image.NewRGBA(image.Rect(0, 0, 4, 4)), filepath.Join(directory, "photo.png"), "png")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	expected["photo.png"] = "png"
+	err = encodeImageFile(image.NewRGBA(image.Rect(0, 0, 4, 4)), filepath.Join(directory, "photo.jpg"), "jpg")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	expected["photo.jpg"] = "jpg"
+
+	zipFiles := map[string]map[string]string{
+		"letter.docx": map[string]string{"[Content_Types].xml": "<Types/>", "word/document.xml": "<document/>"},
+		"budget.xlsx": map[string]string{"[Content_Types].xml": "<Types/>", "xl/workbook.xml": "<workbook/>"},
+		"slides.pptx": map[string]string{"[Content_Types].xml": "<Types/>", "ppt/presentation.xml": "<presentation/>"},
+		"letter.odt":  map[string]string{"mimetype": "application/vnd.oasis.opendocument.text", "content.xml": "<content/>"},
+		"files.zip":   map[string]string{"readme.txt": "hello"},
+	}
+	for name, entries := range zipFiles {
+		err = writeZipFile(filepath.Join(directory, name), entries)
+		if err != nil {
+			t.Errorf("Unexpected error returned: %s", err)
+			return
+		}
+	}
+	expected["letter.docx"] = "docx"
+	expected["budget.xlsx"] = "xlsx"
+	expected["slides.pptx"] = "pptx"
+	expected["letter.odt"] = "odt"
+	expected["files.zip"] = "zip"
+
+	for name, fileType := range expected {
+		if detected := detectFileType(filepath.Join(directory, name)); detected != fileType {
+			t.Errorf("Unexpected file type detected for %s: %q", name, detected)
+		}
+	}
+	if detected := detectFileType(filepath.Join(directory, "missing.pdf")); detected != "" {
+		t.Errorf("Unexpected file type detected for a missing file: %q", detected)
+	}
+}
+
+func TestResolveFileType(t *testing.T) {
+	tests := []struct {
+		declared, detected, fileType string
+		mismatch                     bool
+	}{
+		{"pdf", "pdf", "pdf", false},
+		{"JPEG", "jpg", "jpeg", false},
+		{"jpg", "pdf", "pdf", true},
+		{"", "png", "png", false},
+		{"txt", "", "txt", false},
+		{"doc", oleFileType, "doc", false},
+		{"pdf", oleFileType, "pdf", true},
+		{"zip", "docx", "docx", true},
+		{"docm", "docx", "docm", false},
+	}
+	for _, test := range tests {
+		fileType, mismatch := resolveFileType(test.declared, test.detected)
+		if fileType != test.fileType || mismatch != test.mismatch {
+			t.Errorf("Unexpected file type resolved for %q and %q: %q %v", test.declared, test.detected, fileType, mismatch)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package render
+
+import (
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// imageFit describes how an image is resized to the dimensions of a template.
+type imageFit struct {
+	mode   string
+	width  int
+	height int
+	// background is the colour used to pad images and to flatten transparent images. It is nil when transparency is kept.
+	background color.Color
+	// watermark is stamped onto images once they are resized. It is nil for templates without a watermark.
+	watermark *watermark
+}
+
+// newImageFit reads the height, width, fit and background attributes of a template. The width is only optional for the contain fit mode.
+func newImageFit(template *common.Template, output string) (*imageFit, error) {
+	fit := new(imageFit)
+
+	rawHeight, err := common.GetFirstAttribute(template, common.TemplateAttributeHeight)
+	if err != nil {
+		return nil, err
+	}
+	fit.height, err = strconv.Atoi(rawHeight)
+	if err != nil {
+		return nil, err
+	}
+	rawWidth, err := common.GetFirstAttribute(template, common.TemplateAttributeWidth)
+	if err == nil {
+		fit.width, err = strconv.Atoi(rawWidth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fit.mode, err = common.GetFirstAttribute(template, common.TemplateAttributeFit)
+	if err != nil {
+		fit.mode = common.TemplateFitContain
+	}
+	switch fit.mode {
+	case common.TemplateFitContain:
+	case common.TemplateFitCover, common.TemplateFitPad, common.TemplateFitEntropy, common.TemplateFitEdge:
+		if fit.width <= 0 || fit.height <= 0 {
+			return nil, common.ErrorCouldNotDetermineRenderSize
+		}
+	default:
+		return nil, fmt.Errorf("unknown fit mode %s", fit.mode)
+	}
+
+	rawBackground, err := common.GetFirstAttribute(template, common.TemplateAttributeBackground)
+	if err == nil {
+		fit.background, err = parseColor(rawBackground)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !outputSupportsAlpha(output) && (fit.background == nil || !isOpaque(fit.background)) {
+		fit.background = color.White
+	}
+
+	return fit, nil
+}
+
+// isSmartCrop returns true if the fit mode selects the region of the image to keep.
+func (fit *imageFit) isSmartCrop() bool {
+	return fit.mode == common.TemplateFitEntropy || fit.mode == common.TemplateFitEdge
+}
+
+// apply resizes an image according to the fit mode and stamps the watermark onto it.
+func (fit *imageFit) apply(sourceImage image.Image) image.Image {
+	return fit.watermark.apply(fit.resize(sourceImage))
+}
+
+// resize resizes an image according to the fit mode.
+func (fit *imageFit) resize(sourceImage image.Image) image.Image {
+	switch fit.mode {
+	case common.TemplateFitCover, common.TemplateFitEntropy, common.TemplateFitEdge:
+		sourceBounds := sourceImage.Bounds()
+		coverWidth, coverHeight := coverDimensions(sourceBounds.Dx(), sourceBounds.Dy(), fit.width, fit.height)
+		scaled := image.NewRGBA(image.Rect(0, 0, coverWidth, coverHeight))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), sourceImage, sourceBounds, draw.Src, nil)
+		return fit.crop(scaled)
+	case common.TemplateFitPad:
+		contained := resizeImage(sourceImage, fit.width, fit.height, nil)
+		padded := image.NewRGBA(image.Rect(0, 0, fit.width, fit.height))
+		if fit.background != nil {
+			draw.Draw(padded, padded.Bounds(), image.NewUniform(fit.background), image.ZP, draw.Src)
+		}
+		containedBounds := contained.Bounds()
+		offset := image.Pt((fit.width-containedBounds.Dx())/2, (fit.height-containedBounds.Dy())/2)
+		draw.Draw(padded, containedBounds.Add(offset), contained, containedBounds.Min, draw.Over)
+		return padded
+	}
+	return resizeImage(sourceImage, fit.width, fit.height, fit.background)
+}
+
+// crop cuts an image that covers the fit dimensions down to exactly the fit dimensions, keeping the center or the most interesting region.
+func (fit *imageFit) crop(scaled image.Image) image.Image {
+	region := centerCrop(scaled.Bounds(), fit.width, fit.height)
+	if fit.isSmartCrop() {
+		region = smartCrop(scaled, fit.width, fit.height, fit.mode)
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, fit.width, fit.height))
+	if fit.background != nil {
+		draw.Draw(cropped, cropped.Bounds(), image.NewUniform(fit.background), image.ZP, draw.Src)
+	}
+	draw.Draw(cropped, cropped.Bounds(), scaled, region.Min, draw.Over)
+	return cropped
+}
+
+// cropFile applies a smart crop to an image that has already been scaled to cover the fit dimensions and writes it to the destination. Images are encoded within the limits.
+func (fit *imageFit) cropFile(limits *processLimits, source, destination, output string) error {
+	reader, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scaled, _, err := image.Decode(reader)
+	if err != nil {
+		return err
+	}
+	return encodeImage(limits, fit.watermark.apply(fit.crop(scaled)), destination, output)
+}
+
+// imageMagickArgs returns the convert arguments that resize an image according to the fit mode. Smart crop modes only scale the image to cover the fit dimensions; the crop is applied with cropFile.
+func (fit *imageFit) imageMagickArgs() []string {
+	geometry := fmt.Sprintf("%dx%d", fit.width, fit.height)
+	if fit.width <= 0 {
+		geometry = fmt.Sprintf("x%d", fit.height)
+	}
+	switch fit.mode {
+	case common.TemplateFitCover:
+		return []string{"-resize", geometry + "^", "-gravity", "center", "-extent", geometry}
+	case common.TemplateFitEntropy, common.TemplateFitEdge:
+		return []string{"-resize", geometry + "^"}
+	case common.TemplateFitPad:
+		return []string{"-resize", geometry, "-background", imageMagickColor(fit.background), "-gravity", "center", "-extent", geometry}
+	}
+	return []string{"-resize", geometry}
+}
+
+// coverDimensions returns the smallest dimensions that cover the given width and height while preserving the aspect ratio of the source.
+func coverDimensions(sourceWidth, sourceHeight, width, height int) (int, int) {
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return width, height
+	}
+	scale := math.Max(float64(width)/float64(sourceWidth), float64(height)/float64(sourceHeight))
+	coverWidth := int(math.Ceil(float64(sourceWidth) * scale))
+	coverHeight := int(math.Ceil(float64(sourceHeight) * scale))
+	if coverWidth < width {
+		coverWidth = width
+	}
+	if coverHeight < height {
+		coverHeight = height
+	}
+	return coverWidth, coverHeight
+}
+
+func centerCrop(bounds image.Rectangle, width, height int) image.Rectangle {
+	x := bounds.Min.X + (bounds.Dx()-width)/2
+	y := bounds.Min.Y + (bounds.Dy()-height)/2
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// smartCrop returns the width by height region of an image with the highest score. Because the image covers the region, the region only moves along one axis. The "entropy" mode scores regions by the entropy of their luminance histogram and the "edge" mode scores regions by the strength of the edges in them.
+func smartCrop(sourceImage image.Image, width, height int, mode string) image.Rectangle {
+	bounds := sourceImage.Bounds()
+	horizontal := bounds.Dx() > width
+	if !horizontal && bounds.Dy() <= height {
+		return centerCrop(bounds, width, height)
+	}
+
+	luminance := make([][]uint8, bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		luminance[y] = make([]uint8, bounds.Dx())
+		for x := 0; x < bounds.Dx(); x++ {
+			luminance[y][x] = color.GrayModel.Convert(sourceImage.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+		}
+	}
+
+	// Each slice is a column when the region moves horizontally and a row when it moves vertically.
+	sliceCount, window := bounds.Dy(), height
+	if horizontal {
+		sliceCount, window = bounds.Dx(), width
+	}
+	sample := func(slice, offset int) (uint8, int) {
+		if horizontal {
+			return luminance[offset][slice], edgeStrength(luminance, slice, offset)
+		}
+		return luminance[slice][offset], edgeStrength(luminance, offset, slice)
+	}
+	sampleCount := bounds.Dx()
+	if horizontal {
+		sampleCount = bounds.Dy()
+	}
+
+	histograms := make([][32]int, sliceCount)
+	edges := make([]int, sliceCount)
+	for slice := 0; slice < sliceCount; slice++ {
+		for offset := 0; offset < sampleCount; offset++ {
+			value, edge := sample(slice, offset)
+			histograms[slice][value>>3]++
+			edges[slice] += edge
+		}
+	}
+
+	var histogram [32]int
+	edgeTotal := 0
+	for slice := 0; slice < window; slice++ {
+		for bin := range histogram {
+			histogram[bin] += histograms[slice][bin]
+		}
+		edgeTotal += edges[slice]
+	}
+
+	score := func() float64 {
+		if mode == common.TemplateFitEdge {
+			return float64(edgeTotal)
+		}
+		return histogramEntropy(histogram[:])
+	}
+
+	best, bestScore := 0, score()
+	for start := 1; start+window <= sliceCount; start++ {
+		for bin := range histogram {
+			histogram[bin] += histograms[start+window-1][bin] - histograms[start-1][bin]
+		}
+		edgeTotal += edges[start+window-1] - edges[start-1]
+		current := score()
+		if current > bestScore {
+			best, bestScore = start, current
+		}
+	}
+
+	if horizontal {
+		return image.Rect(bounds.Min.X+best, bounds.Min.Y, bounds.Min.X+best+width, bounds.Min.Y+height)
+	}
+	return image.Rect(bounds.Min.X, bounds.Min.Y+best, bounds.Min.X+width, bounds.Min.Y+best+height)
+}
+
+func edgeStrength(luminance [][]uint8, x, y int) int {
+	strength := 0
+	if x > 0 {
+		strength += absInt(int(luminance[y][x]) - int(luminance[y][x-1]))
+	}
+	if y > 0 {
+		strength += absInt(int(luminance[y][x]) - int(luminance[y-1][x]))
+	}
+	return strength
+}
+
+func histogramEntropy(histogram []int) float64 {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	entropy := 0.0
+	for _, count := range histogram {
+		if count > 0 {
+			p := float64(count) / float64(total)
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+func isOpaque(c color.Color) bool {
+	_, _, _, alpha := c.RGBA()
+	return alpha == 0xffff
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// parseColor parses colours in the "#rrggbb" and "#rrggbbaa" formats. The values "none" and "transparent" are fully transparent.
+func parseColor(value string) (color.Color, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "none" || value == "transparent" {
+		return color.Transparent, nil
+	}
+	value = strings.TrimPrefix(value, "#")
+	if len(value) != 6 && len(value) != 8 {
+		return nil, fmt.Errorf("invalid colour %s", value)
+	}
+	if len(value) == 6 {
+		value = value + "ff"
+	}
+	rgba, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	return color.NRGBA{uint8(rgba >> 24), uint8(rgba >> 16), uint8(rgba >> 8), uint8(rgba)}, nil
+}
+
+func imageMagickColor(background color.Color) string {
+	if background == nil {
+		return "none"
+	}
+	nrgba := color.NRGBAModel.Convert(background).(color.NRGBA)
+	if nrgba.A == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", nrgba.R, nrgba.G, nrgba.B, nrgba.A)
+}
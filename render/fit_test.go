@@ -0,0 +1,100 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newFitTemplate(fit, width, height string) *common.Template {
+	return &common.Template{
+		Id:       "fit",
+		Renderer: common.RenderAgentNativeImage,
+		Group:    "B2D4",
+		Attributes: []common.Attribute{
+			common.Attribute{Key: common.TemplateAttributeWidth, Value: []string{width}},
+			common.Attribute{Key: common.TemplateAttributeHeight, Value: []string{height}},
+			common.Attribute{Key: common.TemplateAttributeFit, Value: []string{fit}},
+			common.Attribute{Key: common.TemplateAttributeBackground, Value: []string{"#ff0000"}},
+		},
+	}
+}
+
+func TestImageFitExactDimensions(t *testing.T) {
+	sourceImage := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for _, mode := range []string{common.TemplateFitCover, common.TemplateFitPad, common.TemplateFitEntropy, common.TemplateFitEdge} {
+		fit, err := newImageFit(newFitTemplate(mode, "100", "100"), "jpg")
+		if err != nil {
+			t.Errorf("Unexpected error returned: %s", err)
+			return
+		}
+		fitted := fit.apply(sourceImage)
+		if fitted.Bounds().Dx() != 100 || fitted.Bounds().Dy() != 100 {
+			t.Errorf("Unexpected bounds for fit %s: %s", mode, fitted.Bounds())
+		}
+	}
+}
+
+func TestImageFitPadBackground(t *testing.T) {
+	fit, err := newImageFit(newFitTemplate(common.TemplateFitPad, "100", "100"), "png")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	sourceImage := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	fitted := fit.apply(sourceImage)
+	r, g, b, _ := fitted.At(50, 5).RGBA()
+	if r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("Padding does not use the background colour: %v", fitted.At(50, 5))
+	}
+}
+
+func TestImageFitRequiresWidth(t *testing.T) {
+	_, err := newImageFit(newFitTemplate(common.TemplateFitCover, "0", "100"), "jpg")
+	if err == nil {
+		t.Error("Expected an error for a cover fit without a width.")
+	}
+	_, err = newImageFit(newFitTemplate("stretch", "100", "100"), "jpg")
+	if err == nil {
+		t.Error("Expected an error for an unknown fit.")
+	}
+}
+
+func TestSmartCrop(t *testing.T) {
+	// A flat image with a checkered region on the right side.
+	sourceImage := image.NewGray(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			value := uint8(128)
+			if x >= 200 && (x/5+y/5)%2 == 0 {
+				value = 255
+			}
+			sourceImage.SetGray(x, y, color.Gray{value})
+		}
+	}
+	for _, mode := range []string{common.TemplateFitEntropy, common.TemplateFitEdge} {
+		region := smartCrop(sourceImage, 100, 100, mode)
+		if region.Min.X != 200 || region.Dx() != 100 || region.Dy() != 100 {
+			t.Errorf("Unexpected region for fit %s: %s", mode, region)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := parseColor("#336699")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if c != (color.NRGBA{0x33, 0x66, 0x99, 0xff}) {
+		t.Errorf("Unexpected colour: %v", c)
+	}
+	if imageMagickColor(c) != "#336699ff" {
+		t.Errorf("Unexpected ImageMagick colour: %s", imageMagickColor(c))
+	}
+	_, err = parseColor("blue")
+	if err == nil {
+		t.Error("Expected an error for an unsupported colour.")
+	}
+}
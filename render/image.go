@@ -0,0 +1,107 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// outputSupportsAlpha returns true if images of the output type can retain transparency.
+func outputSupportsAlpha(output string) bool {
+	switch output {
+	case "png", "gif", "webp", "avif":
+		return true
+	}
+	return false
+}
+
+// encodeImage writes an image to the destination in the format of the output type. The webp and avif formats are encoded with the cwebp and avifenc commands, which are run within the limits.
+func encodeImage(limits *processLimits, sourceImage image.Image, destination, output string) error {
+	switch output {
+	case "webp", "avif":
+		intermediate := destination + ".png"
+		err := encodeImageFile(sourceImage, intermediate, "png")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(intermediate)
+		if output == "webp" {
+			return runLimitedCommand(limits, "cwebp", "-quiet", "-q", "80", "-alpha_q", "100", intermediate, "-o", destination)
+		}
+		return runLimitedCommand(limits, "avifenc", "--speed", "6", intermediate, destination)
+	}
+	return encodeImageFile(sourceImage, destination, output)
+}
+
+// decodeImageFile decodes an image file of any registered format.
+func decodeImageFile(path string) (image.Image, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, _, err := image.Decode(reader)
+	return decoded, err
+}
+
+func encodeImageFile(sourceImage image.Image, destination, output string) error {
+	writer, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	switch output {
+	case "png":
+		return png.Encode(writer, sourceImage)
+	case "gif":
+		return gif.Encode(writer, sourceImage, nil)
+	case "jpg", "jpeg":
+		return jpeg.Encode(writer, sourceImage, &jpeg.Options{Quality: 90})
+	}
+	return fmt.Errorf("unsupported output type %s", output)
+}
+
+// imageDimensions returns the width and height of an image file. Formats that cannot be decoded are measured with the identify command, which is run within the limits.
+func imageDimensions(limits *processLimits, path string) (int, int, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		log.Println("os.Open error", err)
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	imageConfig, _, err := image.DecodeConfig(reader)
+	if err == nil {
+		return imageConfig.Width, imageConfig.Height, nil
+	}
+
+	_, lookErr := exec.LookPath("identify")
+	if lookErr != nil {
+		log.Println("image.DecodeConfig error", err)
+		return 0, 0, err
+	}
+
+	out, err := limits.output(limits.command("identify", "-format", "%w %h", path+"[0]"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var width, height int
+	_, err = fmt.Sscanf(strings.TrimSpace(string(out)), "%d %d", &width, &height)
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
@@ -3,130 +3,108 @@ package render
 import (
 	"bytes"
 	"fmt"
+	"github.com/ngerakines/codederror"
 	"github.com/ngerakines/preview/common"
 	"github.com/ngerakines/preview/util"
-	"github.com/rcrowley/go-metrics"
-	"image"
-	"image/jpeg"
 	"log"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
-	"time"
+	"strings"
 )
 
 type imageMagickRenderAgent struct {
-	metrics              *imageMagickRenderAgentMetrics
-	sasm                 common.SourceAssetStorageManager
-	gasm                 common.GeneratedAssetStorageManager
-	templateManager      common.TemplateManager
-	agentManager         *RenderAgentManager
-	downloader           common.Downloader
-	uploader             common.Uploader
-	workChannel          RenderAgentWorkChannel
-	statusListeners      []RenderStatusChannel
-	temporaryFileManager common.TemporaryFileManager
-	stop                 chan (chan bool)
+	baseRenderAgent
+	limits *processLimits
 }
 
-type imageMagickRenderAgentMetrics struct {
-	workProcessed metrics.Meter
-	convertTime   metrics.Timer
-	fileTypeCount map[string]metrics.Counter
-}
+type imageMagickRenderAgentFactory struct{}
 
-func newImageMagickRenderAgent(
-	metrics *imageMagickRenderAgentMetrics,
-	agentManager *RenderAgentManager,
-	sasm common.SourceAssetStorageManager,
-	gasm common.GeneratedAssetStorageManager,
-	templateManager common.TemplateManager,
-	temporaryFileManager common.TemporaryFileManager,
-	downloader common.Downloader,
-	uploader common.Uploader,
-	workChannel RenderAgentWorkChannel) RenderAgent {
+type imageMagickConfig struct {
+	ResourceLimits map[string]string `json:"resourceLimits"`
+}
 
-	renderAgent := new(imageMagickRenderAgent)
-	renderAgent.metrics = metrics
-	renderAgent.agentManager = agentManager
-	renderAgent.sasm = sasm
-	renderAgent.gasm = gasm
-	renderAgent.templateManager = templateManager
-	renderAgent.temporaryFileManager = temporaryFileManager
-	renderAgent.downloader = downloader
-	renderAgent.uploader = uploader
-	renderAgent.workChannel = workChannel
-	renderAgent.statusListeners = make([]RenderStatusChannel, 0, 0)
-	renderAgent.stop = make(chan (chan bool))
-
-	go renderAgent.start()
+// defaultImageMagickResourceLimits bound the pixel cache of ImageMagick so that decompression bombs fail instead of exhausting the host.
+var defaultImageMagickResourceLimits = map[string]string{
+	"memory": "256MiB",
+	"map":    "512MiB",
+	"disk":   "1GiB",
+	"area":   "128MP",
+	"width":  "16KP",
+	"height": "16KP",
+}
 
-	return renderAgent
+func (factory *imageMagickRenderAgentFactory) Name() string {
+	return common.RenderAgentImageMagick
 }
 
-func newImageMagickRenderAgentMetrics(registry metrics.Registry, supportedFileTypes []string) *imageMagickRenderAgentMetrics {
-	imageMagickMetrics := new(imageMagickRenderAgentMetrics)
-	imageMagickMetrics.workProcessed = metrics.NewMeter()
-	imageMagickMetrics.convertTime = metrics.NewTimer()
+func (factory *imageMagickRenderAgentFactory) ConfigSection() string {
+	return "imageMagickRenderAgent"
+}
 
-	imageMagickMetrics.fileTypeCount = make(map[string]metrics.Counter)
+func (factory *imageMagickRenderAgentFactory) TemplateIds() []string {
+	return common.LegacyDefaultTemplates
+}
 
-	for _, filetype := range supportedFileTypes {
-		imageMagickMetrics.fileTypeCount[filetype] = metrics.NewCounter()
-		registry.Register(fmt.Sprintf("imageMagickRenderAgent.%sCount", filetype), imageMagickMetrics.fileTypeCount[filetype])
+func (factory *imageMagickRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var imageMagickConfig imageMagickConfig
+	err := context.Config.Decode(&imageMagickConfig)
+	if err != nil {
+		return nil, err
 	}
-
-	registry.Register("imageMagickRenderAgent.workProcessed", imageMagickMetrics.workProcessed)
-	registry.Register("imageMagickRenderAgent.convertTime", imageMagickMetrics.convertTime)
-
-	return imageMagickMetrics
+	limits := newProcessLimits(context.Config).withEnvironment(imageMagickEnvironment(imageMagickConfig.ResourceLimits)...)
+	return newImageMagickRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.WorkChannel, limits), nil
 }
 
-func (renderAgent *imageMagickRenderAgent) start() {
-	for {
-		select {
-		case ch, ok := <-renderAgent.stop:
-			{
-				log.Println("Stopping")
-				if !ok {
-					return
-				}
-				ch <- true
-				return
-			}
-		case id, ok := <-renderAgent.workChannel:
-			{
-				if !ok {
-					return
-				}
-				log.Println("Received dispatch message", id)
-				renderAgent.renderGeneratedAsset(id)
-			}
-		}
+// imageMagickEnvironment returns the MAGICK_*_LIMIT environment variables for the configured resource limits, falling back to the default limits for resources that are not configured.
+func imageMagickEnvironment(resourceLimits map[string]string) []string {
+	limits := make(map[string]string)
+	for resource, limit := range defaultImageMagickResourceLimits {
+		limits[resource] = limit
 	}
-}
+	for resource, limit := range resourceLimits {
+		limits[strings.ToLower(resource)] = limit
+	}
+	resources := make([]string, 0, len(limits))
+	for resource := range limits {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
 
-func (renderAgent *imageMagickRenderAgent) Stop() {
-	callback := make(chan bool)
-	renderAgent.stop <- callback
-	select {
-	case <-callback:
-	case <-time.After(5 * time.Second):
+	environment := make([]string, 0, len(limits))
+	for _, resource := range resources {
+		if limits[resource] != "" {
+			environment = append(environment, "MAGICK_"+strings.ToUpper(resource)+"_LIMIT="+limits[resource])
+		}
 	}
-	close(renderAgent.stop)
+	return environment
 }
 
-func (renderAgent *imageMagickRenderAgent) AddStatusListener(listener RenderStatusChannel) {
-	renderAgent.statusListeners = append(renderAgent.statusListeners, listener)
-}
+func newImageMagickRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits) RenderAgent {
+
+	renderAgent := new(imageMagickRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentImageMagick, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
 
-func (renderAgent *imageMagickRenderAgent) Dispatch() RenderAgentWorkChannel {
-	return renderAgent.workChannel
+	return renderAgent
 }
 
 func (renderAgent *imageMagickRenderAgent) renderGeneratedAsset(id string) {
 
-	renderAgent.metrics.workProcessed.Mark(1)
+	renderAgent.metrics.WorkProcessed.Mark(1)
 
 	generatedAsset, err := renderAgent.gasm.FindById(id)
 	if err != nil {
@@ -152,7 +130,11 @@ func (renderAgent *imageMagickRenderAgent) renderGeneratedAsset(id string) {
 		return
 	}
 
-	renderAgent.metrics.fileTypeCount[fileType].Inc(1)
+	// Derived source assets, such as video poster frames, may have file types that are not configured for this render agent.
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
 
 	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
 	if err != nil {
@@ -172,45 +154,90 @@ func (renderAgent *imageMagickRenderAgent) renderGeneratedAsset(id string) {
 		return
 	}
 	defer sourceFile.Release()
+	renderAgent.agentManager.recordContentHash(sourceAsset, sourceFile.Path())
 
-	destination := sourceFile.Path() + "-" + template.Id + ".jpg"
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	destination := sourceFile.Path() + "-" + template.Id + "." + output
 	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
 	defer destinationTemporaryFile.Release()
 
-	size, err := renderAgent.getSize(template)
+	fit, err := newImageFit(template, output)
 	if err != nil {
 		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
 		return
 	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
 
 	density, err := renderAgent.getDensity(template)
 	if err != nil {
 		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderDensity), nil}
 		return
 	}
-	renderAgent.metrics.convertTime.Time(func() {
+	stripMetadata := false
+	rawStripMetadata, err := common.GetFirstAttribute(template, common.TemplateAttributeStripMetadata)
+	if err == nil {
+		stripMetadata = rawStripMetadata == "true"
+	}
+	limits := renderAgent.limits.forTemplate(template)
+	if fileType != "pdf" {
+		recordImageMetadata(limits, renderAgent.sasm, sourceAsset, sourceFile.Path())
+	}
+
+	// Smart crops are applied after ImageMagick has scaled the image.
+	renderDestination := destination
+	if fit.isSmartCrop() {
+		renderDestination = destination + ".png"
+		defer os.Remove(renderDestination)
+	}
+
+	var failure codederror.CodedError = common.ErrorCouldNotResizeImage
+	err = nil
+	renderAgent.metrics.ConvertTime.Time(func() {
 		if fileType == "pdf" {
 			page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
 			if page == 0 {
-				pages, err := util.GetPdfPageCount(sourceFile.Path())
+				var info *pdfDocumentInfo
+				info, err = readPdfInfo(limits, sourceFile.Path())
 				if err != nil {
-					statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+					failure = common.ErrorNotImplemented
 					return
 				}
-				// Create derived work for all pages but first one
-				renderAgent.agentManager.CreateDerivedWork(sourceAsset, templates, 1, pages)
+				// Create derived work for the pages after the first one that are rendered eagerly
+				renderAgent.agentManager.CreatePagedWork(sourceAsset, templates, info.pages)
 			}
-			err = renderAgent.imageFromPdf(sourceFile.Path(), destination, size, density, page)
+		}
+		// Files with the same contents that have already been rendered with the template are copied instead of rendered again.
+		if renderAgent.agentManager.copyPreviousRender(renderAgent.downloader, sourceAsset, generatedAsset, destination) != nil {
+			return
+		}
+		if fileType == "pdf" {
+			page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+			err = renderAgent.imageFromPdf(limits, sourceFile.Path(), renderDestination, fit, density, page)
 		} else if fileType == "gif" {
-			err = renderAgent.firstGifFrame(sourceFile.Path(), destination, size)
+			err = renderAgent.firstGifFrame(limits, sourceFile.Path(), renderDestination, fit, stripMetadata)
 		} else {
-			err = renderAgent.resize(sourceFile.Path(), destination, size)
+			err = renderAgent.resize(limits, sourceFile.Path(), renderDestination, fit, stripMetadata)
 		}
-		if err != nil {
-			statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
-			return
+		if err == nil && fit.isSmartCrop() {
+			err = fit.cropFile(limits, renderDestination, destination, output)
+		} else if err == nil {
+			err = fit.watermark.applyFile(limits, destination, output)
 		}
 	})
+	if err != nil {
+		log.Println("error rendering image", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, failure), nil}
+		return
+	}
 
 	log.Println("---- generated asset is at", destination, "can load file?", util.CanLoadFile(destination))
 
@@ -220,7 +247,7 @@ func (renderAgent *imageMagickRenderAgent) renderGeneratedAsset(id string) {
 		return
 	}
 
-	bounds, err := renderAgent.getBounds(destination)
+	width, height, err := imageDimensions(limits, destination)
 	if err != nil {
 		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
 		return
@@ -233,70 +260,38 @@ func (renderAgent *imageMagickRenderAgent) renderGeneratedAsset(id string) {
 	}
 
 	newAttributes := []common.Attribute{
-		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Max.X)}),
-		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Max.Y)}),
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(height)}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(width)}),
 		// NKG: I'm sure this is going to break something.
 		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
 	}
 
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
 	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
 }
 
-func (renderAgent *imageMagickRenderAgent) getSourceAsset(generatedAsset *common.GeneratedAsset) (*common.SourceAsset, error) {
-	sourceAssets, err := renderAgent.sasm.FindBySourceAssetId(generatedAsset.SourceAssetId)
-	if err != nil {
-		return nil, err
-	}
-	for _, sourceAsset := range sourceAssets {
-		if sourceAsset.IdType == generatedAsset.SourceAssetType {
-			return sourceAsset, nil
-		}
-	}
-	return nil, common.ErrorNoSourceAssetsFoundForId
-}
-
-func (renderAgent *imageMagickRenderAgent) tryDownload(urls []string, source string) (common.TemporaryFile, error) {
-	for _, url := range urls {
-		tempFile, err := renderAgent.downloader.Download(url, source)
-		if err == nil {
-			return tempFile, nil
-		}
-	}
-	return nil, common.ErrorNoDownloadUrlsWork
-}
-
-func (renderAgent *imageMagickRenderAgent) getBounds(path string) (*image.Rectangle, error) {
-	reader, err := os.Open(path)
-	if err != nil {
-		log.Println("os.Open error", err)
-		return nil, err
-	}
-	defer reader.Close()
-	image, err := jpeg.Decode(reader)
-	if err != nil {
-		log.Println("jpeg.Decode error", err)
-		return nil, err
-	}
-	bounds := image.Bounds()
-	return &bounds, nil
-}
-
-func (renderAgent *imageMagickRenderAgent) resize(source, destination string, size int) error {
+// resize turns an image upright according to its EXIF orientation and resizes it according to the template fit.
+func (renderAgent *imageMagickRenderAgent) resize(limits *processLimits, source, destination string, fit *imageFit, stripMetadata bool) error {
 	_, err := exec.LookPath("convert")
 	if err != nil {
 		log.Println("convert command not found")
 		return err
 	}
 
-	cmd := exec.Command("convert", source, "-resize", strconv.Itoa(size), destination)
+	args := append([]string{source, "-auto-orient"}, fit.imageMagickArgs()...)
+	if stripMetadata {
+		args = append(args, "-strip")
+	}
+	cmd := limits.command("convert", append(args, destination)...)
 	log.Println(cmd)
 
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
 
-	err = cmd.Run()
+	err = limits.run(cmd)
 	if err != nil {
+		log.Println(buf.String())
 		return err
 	}
 	log.Println(buf.String())
@@ -304,22 +299,25 @@ func (renderAgent *imageMagickRenderAgent) resize(source, destination string, si
 	return nil
 }
 
-func (renderAgent *imageMagickRenderAgent) imageFromPdf(source, destination string, size, density, page int) error {
+func (renderAgent *imageMagickRenderAgent) imageFromPdf(limits *processLimits, source, destination string, fit *imageFit, density, page int) error {
 	_, err := exec.LookPath("convert")
 	if err != nil {
 		log.Println("convert command not found")
 		return err
 	}
 
-	cmd := exec.Command("convert", "-density", strconv.Itoa(density), "-colorspace", "RGB", fmt.Sprintf("%s[%d]", source, page), "-resize", strconv.Itoa(size), "-flatten", "+adjoin", destination)
+	args := append([]string{"-density", strconv.Itoa(density), "-colorspace", "RGB", fmt.Sprintf("%s[%d]", source, page)}, fit.imageMagickArgs()...)
+	args = append(args, "-background", imageMagickColor(fit.background), "-flatten", "+adjoin", destination)
+	cmd := limits.command("convert", args...)
 	log.Println(cmd)
 
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
 
-	err = cmd.Run()
+	err = limits.run(cmd)
 	if err != nil {
+		log.Println(buf.String())
 		return err
 	}
 	log.Println(buf.String())
@@ -327,22 +325,27 @@ func (renderAgent *imageMagickRenderAgent) imageFromPdf(source, destination stri
 	return nil
 }
 
-func (renderAgent *imageMagickRenderAgent) firstGifFrame(source, destination string, size int) error {
+func (renderAgent *imageMagickRenderAgent) firstGifFrame(limits *processLimits, source, destination string, fit *imageFit, stripMetadata bool) error {
 	_, err := exec.LookPath("convert")
 	if err != nil {
 		log.Println("convert command not found")
 		return err
 	}
 
-	cmd := exec.Command("convert", fmt.Sprintf("%s[0]", source), "-resize", strconv.Itoa(size), destination)
+	args := append([]string{fmt.Sprintf("%s[0]", source)}, fit.imageMagickArgs()...)
+	if stripMetadata {
+		args = append(args, "-strip")
+	}
+	cmd := limits.command("convert", append(args, destination)...)
 	log.Println(cmd)
 
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 	cmd.Stderr = &buf
 
-	err = cmd.Run()
+	err = limits.run(cmd)
 	if err != nil {
+		log.Println(buf.String())
 		return err
 	}
 	log.Println(buf.String())
@@ -350,18 +353,6 @@ func (renderAgent *imageMagickRenderAgent) firstGifFrame(source, destination str
 	return nil
 }
 
-func (renderAgent *imageMagickRenderAgent) getSize(template *common.Template) (int, error) {
-	rawSize, err := common.GetFirstAttribute(template, common.TemplateAttributeHeight)
-	if err == nil {
-		sizeValue, err := strconv.Atoi(rawSize)
-		if err == nil {
-			return sizeValue, nil
-		}
-		return 0, err
-	}
-	return 0, err
-}
-
 func (renderAgent *imageMagickRenderAgent) getDensity(template *common.Template) (int, error) {
 	rawDensity, err := common.GetFirstAttribute(template, common.TemplateAttributeDensity)
 	if err == nil {
@@ -374,18 +365,6 @@ func (renderAgent *imageMagickRenderAgent) getDensity(template *common.Template)
 	return 0, err
 }
 
-func (renderAgent *imageMagickRenderAgent) getGeneratedAssetPage(generatedAsset *common.GeneratedAsset) (int, error) {
-	rawPage, err := common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributePage)
-	if err == nil {
-		pageValue, err := strconv.Atoi(rawPage)
-		if err == nil {
-			return pageValue, nil
-		}
-		return 0, err
-	}
-	return 0, err
-}
-
 func (renderAgent *imageMagickRenderAgent) getSourceAssetFileType(sourceAsset *common.SourceAsset) (string, error) {
 	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
 	if err == nil {
@@ -393,43 +372,3 @@ func (renderAgent *imageMagickRenderAgent) getSourceAssetFileType(sourceAsset *c
 	}
 	return "unknown", err
 }
-
-func (renderAgent *imageMagickRenderAgent) commitStatus(id string, existingAttributes []common.Attribute) chan generatedAssetUpdate {
-	commitChannel := make(chan generatedAssetUpdate, 10)
-
-	go func() {
-		status := common.NewGeneratedAssetError(common.ErrorUnknownError)
-		attributes := make([]common.Attribute, 0, 0)
-		for _, attribute := range existingAttributes {
-			attributes = append(attributes, attribute)
-		}
-		for {
-			select {
-			case message, ok := <-commitChannel:
-				{
-					if !ok {
-						for _, listener := range renderAgent.statusListeners {
-							listener <- RenderStatus{id, status, common.RenderAgentImageMagick}
-						}
-						generatedAsset, err := renderAgent.gasm.FindById(id)
-						if err != nil {
-							log.Fatal(err.Error())
-							return
-						}
-						generatedAsset.Status = status
-						generatedAsset.Attributes = attributes
-						renderAgent.gasm.Update(generatedAsset)
-						return
-					}
-					status = message.status
-					if message.attributes != nil {
-						for _, attribute := range message.attributes {
-							attributes = append(attributes, attribute)
-						}
-					}
-				}
-			}
-		}
-	}()
-	return commitChannel
-}
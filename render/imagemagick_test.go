@@ -2,11 +2,15 @@ package render
 
 import (
 	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
 	"github.com/ngerakines/preview/util"
 	"github.com/ngerakines/testutils"
 	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -145,10 +149,13 @@ func setupTest(path string) (*RenderAgentManager, common.SourceAssetStorageManag
 	downloader := common.NewDownloader(path, path, tfm, false, []string{}, nil)
 	uploader := common.NewLocalUploader(path)
 	registry := metrics.NewRegistry()
-	rm := NewRenderAgentManager(registry, sourceAssetStorageManager, generatedAssetStorageManager, tm, tfm, uploader, true, nil, "", "", []string{"docx"}, []string{"jpeg", "jpg", "png", "pdf", "gif"}, nil)
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentDocument:    &config.RenderAgentConfig{Enabled: true, Count: 1, BasePath: filepath.Join(path, "doc-cache"), SupportedFileTypes: []string{"docx"}, Raw: []byte("{}")},
+		common.RenderAgentImageMagick: &config.RenderAgentConfig{Enabled: true, Count: 1, SupportedFileTypes: []string{"jpeg", "jpg", "png", "pdf", "gif"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(registry, sourceAssetStorageManager, generatedAssetStorageManager, tm, tfm, uploader, true, renderAgentConfigs)
 
-	rm.AddImageMagickRenderAgent(downloader, uploader, 5)
-	rm.AddDocumentRenderAgent(downloader, uploader, filepath.Join(path, "doc-cache"), 5)
+	rm.StartRenderAgents(downloader, uploader, 5)
 
 	return rm, sourceAssetStorageManager, generatedAssetStorageManager, tm, uploader
 }
@@ -156,3 +163,57 @@ func setupTest(path string) (*RenderAgentManager, common.SourceAssetStorageManag
 func fileUrl(dir, file string) string {
 	return "file://" + filepath.Join(util.Cwd(), "../", dir, file)
 }
+
+func TestImageMagickRenderTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake convert command requires a shell")
+	}
+	directory, err := ioutil.TempDir("", "imagemagick")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+	// The fake convert command never finishes and the fake identify command fails.
+	ioutil.WriteFile(filepath.Join(directory, "convert"), []byte("#!/bin/sh\nsleep 10\n"), 0755)
+	ioutil.WriteFile(filepath.Join(directory, "identify"), []byte("#!/bin/sh\nexit 1\n"), 0755)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", directory+string(os.PathListSeparator)+os.Getenv("PATH"))
+	source := filepath.Join(directory, "source.png")
+	ioutil.WriteFile(source, []byte("not an image"), 0644)
+
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	tfm := common.NewTemporaryFileManager()
+	uploader := common.NewLocalUploader(directory)
+	downloader := common.NewDownloader(directory, directory, tfm, false, []string{}, nil)
+	registry := metrics.NewRegistry()
+	rm := NewRenderAgentManager(registry, sasm, gasm, tm, tfm, uploader, false, map[string]*config.RenderAgentConfig{})
+
+	renderAgent := new(imageMagickRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentImageMagick, newRenderAgentMetrics(registry, "timeout", []string{"png"}), rm, sasm, gasm, tm, tfm, downloader, uploader, nil)
+	renderAgent.limits = &processLimits{timeout: 200 * time.Millisecond}
+	listener := make(RenderStatusChannel, 1)
+	renderAgent.AddStatusListener(listener)
+
+	sourceAsset, _ := common.NewSourceAsset("5A0C3E91-7B24-4D6F-8E15-C9D2A4F7B368", common.SourceAssetTypeOrigin)
+	sourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{"file://" + source})
+	sourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{"png"})
+	sasm.Store(sourceAsset)
+	templates, _ := tm.FindByIds([]string{common.LegacyDefaultTemplates[0]})
+	generatedAsset, _ := common.NewGeneratedAssetFromSourceAsset(sourceAsset, templates[0].Id, uploader.Url(sourceAsset, templates[0], 0))
+	gasm.Store(generatedAsset)
+
+	renderAgent.renderGeneratedAsset(generatedAsset.Id)
+	select {
+	case <-listener:
+	case <-time.After(5 * time.Second):
+		t.Error("Timed out waiting for the render to finish")
+		return
+	}
+	stored, err := gasm.FindById(generatedAsset.Id)
+	if err != nil || stored.Status != common.NewGeneratedAssetError(common.ErrorRenderTimedOut) {
+		t.Errorf("Expected the render to time out: %v %v", stored, err)
+	}
+}
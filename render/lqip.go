@@ -0,0 +1,200 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"math"
+	"sort"
+)
+
+const (
+	base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+	// sampleSize is the size images are reduced to before the blur hash and dominant colours are computed.
+	sampleSize        = 32
+	lqipSize          = 16
+	lqipQuality       = 40
+	dominantColorSize = 5
+)
+
+// imagePreviewAttributes computes the blur hash, dominant colours and low quality image placeholder of a rendered image so that clients can show a stand-in before the render is loaded. Images that cannot be decoded have no such attributes.
+func imagePreviewAttributes(generatedAsset *common.GeneratedAsset, path string) []common.Attribute {
+	renderedImage, err := decodeImageFile(path)
+	if err != nil {
+		log.Println("Could not decode render for preview attributes", err)
+		return nil
+	}
+
+	// Transparent images are flattened onto white, which is also what the jpeg placeholder would show.
+	sample := resizeImage(renderedImage, sampleSize, sampleSize, color.White)
+	attributes := []common.Attribute{
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeBlurHash, []string{blurHash(sample)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeDominantColors, dominantColors(sample, dominantColorSize)),
+	}
+	placeholder, err := lqip(resizeImage(renderedImage, lqipSize, lqipSize, color.White))
+	if err == nil {
+		attributes = append(attributes, generatedAsset.AddAttribute(common.GeneratedAssetAttributeLqip, []string{placeholder}))
+	}
+	return attributes
+}
+
+// blurHash encodes an image with the BlurHash algorithm, using four components along the longer side of the image and three along the shorter side.
+func blurHash(sourceImage image.Image) string {
+	bounds := sourceImage.Bounds()
+	xComponents, yComponents := 4, 3
+	if bounds.Dy() > bounds.Dx() {
+		xComponents, yComponents = 3, 4
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for y := 0; y < yComponents; y++ {
+		for x := 0; x < xComponents; x++ {
+			factors = append(factors, blurHashFactor(sourceImage, x, y))
+		}
+	}
+
+	var hash bytes.Buffer
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		actualMaximumValue := 0.0
+		for _, factor := range factors[1:] {
+			for _, value := range factor {
+				actualMaximumValue = math.Max(actualMaximumValue, math.Abs(value))
+			}
+		}
+		quantisedMaximumValue := int(math.Max(0, math.Min(82, math.Floor(actualMaximumValue*166-0.5))))
+		maximumValue = float64(quantisedMaximumValue+1) / 166
+		hash.WriteString(encodeBase83(quantisedMaximumValue, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encodeBase83(linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4))
+	for _, factor := range factors[1:] {
+		quantised := [3]int{}
+		for i, value := range factor {
+			quantised[i] = int(math.Max(0, math.Min(18, math.Floor(signPow(value/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quantised[0]*19*19+quantised[1]*19+quantised[2], 2))
+	}
+	return hash.String()
+}
+
+// blurHashFactor returns the linear colour of the cosine component of an image.
+func blurHashFactor(sourceImage image.Image, xComponent, yComponent int) [3]float64 {
+	bounds := sourceImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var factor [3]float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			basis := math.Cos(math.Pi*float64(xComponent*x)/float64(width)) * math.Cos(math.Pi*float64(yComponent*y)/float64(height))
+			pixel := color.NRGBAModel.Convert(sourceImage.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			factor[0] += basis * srgbToLinear(pixel.R)
+			factor[1] += basis * srgbToLinear(pixel.G)
+			factor[2] += basis * srgbToLinear(pixel.B)
+		}
+	}
+	normalisation := 2.0
+	if xComponent == 0 && yComponent == 0 {
+		normalisation = 1
+	}
+	scale := normalisation / float64(width*height)
+	return [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale}
+}
+
+func encodeBase83(value, length int) string {
+	encoded := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		encoded[i] = base83Characters[value%83]
+		value /= 83
+	}
+	return string(encoded)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exponent float64) float64 {
+	if value < 0 {
+		return -math.Pow(-value, exponent)
+	}
+	return math.Pow(value, exponent)
+}
+
+// dominantColors returns up to count of the most common colours of an image in the "#rrggbb" format, most common first. Pixels are grouped by the four most significant bits of each channel and each group is reported as the average colour of its pixels.
+func dominantColors(sourceImage image.Image, count int) []string {
+	type colorBucket struct {
+		pixels           int
+		red, green, blue int
+	}
+	buckets := make(map[int]*colorBucket)
+	bounds := sourceImage.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(sourceImage.At(x, y)).(color.NRGBA)
+			key := int(pixel.R>>4)<<8 | int(pixel.G>>4)<<4 | int(pixel.B>>4)
+			bucket, hasBucket := buckets[key]
+			if !hasBucket {
+				bucket = new(colorBucket)
+				buckets[key] = bucket
+			}
+			bucket.pixels++
+			bucket.red += int(pixel.R)
+			bucket.green += int(pixel.G)
+			bucket.blue += int(pixel.B)
+		}
+	}
+
+	keys := make([]int, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if buckets[keys[i]].pixels == buckets[keys[j]].pixels {
+			return keys[i] < keys[j]
+		}
+		return buckets[keys[i]].pixels > buckets[keys[j]].pixels
+	})
+
+	results := make([]string, 0, count)
+	for _, key := range keys {
+		if len(results) == count {
+			break
+		}
+		bucket := buckets[key]
+		results = append(results, fmt.Sprintf("#%02x%02x%02x", bucket.red/bucket.pixels, bucket.green/bucket.pixels, bucket.blue/bucket.pixels))
+	}
+	return results
+}
+
+// lqip encodes a tiny image as a jpeg data URI.
+func lqip(tinyImage image.Image) (string, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, tinyImage, &jpeg.Options{Quality: lqipQuality})
+	if err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
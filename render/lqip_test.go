@@ -0,0 +1,95 @@
+package render
+
+import (
+	"encoding/base64"
+	"github.com/ngerakines/preview/common"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBlurHash(t *testing.T) {
+	landscape := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	draw.Draw(landscape, landscape.Bounds(), image.NewUniform(color.White), image.ZP, draw.Src)
+	hash := blurHash(landscape)
+	// One size character, one maximum value character, four DC characters and two characters for each of the eleven AC components.
+	if len(hash) != 28 {
+		t.Errorf("Unexpected blur hash length: %s", hash)
+	}
+	if !strings.HasPrefix(hash, "L") || hash[2:6] != "TSUA" {
+		t.Errorf("Unexpected blur hash for a white image: %s", hash)
+	}
+
+	portrait := image.NewRGBA(image.Rect(0, 0, 24, 32))
+	if hash := blurHash(portrait); !strings.HasPrefix(hash, "T") || len(hash) != 28 {
+		t.Errorf("Unexpected blur hash for a portrait image: %s", hash)
+	}
+}
+
+func TestDominantColors(t *testing.T) {
+	sourceImage := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(sourceImage, image.Rect(0, 0, 10, 7), image.NewUniform(color.RGBA{200, 0, 0, 255}), image.ZP, draw.Src)
+	draw.Draw(sourceImage, image.Rect(0, 7, 10, 10), image.NewUniform(color.RGBA{0, 0, 200, 255}), image.ZP, draw.Src)
+
+	colors := dominantColors(sourceImage, 5)
+	expected := []string{"#c80000", "#0000c8"}
+	if !reflect.DeepEqual(colors, expected) {
+		t.Errorf("Unexpected dominant colors: %q", colors)
+	}
+	if colors := dominantColors(sourceImage, 1); len(colors) != 1 {
+		t.Errorf("Unexpected number of dominant colors: %q", colors)
+	}
+}
+
+func TestImagePreviewAttributes(t *testing.T) {
+	directory, err := ioutil.TempDir("", "lqip")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "render.png")
+	err = encodeImageFile(image.NewRGBA(image.Rect(0, 0, 300, 200)), path, "png")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	generatedAsset := &common.GeneratedAsset{Id: "C4A81E27-9B3D-4F50-8E6A-2D17F9B0C365"}
+	attributes := imagePreviewAttributes(generatedAsset, path)
+	if len(attributes) != 3 {
+		t.Errorf("Unexpected attributes: %v", attributes)
+		return
+	}
+	// Transparent renders are flattened onto white.
+	if colors := generatedAsset.GetAttribute(common.GeneratedAssetAttributeDominantColors); !reflect.DeepEqual(colors, []string{"#ffffff"}) {
+		t.Errorf("Unexpected dominant colors: %q", colors)
+	}
+
+	placeholder, _ := common.GetFirstAttribute(generatedAsset, common.GeneratedAssetAttributeLqip)
+	if !strings.HasPrefix(placeholder, "data:image/jpeg;base64,") {
+		t.Errorf("Unexpected lqip: %s", placeholder)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(placeholder, "data:image/jpeg;base64,"))
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	config, err := jpeg.DecodeConfig(strings.NewReader(string(data)))
+	if err != nil || config.Width != 16 || config.Height != 11 {
+		t.Errorf("Unexpected lqip image: %+v %v", config, err)
+	}
+
+	if imagePreviewAttributes(generatedAsset, filepath.Join(directory, "missing.png")) != nil {
+		t.Error("Expected no attributes for renders that cannot be decoded")
+	}
+}
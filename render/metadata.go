@@ -0,0 +1,391 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"github.com/ngerakines/preview/common"
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// imageMetadataHeaderSize is the number of bytes at the start of an image that are searched for XMP packets and ICC profiles.
+const imageMetadataHeaderSize = 4 << 20
+
+// imageMetadata contains the metadata read from the EXIF, XMP and ICC profile of an image.
+type imageMetadata struct {
+	// orientation is the EXIF orientation, from 1 to 8, or 0 when the image has none.
+	orientation  int
+	width        int
+	height       int
+	cameraMake   string
+	cameraModel  string
+	captureTime  time.Time
+	hasLocation  bool
+	latitude     float64
+	longitude    float64
+	colorProfile string
+}
+
+// readImageMetadata reads the metadata of an image file. Missing or malformed metadata is ignored; an error is only returned when the file cannot be read.
+func readImageMetadata(limits *processLimits, path string) (*imageMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header, err := ioutil.ReadAll(io.LimitReader(file, imageMetadataHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := new(imageMetadata)
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	exifData, err := exif.Decode(file)
+	if err == nil {
+		metadata.readExif(exifData)
+	}
+	metadata.readXmp(header)
+	metadata.colorProfile = iccProfileDescription(header)
+
+	width, height, err := imageDimensions(limits, path)
+	if err == nil {
+		metadata.width, metadata.height = width, height
+		if metadata.orientation >= 5 {
+			metadata.width, metadata.height = height, width
+		}
+	}
+	return metadata, nil
+}
+
+func (metadata *imageMetadata) readExif(exifData *exif.Exif) {
+	tag, err := exifData.Get(exif.Orientation)
+	if err == nil {
+		orientation, err := tag.Int(0)
+		if err == nil && orientation >= 1 && orientation <= 8 {
+			metadata.orientation = orientation
+		}
+	}
+	metadata.cameraMake = exifString(exifData, exif.Make)
+	metadata.cameraModel = exifString(exifData, exif.Model)
+	captureTime, err := exifData.DateTime()
+	if err == nil {
+		metadata.captureTime = captureTime
+	}
+	latitude, longitude, err := exifData.LatLong()
+	if err == nil {
+		metadata.hasLocation = true
+		metadata.latitude, metadata.longitude = latitude, longitude
+	}
+}
+
+func exifString(exifData *exif.Exif, name exif.FieldName) string {
+	tag, err := exifData.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+// xmpTimeLayouts are the date formats used by XMP properties.
+var xmpTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00", "2006-01-02T15:04", "2006-01-02"}
+
+// readXmp fills the camera and capture time from the XMP packet of an image when they are not in its EXIF.
+func (metadata *imageMetadata) readXmp(header []byte) {
+	start := bytes.Index(header, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return
+	}
+	end := bytes.Index(header[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return
+	}
+	properties := xmpProperties(header[start : start+end+len("</x:xmpmeta>")])
+
+	if metadata.cameraMake == "" {
+		metadata.cameraMake = properties["Make"]
+	}
+	if metadata.cameraModel == "" {
+		metadata.cameraModel = properties["Model"]
+	}
+	if metadata.captureTime.IsZero() {
+		for _, name := range []string{"DateTimeOriginal", "CreateDate", "DateCreated"} {
+			value, hasValue := properties[name]
+			if !hasValue {
+				continue
+			}
+			for _, layout := range xmpTimeLayouts {
+				captureTime, err := time.Parse(layout, value)
+				if err == nil {
+					metadata.captureTime = captureTime
+					break
+				}
+			}
+			if !metadata.captureTime.IsZero() {
+				break
+			}
+		}
+	}
+}
+
+// xmpProperties returns the simple properties of an XMP packet by their local names. Properties may be written as attributes or as elements.
+func xmpProperties(packet []byte) map[string]string {
+	properties := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	elements := make([]string, 0, 0)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return properties
+		}
+		switch value := token.(type) {
+		case xml.StartElement:
+			elements = append(elements, value.Name.Local)
+			for _, attribute := range value.Attr {
+				if _, hasProperty := properties[attribute.Name.Local]; !hasProperty {
+					properties[attribute.Name.Local] = strings.TrimSpace(attribute.Value)
+				}
+			}
+		case xml.EndElement:
+			elements = elements[:len(elements)-1]
+		case xml.CharData:
+			text := strings.TrimSpace(string(value))
+			if text != "" && len(elements) > 0 {
+				name := elements[len(elements)-1]
+				if _, hasProperty := properties[name]; !hasProperty {
+					properties[name] = text
+				}
+			}
+		}
+	}
+}
+
+// iccProfileDescription returns the description of the ICC profile embedded in a jpeg or png image, or an empty string.
+func iccProfileDescription(header []byte) string {
+	var profile []byte
+	if bytes.HasPrefix(header, []byte{0xFF, 0xD8}) {
+		profile = jpegIccProfile(header)
+	} else if bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")) {
+		profile = pngIccProfile(header)
+	}
+	if profile == nil {
+		return ""
+	}
+	return parseIccDescription(profile)
+}
+
+// jpegIccProfile joins the ICC profile chunks stored in the APP2 segments of a jpeg image.
+func jpegIccProfile(data []byte) []byte {
+	var profile []byte
+	position := 2
+	for position+4 <= len(data) {
+		if data[position] != 0xFF {
+			return profile
+		}
+		marker := data[position+1]
+		if marker == 0xFF {
+			position++
+			continue
+		}
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			position += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return profile
+		}
+		length := int(binary.BigEndian.Uint16(data[position+2:]))
+		if length < 2 || position+2+length > len(data) {
+			return profile
+		}
+		segment := data[position+4 : position+2+length]
+		if marker == 0xE2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) && len(segment) > 14 {
+			profile = append(profile, segment[14:]...)
+		}
+		position += 2 + length
+	}
+	return profile
+}
+
+// pngIccProfile decompresses the ICC profile stored in the iCCP chunk of a png image.
+func pngIccProfile(data []byte) []byte {
+	position := 8
+	for position+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[position:]))
+		chunkType := string(data[position+4 : position+8])
+		if length < 0 || position+12+length > len(data) || chunkType == "IDAT" {
+			return nil
+		}
+		if chunkType == "iCCP" {
+			chunk := data[position+8 : position+8+length]
+			separator := bytes.IndexByte(chunk, 0)
+			if separator < 0 || separator+2 > len(chunk) {
+				return nil
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(chunk[separator+2:]))
+			if err != nil {
+				return nil
+			}
+			defer reader.Close()
+			profile, err := ioutil.ReadAll(io.LimitReader(reader, imageMetadataHeaderSize))
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		position += 12 + length
+	}
+	return nil
+}
+
+// parseIccDescription returns the text of the "desc" tag of an ICC profile. Both the version 2 "desc" and version 4 "mluc" tag types are supported.
+func parseIccDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for index := 0; index < count; index++ {
+		entry := 132 + index*12
+		if entry+12 > len(profile) {
+			return ""
+		}
+		if string(profile[entry:entry+4]) != "desc" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 12 || offset+size > len(profile) {
+			return ""
+		}
+		tag := profile[offset : offset+size]
+		switch string(tag[0:4]) {
+		case "desc":
+			length := int(binary.BigEndian.Uint32(tag[8:]))
+			if length < 0 || 12+length > len(tag) {
+				return ""
+			}
+			return strings.TrimSpace(strings.TrimRight(string(tag[12:12+length]), "\x00"))
+		case "mluc":
+			if len(tag) < 28 {
+				return ""
+			}
+			length := int(binary.BigEndian.Uint32(tag[20:]))
+			start := int(binary.BigEndian.Uint32(tag[24:]))
+			if length < 0 || start < 0 || start+length > len(tag) {
+				return ""
+			}
+			units := make([]uint16, length/2)
+			for unit := range units {
+				units[unit] = binary.BigEndian.Uint16(tag[start+unit*2:])
+			}
+			return strings.TrimSpace(strings.TrimRight(string(utf16.Decode(units)), "\x00"))
+		}
+		return ""
+	}
+	return ""
+}
+
+// attributes returns the metadata as source asset attributes. Empty values are not included.
+func (metadata *imageMetadata) attributes() []common.Attribute {
+	attributes := []common.Attribute{
+		common.Attribute{Key: common.SourceAssetAttributeMetadataExtracted, Value: []string{"true"}},
+	}
+	if metadata.width > 0 && metadata.height > 0 {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeImageWidth, Value: []string{strconv.Itoa(metadata.width)}})
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeImageHeight, Value: []string{strconv.Itoa(metadata.height)}})
+	}
+	if metadata.orientation > 0 {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeOrientation, Value: []string{strconv.Itoa(metadata.orientation)}})
+	}
+	if metadata.cameraMake != "" {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeCameraMake, Value: []string{metadata.cameraMake}})
+	}
+	if metadata.cameraModel != "" {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeCameraModel, Value: []string{metadata.cameraModel}})
+	}
+	if !metadata.captureTime.IsZero() {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeCaptureTime, Value: []string{metadata.captureTime.Format(time.RFC3339)}})
+	}
+	if metadata.hasLocation {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeGpsLatitude, Value: []string{strconv.FormatFloat(metadata.latitude, 'f', -1, 64)}})
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeGpsLongitude, Value: []string{strconv.FormatFloat(metadata.longitude, 'f', -1, 64)}})
+	}
+	if metadata.colorProfile != "" {
+		attributes = append(attributes, common.Attribute{Key: common.SourceAssetAttributeColorProfile, Value: []string{metadata.colorProfile}})
+	}
+	return attributes
+}
+
+// recordImageMetadata reads the metadata of an image and stores it as attributes of its source asset, unless that has already been done by the render of another template. The metadata is returned so that the orientation can be applied.
+func recordImageMetadata(limits *processLimits, sasm common.SourceAssetStorageManager, sourceAsset *common.SourceAsset, path string) *imageMetadata {
+	metadata, err := readImageMetadata(limits, path)
+	if err != nil {
+		log.Println("error reading image metadata", err)
+		return new(imageMetadata)
+	}
+	if !sourceAsset.HasAttribute(common.SourceAssetAttributeMetadataExtracted) {
+		err = addSourceAssetAttributes(sasm, sourceAsset, metadata.attributes())
+		if err != nil {
+			log.Println("error storing image metadata", err)
+		}
+	}
+	return metadata
+}
+
+// orientImage transforms an image so that it is displayed upright according to its EXIF orientation.
+func orientImage(sourceImage image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return sourceImage
+	}
+	bounds := sourceImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	source := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(source, source.Bounds(), sourceImage, bounds.Min, draw.Src)
+
+	orientedWidth, orientedHeight := width, height
+	if orientation >= 5 {
+		orientedWidth, orientedHeight = height, width
+	}
+	oriented := image.NewRGBA(image.Rect(0, 0, orientedWidth, orientedHeight))
+	for y := 0; y < orientedHeight; y++ {
+		for x := 0; x < orientedWidth; x++ {
+			var sourceX, sourceY int
+			switch orientation {
+			case 2:
+				sourceX, sourceY = width-1-x, y
+			case 3:
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4:
+				sourceX, sourceY = x, height-1-y
+			case 5:
+				sourceX, sourceY = y, x
+			case 6:
+				sourceX, sourceY = y, height-1-x
+			case 7:
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8:
+				sourceX, sourceY = width-1-y, x
+			}
+			copy(oriented.Pix[oriented.PixOffset(x, y):oriented.PixOffset(x, y)+4], source.Pix[source.PixOffset(sourceX, sourceY):source.PixOffset(sourceX, sourceY)+4])
+		}
+	}
+	return oriented
+}
@@ -0,0 +1,209 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+type testTiffEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	data     []byte
+}
+
+// testTiffIfd encodes a little endian TIFF image file directory that starts at the given offset, followed by the values that do not fit in its entries.
+func testTiffIfd(entries []testTiffEntry, start int) []byte {
+	var ifd, values bytes.Buffer
+	valuesStart := start + 2 + len(entries)*12 + 4
+	binary.Write(&ifd, binary.LittleEndian, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(&ifd, binary.LittleEndian, entry.tag)
+		binary.Write(&ifd, binary.LittleEndian, entry.dataType)
+		binary.Write(&ifd, binary.LittleEndian, entry.count)
+		if len(entry.data) <= 4 {
+			ifd.Write(append(entry.data, make([]byte, 4-len(entry.data))...))
+		} else {
+			binary.Write(&ifd, binary.LittleEndian, uint32(valuesStart+values.Len()))
+			values.Write(entry.data)
+		}
+	}
+	binary.Write(&ifd, binary.LittleEndian, uint32(0))
+	return append(ifd.Bytes(), values.Bytes()...)
+}
+
+func testRationals(values ...uint32) []byte {
+	var buffer bytes.Buffer
+	for _, value := range values {
+		binary.Write(&buffer, binary.LittleEndian, value)
+		binary.Write(&buffer, binary.LittleEndian, uint32(1))
+	}
+	return buffer.Bytes()
+}
+
+func testLong(value int) []byte {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(value))
+	return data
+}
+
+func writeTestExifJpeg(t *testing.T, path string) {
+	ifdEntries := func(gpsOffset int) []testTiffEntry {
+		return []testTiffEntry{
+			{0x010F, 2, 5, []byte("Acme\x00")},
+			{0x0110, 2, 6, []byte("Phone\x00")},
+			{0x0112, 3, 1, []byte{6, 0}},
+			{0x0132, 2, 20, []byte("2020:01:02 03:04:05\x00")},
+			{0x8825, 4, 1, testLong(gpsOffset)},
+		}
+	}
+	ifd := testTiffIfd(ifdEntries(0), 8)
+	ifd = testTiffIfd(ifdEntries(8+len(ifd)), 8)
+	gps := testTiffIfd([]testTiffEntry{
+		{0x0001, 2, 2, []byte("N\x00")},
+		{0x0002, 5, 3, testRationals(12, 30, 0)},
+		{0x0003, 2, 2, []byte("W\x00")},
+		{0x0004, 5, 3, testRationals(45, 15, 0)},
+	}, 8+len(ifd))
+	tiff := append(append([]byte("II*\x00\x08\x00\x00\x00"), ifd...), gps...)
+
+	var encoded bytes.Buffer
+	err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}
+	data := append(append(append([]byte{0xFF, 0xD8}, app1...), segment...), encoded.Bytes()[2:]...)
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadImageMetadata(t *testing.T) {
+	directory, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "source.jpg")
+	writeTestExifJpeg(t, path)
+
+	metadata, err := readImageMetadata(nil, path)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if metadata.orientation != 6 || metadata.width != 2 || metadata.height != 4 {
+		t.Errorf("Unexpected orientation and dimensions: %d %dx%d", metadata.orientation, metadata.width, metadata.height)
+	}
+	if metadata.cameraMake != "Acme" || metadata.cameraModel != "Phone" {
+		t.Errorf("Unexpected camera: %q %q", metadata.cameraMake, metadata.cameraModel)
+	}
+	if metadata.captureTime.Format("2006-01-02 15:04:05") != "2020-01-02 03:04:05" {
+		t.Errorf("Unexpected capture time: %s", metadata.captureTime)
+	}
+	if !metadata.hasLocation || metadata.latitude != 12.5 || metadata.longitude != -45.25 {
+		t.Errorf("Unexpected location: %v %f %f", metadata.hasLocation, metadata.latitude, metadata.longitude)
+	}
+}
+
+func TestReadXmp(t *testing.T) {
+	packet := `<?xpacket begin=""?><x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/" xmp:CreateDate="2019-05-06T07:08:09Z" tiff:Make="Xmp Make">
+<tiff:Model>Xmp Model</tiff:Model>
+</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+	metadata := &imageMetadata{cameraMake: "Exif Make"}
+	metadata.readXmp([]byte("binary prefix" + packet + "binary suffix"))
+	if metadata.cameraMake != "Exif Make" || metadata.cameraModel != "Xmp Model" {
+		t.Errorf("Unexpected camera: %q %q", metadata.cameraMake, metadata.cameraModel)
+	}
+	if metadata.captureTime.UTC().Format("2006-01-02 15:04:05") != "2019-05-06 07:08:09" {
+		t.Errorf("Unexpected capture time: %s", metadata.captureTime)
+	}
+}
+
+func testIccProfile(tag []byte) []byte {
+	profile := make([]byte, 144)
+	binary.BigEndian.PutUint32(profile[128:], 1)
+	copy(profile[132:], "desc")
+	binary.BigEndian.PutUint32(profile[136:], 144)
+	binary.BigEndian.PutUint32(profile[140:], uint32(len(tag)))
+	return append(profile, tag...)
+}
+
+func TestIccProfileDescription(t *testing.T) {
+	text := "sRGB IEC61966-2.1\x00"
+	descTag := append([]byte("desc\x00\x00\x00\x00"), 0, 0, 0, byte(len(text)))
+	descTag = append(descTag, text...)
+	descTag = append(descTag, make([]byte, 12)...)
+	profile := testIccProfile(descTag)
+
+	segment := append([]byte("ICC_PROFILE\x00\x01\x01"), profile...)
+	header := append([]byte{0xFF, 0xD8, 0xFF, 0xE2, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}, segment...)
+	header = append(header, 0xFF, 0xDA)
+	if description := iccProfileDescription(header); description != "sRGB IEC61966-2.1" {
+		t.Errorf("Unexpected jpeg profile description: %q", description)
+	}
+
+	units := utf16.Encode([]rune("Display P3"))
+	mlucTag := append([]byte("mluc\x00\x00\x00\x00"), 0, 0, 0, 1, 0, 0, 0, 12)
+	mlucTag = append(mlucTag, "enUS"...)
+	mlucTag = append(mlucTag, 0, 0, 0, byte(len(units)*2), 0, 0, 0, 28)
+	for _, unit := range units {
+		mlucTag = append(mlucTag, byte(unit>>8), byte(unit))
+	}
+	if description := parseIccDescription(testIccProfile(mlucTag)); description != "Display P3" {
+		t.Errorf("Unexpected mluc profile description: %q", description)
+	}
+
+	if description := iccProfileDescription([]byte("not an image")); description != "" {
+		t.Errorf("Unexpected description: %q", description)
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	sourceImage := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			sourceImage.Set(x, y, color.RGBA{uint8(x * 50), uint8(y * 50), 0, 255})
+		}
+	}
+
+	tests := []struct {
+		orientation      int
+		width, height    int
+		sourceX, sourceY int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 0, 1},
+		{7, 2, 3, 2, 1},
+		{8, 2, 3, 2, 0},
+	}
+	for _, test := range tests {
+		oriented := orientImage(sourceImage, test.orientation)
+		bounds := oriented.Bounds()
+		if bounds.Dx() != test.width || bounds.Dy() != test.height {
+			t.Errorf("Unexpected bounds for orientation %d: %v", test.orientation, bounds)
+			continue
+		}
+		if oriented.At(0, 0) != sourceImage.At(test.sourceX, test.sourceY) {
+			t.Errorf("Unexpected top left pixel for orientation %d: %v", test.orientation, oriented.At(0, 0))
+		}
+	}
+}
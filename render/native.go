@@ -0,0 +1,299 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"strconv"
+)
+
+// nativeImageRenderAgent creates resized images by decoding and resampling images in process.
+type nativeImageRenderAgent struct {
+	baseRenderAgent
+	limits    *processLimits
+	maxPixels int
+}
+
+type nativeImageRenderAgentFactory struct{}
+
+type nativeImageConfig struct {
+	MaxPixels int `json:"maxPixels"`
+}
+
+// defaultNativeImageMaxPixels is the largest image, in pixels, that is decoded when the "maxPixels" key is not configured.
+const defaultNativeImageMaxPixels = 8192 * 8192
+
+func (factory *nativeImageRenderAgentFactory) Name() string {
+	return common.RenderAgentNativeImage
+}
+
+func (factory *nativeImageRenderAgentFactory) ConfigSection() string {
+	return "nativeImageRenderAgent"
+}
+
+func (factory *nativeImageRenderAgentFactory) TemplateIds() []string {
+	return common.NativeImageTemplates
+}
+
+func (factory *nativeImageRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var nativeImageConfig nativeImageConfig
+	err := context.Config.Decode(&nativeImageConfig)
+	if err != nil {
+		return nil, err
+	}
+	maxPixels := nativeImageConfig.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = defaultNativeImageMaxPixels
+	}
+	return newNativeImageRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.WorkChannel, newProcessLimits(context.Config), maxPixels), nil
+}
+
+func newNativeImageRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits,
+	maxPixels int) RenderAgent {
+
+	renderAgent := new(nativeImageRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentNativeImage, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.limits = limits
+	renderAgent.maxPixels = maxPixels
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *nativeImageRenderAgent) renderGeneratedAsset(id string) {
+
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	limits, err := newAnimationLimits(template)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+	renderAgent.agentManager.recordContentHash(sourceAsset, sourceFile.Path())
+
+	metadata := recordImageMetadata(renderAgent.limits.forTemplate(template), renderAgent.sasm, sourceAsset, sourceFile.Path())
+
+	destination := sourceFile.Path() + "-" + template.Id + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	frameCount, duration := 1, 0
+	renderAgent.metrics.ConvertTime.Time(func() {
+		// Files with the same contents that have already been rendered with the template are copied instead of rendered again.
+		previousRender := renderAgent.agentManager.copyPreviousRender(renderAgent.downloader, sourceAsset, generatedAsset, destination)
+		if previousRender != nil {
+			var width, height int
+			width, height, err = imageDimensions(renderAgent.limits.forTemplate(template), destination)
+			bounds = image.Rect(0, 0, width, height)
+			frameCount, duration = previousRenderAnimation(previousRender)
+			return
+		}
+		if limits != nil && fileType == "gif" {
+			bounds, frameCount, duration, err = animate(renderAgent.limits.forTemplate(template), sourceFile.Path(), destination, output, fit, limits)
+			if err != errAnimationLimitExceeded {
+				return
+			}
+			log.Println("Rendering first frame of animation with", frameCount, "frames and a duration of", duration)
+			frameCount, duration = 1, 0
+		}
+		bounds, err = renderAgent.resize(renderAgent.limits.forTemplate(template), sourceFile.Path(), destination, output, fit, metadata.orientation)
+	})
+	if err != nil {
+		log.Println("error resizing image", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+	}
+	if limits != nil {
+		newAttributes = append(newAttributes,
+			generatedAsset.AddAttribute(common.GeneratedAssetAttributeFrameCount, []string{strconv.Itoa(frameCount)}),
+			generatedAsset.AddAttribute(common.GeneratedAssetAttributeDuration, []string{strconv.Itoa(duration)}))
+	}
+
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// previousRenderAnimation returns the frame count and duration recorded for a copied render. Renders without them have a single frame.
+func previousRenderAnimation(previousRender *common.GeneratedAsset) (int, int) {
+	frameCount, err := strconv.Atoi(firstAttribute(previousRender, common.GeneratedAssetAttributeFrameCount))
+	if err != nil {
+		return 1, 0
+	}
+	duration, err := strconv.Atoi(firstAttribute(previousRender, common.GeneratedAssetAttributeDuration))
+	if err != nil {
+		return frameCount, 0
+	}
+	return frameCount, duration
+}
+
+// resize decodes the source image, turns it upright according to its EXIF orientation, resizes it according to the template fit and encodes it to the destination. Images larger than the pixel limit of the agent are not decoded and images are encoded within the limits. Metadata is never copied to the destination. The bounds of the resized image are returned.
+func (renderAgent *nativeImageRenderAgent) resize(limits *processLimits, source, destination, output string, fit *imageFit, orientation int) (image.Rectangle, error) {
+	reader, err := os.Open(source)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	defer reader.Close()
+
+	config, _, err := image.DecodeConfig(reader)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if renderAgent.maxPixels > 0 && int64(config.Width)*int64(config.Height) > int64(renderAgent.maxPixels) {
+		log.Println("Image of", config.Width, "by", config.Height, "pixels exceeds the pixel limit")
+		return image.Rectangle{}, common.ErrorCouldNotResizeImage
+	}
+	_, err = reader.Seek(0, 0)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	sourceImage, _, err := image.Decode(reader)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	resized := fit.apply(orientImage(sourceImage, orientation))
+
+	err = encodeImage(limits, resized, destination, output)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	return resized.Bounds(), nil
+}
+
+// resizeImage scales an image to fit within the given width and height, preserving the aspect ratio. Images are never enlarged. When a background is given, transparent areas are drawn onto it.
+func resizeImage(sourceImage image.Image, width, height int, background color.Color) image.Image {
+	sourceBounds := sourceImage.Bounds()
+	targetWidth, targetHeight := fitWithin(sourceBounds.Dx(), sourceBounds.Dy(), width, height)
+
+	resized := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	if background != nil {
+		draw.Draw(resized, resized.Bounds(), image.NewUniform(background), image.ZP, draw.Src)
+		draw.CatmullRom.Scale(resized, resized.Bounds(), sourceImage, sourceBounds, draw.Over, nil)
+	} else {
+		draw.CatmullRom.Scale(resized, resized.Bounds(), sourceImage, sourceBounds, draw.Src, nil)
+	}
+	return resized
+}
+
+// fitWithin returns the largest dimensions no greater than the source dimensions that fit within the given width and height while preserving the aspect ratio. A width or height of zero is unbounded.
+func fitWithin(sourceWidth, sourceHeight, width, height int) (int, int) {
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return 1, 1
+	}
+	scale := 1.0
+	if width > 0 && sourceWidth > width {
+		scale = float64(width) / float64(sourceWidth)
+	}
+	if height > 0 && float64(sourceHeight)*scale > float64(height) {
+		scale = float64(height) / float64(sourceHeight)
+	}
+	targetWidth := int(float64(sourceWidth)*scale + 0.5)
+	targetHeight := int(float64(sourceHeight)*scale + 0.5)
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+	if targetHeight < 1 {
+		targetHeight = 1
+	}
+	return targetWidth, targetHeight
+}
@@ -0,0 +1,96 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ngerakines/preview/common"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFitWithin(t *testing.T) {
+	cases := []struct {
+		sourceWidth, sourceHeight, width, height int
+		expectedWidth, expectedHeight            int
+	}{
+		{2080, 1560, 1040, 780, 1040, 780},
+		{1000, 2000, 520, 390, 195, 390},
+		{2000, 1000, 250, 188, 250, 125},
+		{100, 50, 1040, 780, 100, 50},
+		{4000, 10, 250, 188, 250, 1},
+		{1000, 500, 0, 100, 200, 100},
+	}
+	for _, c := range cases {
+		width, height := fitWithin(c.sourceWidth, c.sourceHeight, c.width, c.height)
+		if width != c.expectedWidth || height != c.expectedHeight {
+			t.Errorf("fitWithin(%d, %d, %d, %d) = %dx%d, expected %dx%d", c.sourceWidth, c.sourceHeight, c.width, c.height, width, height, c.expectedWidth, c.expectedHeight)
+		}
+	}
+}
+
+func TestResizeImageFlatten(t *testing.T) {
+	sourceImage := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+
+	resized := resizeImage(sourceImage, 100, 100, color.White)
+	if resized.Bounds().Dx() != 100 || resized.Bounds().Dy() != 50 {
+		t.Errorf("Unexpected bounds: %s", resized.Bounds())
+	}
+	r, g, b, a := resized.At(50, 25).RGBA()
+	if r != 0xffff || g != 0xffff || b != 0xffff || a != 0xffff {
+		t.Errorf("Transparent pixel was not flattened onto white: %v", resized.At(50, 25))
+	}
+
+	resized = resizeImage(sourceImage, 100, 100, nil)
+	_, _, _, a = resized.At(50, 25).RGBA()
+	if a != 0 {
+		t.Errorf("Transparent pixel was not preserved: %v", color.RGBAModel.Convert(resized.At(50, 25)))
+	}
+}
+
+func TestPreviousRenderAnimation(t *testing.T) {
+	previousRender := &common.GeneratedAsset{Attributes: []common.Attribute{}}
+	frameCount, duration := previousRenderAnimation(previousRender)
+	if frameCount != 1 || duration != 0 {
+		t.Errorf("Unexpected animation of a still render: %d %d", frameCount, duration)
+	}
+
+	previousRender.AddAttribute(common.GeneratedAssetAttributeFrameCount, []string{"12"})
+	previousRender.AddAttribute(common.GeneratedAssetAttributeDuration, []string{"1200"})
+	frameCount, duration = previousRenderAnimation(previousRender)
+	if frameCount != 12 || duration != 1200 {
+		t.Errorf("Unexpected animation of an animated render: %d %d", frameCount, duration)
+	}
+}
+
+func TestResizePixelLimit(t *testing.T) {
+	directory, err := ioutil.TempDir("", "native")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	// A small png whose header claims it is 30000 by 30000 pixels.
+	var buffer bytes.Buffer
+	png.Encode(&buffer, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buffer.Bytes()
+	binary.BigEndian.PutUint32(data[16:20], 30000)
+	binary.BigEndian.PutUint32(data[20:24], 30000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	source := filepath.Join(directory, "source.png")
+	ioutil.WriteFile(source, data, 0644)
+
+	renderAgent := new(nativeImageRenderAgent)
+	renderAgent.maxPixels = defaultNativeImageMaxPixels
+	fit := &imageFit{width: 100, height: 100}
+	_, err = renderAgent.resize(nil, source, filepath.Join(directory, "destination.jpg"), "jpg", fit, 1)
+	if err == nil || err.Error() != common.ErrorCouldNotResizeImage.Error() {
+		t.Errorf("Expected the oversized image to be rejected: %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultOcrMinTextCharacters = 20
+	defaultOcrDensity           = 300
+)
+
+// ocrRenderAgent recognizes the text of scanned pdf pages and images with tesseract. The text and the bounding box of every recognized word are stored as a json generated asset for each page. Pdf pages that already have a text layer are skipped. Like the document text render agent, it is a supplemental render agent.
+type ocrRenderAgent struct {
+	baseRenderAgent
+	minTextCharacters int
+	limits            *processLimits
+}
+
+type ocrRenderAgentFactory struct{}
+
+type ocrRenderAgentConfig struct {
+	MinTextCharacters int `json:"minTextCharacters"`
+}
+
+// ocrResult is the content of the generated asset of a page. Word boxes are in pixels of the image that text was recognized in, which is width by height pixels.
+type ocrResult struct {
+	Page      int       `json:"page"`
+	Languages []string  `json:"languages"`
+	TextLayer bool      `json:"textLayer"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Text      string    `json:"text"`
+	Words     []ocrWord `json:"words"`
+}
+
+type ocrWord struct {
+	Text       string  `json:"text"`
+	Left       int     `json:"left"`
+	Top        int     `json:"top"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Confidence float64 `json:"confidence"`
+}
+
+var ocrLanguage = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+func (factory *ocrRenderAgentFactory) Name() string {
+	return common.RenderAgentOcr
+}
+
+func (factory *ocrRenderAgentFactory) ConfigSection() string {
+	return "ocrRenderAgent"
+}
+
+func (factory *ocrRenderAgentFactory) TemplateIds() []string {
+	return []string{common.OcrTemplateId}
+}
+
+func (factory *ocrRenderAgentFactory) IsSupplemental() bool {
+	return true
+}
+
+func (factory *ocrRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var ocrConfig ocrRenderAgentConfig
+	err := context.Config.Decode(&ocrConfig)
+	if err != nil {
+		return nil, err
+	}
+	minTextCharacters := defaultOcrMinTextCharacters
+	if ocrConfig.MinTextCharacters > 0 {
+		minTextCharacters = ocrConfig.MinTextCharacters
+	}
+	return newOcrRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, minTextCharacters, context.WorkChannel, newProcessLimits(context.Config)), nil
+}
+
+func newOcrRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	minTextCharacters int,
+	workChannel RenderAgentWorkChannel,
+	limits *processLimits) RenderAgent {
+
+	renderAgent := new(ocrRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentOcr, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.minTextCharacters = minTextCharacters
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *ocrRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	languages, err := ocrLanguages(template)
+	if err != nil {
+		log.Println("invalid ocr languages", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotRecognizeText), nil}
+		return
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	limits := renderAgent.limits.forTemplate(template)
+
+	page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+	isPdf := fileType == "pdf"
+	if isPdf && page == 0 {
+		info, err := readPdfInfo(limits, sourceFile.Path())
+		if err != nil {
+			log.Println("error reading document information", err)
+			statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotRecognizeText), nil}
+			return
+		}
+		// Create derived work for the pages after the first one that are rendered eagerly
+		renderAgent.agentManager.CreatePagedWork(sourceAsset, templates, info.pages)
+	}
+
+	result := &ocrResult{Page: page, Languages: languages, Words: []ocrWord{}}
+	if isPdf {
+		text, err := extractPdfPageText(limits, sourceFile.Path(), page)
+		result.TextLayer = err == nil && hasTextLayer(text, renderAgent.minTextCharacters)
+	}
+
+	if !result.TextLayer {
+		renderAgent.metrics.ConvertTime.Time(func() {
+			var imagePath string
+			var release func()
+			imagePath, release, err = renderAgent.ocrImage(limits, sourceAsset, sourceFile.Path(), isPdf, page, template)
+			if err != nil {
+				return
+			}
+			defer release()
+			var tsv []byte
+			tsv, err = recognizeText(limits, imagePath, languages)
+			if err != nil {
+				return
+			}
+			result.Width, result.Height, result.Text, result.Words = parseTesseractTsv(tsv)
+		})
+		if err != nil {
+			log.Println("error recognizing text", err)
+			statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotRecognizeText), nil}
+			return
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotRecognizeText), nil}
+		return
+	}
+	destination := sourceFile.Path() + "-" + template.Id + "-" + strconv.Itoa(page) + ".json"
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+	err = ioutil.WriteFile(destination, data, 0644)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotRecognizeText), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeTextLayer, []string{strconv.FormatBool(result.TextLayer)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeWordCount, []string{strconv.Itoa(len(result.Words))}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.Itoa(len(data))}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// ocrImage returns the path of the image that text of the page is recognized in and a function that releases it. Images are used as they are, pdf pages are rasterized at the template density unless the template prefers the jumbo preview of the page and it has been rendered.
+func (renderAgent *ocrRenderAgent) ocrImage(limits *processLimits, sourceAsset *common.SourceAsset, source string, isPdf bool, page int, template *common.Template) (string, func(), error) {
+	ocrSource, err := common.GetFirstAttribute(template, common.TemplateAttributeOcrSource)
+	if err == nil && ocrSource == common.TemplateOcrSourcePreview {
+		preview, err := renderAgent.downloadPreview(sourceAsset, page)
+		if err == nil {
+			return preview.Path(), func() { preview.Release() }, nil
+		}
+		log.Println("no preview available for ocr, using the page", err)
+	}
+	if !isPdf {
+		return source, func() {}, nil
+	}
+
+	density := defaultOcrDensity
+	rawDensity, err := common.GetFirstAttribute(template, common.TemplateAttributeDensity)
+	if err == nil {
+		density, err = strconv.Atoi(rawDensity)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	prefix := source + "-" + template.Id + "-" + strconv.Itoa(page)
+	rasterized := renderAgent.temporaryFileManager.Create(prefix + ".png")
+	err = rasterizePdfPage(limits, source, prefix, page, density)
+	if err != nil {
+		rasterized.Release()
+		return "", nil, err
+	}
+	return rasterized.Path(), func() { rasterized.Release() }, nil
+}
+
+// downloadPreview downloads the completed jumbo preview of a page of the source asset.
+func (renderAgent *ocrRenderAgent) downloadPreview(sourceAsset *common.SourceAsset, page int) (common.TemporaryFile, error) {
+	generatedAssets, err := renderAgent.gasm.FindBySourceAssetId(sourceAsset.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, generatedAsset := range generatedAssets {
+		if generatedAsset.SourceAssetType != sourceAsset.IdType || generatedAsset.Status != common.GeneratedAssetStatusComplete {
+			continue
+		}
+		if generatedAsset.TemplateId != common.DefaultTemplateJumbo.Id && generatedAsset.TemplateId != common.NativeImageTemplateJumbo.Id {
+			continue
+		}
+		generatedAssetPage, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+		if generatedAssetPage == page {
+			return renderAgent.downloader.Download(generatedAsset.Location, common.SourceAssetSource(sourceAsset))
+		}
+	}
+	return nil, common.ErrorNoGeneratedAssetsFoundForId
+}
+
+// ocrLanguages returns the tesseract languages of the template, defaulting to english.
+func ocrLanguages(template *common.Template) ([]string, error) {
+	languages := template.GetAttribute(common.TemplateAttributeLanguages)
+	if len(languages) == 0 {
+		return []string{"eng"}, nil
+	}
+	for _, language := range languages {
+		if !ocrLanguage.MatchString(language) {
+			return nil, fmt.Errorf("invalid language %q", language)
+		}
+	}
+	return languages, nil
+}
+
+// hasTextLayer returns true when the text extracted from a page has at least minTextCharacters characters that are not white space.
+func hasTextLayer(text []byte, minTextCharacters int) bool {
+	characters := 0
+	for _, character := range string(text) {
+		if !unicode.IsSpace(character) {
+			characters++
+			if characters >= minTextCharacters {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rasterizePdfPage draws a zero based page of a pdf document as a grayscale png image at prefix.png.
+func rasterizePdfPage(limits *processLimits, source, prefix string, page, density int) error {
+	_, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		log.Println("pdftoppm command not found")
+		return err
+	}
+	pageNumber := strconv.Itoa(page + 1)
+	cmd := limits.command("pdftoppm", "-q", "-f", pageNumber, "-l", pageNumber, "-r", strconv.Itoa(density), "-gray", "-png", "-singlefile", source, prefix)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(buf.String())
+		return err
+	}
+	return nil
+}
+
+// recognizeText runs tesseract against an image and returns its tsv output.
+func recognizeText(limits *processLimits, path string, languages []string) ([]byte, error) {
+	_, err := exec.LookPath("tesseract")
+	if err != nil {
+		log.Println("tesseract command not found")
+		return nil, err
+	}
+	cmd := limits.command("tesseract", path, "stdout", "-l", strings.Join(languages, "+"), "tsv")
+	log.Println(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(stderr.String())
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseTesseractTsv reads the size of the page and the recognized words from tesseract tsv output. The text joins the words of a line with spaces, lines with new lines and paragraphs with blank lines.
+func parseTesseractTsv(tsv []byte) (int, int, string, []ocrWord) {
+	var width, height int
+	var text bytes.Buffer
+	words := make([]ocrWord, 0, 0)
+	var lastBlock, lastParagraph, lastLine string
+
+	scanner := bufio.NewScanner(bytes.NewReader(tsv))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 12 {
+			continue
+		}
+		level, err := strconv.Atoi(fields[0])
+		if err != nil {
+			// The header row.
+			continue
+		}
+		box := make([]int, 4)
+		for index := range box {
+			box[index], _ = strconv.Atoi(fields[6+index])
+		}
+		if level == 1 {
+			width, height = box[2], box[3]
+			continue
+		}
+		wordText := strings.TrimSpace(fields[11])
+		if level != 5 || wordText == "" {
+			continue
+		}
+		confidence, _ := strconv.ParseFloat(fields[10], 64)
+		words = append(words, ocrWord{wordText, box[0], box[1], box[2], box[3], confidence})
+
+		block, paragraph, line := fields[2], fields[3], fields[4]
+		if text.Len() > 0 {
+			if block != lastBlock || paragraph != lastParagraph {
+				text.WriteString("\n\n")
+			} else if line != lastLine {
+				text.WriteString("\n")
+			} else {
+				text.WriteString(" ")
+			}
+		}
+		text.WriteString(wordText)
+		lastBlock, lastParagraph, lastLine = block, paragraph, line
+	}
+	return width, height, text.String(), words
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"reflect"
+	"testing"
+)
+
+const testTesseractTsv = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t2550\t3300\t-1\t\n" +
+	"2\t1\t1\t0\t0\t0\t100\t120\t900\t80\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t100\t120\t200\t40\t96.5\tInvoice\n" +
+	"5\t1\t1\t1\t1\t2\t320\t120\t150\t40\t91\tnumber\n" +
+	"5\t1\t1\t1\t2\t1\t100\t170\t120\t40\t88\t42\n" +
+	"5\t1\t1\t1\t2\t2\t240\t170\t20\t40\t95\t \n" +
+	"5\t1\t2\t1\t1\t1\t100\t400\t180\t40\t90.25\tTotal\n"
+
+func TestParseTesseractTsv(t *testing.T) {
+	width, height, text, words := parseTesseractTsv([]byte(testTesseractTsv))
+	if width != 2550 || height != 3300 {
+		t.Errorf("Unexpected page size: %dx%d", width, height)
+	}
+	if text != "Invoice number\n42\n\nTotal" {
+		t.Errorf("Unexpected text: %q", text)
+	}
+	if len(words) != 4 {
+		t.Errorf("Unexpected words: %v", words)
+		return
+	}
+	expected := ocrWord{"Total", 100, 400, 180, 40, 90.25}
+	if !reflect.DeepEqual(words[3], expected) {
+		t.Errorf("Unexpected word: %+v", words[3])
+	}
+
+	_, _, text, words = parseTesseractTsv([]byte{})
+	if text != "" || len(words) != 0 {
+		t.Errorf("Unexpected result for empty output: %q %v", text, words)
+	}
+}
+
+func TestHasTextLayer(t *testing.T) {
+	if hasTextLayer([]byte("  \n\f  \t"), 1) {
+		t.Error("Expected white space not to be a text layer")
+	}
+	if hasTextLayer([]byte("Page 1"), 20) {
+		t.Error("Expected a few characters not to be a text layer")
+	}
+	if !hasTextLayer([]byte("The quick brown fox jumps over the lazy dog"), 20) {
+		t.Error("Expected a sentence to be a text layer")
+	}
+}
+
+func TestOcrLanguages(t *testing.T) {
+	languages, err := ocrLanguages(common.OcrTemplate)
+	if err != nil || !reflect.DeepEqual(languages, []string{"eng"}) {
+		t.Errorf("Unexpected languages: %v %v", languages, err)
+	}
+
+	template := &common.Template{Id: "E5A0C3B1-9D7F-4E62-8A14-C0B9D2F7E351", Renderer: common.RenderAgentOcr}
+	languages, err = ocrLanguages(template)
+	if err != nil || !reflect.DeepEqual(languages, []string{"eng"}) {
+		t.Errorf("Unexpected default languages: %v %v", languages, err)
+	}
+
+	template.AddAttribute(common.TemplateAttributeLanguages, []string{"deu", "chi_sim"})
+	languages, err = ocrLanguages(template)
+	if err != nil || !reflect.DeepEqual(languages, []string{"deu", "chi_sim"}) {
+		t.Errorf("Unexpected languages: %v %v", languages, err)
+	}
+
+	template.Attributes = []common.Attribute{common.Attribute{Key: common.TemplateAttributeLanguages, Value: []string{"eng+../../etc"}}}
+	_, err = ocrLanguages(template)
+	if err == nil {
+		t.Error("Expected an error for an invalid language")
+	}
+}
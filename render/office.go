@@ -0,0 +1,348 @@
+package render
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	officeWorkerStateStarting   = "starting"
+	officeWorkerStateReady      = "ready"
+	officeWorkerStateConverting = "converting"
+	officeWorkerStateStopped    = "stopped"
+	officeWorkerStateFailed     = "failed"
+
+	defaultOfficeMaxConversions      = 100
+	defaultOfficeHealthCheckInterval = 30
+	officeStartTimeout               = 30 * time.Second
+)
+
+var errOfficeWorkerNotRunning = errors.New("libreoffice worker is not running")
+
+// officeWorker is a long running LibreOffice process that accepts conversions over the UNO socket interface. Each document render agent owns one worker, so the pool has as many members as there are document render agents. Every worker has its own user profile so that workers never share state. When unoconv, the UNO client used to submit conversions, is not available, documents are converted by starting soffice for each document with the profile of the worker.
+type officeWorker struct {
+	limits         *processLimits
+	maxConversions int
+	pooled         bool
+
+	mu              sync.Mutex
+	cmd             *exec.Cmd
+	exited          chan struct{}
+	profile         string
+	port            int
+	state           string
+	conversions     int
+	restarts        int
+	started         time.Time
+	lastHealthCheck time.Time
+	launch          *officeLaunch
+}
+
+// officeWorkerStatus is the state of a worker reported on the render agents admin resource.
+type officeWorkerStatus struct {
+	State           string    `json:"state"`
+	Pooled          bool      `json:"pooled"`
+	Pid             int       `json:"pid,omitempty"`
+	Port            int       `json:"port,omitempty"`
+	Profile         string    `json:"profile"`
+	Conversions     int       `json:"conversions"`
+	Restarts        int       `json:"restarts"`
+	Started         time.Time `json:"started"`
+	LastHealthCheck time.Time `json:"lastHealthCheck"`
+}
+
+func newOfficeWorker(basePath string, limits *processLimits, maxConversions int) (*officeWorker, error) {
+	if basePath == "" {
+		basePath = os.TempDir()
+	}
+	err := os.MkdirAll(basePath, 0777)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := ioutil.TempDir(basePath, "libreoffice-profile")
+	if err != nil {
+		return nil, err
+	}
+
+	worker := new(officeWorker)
+	worker.limits = limits
+	worker.maxConversions = maxConversions
+	worker.profile = profile
+	worker.state = officeWorkerStateStopped
+	_, err = exec.LookPath("unoconv")
+	worker.pooled = err == nil
+	if !worker.pooled {
+		log.Println("unoconv command not found, starting soffice for every document with the profile", profile)
+	}
+	return worker, nil
+}
+
+// officeLaunch is a LibreOffice listener that has been started but may not accept connections yet. The done channel is closed once the worker has finished waiting for it.
+type officeLaunch struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	port   int
+	done   chan struct{}
+}
+
+// start launches the LibreOffice listener of a pooled worker and waits for it to accept connections.
+func (worker *officeWorker) start() error {
+	worker.mu.Lock()
+	launch, err := worker.launchLocked()
+	worker.mu.Unlock()
+	return worker.awaitLaunch(launch, err)
+}
+
+// launchLocked starts the LibreOffice listener of a pooled worker without waiting for it to accept connections. Workers that are not pooled are ready without a listener and have no launch.
+func (worker *officeWorker) launchLocked() (*officeLaunch, error) {
+	if !worker.pooled {
+		worker.state = officeWorkerStateReady
+		return nil, nil
+	}
+	_, err := exec.LookPath("soffice")
+	if err != nil {
+		log.Println("soffice command not found")
+		worker.state = officeWorkerStateFailed
+		return nil, err
+	}
+	port, err := freeLocalPort()
+	if err != nil {
+		worker.state = officeWorkerStateFailed
+		return nil, err
+	}
+
+	cmd := worker.limits.command("soffice", "--headless", "--invisible", "--nologo", "--nodefault", "--norestore", "--nofirststartwizard", worker.profileArgument(), "--accept="+officeConnection(port))
+	log.Println(cmd)
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	if err != nil {
+		worker.state = officeWorkerStateFailed
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	launch := &officeLaunch{cmd: cmd, exited: exited, port: port, done: make(chan struct{})}
+	worker.cmd = cmd
+	worker.exited = exited
+	worker.port = port
+	worker.launch = launch
+	worker.state = officeWorkerStateStarting
+	worker.conversions = 0
+	worker.started = time.Now()
+	return launch, nil
+}
+
+// awaitLaunch waits, without holding the lock of the worker, for a launched listener to accept connections and marks the worker as ready or failed. When there is no launch, the error of the launch is returned.
+func (worker *officeWorker) awaitLaunch(launch *officeLaunch, err error) error {
+	if launch == nil {
+		return err
+	}
+
+	err = errOfficeWorkerNotRunning
+	deadline := time.Now().Add(officeStartTimeout)
+wait:
+	for time.Now().Before(deadline) {
+		if officeAcceptsConnections(launch.port) {
+			err = nil
+			break
+		}
+		select {
+		case <-launch.exited:
+			break wait
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	defer close(launch.done)
+	if worker.launch == launch {
+		worker.launch = nil
+	}
+	// The worker was stopped or restarted while the listener was starting.
+	if worker.cmd != launch.cmd {
+		return errOfficeWorkerNotRunning
+	}
+	if err != nil {
+		worker.stopLocked()
+		worker.state = officeWorkerStateFailed
+		return err
+	}
+	worker.state = officeWorkerStateReady
+	return nil
+}
+
+// stop kills the LibreOffice listener and every process it started.
+func (worker *officeWorker) stop() {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	worker.stopLocked()
+}
+
+func (worker *officeWorker) stopLocked() {
+	if worker.cmd != nil {
+		killProcessGroup(worker.cmd)
+		select {
+		case <-worker.exited:
+		case <-time.After(5 * time.Second):
+		}
+		worker.cmd = nil
+	}
+	worker.state = officeWorkerStateStopped
+}
+
+// close stops the worker and removes its profile.
+func (worker *officeWorker) close() {
+	worker.stop()
+	os.RemoveAll(worker.profile)
+}
+
+// restartLocked replaces the LibreOffice listener with a new one using the same profile. The launch must be awaited once the lock is released.
+func (worker *officeWorker) restartLocked() (*officeLaunch, error) {
+	log.Println("Recycling libreoffice worker", worker.profile)
+	worker.stopLocked()
+	worker.restarts++
+	return worker.launchLocked()
+}
+
+// checkHealth restarts a pooled worker whose listener has exited or stopped accepting connections.
+func (worker *officeWorker) checkHealth() {
+	worker.mu.Lock()
+	worker.lastHealthCheck = time.Now()
+	if !worker.pooled || worker.state == officeWorkerStateStopped || worker.state == officeWorkerStateStarting {
+		worker.mu.Unlock()
+		return
+	}
+	if worker.state == officeWorkerStateConverting || (worker.state == officeWorkerStateReady && worker.isRunning() && officeAcceptsConnections(worker.port)) {
+		worker.mu.Unlock()
+		return
+	}
+	launch, err := worker.restartLocked()
+	worker.mu.Unlock()
+	worker.awaitLaunch(launch, err)
+}
+
+// convert converts the source document into the format in the destination directory. Workers are recycled after a failed conversion and once they have converted the maximum number of documents. Only the render agent that owns the worker converts documents with it.
+func (worker *officeWorker) convert(limits *processLimits, format, source, destination string) error {
+	if !worker.pooled {
+		return runLimitedCommand(limits, "soffice", "--headless", "--nologo", "--nofirststartwizard", "--norestore", worker.profileArgument(), "--convert-to", format, source, "--outdir", destination)
+	}
+
+	worker.mu.Lock()
+	// A listener started by a health check is waited for instead of being replaced.
+	for worker.launch != nil {
+		launch := worker.launch
+		worker.mu.Unlock()
+		<-launch.done
+		worker.mu.Lock()
+	}
+	if worker.state != officeWorkerStateReady || !worker.isRunning() {
+		launch, err := worker.restartLocked()
+		worker.mu.Unlock()
+		err = worker.awaitLaunch(launch, err)
+		if err != nil {
+			return err
+		}
+		worker.mu.Lock()
+		if worker.state != officeWorkerStateReady {
+			worker.mu.Unlock()
+			return errOfficeWorkerNotRunning
+		}
+	}
+	worker.state = officeWorkerStateConverting
+	port := worker.port
+	worker.mu.Unlock()
+
+	err := runLimitedCommand(limits, "unoconv", "--connection", officeConnection(port), "--no-launch", "--format", format, "--output", destination+string(filepath.Separator), source)
+
+	worker.mu.Lock()
+	worker.conversions++
+	worker.state = officeWorkerStateReady
+	if err != nil || worker.conversions >= worker.maxConversions {
+		launch, restartErr := worker.restartLocked()
+		worker.mu.Unlock()
+		worker.awaitLaunch(launch, restartErr)
+		return err
+	}
+	worker.mu.Unlock()
+	return err
+}
+
+// status returns the state of the worker.
+func (worker *officeWorker) status() officeWorkerStatus {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	status := officeWorkerStatus{
+		State:           worker.state,
+		Pooled:          worker.pooled,
+		Port:            worker.port,
+		Profile:         worker.profile,
+		Conversions:     worker.conversions,
+		Restarts:        worker.restarts,
+		Started:         worker.started,
+		LastHealthCheck: worker.lastHealthCheck,
+	}
+	if worker.cmd != nil && worker.cmd.Process != nil {
+		status.Pid = worker.cmd.Process.Pid
+	}
+	return status
+}
+
+func (worker *officeWorker) isRunning() bool {
+	if worker.cmd == nil {
+		return false
+	}
+	select {
+	case <-worker.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// officeAcceptsConnections returns true when a LibreOffice listener accepts connections on a local port.
+func officeAcceptsConnections(port int) bool {
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), 2*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// profileArgument returns the LibreOffice argument that sets the user profile of the worker.
+func (worker *officeWorker) profileArgument() string {
+	return officeProfileArgument(worker.profile)
+}
+
+// officeProfileArgument returns the LibreOffice argument that sets the user profile to an absolute directory.
+func officeProfileArgument(profile string) string {
+	return "-env:UserInstallation=file://" + filepath.ToSlash(profile)
+}
+
+// officeConnection returns the UNO connection string of a LibreOffice listener on a local port.
+func officeConnection(port int) string {
+	return "socket,host=127.0.0.1,port=" + strconv.Itoa(port) + ";urp;StarOffice.ComponentContext"
+}
+
+// freeLocalPort returns a local port that is not in use.
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,152 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOfficeWorkerConvert(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake soffice command requires a shell")
+	}
+	bin, err := ioutil.TempDir("", "office-bin")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(bin)
+	// The fake soffice command records its arguments as the converted document.
+	script := "#!/bin/sh\nfor last; do :; done\necho \"$@\" > \"$last/document.pdf\"\n"
+	err = ioutil.WriteFile(filepath.Join(bin, "soffice"), []byte(script), 0755)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin)
+
+	worker, err := newOfficeWorker(bin, nil, 2)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer worker.close()
+	if worker.pooled {
+		t.Error("Expected workers not to be pooled without unoconv")
+	}
+	if !strings.HasPrefix(worker.profile, filepath.Join(bin, "libreoffice-profile")) {
+		t.Errorf("Unexpected profile: %s", worker.profile)
+	}
+	err = worker.start()
+	if err != nil || worker.status().State != officeWorkerStateReady {
+		t.Errorf("Unexpected worker state: %+v %v", worker.status(), err)
+	}
+
+	destination := filepath.Join(bin, "out")
+	os.Mkdir(destination, 0777)
+	err = worker.convert(nil, "pdf", "report.docx", destination)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	args, err := ioutil.ReadFile(filepath.Join(destination, "document.pdf"))
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if !strings.Contains(string(args), "-env:UserInstallation=file://"+filepath.ToSlash(worker.profile)) || !strings.Contains(string(args), "--convert-to pdf report.docx") {
+		t.Errorf("Unexpected soffice arguments: %s", args)
+	}
+
+	worker.checkHealth()
+	status := worker.status()
+	if status.State != officeWorkerStateReady || status.Restarts != 0 || status.LastHealthCheck.IsZero() {
+		t.Errorf("Unexpected worker status: %+v", status)
+	}
+
+	other, err := newOfficeWorker(bin, nil, 2)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer other.close()
+	if other.profile == worker.profile {
+		t.Error("Expected every worker to have its own profile")
+	}
+}
+
+func TestOfficeWorkerRecycle(t *testing.T) {
+	worker := &officeWorker{pooled: true, state: officeWorkerStateReady, profile: os.TempDir()}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", "")
+
+	// Without a running listener, the health check tries to start a new one.
+	worker.checkHealth()
+	status := worker.status()
+	if status.Restarts != 1 || status.State != officeWorkerStateFailed {
+		t.Errorf("Unexpected worker status: %+v", status)
+	}
+
+	err := worker.convert(nil, "pdf", "report.docx", os.TempDir())
+	if err == nil {
+		t.Error("Expected an error without a listener")
+	}
+	if worker.status().Restarts != 2 {
+		t.Errorf("Expected the worker to be restarted before converting: %+v", worker.status())
+	}
+}
+
+func TestOfficeWorkerStartUnlocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake soffice command requires a shell")
+	}
+	bin, err := ioutil.TempDir("", "office-bin")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(bin)
+	// The fake soffice command exits without ever accepting connections.
+	err = ioutil.WriteFile(filepath.Join(bin, "soffice"), []byte("#!/bin/sh\nsleep 1\n"), 0755)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	worker := &officeWorker{pooled: true, state: officeWorkerStateStopped, profile: bin}
+	started := make(chan error)
+	go func() {
+		started <- worker.start()
+	}()
+
+	// The status of the worker can be read while it waits for the listener.
+	deadline := time.Now().Add(time.Second)
+	for worker.status().State != officeWorkerStateStarting && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if worker.status().State != officeWorkerStateStarting {
+		t.Errorf("Expected the worker to be starting: %+v", worker.status())
+	}
+
+	err = <-started
+	if err == nil || worker.status().State != officeWorkerStateFailed {
+		t.Errorf("Unexpected worker state: %+v %v", worker.status(), err)
+	}
+}
+
+func TestOfficeConnection(t *testing.T) {
+	if officeConnection(2002) != "socket,host=127.0.0.1,port=2002;urp;StarOffice.ComponentContext" {
+		t.Errorf("Unexpected connection: %s", officeConnection(2002))
+	}
+	port, err := freeLocalPort()
+	if err != nil || port == 0 {
+		t.Errorf("Unexpected port: %d %v", port, err)
+	}
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"github.com/rcrowley/go-metrics"
+	"sync"
+)
+
+// RenderAgentFactory describes a type of render agent: its name, the configuration section it reads, the templates used when work is routed to it and how instances of it are created.
+type RenderAgentFactory interface {
+	// Name returns the name of the render agent. Templates reference the render agent that processes them by this name.
+	Name() string
+	// ConfigSection returns the key of the configuration section for the render agent. It is also used as the prefix of the render agent's metrics.
+	ConfigSection() string
+	// TemplateIds returns the ids of the templates used to create generated assets for source assets with a file type supported by the render agent.
+	TemplateIds() []string
+	// NewRenderAgent creates and starts a new render agent.
+	NewRenderAgent(context *RenderAgentContext) (RenderAgent, error)
+}
+
+// RenderAgentConfigValidator is implemented by render agent factories that verify their configuration before any render agents are created.
+type RenderAgentConfigValidator interface {
+	ValidateConfig(renderAgentConfig *config.RenderAgentConfig) error
+}
+
+// GeneratedAssetLocator is implemented by render agent factories that store generated assets somewhere other than the location given by the uploader.
+type GeneratedAssetLocator interface {
+	Location(renderAgentConfig *config.RenderAgentConfig, sourceAsset *common.SourceAsset, template *common.Template) string
+}
+
+// SupplementalRenderAgentFactory is implemented by render agent factories whose templates are added to the work of the render agent that a file type is routed to instead of taking the file type over.
+type SupplementalRenderAgentFactory interface {
+	IsSupplemental() bool
+}
+
+// RenderAgentContext contains the shared state given to a render agent factory when a render agent is created.
+type RenderAgentContext struct {
+	AgentManager                 *RenderAgentManager
+	Metrics                      *RenderAgentMetrics
+	Config                       *config.RenderAgentConfig
+	SourceAssetStorageManager    common.SourceAssetStorageManager
+	GeneratedAssetStorageManager common.GeneratedAssetStorageManager
+	TemplateManager              common.TemplateManager
+	TemporaryFileManager         common.TemporaryFileManager
+	Downloader                   common.Downloader
+	Uploader                     common.Uploader
+	WorkChannel                  RenderAgentWorkChannel
+}
+
+// RenderAgentMetrics contains the metrics shared by all of the render agents of a given type.
+type RenderAgentMetrics struct {
+	WorkProcessed metrics.Meter
+	ConvertTime   metrics.Timer
+	FileTypeCount map[string]metrics.Counter
+}
+
+var (
+	renderAgentFactories   = make([]RenderAgentFactory, 0, 0)
+	renderAgentFactoriesMu sync.Mutex
+)
+
+func init() {
+	RegisterRenderAgentFactory(new(documentRenderAgentFactory))
+	RegisterRenderAgentFactory(new(videoRenderAgentFactory))
+	RegisterRenderAgentFactory(new(ffmpegRenderAgentFactory))
+	RegisterRenderAgentFactory(new(audioRenderAgentFactory))
+	RegisterRenderAgentFactory(new(spreadsheetRenderAgentFactory))
+	RegisterRenderAgentFactory(new(textRenderAgentFactory))
+	RegisterRenderAgentFactory(new(svgRenderAgentFactory))
+	RegisterRenderAgentFactory(new(archiveRenderAgentFactory))
+	RegisterRenderAgentFactory(new(emailRenderAgentFactory))
+	RegisterRenderAgentFactory(new(documentTextRenderAgentFactory))
+	RegisterRenderAgentFactory(new(ocrRenderAgentFactory))
+	RegisterRenderAgentFactory(new(nativeImageRenderAgentFactory))
+	RegisterRenderAgentFactory(new(imageMagickRenderAgentFactory))
+}
+
+// RegisterRenderAgentFactory makes a type of render agent available to render agent managers. Work is routed to the first registered and enabled render agent that supports a file type. It panics if a render agent with the same name has already been registered.
+func RegisterRenderAgentFactory(factory RenderAgentFactory) {
+	renderAgentFactoriesMu.Lock()
+	defer renderAgentFactoriesMu.Unlock()
+	for _, registeredFactory := range renderAgentFactories {
+		if registeredFactory.Name() == factory.Name() {
+			panic(fmt.Sprintf("render: RegisterRenderAgentFactory called twice for render agent %s", factory.Name()))
+		}
+	}
+	renderAgentFactories = append(renderAgentFactories, factory)
+}
+
+// RenderAgentFactories returns the registered render agent factories in the order that they were registered.
+func RenderAgentFactories() []RenderAgentFactory {
+	renderAgentFactoriesMu.Lock()
+	defer renderAgentFactoriesMu.Unlock()
+	results := make([]RenderAgentFactory, len(renderAgentFactories))
+	copy(results, renderAgentFactories)
+	return results
+}
+
+// NewRenderAgentConfigs reads the configuration section of every registered render agent, keyed by render agent name.
+func NewRenderAgentConfigs(appConfig *config.AppConfig) (map[string]*config.RenderAgentConfig, error) {
+	results := make(map[string]*config.RenderAgentConfig)
+	for _, factory := range RenderAgentFactories() {
+		renderAgentConfig, err := appConfig.RenderAgentSection(factory.ConfigSection())
+		if err != nil {
+			return nil, err
+		}
+		results[factory.Name()] = renderAgentConfig
+	}
+	return results, nil
+}
+
+func newRenderAgentMetrics(registry metrics.Registry, prefix string, supportedFileTypes []string) *RenderAgentMetrics {
+	renderAgentMetrics := new(RenderAgentMetrics)
+	renderAgentMetrics.WorkProcessed = metrics.NewMeter()
+	renderAgentMetrics.ConvertTime = metrics.NewTimer()
+
+	renderAgentMetrics.FileTypeCount = make(map[string]metrics.Counter)
+
+	for _, filetype := range supportedFileTypes {
+		renderAgentMetrics.FileTypeCount[filetype] = metrics.NewCounter()
+		registry.Register(fmt.Sprintf("%s.%sCount", prefix, filetype), renderAgentMetrics.FileTypeCount[filetype])
+	}
+
+	registry.Register(prefix+".workProcessed", renderAgentMetrics.WorkProcessed)
+	registry.Register(prefix+".convertTime", renderAgentMetrics.ConvertTime)
+
+	return renderAgentMetrics
+}
@@ -0,0 +1,122 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"github.com/ngerakines/preview/util"
+	"github.com/rcrowley/go-metrics"
+	"testing"
+)
+
+type testRenderAgentFactory struct{}
+
+var testRenderAgentTemplate = &common.Template{
+	Id:       "9A1B3C66-4B3E-4C1F-9A0E-5F3A6B8E2D11",
+	Renderer: "renderAgentTest",
+	Group:    "T35T",
+	Attributes: []common.Attribute{
+		common.Attribute{Key: common.TemplateAttributeOutput, Value: []string{"txt"}},
+		common.Attribute{Key: common.TemplateAttributePlaceholderSize, Value: []string{common.PlaceholderSizeJumbo}},
+	},
+}
+
+func init() {
+	RegisterRenderAgentFactory(new(testRenderAgentFactory))
+}
+
+func (factory *testRenderAgentFactory) Name() string {
+	return "renderAgentTest"
+}
+
+func (factory *testRenderAgentFactory) ConfigSection() string {
+	return "testRenderAgent"
+}
+
+func (factory *testRenderAgentFactory) TemplateIds() []string {
+	return []string{testRenderAgentTemplate.Id}
+}
+
+func (factory *testRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	return nil, common.ErrorNotImplemented
+}
+
+func TestRegisteredRenderAgentReceivesWork(t *testing.T) {
+	tm := common.NewTemplateManager()
+	tm.Store(testRenderAgentTemplate)
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	uploader := common.NewLocalUploader("")
+
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		"renderAgentTest": &config.RenderAgentConfig{SupportedFileTypes: []string{"txt"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, common.NewTemporaryFileManager(), uploader, false, renderAgentConfigs)
+
+	rm.CreateWork("5B54B2AE-60D7-4BC6-B15A-B1E5F2E2B7A4", "file:///tmp/notes.txt", "txt", 12)
+
+	generatedAssets, err := gasm.FindBySourceAssetId("5B54B2AE-60D7-4BC6-B15A-B1E5F2E2B7A4")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(generatedAssets) != 1 {
+		t.Error("One generated asset expected:", len(generatedAssets))
+		return
+	}
+	if generatedAssets[0].TemplateId != testRenderAgentTemplate.Id {
+		t.Errorf("Unexpected template for generated asset: %s", generatedAssets[0].TemplateId)
+	}
+
+	names := rm.RenderAgentNames()
+	if !util.Contains(names, "renderAgentTest") || !util.Contains(names, common.RenderAgentImageMagick) {
+		t.Error("Registered render agents missing from render agent manager:", names)
+	}
+}
+
+func TestRegisterRenderAgentFactoryTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected duplicate registration to panic.")
+		}
+	}()
+	RegisterRenderAgentFactory(new(testRenderAgentFactory))
+}
+
+func TestEnabledRenderAgentPreferred(t *testing.T) {
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	uploader := common.NewLocalUploader("")
+
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentVideo:  &config.RenderAgentConfig{SupportedFileTypes: []string{"mp4"}, Raw: []byte("{}")},
+		common.RenderAgentFfmpeg: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"mp4"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, common.NewTemporaryFileManager(), uploader, false, renderAgentConfigs)
+
+	rm.CreateWork("0E3D2BB4-4D4B-4E63-9C4A-3B7F0D8E3C51", "file:///tmp/movie.mp4", "mp4", 12)
+
+	generatedAssets, err := gasm.FindBySourceAssetId("0E3D2BB4-4D4B-4E63-9C4A-3B7F0D8E3C51")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(generatedAssets) != 3 {
+		t.Error("Three generated assets expected:", len(generatedAssets))
+		return
+	}
+	for _, generatedAsset := range generatedAssets {
+		switch generatedAsset.TemplateId {
+		case common.FfmpegVideoConversionTemplateId:
+			if generatedAsset.Location != "local:///0E3D2BB4-4D4B-4E63-9C4A-3B7F0D8E3C51/"+common.FfmpegVideoConversionTemplateId+"/0.m3u8" {
+				t.Errorf("Unexpected location for generated asset: %s", generatedAsset.Location)
+			}
+		case common.VideoPosterFrameTemplateId, common.VideoSpriteSheetTemplateId:
+			if generatedAsset.Location != "local:///0E3D2BB4-4D4B-4E63-9C4A-3B7F0D8E3C51/"+generatedAsset.TemplateId+"/0" {
+				t.Errorf("Unexpected location for generated asset: %s", generatedAsset.Location)
+			}
+		default:
+			t.Errorf("Unexpected template for generated asset: %s", generatedAsset.TemplateId)
+		}
+	}
+}
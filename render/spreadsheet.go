@@ -0,0 +1,813 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultSpreadsheetMaxRows    = 50
+	defaultSpreadsheetMaxColumns = 12
+	defaultSpreadsheetMaxSheets  = 20
+	// spreadsheetCellCharacters is the number of characters drawn for each cell. Longer values are truncated.
+	spreadsheetCellCharacters = 14
+	spreadsheetFontSize       = 14
+	spreadsheetCellPadding    = 4
+	// spreadsheetMaxValueLength is the number of bytes of a cell value that are read. Longer values are truncated.
+	spreadsheetMaxValueLength = 1024
+	// xlsxMaxPartSize is the largest uncompressed size of a part of an xlsx file that is read.
+	xlsxMaxPartSize = 64 * 1024 * 1024
+)
+
+// errSpreadsheetTooLarge is returned when a part of an xlsx file is larger than xlsxMaxPartSize.
+var errSpreadsheetTooLarge = errors.New("spreadsheet is too large")
+
+// spreadsheetRenderAgent renders one page for each sheet of a spreadsheet. Spreadsheets are first converted into a derived source asset containing the cells of each sheet, which the pages are drawn from. Csv and xlsx files are read natively and other spreadsheets are converted to xlsx with LibreOffice.
+type spreadsheetRenderAgent struct {
+	baseRenderAgent
+	tempFileBasePath string
+	limits           spreadsheetLimits
+	processLimits    *processLimits
+}
+
+type spreadsheetRenderAgentFactory struct{}
+
+type spreadsheetRenderAgentConfig struct {
+	MaxRows    int `json:"maxRows"`
+	MaxColumns int `json:"maxColumns"`
+	MaxSheets  int `json:"maxSheets"`
+}
+
+// spreadsheetLimits contains the number of rows and columns read from each sheet and the number of sheets read from each spreadsheet.
+type spreadsheetLimits struct {
+	maxRows    int
+	maxColumns int
+	maxSheets  int
+}
+
+// spreadsheetWorkbook is the content of derived source assets of spreadsheets.
+type spreadsheetWorkbook struct {
+	Sheets []*spreadsheetSheet `json:"sheets"`
+}
+
+type spreadsheetSheet struct {
+	Name string     `json:"name"`
+	Rows [][]string `json:"rows"`
+}
+
+func (factory *spreadsheetRenderAgentFactory) Name() string {
+	return common.RenderAgentSpreadsheet
+}
+
+func (factory *spreadsheetRenderAgentFactory) ConfigSection() string {
+	return "spreadsheetRenderAgent"
+}
+
+func (factory *spreadsheetRenderAgentFactory) TemplateIds() []string {
+	return []string{common.SpreadsheetConversionTemplateId}
+}
+
+func (factory *spreadsheetRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var spreadsheetConfig spreadsheetRenderAgentConfig
+	err := context.Config.Decode(&spreadsheetConfig)
+	if err != nil {
+		return nil, err
+	}
+	limits := spreadsheetLimits{defaultSpreadsheetMaxRows, defaultSpreadsheetMaxColumns, defaultSpreadsheetMaxSheets}
+	if spreadsheetConfig.MaxRows > 0 {
+		limits.maxRows = spreadsheetConfig.MaxRows
+	}
+	if spreadsheetConfig.MaxColumns > 0 {
+		limits.maxColumns = spreadsheetConfig.MaxColumns
+	}
+	if spreadsheetConfig.MaxSheets > 0 {
+		limits.maxSheets = spreadsheetConfig.MaxSheets
+	}
+	return newSpreadsheetRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, context.Config.BasePath, limits, newProcessLimits(context.Config), context.WorkChannel), nil
+}
+
+func newSpreadsheetRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	tempFileBasePath string,
+	limits spreadsheetLimits,
+	processLimits *processLimits,
+	workChannel RenderAgentWorkChannel) RenderAgent {
+
+	renderAgent := new(spreadsheetRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentSpreadsheet, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.tempFileBasePath = tempFileBasePath
+	renderAgent.limits = limits
+	renderAgent.processLimits = processLimits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *spreadsheetRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	if generatedAsset.TemplateId == common.SpreadsheetConversionTemplateId {
+		renderAgent.convert(generatedAsset, sourceAsset, sourceFile, fileType, statusCallback)
+		return
+	}
+	renderAgent.renderSheet(generatedAsset, sourceFile, statusCallback)
+}
+
+// convert reads the sheets of a spreadsheet and stores their cells as a derived source asset. A page is created for each sheet with the spreadsheet templates.
+func (renderAgent *spreadsheetRenderAgent) convert(generatedAsset *common.GeneratedAsset, sourceAsset *common.SourceAsset, sourceFile common.TemporaryFile, fileType string, statusCallback chan generatedAssetUpdate) {
+	processLimits := renderAgent.processLimits
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err == nil && len(templates) > 0 {
+		processLimits = processLimits.forTemplate(templates[0])
+	}
+
+	var workbook *spreadsheetWorkbook
+	renderAgent.metrics.ConvertTime.Time(func() {
+		workbook, err = renderAgent.readWorkbook(processLimits, sourceFile.Path(), fileType)
+	})
+	if err == errSpreadsheetTooLarge {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorSpreadsheetTooLarge), nil}
+		return
+	}
+	if err != nil {
+		log.Println("error reading spreadsheet", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotReadSpreadsheet), nil}
+		return
+	}
+	if len(workbook.Sheets) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotReadSpreadsheet), nil}
+		return
+	}
+
+	data, err := json.Marshal(workbook)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+	destination := sourceFile.Path() + "-" + generatedAsset.TemplateId + ".json"
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+	err = ioutil.WriteFile(destination, data, 0644)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	sheetsSourceAsset, err := common.NewSourceAsset(sourceAsset.Id, common.SourceAssetTypeSheets)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
+		return
+	}
+	sheetsSourceAsset.AddAttribute(common.SourceAssetAttributeSize, []string{strconv.Itoa(len(data))})
+	sheetsSourceAsset.AddAttribute(common.SourceAssetAttributePages, []string{strconv.Itoa(len(workbook.Sheets))})
+	sheetsSourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{generatedAsset.Location})
+	sheetsSourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{"json"})
+	renderAgent.sasm.Store(sheetsSourceAsset)
+
+	spreadsheetTemplates, err := renderAgent.templateManager.FindByIds(common.SpreadsheetTemplates)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	renderAgent.agentManager.CreateDerivedWork(sheetsSourceAsset, spreadsheetTemplates, 0, len(workbook.Sheets))
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("fileSize", []string{strconv.Itoa(len(data))}),
+	}
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// renderSheet draws the sheet for the page of the generated asset and resizes it to the template.
+func (renderAgent *spreadsheetRenderAgent) renderSheet(generatedAsset *common.GeneratedAsset, sourceFile common.TemporaryFile, statusCallback chan generatedAssetUpdate) {
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	data, err := ioutil.ReadFile(sourceFile.Path())
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	var workbook spreadsheetWorkbook
+	err = json.Unmarshal(data, &workbook)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotReadSpreadsheet), nil}
+		return
+	}
+
+	page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+	if page < 0 || page >= len(workbook.Sheets) {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotReadSpreadsheet), nil}
+		return
+	}
+	sheet := workbook.Sheets[page]
+
+	destination := sourceFile.Path() + "-" + template.Id + "-" + strconv.Itoa(page) + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	renderAgent.metrics.ConvertTime.Time(func() {
+		var sheetImage image.Image
+		sheetImage, err = drawSheet(sheet)
+		if err != nil {
+			return
+		}
+		resized := fit.apply(sheetImage)
+		bounds = resized.Bounds()
+		err = encodeImage(renderAgent.processLimits.forTemplate(template), resized, destination, output)
+	})
+	if err != nil {
+		log.Println("error drawing sheet", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+		generatedAsset.AddAttribute(common.GeneratedAssetAttributeSheetName, []string{sheet.Name}),
+	}
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// readWorkbook reads the sheets of a csv, xlsx, xls or ods file.
+func (renderAgent *spreadsheetRenderAgent) readWorkbook(processLimits *processLimits, source, fileType string) (*spreadsheetWorkbook, error) {
+	switch strings.ToLower(fileType) {
+	case "csv":
+		return readCsvWorkbook(source, renderAgent.limits)
+	case "xlsx":
+		return readXlsxWorkbook(source, renderAgent.limits)
+	}
+
+	destination, err := ioutil.TempDir(renderAgent.tempFileBasePath, "spreadsheet")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(destination)
+
+	converted, err := convertToXlsx(processLimits, source, destination)
+	if err != nil {
+		return nil, err
+	}
+	return readXlsxWorkbook(converted, renderAgent.limits)
+}
+
+// convertToXlsx converts a spreadsheet into the xlsx format with LibreOffice and returns the path of the converted file. Each conversion uses its own LibreOffice profile inside of the destination directory, so that conversions run by different render agents at the same time do not share a profile.
+func convertToXlsx(limits *processLimits, source, destination string) (string, error) {
+	_, err := exec.LookPath("soffice")
+	if err != nil {
+		log.Println("soffice command not found")
+		return "", err
+	}
+	profile, err := filepath.Abs(filepath.Join(destination, "profile"))
+	if err != nil {
+		return "", err
+	}
+
+	cmd := limits.command("soffice", "--headless", "--nologo", "--nofirststartwizard", "--norestore", officeProfileArgument(profile), "--convert-to", "xlsx", source, "--outdir", destination)
+	log.Println(cmd)
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	err = limits.run(cmd)
+	if err != nil {
+		log.Println(buf.String())
+		return "", err
+	}
+
+	converted, err := filepath.Glob(filepath.Join(destination, "*.xlsx"))
+	if err != nil {
+		return "", err
+	}
+	if len(converted) != 1 {
+		return "", common.ErrorCouldNotReadSpreadsheet
+	}
+	return converted[0], nil
+}
+
+// readCsvWorkbook reads a csv file as a spreadsheet with a single sheet.
+func readCsvWorkbook(source string, limits spreadsheetLimits) (*spreadsheetWorkbook, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	sheet := &spreadsheetSheet{Name: "Sheet1", Rows: make([][]string, 0, limits.maxRows)}
+	for len(sheet.Rows) < limits.maxRows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) > limits.maxColumns {
+			record = record[:limits.maxColumns]
+		}
+		sheet.Rows = append(sheet.Rows, record)
+	}
+	return &spreadsheetWorkbook{Sheets: []*spreadsheetSheet{sheet}}, nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		Id   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxSharedStringReference is a cell whose value is an index into the shared strings of an xlsx file.
+type xlsxSharedStringReference struct {
+	sheet  *spreadsheetSheet
+	row    int
+	column int
+	index  int
+}
+
+// readXlsxWorkbook reads the sheets of an xlsx file in workbook order. Cell values are read as stored, without number formats applied. The worksheets and shared strings are read as a stream of xml tokens, so that only the rows, columns and shared strings within the limits are kept, and parts larger than xlsxMaxPartSize when uncompressed are refused.
+func readXlsxWorkbook(source string, limits spreadsheetLimits) (*spreadsheetWorkbook, error) {
+	archive, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var workbookXml xlsxWorkbook
+	err = readZipXml(files, "xl/workbook.xml", &workbookXml)
+	if err != nil {
+		return nil, err
+	}
+	var relationships xlsxRelationships
+	err = readZipXml(files, "xl/_rels/workbook.xml.rels", &relationships)
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, relationship := range relationships.Relationships {
+		if strings.HasPrefix(relationship.Target, "/") {
+			targets[relationship.Id] = strings.TrimPrefix(relationship.Target, "/")
+		} else {
+			targets[relationship.Id] = path.Join("xl", relationship.Target)
+		}
+	}
+
+	workbook := &spreadsheetWorkbook{Sheets: make([]*spreadsheetSheet, 0, len(workbookXml.Sheets))}
+	references := make([]xlsxSharedStringReference, 0, 0)
+	for _, sheetXml := range workbookXml.Sheets {
+		if len(workbook.Sheets) >= limits.maxSheets {
+			break
+		}
+		sheet := &spreadsheetSheet{Name: sheetXml.Name, Rows: make([][]string, 0, 0)}
+		reader, err := openZipPart(files, targets[sheetXml.Id])
+		if err != nil {
+			return nil, err
+		}
+		sheetReferences, err := readXlsxWorksheet(reader, sheet, limits)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		references = append(references, sheetReferences...)
+		workbook.Sheets = append(workbook.Sheets, sheet)
+	}
+
+	if len(references) > 0 {
+		indexes := make(map[int]bool)
+		for _, reference := range references {
+			indexes[reference.index] = true
+		}
+		reader, err := openZipPart(files, "xl/sharedStrings.xml")
+		if err == nil {
+			sharedStrings, err := readXlsxSharedStrings(reader, indexes)
+			reader.Close()
+			if err != nil {
+				return nil, err
+			}
+			for _, reference := range references {
+				value, hasValue := sharedStrings[reference.index]
+				if hasValue && value != "" {
+					setSpreadsheetCell(reference.sheet, reference.row, reference.column, value)
+				}
+			}
+		}
+	}
+	return workbook, nil
+}
+
+// readXlsxWorksheet reads the cells of a worksheet within the row and column limits into a sheet, stopping at the first row after the row limit. Cells that refer to shared strings are returned so that their values can be filled in once the shared strings are read.
+func readXlsxWorksheet(reader io.Reader, sheet *spreadsheetSheet, limits spreadsheetLimits) ([]xlsxSharedStringReference, error) {
+	references := make([]xlsxSharedStringReference, 0, 0)
+	decoder := xml.NewDecoder(reader)
+
+	rowPosition, rowIndex, columnPosition := -1, 0, -1
+	inCell, inText := false, false
+	var cellType string
+	var columnIndex int
+	var text bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return references, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch value := token.(type) {
+		case xml.StartElement:
+			switch value.Name.Local {
+			case "row":
+				rowPosition++
+				rowIndex = rowPosition
+				index, err := strconv.Atoi(xmlAttribute(value, "r"))
+				if err == nil && index > 0 {
+					rowIndex = index - 1
+				}
+				if rowIndex >= limits.maxRows {
+					return references, nil
+				}
+				columnPosition = -1
+			case "c":
+				columnPosition++
+				columnIndex = columnPosition
+				if reference := xmlAttribute(value, "r"); reference != "" {
+					columnIndex = spreadsheetColumnIndex(reference)
+				}
+				cellType = xmlAttribute(value, "t")
+				inCell = true
+				text.Reset()
+			case "v", "t":
+				inText = inCell
+			}
+		case xml.CharData:
+			if inText {
+				appendSpreadsheetValue(&text, value)
+			}
+		case xml.EndElement:
+			switch value.Name.Local {
+			case "v", "t":
+				inText = false
+			case "c":
+				inCell = false
+				if columnIndex < 0 || columnIndex >= limits.maxColumns || text.Len() == 0 {
+					continue
+				}
+				cellValue := spreadsheetValue(text.Bytes())
+				switch cellType {
+				case "s":
+					index, err := strconv.Atoi(cellValue)
+					if err == nil && index >= 0 {
+						references = append(references, xlsxSharedStringReference{sheet, rowIndex, columnIndex, index})
+					}
+					continue
+				case "b":
+					cellValue = strings.ToUpper(strconv.FormatBool(cellValue == "1"))
+				}
+				setSpreadsheetCell(sheet, rowIndex, columnIndex, cellValue)
+			}
+		}
+	}
+}
+
+// readXlsxSharedStrings returns the shared strings with the given indexes, stopping after the largest index. The text of phonetic runs is not included.
+func readXlsxSharedStrings(reader io.Reader, indexes map[int]bool) (map[int]string, error) {
+	lastIndex := -1
+	for index := range indexes {
+		if index > lastIndex {
+			lastIndex = index
+		}
+	}
+
+	sharedStrings := make(map[int]string)
+	decoder := xml.NewDecoder(reader)
+	index := -1
+	inText, inPhonetic := false, false
+	var text bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return sharedStrings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch value := token.(type) {
+		case xml.StartElement:
+			switch value.Name.Local {
+			case "si":
+				index++
+				if index > lastIndex {
+					return sharedStrings, nil
+				}
+				text.Reset()
+			case "rPh":
+				inPhonetic = true
+			case "t":
+				inText = !inPhonetic && indexes[index]
+			}
+		case xml.CharData:
+			if inText {
+				appendSpreadsheetValue(&text, value)
+			}
+		case xml.EndElement:
+			switch value.Name.Local {
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			case "si":
+				if indexes[index] {
+					sharedStrings[index] = spreadsheetValue(text.Bytes())
+				}
+			}
+		}
+	}
+}
+
+// appendSpreadsheetValue appends text to a cell value, dropping whatever goes past spreadsheetMaxValueLength.
+func appendSpreadsheetValue(buffer *bytes.Buffer, text []byte) {
+	remaining := spreadsheetMaxValueLength - buffer.Len()
+	if remaining <= 0 {
+		return
+	}
+	if len(text) > remaining {
+		text = text[:remaining]
+	}
+	buffer.Write(text)
+}
+
+// spreadsheetValue returns a cell value read by appendSpreadsheetValue without an incomplete character at its end.
+func spreadsheetValue(value []byte) string {
+	for len(value) > 0 && !utf8.Valid(value) {
+		value = value[:len(value)-1]
+	}
+	return string(value)
+}
+
+// setSpreadsheetCell sets the value of a cell of a sheet, adding the rows and columns before it.
+func setSpreadsheetCell(sheet *spreadsheetSheet, rowIndex, columnIndex int, value string) {
+	for len(sheet.Rows) <= rowIndex {
+		sheet.Rows = append(sheet.Rows, []string{})
+	}
+	for len(sheet.Rows[rowIndex]) <= columnIndex {
+		sheet.Rows[rowIndex] = append(sheet.Rows[rowIndex], "")
+	}
+	sheet.Rows[rowIndex][columnIndex] = value
+}
+
+// xmlAttribute returns the value of an attribute of an element, or an empty string if the element does not have it.
+func xmlAttribute(element xml.StartElement, name string) string {
+	for _, attribute := range element.Attr {
+		if attribute.Name.Local == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+// openZipPart opens a part of a zip file, refusing parts larger than xlsxMaxPartSize when uncompressed. The reader stops at that size even when the size recorded in the zip file is wrong.
+func openZipPart(files map[string]*zip.File, name string) (io.ReadCloser, error) {
+	file, hasFile := files[name]
+	if !hasFile {
+		return nil, common.ErrorCouldNotReadSpreadsheet
+	}
+	if file.UncompressedSize64 > xlsxMaxPartSize {
+		return nil, errSpreadsheetTooLarge
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReadCloser{io.LimitReader(reader, xlsxMaxPartSize), reader}, nil
+}
+
+// limitedReadCloser reads from a limited reader and closes the reader it limits.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func readZipXml(files map[string]*zip.File, name string, value interface{}) error {
+	reader, err := openZipPart(files, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return xml.NewDecoder(reader).Decode(value)
+}
+
+// spreadsheetColumnIndex returns the zero based column of a cell reference such as "AB12".
+func spreadsheetColumnIndex(reference string) int {
+	index := 0
+	for _, character := range strings.ToUpper(reference) {
+		if character < 'A' || character > 'Z' {
+			break
+		}
+		index = index*26 + int(character-'A') + 1
+	}
+	return index - 1
+}
+
+// spreadsheetColumnName returns the letters of a zero based column, such as "AB" for 27.
+func spreadsheetColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// drawSheet draws the cells of a sheet as a grid with column letters and row numbers.
+func drawSheet(sheet *spreadsheetSheet) (image.Image, error) {
+	face, err := newMonospaceFace(spreadsheetFontSize)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	advance, _ := face.GlyphAdvance('M')
+	rowHeight := metrics.Height.Ceil() + spreadsheetCellPadding*2
+	cellWidth := advance.Ceil()*spreadsheetCellCharacters + spreadsheetCellPadding*2
+	headerWidth := advance.Ceil()*4 + spreadsheetCellPadding*2
+
+	rows := len(sheet.Rows)
+	if rows < 1 {
+		rows = 1
+	}
+	columns := 1
+	for _, row := range sheet.Rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	width := headerWidth + columns*cellWidth + 1
+	height := (rows+1)*rowHeight + 1
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.ZP, draw.Src)
+
+	headerColour := image.NewUniform(color.RGBA{0xee, 0xee, 0xee, 0xff})
+	gridColour := image.NewUniform(color.RGBA{0xcc, 0xcc, 0xcc, 0xff})
+	draw.Draw(canvas, image.Rect(0, 0, width, rowHeight), headerColour, image.ZP, draw.Src)
+	draw.Draw(canvas, image.Rect(0, 0, headerWidth, height), headerColour, image.ZP, draw.Src)
+	for row := 0; row <= rows+1; row++ {
+		draw.Draw(canvas, image.Rect(0, row*rowHeight, width, row*rowHeight+1), gridColour, image.ZP, draw.Src)
+	}
+	for column := 0; column <= columns; column++ {
+		x := headerWidth + column*cellWidth
+		draw.Draw(canvas, image.Rect(x, 0, x+1, height), gridColour, image.ZP, draw.Src)
+	}
+	draw.Draw(canvas, image.Rect(0, 0, 1, height), gridColour, image.ZP, draw.Src)
+
+	drawer := &font.Drawer{Dst: canvas, Face: face, Src: image.Black}
+	drawCell := func(x, y int, text string) {
+		if runes := []rune(text); len(runes) > spreadsheetCellCharacters {
+			text = string(runes[:spreadsheetCellCharacters])
+		}
+		drawer.Dot = fixed.P(x+spreadsheetCellPadding, y+spreadsheetCellPadding+metrics.Ascent.Ceil())
+		drawer.DrawString(text)
+	}
+	for column := 0; column < columns; column++ {
+		drawCell(headerWidth+column*cellWidth, 0, spreadsheetColumnName(column))
+	}
+	for row := 0; row < rows; row++ {
+		y := (row + 1) * rowHeight
+		drawCell(0, y, strconv.Itoa(row+1))
+		if row < len(sheet.Rows) {
+			for column, value := range sheet.Rows[row] {
+				drawCell(headerWidth+column*cellWidth, y, strings.Replace(value, "\n", " ", -1))
+			}
+		}
+	}
+	return canvas, nil
+}
@@ -0,0 +1,198 @@
+package render
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestReadCsvWorkbook(t *testing.T) {
+	directory, err := ioutil.TempDir("", "spreadsheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "source.csv")
+	content := "name,count,note\nalpha,1,\"one, two\"\nbeta,2\ngamma,3,x,y\n"
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workbook, err := readCsvWorkbook(path, spreadsheetLimits{3, 3, 1})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != "Sheet1" {
+		t.Errorf("Unexpected sheets: %v", workbook.Sheets)
+		return
+	}
+	expected := [][]string{
+		{"name", "count", "note"},
+		{"alpha", "1", "one, two"},
+		{"beta", "2"},
+	}
+	if !reflect.DeepEqual(workbook.Sheets[0].Rows, expected) {
+		t.Errorf("Unexpected rows: %q", workbook.Sheets[0].Rows)
+	}
+}
+
+func TestReadXlsxWorkbook(t *testing.T) {
+	directory, err := ioutil.TempDir("", "spreadsheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "source.xlsx")
+	writeTestZip(t, path, map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Summary" sheetId="2" r:id="rId2"/><sheet name="Data" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Total</t></si><si><r><t>Rich</t></r><r><t> text</t></r></si>
+</sst>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>1</v></c><c r="C1"><v>42</v></c><c r="D1"><v>ignored</v></c></row>
+<row r="3"><c r="B3" t="inlineStr"><is><t>inline</t></is></c><c r="C3" t="b"><v>1</v></c></row>
+<row r="4"><c r="A4"><v>ignored</v></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="str"><v>10</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	workbook, err := readXlsxWorkbook(path, spreadsheetLimits{3, 3, 5})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(workbook.Sheets) != 2 || workbook.Sheets[0].Name != "Summary" || workbook.Sheets[1].Name != "Data" {
+		t.Errorf("Unexpected sheets: %v", workbook.Sheets)
+		return
+	}
+	if !reflect.DeepEqual(workbook.Sheets[0].Rows, [][]string{{"Total", "10"}}) {
+		t.Errorf("Unexpected rows: %q", workbook.Sheets[0].Rows)
+	}
+	expected := [][]string{
+		{"Rich text", "", "42"},
+		{},
+		{"", "inline", "TRUE"},
+	}
+	if !reflect.DeepEqual(workbook.Sheets[1].Rows, expected) {
+		t.Errorf("Unexpected rows: %q", workbook.Sheets[1].Rows)
+	}
+
+	workbook, err = readXlsxWorkbook(path, spreadsheetLimits{3, 3, 1})
+	if err != nil || len(workbook.Sheets) != 1 {
+		t.Errorf("Expected the sheets to be limited: %v %s", workbook, err)
+	}
+}
+
+func TestReadXlsxWorksheetLimits(t *testing.T) {
+	worksheet := `<worksheet><sheetData>
+<row r="1"><c r="A1"><v>` + strings.Repeat("é", spreadsheetMaxValueLength) + `</v></c><c r="B1" t="s"><v>2</v></c></row>
+<row r="2"><c r="A2"><v>after the limit</v></c></row>
+<row r="3"><broken`
+	sheet := &spreadsheetSheet{Name: "Sheet1", Rows: make([][]string, 0, 0)}
+	references, err := readXlsxWorksheet(strings.NewReader(worksheet), sheet, spreadsheetLimits{1, 5, 1})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(sheet.Rows) != 1 || len(sheet.Rows[0][0]) != spreadsheetMaxValueLength || !utf8.ValidString(sheet.Rows[0][0]) {
+		t.Errorf("Unexpected rows: %d %d", len(sheet.Rows), len(sheet.Rows[0][0]))
+	}
+	if len(references) != 1 || references[0].index != 2 || references[0].column != 1 {
+		t.Errorf("Unexpected shared string references: %v", references)
+	}
+
+	sharedStrings := `<sst><si><t>zero</t></si><si><t>one</t></si><si><r><t>t</t></r><r><t>wo</t></r><rPh><t>phonetic</t></rPh></si><si><broken`
+	values, err := readXlsxSharedStrings(strings.NewReader(sharedStrings), map[int]bool{0: true, 2: true})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(values, map[int]string{0: "zero", 2: "two"}) {
+		t.Errorf("Unexpected shared strings: %v", values)
+	}
+}
+
+func TestOpenZipPartSize(t *testing.T) {
+	files := map[string]*zip.File{
+		"xl/worksheets/sheet1.xml": &zip.File{FileHeader: zip.FileHeader{Name: "xl/worksheets/sheet1.xml", UncompressedSize64: xlsxMaxPartSize + 1}},
+	}
+	if _, err := openZipPart(files, "xl/worksheets/sheet1.xml"); err != errSpreadsheetTooLarge {
+		t.Errorf("Expected the part to be too large: %v", err)
+	}
+	if _, err := openZipPart(files, "xl/workbook.xml"); err == nil {
+		t.Error("Expected an error for a missing part")
+	}
+}
+
+func TestSpreadsheetColumns(t *testing.T) {
+	names := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for index, name := range names {
+		if spreadsheetColumnName(index) != name {
+			t.Errorf("Unexpected name for column %d: %s", index, spreadsheetColumnName(index))
+		}
+		if spreadsheetColumnIndex(name+"12") != index {
+			t.Errorf("Unexpected index for reference %s12: %d", name, spreadsheetColumnIndex(name+"12"))
+		}
+	}
+}
+
+func TestDrawSheet(t *testing.T) {
+	empty, err := drawSheet(&spreadsheetSheet{Name: "Empty"})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	sheet, err := drawSheet(&spreadsheetSheet{Name: "Data", Rows: [][]string{{"a", "b", "c"}, {"d"}}})
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if sheet.Bounds().Dx() <= empty.Bounds().Dx() || sheet.Bounds().Dy() <= empty.Bounds().Dy() {
+		t.Errorf("Unexpected bounds: %v %v", sheet.Bounds(), empty.Bounds())
+	}
+}
+
+func writeTestZip(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for name, content := range files {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = entry.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,431 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/net/html/charset"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSvgMaxNodes      = 10000
+	defaultSvgRenderTimeout = 10
+	// svgMaxPixels is the largest number of pixels an svg document is rasterized at, whatever the shape of its view box.
+	svgMaxPixels = 4096 * 4096
+)
+
+// svgRenderAgent rasterizes svg documents at the size of each template. Documents that declare entities, reference anything outside of themselves or contain too many elements are refused before they are parsed. Documents are rasterized by the "rasterizeSvg" command of the preview executable in a child process, so that a document that takes too long or uses too much memory is killed along with that process.
+type svgRenderAgent struct {
+	baseRenderAgent
+	maxNodes         int
+	rasterizeCommand string
+	limits           *processLimits
+}
+
+type svgRenderAgentFactory struct{}
+
+type svgRenderAgentConfig struct {
+	MaxNodes      int `json:"maxNodes"`
+	RenderTimeout int `json:"renderTimeout"`
+}
+
+func (factory *svgRenderAgentFactory) Name() string {
+	return common.RenderAgentSvg
+}
+
+func (factory *svgRenderAgentFactory) ConfigSection() string {
+	return "svgRenderAgent"
+}
+
+func (factory *svgRenderAgentFactory) TemplateIds() []string {
+	return common.SvgTemplates
+}
+
+func (factory *svgRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var svgConfig svgRenderAgentConfig
+	err := context.Config.Decode(&svgConfig)
+	if err != nil {
+		return nil, err
+	}
+	maxNodes := defaultSvgMaxNodes
+	if svgConfig.MaxNodes > 0 {
+		maxNodes = svgConfig.MaxNodes
+	}
+	renderTimeout := defaultSvgRenderTimeout
+	if svgConfig.RenderTimeout > 0 {
+		renderTimeout = svgConfig.RenderTimeout
+	}
+	limits := newProcessLimits(context.Config)
+	if limits.timeout <= 0 {
+		limits.timeout = time.Duration(renderTimeout) * time.Second
+	}
+	rasterizeCommand, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return newSvgRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, maxNodes, rasterizeCommand, limits, context.WorkChannel), nil
+}
+
+func newSvgRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	maxNodes int,
+	rasterizeCommand string,
+	limits *processLimits,
+	workChannel RenderAgentWorkChannel) RenderAgent {
+
+	renderAgent := new(svgRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentSvg, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.maxNodes = maxNodes
+	renderAgent.rasterizeCommand = rasterizeCommand
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *svgRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "png"
+	}
+
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	data, err := ioutil.ReadFile(sourceFile.Path())
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	err = validateSvg(bytes.NewReader(data), renderAgent.maxNodes)
+	if err != nil {
+		log.Println("refusing svg document", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnsafeSvg), nil}
+		return
+	}
+
+	viewBoxWidth, viewBoxHeight, err := readSvgSize(bytes.NewReader(data))
+	if err != nil {
+		log.Println("error reading svg size", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+	width, height := svgDimensions(viewBoxWidth, viewBoxHeight, fit)
+
+	rasterizedPath := sourceFile.Path() + "-" + template.Id + "-rasterized.png"
+	rasterizedTemporaryFile := renderAgent.temporaryFileManager.Create(rasterizedPath)
+	defer rasterizedTemporaryFile.Release()
+
+	destination := sourceFile.Path() + "-" + template.Id + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	renderAgent.metrics.ConvertTime.Time(func() {
+		err = runLimitedCommand(renderAgent.limits.forTemplate(template), renderAgent.rasterizeCommand, "rasterizeSvg", strconv.Itoa(width), strconv.Itoa(height), sourceFile.Path(), rasterizedPath)
+		if err != nil {
+			return
+		}
+		var rasterized image.Image
+		rasterized, err = decodeImageFile(rasterizedPath)
+		if err != nil {
+			return
+		}
+		resized := fit.apply(rasterized)
+		bounds = resized.Bounds()
+		err = encodeImage(renderAgent.limits.forTemplate(template), resized, destination, output)
+	})
+	if err != nil {
+		log.Println("error rasterizing svg", err)
+		statusCallback <- generatedAssetUpdate{renderError(err, common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+	}
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// validateSvg reads an svg document without resolving anything in it and returns an error if it declares a document type or entities, references a resource that is not a fragment of the document or a data uri, or contains more than maxNodes elements.
+func validateSvg(reader io.Reader, maxNodes int) error {
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	nodes := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch value := token.(type) {
+		case xml.Directive:
+			return fmt.Errorf("document type declarations are not allowed")
+		case xml.ProcInst:
+			if value.Target == "xml-stylesheet" {
+				return fmt.Errorf("stylesheets are not allowed")
+			}
+		case xml.StartElement:
+			nodes++
+			if nodes > maxNodes {
+				return fmt.Errorf("more than %d elements", maxNodes)
+			}
+			if value.Name.Local == "style" {
+				text, err := readSvgElementText(decoder)
+				if err != nil {
+					return err
+				}
+				if hasExternalSvgReference(text) {
+					return fmt.Errorf("external reference in style element")
+				}
+			}
+			for _, attribute := range value.Attr {
+				if attribute.Name.Local == "href" && !isLocalSvgReference(attribute.Value) {
+					return fmt.Errorf("external reference %s", attribute.Value)
+				}
+				if hasExternalSvgReference(attribute.Value) {
+					return fmt.Errorf("external reference in %s attribute", attribute.Name.Local)
+				}
+			}
+		}
+	}
+	if nodes == 0 {
+		return fmt.Errorf("no elements")
+	}
+	return nil
+}
+
+// readSvgElementText returns the text of the element that was just started, consuming its end element.
+func readSvgElementText(decoder *xml.Decoder) (string, error) {
+	var text bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch value := token.(type) {
+		case xml.CharData:
+			text.Write(value)
+		case xml.EndElement:
+			return text.String(), nil
+		case xml.StartElement:
+			return "", fmt.Errorf("unexpected element %s in style", value.Name.Local)
+		}
+	}
+}
+
+// isLocalSvgReference returns true if a reference points to a fragment of the document or is a data uri.
+func isLocalSvgReference(reference string) bool {
+	reference = strings.TrimSpace(reference)
+	return strings.HasPrefix(reference, "#") || strings.HasPrefix(strings.ToLower(reference), "data:")
+}
+
+// hasExternalSvgReference returns true if a style value contains an @import rule or a url() that is not local.
+func hasExternalSvgReference(value string) bool {
+	lowered := strings.ToLower(value)
+	if strings.Contains(lowered, "@import") {
+		return true
+	}
+	for {
+		index := strings.Index(lowered, "url(")
+		if index < 0 {
+			return false
+		}
+		lowered = lowered[index+len("url("):]
+		reference := strings.Trim(strings.TrimSpace(lowered), "'\"")
+		if !isLocalSvgReference(reference) {
+			return true
+		}
+	}
+}
+
+// readSvgSize returns the width and height of the view box of an svg document, falling back to the width and height attributes of the document when it has no view box.
+func readSvgSize(reader io.Reader) (float64, float64, error) {
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+		root, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var width, height float64
+		for _, attribute := range root.Attr {
+			switch attribute.Name.Local {
+			case "viewBox":
+				fields := strings.FieldsFunc(attribute.Value, func(r rune) bool {
+					return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+				})
+				if len(fields) == 4 {
+					viewBoxWidth, widthErr := strconv.ParseFloat(fields[2], 64)
+					viewBoxHeight, heightErr := strconv.ParseFloat(fields[3], 64)
+					if widthErr == nil && heightErr == nil && isSvgLength(viewBoxWidth) && isSvgLength(viewBoxHeight) {
+						return viewBoxWidth, viewBoxHeight, nil
+					}
+				}
+			case "width":
+				width, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(attribute.Value), "px"), 64)
+			case "height":
+				height, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(attribute.Value), "px"), 64)
+			}
+		}
+		if isSvgLength(width) && isSvgLength(height) {
+			return width, height, nil
+		}
+		return 0, 0, fmt.Errorf("svg document has no size")
+	}
+}
+
+// isSvgLength returns true if a length is positive and finite.
+func isSvgLength(length float64) bool {
+	return length > 0 && !math.IsInf(length, 0)
+}
+
+// RasterizeSvgFile draws an svg document onto a transparent png image of the given size. It is run by the "rasterizeSvg" command in a child process of the svg render agent.
+func RasterizeSvgFile(source, destination string, width, height int) error {
+	if width < 1 || height < 1 || width > svgMaxPixels || height > svgMaxPixels || width*height > svgMaxPixels {
+		return fmt.Errorf("invalid svg size %dx%d", width, height)
+	}
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	rasterized, err := rasterizeSvg(data, width, height)
+	if err != nil {
+		return err
+	}
+	return encodeImageFile(rasterized, destination, "png")
+}
+
+// rasterizeSvg draws an svg document onto a transparent image of the given size.
+func rasterizeSvg(data []byte, width, height int) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	icon.SetTarget(0, 0, float64(width), float64(height))
+
+	rasterized := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, rasterized, rasterized.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return rasterized, nil
+}
+
+// svgDimensions returns the size an svg document is rasterized at so that it fills the fit without being resampled up. Documents are scaled to fit within the template for the contain and pad fit modes and to cover it for the other modes. Documents with an extreme aspect ratio are scaled down so that they are never rasterized at more than svgMaxPixels pixels.
+func svgDimensions(viewBoxWidth, viewBoxHeight float64, fit *imageFit) (int, int) {
+	widthScale := float64(fit.width) / viewBoxWidth
+	heightScale := float64(fit.height) / viewBoxHeight
+	scale := math.Min(widthScale, heightScale)
+	if fit.width <= 0 {
+		scale = heightScale
+	} else if fit.mode != common.TemplateFitContain && fit.mode != common.TemplateFitPad {
+		scale = math.Max(widthScale, heightScale)
+	}
+	width := math.Max(1, math.Min(viewBoxWidth*scale, svgMaxPixels))
+	height := math.Max(1, math.Min(viewBoxHeight*scale, svgMaxPixels))
+	if width*height > svgMaxPixels {
+		shrink := math.Sqrt(svgMaxPixels / (width * height))
+		width = math.Max(1, math.Floor(width*shrink))
+		height = math.Max(1, math.Floor(height*shrink))
+	}
+	return int(width + 0.5), int(height + 0.5)
+}
@@ -0,0 +1,142 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSvg = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 40 20">
+<defs><linearGradient id="fade"><stop offset="0" stop-color="#ff0000"/><stop offset="1" stop-color="#0000ff"/></linearGradient></defs>
+<rect x="10" y="5" width="20" height="10" fill="url(#fade)"/>
+</svg>`
+
+func TestValidateSvg(t *testing.T) {
+	err := validateSvg(strings.NewReader(testSvg), 10)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+	}
+
+	refused := map[string]string{
+		"entity":     `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><svg><text>&xxe;</text></svg>`,
+		"image":      `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><image xlink:href="http://example.com/a.png"/></svg>`,
+		"use":        `<svg><use href="other.svg#icon"/></svg>`,
+		"fill":       `<svg><rect fill="url(http://example.com/a.svg#grad)"/></svg>`,
+		"style":      `<svg><style>@import url(http://example.com/a.css);</style></svg>`,
+		"stylesheet": `<?xml-stylesheet href="http://example.com/a.css"?><svg/>`,
+		"nodes":      `<svg>` + strings.Repeat(`<g/>`, 10) + `</svg>`,
+		"empty":      ``,
+	}
+	for name, document := range refused {
+		if validateSvg(strings.NewReader(document), 10) == nil {
+			t.Errorf("Expected the %s document to be refused", name)
+		}
+	}
+
+	allowed := `<svg><use href="#icon"/><image href="data:image/png;base64,AAAA"/><rect style="fill: url('#fade')"/></svg>`
+	err = validateSvg(strings.NewReader(allowed), 10)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+	}
+}
+
+func TestSvgDimensions(t *testing.T) {
+	fit := &imageFit{mode: common.TemplateFitContain, width: 100, height: 100}
+	width, height := svgDimensions(24, 12, fit)
+	if width != 100 || height != 50 {
+		t.Errorf("Unexpected contain dimensions: %dx%d", width, height)
+	}
+
+	fit = &imageFit{mode: common.TemplateFitCover, width: 100, height: 100}
+	width, height = svgDimensions(24, 12, fit)
+	if width != 200 || height != 100 {
+		t.Errorf("Unexpected cover dimensions: %dx%d", width, height)
+	}
+
+	fit = &imageFit{mode: common.TemplateFitContain, height: 30}
+	width, height = svgDimensions(24, 12, fit)
+	if width != 60 || height != 30 {
+		t.Errorf("Unexpected height only dimensions: %dx%d", width, height)
+	}
+
+	fit = &imageFit{mode: common.TemplateFitPad, width: 100, height: 100}
+	width, height = svgDimensions(24, 12, fit)
+	if width != 100 || height != 50 {
+		t.Errorf("Unexpected pad dimensions: %dx%d", width, height)
+	}
+
+	fit = &imageFit{mode: common.TemplateFitCover, width: 1024, height: 1024}
+	width, height = svgDimensions(1, 100000, fit)
+	if width*height > svgMaxPixels || width < 1 {
+		t.Errorf("Unexpected capped dimensions: %dx%d", width, height)
+	}
+}
+
+func TestRasterizeSvg(t *testing.T) {
+	rasterized, err := rasterizeSvg([]byte(testSvg), 400, 200)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	bounds := rasterized.Bounds()
+	if bounds.Dx() != 400 || bounds.Dy() != 200 {
+		t.Errorf("Unexpected bounds: %v", bounds)
+		return
+	}
+	if _, _, _, alpha := rasterized.At(5, 5).RGBA(); alpha != 0 {
+		t.Errorf("Expected the background to be transparent: %d", alpha)
+	}
+	if _, _, _, alpha := rasterized.At(200, 100).RGBA(); alpha != 0xffff {
+		t.Errorf("Expected the rectangle to be opaque: %d", alpha)
+	}
+}
+
+func TestRasterizeSvgFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "svg")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	source := filepath.Join(directory, "test.svg")
+	destination := filepath.Join(directory, "test.png")
+	ioutil.WriteFile(source, []byte(testSvg), 0644)
+
+	err = RasterizeSvgFile(source, destination, 80, 40)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	width, height, err := imageDimensions(nil, destination)
+	if err != nil || width != 80 || height != 40 {
+		t.Errorf("Unexpected dimensions: %dx%d %v", width, height, err)
+	}
+
+	if RasterizeSvgFile(source, destination, svgMaxPixels, 2) == nil {
+		t.Error("Expected an error for a size over the pixel limit")
+	}
+}
+
+func TestReadSvgSize(t *testing.T) {
+	sizes := map[string][]float64{
+		testSvg:                           []float64{40, 20},
+		`<svg width="24px" height="12"/>`: []float64{24, 12},
+		`<svg viewBox="0,0,10,5" width="100" height="100"/>`: []float64{10, 5},
+	}
+	for document, expected := range sizes {
+		width, height, err := readSvgSize(strings.NewReader(document))
+		if err != nil || width != expected[0] || height != expected[1] {
+			t.Errorf("Unexpected size of %s: %vx%v %v", document, width, height, err)
+		}
+	}
+	for _, document := range []string{`<svg></svg>`, `<svg width="100%" height="100%"/>`, `<svg viewBox="0 0 -1 5"/>`, ``} {
+		if _, _, err := readSvgSize(strings.NewReader(document)); err == nil {
+			t.Errorf("Expected an error for %s", document)
+		}
+	}
+}
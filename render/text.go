@@ -0,0 +1,359 @@
+package render
+
+import (
+	"bufio"
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/util"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultTextLinesPerPage = 60
+	defaultTextMaxPages     = 10
+	// textColumns is the number of characters drawn for each line. Longer lines are truncated.
+	textColumns = 100
+	// textFontSize is the size, in pixels, of the monospace font that pages are drawn with before they are resized to the template.
+	textFontSize = 14
+	textMargin   = 16
+	textTabWidth = 4
+)
+
+// textRenderAgent draws the lines of text and source files in a monospace font with syntax highlighting chosen from the file type. Files are paginated into pages of a fixed number of lines.
+type textRenderAgent struct {
+	baseRenderAgent
+	linesPerPage int
+	maxPages     int
+	limits       *processLimits
+}
+
+type textRenderAgentFactory struct{}
+
+type textRenderAgentConfig struct {
+	LinesPerPage int `json:"linesPerPage"`
+	MaxPages     int `json:"maxPages"`
+}
+
+// textRun is a span of a line drawn in one colour.
+type textRun struct {
+	text   string
+	colour color.Color
+}
+
+func (factory *textRenderAgentFactory) Name() string {
+	return common.RenderAgentText
+}
+
+func (factory *textRenderAgentFactory) ConfigSection() string {
+	return "textRenderAgent"
+}
+
+func (factory *textRenderAgentFactory) TemplateIds() []string {
+	return common.TextTemplates
+}
+
+func (factory *textRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var textConfig textRenderAgentConfig
+	err := context.Config.Decode(&textConfig)
+	if err != nil {
+		return nil, err
+	}
+	if textConfig.LinesPerPage < 1 {
+		textConfig.LinesPerPage = defaultTextLinesPerPage
+	}
+	if textConfig.MaxPages < 1 {
+		textConfig.MaxPages = defaultTextMaxPages
+	}
+	return newTextRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.TemporaryFileManager, context.Downloader, context.Uploader, textConfig.LinesPerPage, textConfig.MaxPages, newProcessLimits(context.Config), context.WorkChannel), nil
+}
+
+func newTextRenderAgent(
+	metrics *RenderAgentMetrics,
+	agentManager *RenderAgentManager,
+	sasm common.SourceAssetStorageManager,
+	gasm common.GeneratedAssetStorageManager,
+	templateManager common.TemplateManager,
+	temporaryFileManager common.TemporaryFileManager,
+	downloader common.Downloader,
+	uploader common.Uploader,
+	linesPerPage int,
+	maxPages int,
+	limits *processLimits,
+	workChannel RenderAgentWorkChannel) RenderAgent {
+
+	renderAgent := new(textRenderAgent)
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentText, metrics, agentManager, sasm, gasm, templateManager, temporaryFileManager, downloader, uploader, workChannel)
+	renderAgent.linesPerPage = linesPerPage
+	renderAgent.maxPages = maxPages
+	renderAgent.limits = limits
+
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
+
+	return renderAgent
+}
+
+func (renderAgent *textRenderAgent) renderGeneratedAsset(id string) {
+	renderAgent.metrics.WorkProcessed.Mark(1)
+
+	generatedAsset, err := renderAgent.gasm.FindById(id)
+	if err != nil {
+		log.Fatal("No Generated Asset with that ID can be retreived from storage: ", id)
+		return
+	}
+
+	statusCallback := renderAgent.commitStatus(generatedAsset.Id, generatedAsset.Attributes)
+	defer func() { close(statusCallback) }()
+
+	generatedAsset.Status = common.GeneratedAssetStatusProcessing
+	renderAgent.gasm.Update(generatedAsset)
+
+	sourceAsset, err := renderAgent.getSourceAsset(generatedAsset)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindSourceAssetsById), nil}
+		return
+	}
+
+	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileType), nil}
+		return
+	}
+	fileTypeCount, hasFileTypeCount := renderAgent.metrics.FileTypeCount[fileType]
+	if hasFileTypeCount {
+		fileTypeCount.Inc(1)
+	}
+
+	templates, err := renderAgent.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorUnableToFindTemplatesById), nil}
+		return
+	}
+	if len(templates) == 0 {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoTemplatesFoundForId), nil}
+		return
+	}
+	template := templates[0]
+
+	output, err := common.GetFirstAttribute(template, common.TemplateAttributeOutput)
+	if err != nil {
+		output = "jpg"
+	}
+
+	fit, err := newImageFit(template, output)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineRenderSize), nil}
+		return
+	}
+	fit.watermark, err = newWatermark(template, renderAgent.agentManager.watermarkImages)
+	if err != nil {
+		log.Println("error loading watermark", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotApplyWatermark), nil}
+		return
+	}
+
+	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
+	sourceFile, err := renderAgent.tryDownload(urls, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNoDownloadUrlsWork), nil}
+		return
+	}
+	defer sourceFile.Release()
+
+	page, _ := renderAgent.getGeneratedAssetPage(generatedAsset)
+
+	destination := sourceFile.Path() + "-" + template.Id + "-" + strconv.Itoa(page) + "." + output
+	destinationTemporaryFile := renderAgent.temporaryFileManager.Create(destination)
+	defer destinationTemporaryFile.Release()
+
+	var bounds image.Rectangle
+	renderAgent.metrics.ConvertTime.Time(func() {
+		var lines []string
+		lines, err = readTextLines(sourceFile.Path(), renderAgent.linesPerPage*renderAgent.maxPages)
+		if err != nil {
+			return
+		}
+		pages := (len(lines) + renderAgent.linesPerPage - 1) / renderAgent.linesPerPage
+		if page == 0 && pages > 1 {
+			// Create derived work for the pages after the first one that are rendered eagerly
+			renderAgent.agentManager.CreatePagedWork(sourceAsset, templates, pages)
+		}
+
+		start := page * renderAgent.linesPerPage
+		if start > len(lines) {
+			start = len(lines)
+		}
+		end := start + renderAgent.linesPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		var pageImage image.Image
+		pageImage, err = drawTextPage(highlightText(lines[start:end], fileType), renderAgent.linesPerPage)
+		if err != nil {
+			return
+		}
+		resized := fit.apply(pageImage)
+		bounds = resized.Bounds()
+		err = encodeImage(renderAgent.limits.forTemplate(template), resized, destination, output)
+	})
+	if err != nil {
+		log.Println("error rendering text", err)
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotResizeImage), nil}
+		return
+	}
+
+	err = renderAgent.uploader.Upload(generatedAsset.Location, destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotUploadAsset), nil}
+		return
+	}
+
+	generatedAssetFileSize, err := util.FileSize(destination)
+	if err != nil {
+		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorCouldNotDetermineFileSize), nil}
+		return
+	}
+
+	newAttributes := []common.Attribute{
+		generatedAsset.AddAttribute("imageHeight", []string{strconv.Itoa(bounds.Dy())}),
+		generatedAsset.AddAttribute("imageWidth", []string{strconv.Itoa(bounds.Dx())}),
+		generatedAsset.AddAttribute("fileSize", []string{strconv.FormatInt(generatedAssetFileSize, 10)}),
+	}
+
+	newAttributes = append(newAttributes, imagePreviewAttributes(generatedAsset, destination)...)
+	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusComplete, newAttributes}
+}
+
+// readTextLines returns up to maxLines lines of a text file with tabs expanded and lines truncated to the page width. Only the start of each line is buffered, so files with very long lines, such as minified sources, are read in bounded memory.
+func readTextLines(path string, maxLines int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0, maxLines)
+	// The buffer holds at least textColumns characters of any line.
+	reader := bufio.NewReaderSize(file, textColumns*utf8.UTFMax)
+	for len(lines) < maxLines {
+		data, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line := strings.Replace(string(data), "\t", strings.Repeat(" ", textTabWidth), -1)
+		if runes := []rune(line); len(runes) > textColumns {
+			line = string(runes[:textColumns])
+		}
+		lines = append(lines, line)
+
+		for isPrefix {
+			_, isPrefix, err = reader.ReadLine()
+			if err == io.EOF {
+				return lines, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return lines, nil
+}
+
+// highlightText splits each line into runs coloured by the lexer for the file type. Unknown file types are drawn as plain text.
+func highlightText(lines []string, fileType string) [][]textRun {
+	lexer := lexers.Get(fileType)
+	if lexer == nil {
+		lexer = lexers.Match("preview." + fileType)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	style := styles.Get("github")
+
+	iterator, err := lexer.Tokenise(nil, strings.Join(lines, "\n"))
+	if err != nil {
+		plain := make([][]textRun, len(lines))
+		for index, line := range lines {
+			plain[index] = []textRun{textRun{line, color.Black}}
+		}
+		return plain
+	}
+
+	highlighted := make([][]textRun, 1, len(lines)+1)
+	for _, token := range iterator.Tokens() {
+		colour := color.Color(color.Black)
+		entry := style.Get(token.Type)
+		if entry.Colour.IsSet() {
+			colour = color.RGBA{entry.Colour.Red(), entry.Colour.Green(), entry.Colour.Blue(), 0xff}
+		}
+		for index, part := range strings.Split(token.Value, "\n") {
+			if index > 0 {
+				highlighted = append(highlighted, nil)
+			}
+			if len(part) > 0 {
+				last := len(highlighted) - 1
+				highlighted[last] = append(highlighted[last], textRun{part, colour})
+			}
+		}
+	}
+	// Lexers may add a trailing new line.
+	for len(highlighted) < len(lines) {
+		highlighted = append(highlighted, nil)
+	}
+	return highlighted[:len(lines)]
+}
+
+// drawTextPage draws the lines onto a white page tall enough for the given number of lines, so that every page of a file has the same size.
+func drawTextPage(lines [][]textRun, linesPerPage int) (image.Image, error) {
+	face, err := newMonospaceFace(textFontSize)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	advance, _ := face.GlyphAdvance('M')
+
+	width := textMargin*2 + advance.Ceil()*textColumns
+	height := textMargin*2 + lineHeight*linesPerPage
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.ZP, draw.Src)
+
+	drawer := &font.Drawer{Dst: canvas, Face: face}
+	for index, line := range lines {
+		drawer.Dot = fixed.P(textMargin, textMargin+index*lineHeight+metrics.Ascent.Ceil())
+		for _, run := range line {
+			drawer.Src = image.NewUniform(run.colour)
+			drawer.DrawString(run.text)
+		}
+	}
+	return canvas, nil
+}
+
+// newMonospaceFace returns the Go Mono font at a size in pixels.
+func newMonospaceFace(size float64) (font.Face, error) {
+	parsedFont, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(parsedFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
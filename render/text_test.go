@@ -0,0 +1,100 @@
+package render
+
+import (
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTextLines(t *testing.T) {
+	directory, err := ioutil.TempDir("", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "source.txt")
+	content := "first\r\n\tsecond\n" + strings.Repeat("x", 150) + "\nfourth"
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := readTextLines(path, 10)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if len(lines) != 4 {
+		t.Errorf("Unexpected number of lines: %d", len(lines))
+		return
+	}
+	if lines[0] != "first" || lines[1] != "    second" || len(lines[2]) != textColumns || lines[3] != "fourth" {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+
+	lines, err = readTextLines(path, 2)
+	if err != nil || len(lines) != 2 {
+		t.Errorf("Expected the lines to be limited: %d %s", len(lines), err)
+	}
+
+	content = strings.Repeat("é", 100000) + "\nlast"
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err = readTextLines(path, 10)
+	if err != nil || len(lines) != 2 {
+		t.Errorf("Unexpected lines of a file with a long line: %d %v", len(lines), err)
+		return
+	}
+	if lines[0] != strings.Repeat("é", textColumns) || lines[1] != "last" {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+}
+
+func TestHighlightText(t *testing.T) {
+	lines := []string{"package main", "", "func main() {", "}"}
+	highlighted := highlightText(lines, "go")
+	if len(highlighted) != len(lines) {
+		t.Errorf("Unexpected number of highlighted lines: %d", len(highlighted))
+		return
+	}
+	for index, line := range lines {
+		text := ""
+		for _, run := range highlighted[index] {
+			text += run.text
+		}
+		if text != line {
+			t.Errorf("Unexpected text for line %d: %q", index, text)
+		}
+	}
+	keyword := highlighted[0][0]
+	if keyword.text != "package" || keyword.colour == color.Color(color.Black) {
+		t.Errorf("Expected the package keyword to be highlighted: %+v", keyword)
+	}
+
+	plain := highlightText([]string{"plain text"}, "unknown")
+	if len(plain) != 1 {
+		t.Errorf("Unexpected number of plain lines: %d", len(plain))
+	}
+}
+
+func TestDrawTextPage(t *testing.T) {
+	short, err := drawTextPage(highlightText([]string{"one"}, "txt"), 60)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	long, err := drawTextPage(highlightText(strings.Split(strings.Repeat("line\n", 59)+"line", "\n"), "txt"), 60)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if short.Bounds() != long.Bounds() {
+		t.Errorf("Expected pages of the same size: %s %s", short.Bounds(), long.Bounds())
+	}
+}
@@ -5,34 +5,70 @@ import (
 	"fmt"
 	"github.com/jherman3/zencoder"
 	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
 	"github.com/ngerakines/preview/util"
-	"github.com/rcrowley/go-metrics"
 	"log"
-	"time"
 )
 
 type videoRenderAgent struct {
-	metrics                 *videoRenderAgentMetrics
-	sasm                    common.SourceAssetStorageManager
-	gasm                    common.GeneratedAssetStorageManager
-	templateManager         common.TemplateManager
-	workChannel             RenderAgentWorkChannel
-	statusListeners         []RenderStatusChannel
-	agentManager            *RenderAgentManager
-	stop                    chan (chan bool)
+	baseRenderAgent
 	zencoder                *zencoder.Zencoder
 	zencoderS3Bucket        string
 	zencoderNotificationUrl string
 }
 
-type videoRenderAgentMetrics struct {
-	workProcessed metrics.Meter
-	convertTime   metrics.Timer
-	fileTypeCount map[string]metrics.Counter
+type videoRenderAgentFactory struct{}
+
+type videoRenderAgentConfig struct {
+	ZencoderKey             string `json:"zencoderKey"`
+	ZencoderS3Bucket        string `json:"zencoderS3Bucket"`
+	ZencoderNotificationUrl string `json:"zencoderNotificationUrl"`
+}
+
+func (factory *videoRenderAgentFactory) Name() string {
+	return common.RenderAgentVideo
+}
+
+func (factory *videoRenderAgentFactory) ConfigSection() string {
+	return "videoRenderAgent"
+}
+
+func (factory *videoRenderAgentFactory) TemplateIds() []string {
+	return []string{common.VideoConversionTemplateId}
+}
+
+func (factory *videoRenderAgentFactory) ValidateConfig(renderAgentConfig *config.RenderAgentConfig) error {
+	var videoConfig videoRenderAgentConfig
+	err := renderAgentConfig.Decode(&videoConfig)
+	if err != nil {
+		return err
+	}
+	_, err = zencoder.NewZencoder(videoConfig.ZencoderKey).GetAccount()
+	if err != nil {
+		log.Println("Invalid Zencoder key")
+		return common.ErrorNotImplemented
+	}
+	return nil
+}
+
+// Location returns an S3 url for the generated asset because Zencoder has to use S3 for an output.
+func (factory *videoRenderAgentFactory) Location(renderAgentConfig *config.RenderAgentConfig, sourceAsset *common.SourceAsset, template *common.Template) string {
+	var videoConfig videoRenderAgentConfig
+	renderAgentConfig.Decode(&videoConfig)
+	return fmt.Sprintf("s3://%s/%s", videoConfig.ZencoderS3Bucket, sourceAsset.Id)
+}
+
+func (factory *videoRenderAgentFactory) NewRenderAgent(context *RenderAgentContext) (RenderAgent, error) {
+	var videoConfig videoRenderAgentConfig
+	err := context.Config.Decode(&videoConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newVideoRenderAgent(context.Metrics, context.AgentManager, context.SourceAssetStorageManager, context.GeneratedAssetStorageManager, context.TemplateManager, context.WorkChannel, zencoder.NewZencoder(videoConfig.ZencoderKey), videoConfig.ZencoderS3Bucket, videoConfig.ZencoderNotificationUrl), nil
 }
 
 func newVideoRenderAgent(
-	metrics *videoRenderAgentMetrics,
+	metrics *RenderAgentMetrics,
 	agentManager *RenderAgentManager,
 	sasm common.SourceAssetStorageManager,
 	gasm common.GeneratedAssetStorageManager,
@@ -43,85 +79,18 @@ func newVideoRenderAgent(
 	notificationUrl string) RenderAgent {
 
 	renderAgent := new(videoRenderAgent)
-	renderAgent.metrics = metrics
-	renderAgent.agentManager = agentManager
-	renderAgent.sasm = sasm
-	renderAgent.gasm = gasm
-	renderAgent.templateManager = templateManager
-	renderAgent.workChannel = workChannel
-	renderAgent.statusListeners = make([]RenderStatusChannel, 0, 0)
-	renderAgent.stop = make(chan (chan bool))
+	renderAgent.baseRenderAgent = newBaseRenderAgent(common.RenderAgentVideo, metrics, agentManager, sasm, gasm, templateManager, nil, nil, nil, workChannel)
 
 	renderAgent.zencoder = zencoder
 	renderAgent.zencoderS3Bucket = s3Bucket
 	renderAgent.zencoderNotificationUrl = notificationUrl
-	go renderAgent.start()
+	go renderAgent.start(renderAgent.renderGeneratedAsset)
 
 	return renderAgent
 }
 
-func newVideoRenderAgentMetrics(registry metrics.Registry, supportedFileTypes []string) *videoRenderAgentMetrics {
-	videoMetrics := new(videoRenderAgentMetrics)
-	videoMetrics.workProcessed = metrics.NewMeter()
-	videoMetrics.convertTime = metrics.NewTimer()
-
-	videoMetrics.fileTypeCount = make(map[string]metrics.Counter)
-
-	for _, filetype := range supportedFileTypes {
-		videoMetrics.fileTypeCount[filetype] = metrics.NewCounter()
-		registry.Register(fmt.Sprintf("videoRenderAgent.%sCount", filetype), videoMetrics.fileTypeCount[filetype])
-	}
-
-	registry.Register("videoRenderAgent.workProcessed", videoMetrics.workProcessed)
-	registry.Register("videoRenderAgent.convertTime", videoMetrics.convertTime)
-
-	return videoMetrics
-}
-
-func (renderAgent *videoRenderAgent) start() {
-	for {
-		select {
-		case ch, ok := <-renderAgent.stop:
-			{
-				log.Println("Stopping")
-				if !ok {
-					return
-				}
-				ch <- true
-				return
-			}
-		case id, ok := <-renderAgent.workChannel:
-			{
-				if !ok {
-					return
-				}
-				log.Println("Received dispatch message", id)
-				renderAgent.renderGeneratedAsset(id)
-			}
-		}
-	}
-}
-
-func (renderAgent *videoRenderAgent) Stop() {
-	callback := make(chan bool)
-	renderAgent.stop <- callback
-	select {
-	case <-callback:
-	case <-time.After(5 * time.Second):
-	}
-	close(renderAgent.stop)
-}
-
-func (renderAgent *videoRenderAgent) AddStatusListener(listener RenderStatusChannel) {
-	renderAgent.statusListeners = append(renderAgent.statusListeners, listener)
-}
-
-func (renderAgent *videoRenderAgent) Dispatch() RenderAgentWorkChannel {
-	return renderAgent.workChannel
-}
-
 func (renderAgent *videoRenderAgent) renderGeneratedAsset(id string) {
-	renderAgent.metrics.workProcessed.Mark(1)
+	renderAgent.metrics.WorkProcessed.Mark(1)
 
 	generatedAsset, err := renderAgent.gasm.FindById(id)
 	if err != nil {
@@ -143,13 +112,13 @@ func (renderAgent *videoRenderAgent) renderGeneratedAsset(id string) {
 	}
 
 	fileType, err := common.GetFirstAttribute(sourceAsset, common.SourceAssetAttributeType)
-	if _, supports := renderAgent.metrics.fileTypeCount[fileType]; !supports {
+	if _, supports := renderAgent.metrics.FileTypeCount[fileType]; !supports {
 		log.Println("VideoRenderAgent doesn't support filetype", fileType)
 		statusCallback <- generatedAssetUpdate{common.NewGeneratedAssetError(common.ErrorNotImplemented), nil}
 		return
 	}
 	if err == nil {
-		renderAgent.metrics.fileTypeCount[fileType].Inc(1)
+		renderAgent.metrics.FileTypeCount[fileType].Inc(1)
 	}
 
 	urls := sourceAsset.GetAttribute(common.SourceAssetAttributeSource)
@@ -170,57 +139,3 @@ func (renderAgent *videoRenderAgent) renderGeneratedAsset(id string) {
 	// The webhook API will mark the GA as completed once Zencoder sends back a notification
 	statusCallback <- generatedAssetUpdate{common.GeneratedAssetStatusDelegated, nil}
 }
-
-func (renderAgent *videoRenderAgent) getSourceAsset(generatedAsset *common.GeneratedAsset) (*common.SourceAsset, error) {
-	sourceAssets, err := renderAgent.sasm.FindBySourceAssetId(generatedAsset.SourceAssetId)
-	if err != nil {
-		return nil, err
-	}
-	for _, sourceAsset := range sourceAssets {
-		if sourceAsset.IdType == generatedAsset.SourceAssetType {
-			return sourceAsset, nil
-		}
-	}
-	return nil, common.ErrorNoSourceAssetsFoundForId
-}
-
-func (renderAgent *videoRenderAgent) commitStatus(id string, existingAttributes []common.Attribute) chan generatedAssetUpdate {
-	commitChannel := make(chan generatedAssetUpdate, 10)
-
-	go func() {
-		status := common.NewGeneratedAssetError(common.ErrorUnknownError)
-		attributes := make([]common.Attribute, 0, 0)
-		for _, attribute := range existingAttributes {
-			attributes = append(attributes, attribute)
-		}
-		for {
-			select {
-			case message, ok := <-commitChannel:
-				{
-					if !ok {
-						for _, listener := range renderAgent.statusListeners {
-							listener <- RenderStatus{id, status, common.RenderAgentDocument}
-						}
-						generatedAsset, err := renderAgent.gasm.FindById(id)
-						if err != nil {
-							panic(err)
-							return
-						}
-						generatedAsset.Status = status
-						generatedAsset.Attributes = attributes
-						log.Println("Updating", generatedAsset)
-						renderAgent.gasm.Update(generatedAsset)
-						return
-					}
-					status = message.status
-					if message.attributes != nil {
-						for _, attribute := range message.attributes {
-							attributes = append(attributes, attribute)
-						}
-					}
-				}
-			}
-		}
-	}()
-	return commitChannel
-}
@@ -0,0 +1,233 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ngerakines/preview/common"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultWatermarkOpacity = 0.5
+	defaultWatermarkScale   = 0.25
+	// watermarkFontSize is the size, in pixels, that watermark text is drawn with before it is scaled to the render.
+	watermarkFontSize = 64
+	// watermarkMargin is the distance, as a fraction of the shorter side of the render, between positioned watermarks and the edges of the render and between tiled watermarks.
+	watermarkMargin = 0.03
+)
+
+var errUnsafeWatermarkImage = errors.New("watermark images must be files in the placeholder directory")
+
+// watermark is an image or text stamped onto the renders of templates with the watermark attributes. The same source can have both clean and watermarked generated assets by using templates with and without the attributes.
+type watermark struct {
+	mark     image.Image
+	position string
+	opacity  float64
+	scale    float64
+}
+
+// watermarkImageCache loads watermark images from the placeholder directory and keeps them in memory.
+type watermarkImageCache struct {
+	basePath string
+	mu       sync.Mutex
+	images   map[string]image.Image
+}
+
+func newWatermarkImageCache(basePath string) *watermarkImageCache {
+	cache := new(watermarkImageCache)
+	cache.basePath = basePath
+	cache.images = make(map[string]image.Image)
+	return cache
+}
+
+// load returns the decoded watermark image with the given file name. Images that cannot be loaded are not cached so that they can be added later.
+func (cache *watermarkImageCache) load(name string) (image.Image, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, errUnsafeWatermarkImage
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if mark, hasMark := cache.images[name]; hasMark {
+		return mark, nil
+	}
+	mark, err := decodeImageFile(filepath.Join(cache.basePath, name))
+	if err != nil {
+		return nil, err
+	}
+	cache.images[name] = mark
+	return mark, nil
+}
+
+// newWatermark reads the watermark attributes of a template. Templates without the watermarkImage and watermarkText attributes have no watermark, and nil is returned. When both are set, the image is used.
+func newWatermark(template *common.Template, images *watermarkImageCache) (*watermark, error) {
+	imageName, _ := common.GetFirstAttribute(template, common.TemplateAttributeWatermarkImage)
+	text, _ := common.GetFirstAttribute(template, common.TemplateAttributeWatermarkText)
+	if imageName == "" && text == "" {
+		return nil, nil
+	}
+
+	mark := new(watermark)
+	mark.position = common.TemplateWatermarkPositionBottomRight
+	mark.opacity = defaultWatermarkOpacity
+	mark.scale = defaultWatermarkScale
+
+	position, err := common.GetFirstAttribute(template, common.TemplateAttributeWatermarkPosition)
+	if err == nil {
+		switch position {
+		case common.TemplateWatermarkPositionCenter, common.TemplateWatermarkPositionTopLeft, common.TemplateWatermarkPositionTopRight, common.TemplateWatermarkPositionBottomLeft, common.TemplateWatermarkPositionBottomRight, common.TemplateWatermarkPositionTile:
+			mark.position = position
+		default:
+			return nil, fmt.Errorf("unknown watermark position %s", position)
+		}
+	}
+	mark.opacity, err = watermarkFraction(template, common.TemplateAttributeWatermarkOpacity, defaultWatermarkOpacity)
+	if err != nil {
+		return nil, err
+	}
+	mark.scale, err = watermarkFraction(template, common.TemplateAttributeWatermarkScale, defaultWatermarkScale)
+	if err != nil {
+		return nil, err
+	}
+
+	if imageName != "" {
+		mark.mark, err = images.load(imageName)
+		return mark, err
+	}
+	foreground := color.Color(color.White)
+	rawForeground, err := common.GetFirstAttribute(template, common.TemplateAttributeForeground)
+	if err == nil {
+		foreground, err = parseColor(rawForeground)
+		if err != nil {
+			return nil, err
+		}
+	}
+	mark.mark, err = textImage(text, foreground)
+	return mark, err
+}
+
+// watermarkFraction reads a template attribute that must be greater than 0 and no greater than 1.
+func watermarkFraction(template *common.Template, key string, defaultValue float64) (float64, error) {
+	rawValue, err := common.GetFirstAttribute(template, key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value <= 0 || value > 1 {
+		return 0, fmt.Errorf("%s must be greater than 0 and no greater than 1", key)
+	}
+	return value, nil
+}
+
+// textImage draws text onto a transparent image with a shadow that keeps it readable on light renders.
+func textImage(text string, foreground color.Color) (image.Image, error) {
+	parsedFont, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(parsedFont, &opentype.FaceOptions{Size: watermarkFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	shadowOffset := watermarkFontSize / 32
+	width := font.MeasureString(face, text).Ceil() + shadowOffset
+	height := metrics.Ascent.Ceil() + metrics.Descent.Ceil() + shadowOffset
+	if width <= shadowOffset {
+		return nil, fmt.Errorf("watermark text %q has no width", text)
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	drawer := &font.Drawer{Dst: canvas, Src: image.NewUniform(color.NRGBA{0, 0, 0, 128}), Face: face}
+	drawer.Dot = fixed.P(shadowOffset, shadowOffset+metrics.Ascent.Ceil())
+	drawer.DrawString(text)
+	drawer.Src = image.NewUniform(foreground)
+	drawer.Dot = fixed.P(0, metrics.Ascent.Ceil())
+	drawer.DrawString(text)
+	return canvas, nil
+}
+
+// apply stamps the watermark onto an image. The watermark is scaled to the scale fraction of the width of the image and drawn with the opacity at the position. A nil watermark returns the image unchanged.
+func (mark *watermark) apply(sourceImage image.Image) image.Image {
+	if mark == nil {
+		return sourceImage
+	}
+	bounds := sourceImage.Bounds()
+	markBounds := mark.mark.Bounds()
+	width := int(float64(bounds.Dx())*mark.scale + 0.5)
+	if width < 1 || markBounds.Dx() < 1 {
+		return sourceImage
+	}
+	height := markBounds.Dy() * width / markBounds.Dx()
+	if height < 1 {
+		return sourceImage
+	}
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), mark.mark, markBounds, draw.Src, nil)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), sourceImage, bounds.Min, draw.Src)
+	opacity := image.NewUniform(color.Alpha{uint8(mark.opacity*255 + 0.5)})
+	for _, point := range mark.positions(canvas.Bounds(), scaled.Bounds()) {
+		draw.DrawMask(canvas, scaled.Bounds().Add(point), scaled, image.ZP, opacity, image.ZP, draw.Over)
+	}
+	return canvas
+}
+
+// positions returns the points of the image the top left corner of the scaled watermark is drawn at.
+func (mark *watermark) positions(bounds, markBounds image.Rectangle) []image.Point {
+	shorterSide := bounds.Dx()
+	if bounds.Dy() < shorterSide {
+		shorterSide = bounds.Dy()
+	}
+	margin := int(float64(shorterSide) * watermarkMargin)
+	right := bounds.Dx() - markBounds.Dx() - margin
+	bottom := bounds.Dy() - markBounds.Dy() - margin
+
+	switch mark.position {
+	case common.TemplateWatermarkPositionCenter:
+		return []image.Point{image.Pt((bounds.Dx()-markBounds.Dx())/2, (bounds.Dy()-markBounds.Dy())/2)}
+	case common.TemplateWatermarkPositionTopLeft:
+		return []image.Point{image.Pt(margin, margin)}
+	case common.TemplateWatermarkPositionTopRight:
+		return []image.Point{image.Pt(right, margin)}
+	case common.TemplateWatermarkPositionBottomLeft:
+		return []image.Point{image.Pt(margin, bottom)}
+	case common.TemplateWatermarkPositionTile:
+		points := make([]image.Point, 0, 0)
+		for y := margin; y < bounds.Dy(); y += markBounds.Dy() + 2*margin {
+			for x := margin; x < bounds.Dx(); x += markBounds.Dx() + 2*margin {
+				points = append(points, image.Pt(x, y))
+			}
+		}
+		return points
+	}
+	return []image.Point{image.Pt(right, bottom)}
+}
+
+// applyFile stamps the watermark onto an image file, replacing it. Images are encoded within the limits. A nil watermark leaves the file unchanged.
+func (mark *watermark) applyFile(limits *processLimits, path, output string) error {
+	if mark == nil {
+		return nil
+	}
+	sourceImage, err := decodeImageFile(path)
+	if err != nil {
+		return err
+	}
+	return encodeImage(limits, mark.apply(sourceImage), path, output)
+}
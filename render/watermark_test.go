@@ -0,0 +1,138 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newWatermarkTemplate(attributes ...common.Attribute) *common.Template {
+	return &common.Template{
+		Id:         "watermark",
+		Renderer:   common.RenderAgentNativeImage,
+		Group:      "B2D4",
+		Attributes: attributes,
+	}
+}
+
+func TestNewWatermark(t *testing.T) {
+	images := newWatermarkImageCache("")
+
+	mark, err := newWatermark(newWatermarkTemplate(), images)
+	if mark != nil || err != nil {
+		t.Errorf("Expected no watermark for templates without watermark attributes: %v %v", mark, err)
+	}
+
+	mark, err = newWatermark(newWatermarkTemplate(common.Attribute{Key: common.TemplateAttributeWatermarkText, Value: []string{"Trial"}}), images)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	if mark.position != common.TemplateWatermarkPositionBottomRight || mark.opacity != defaultWatermarkOpacity || mark.scale != defaultWatermarkScale {
+		t.Errorf("Unexpected watermark defaults: %+v", mark)
+	}
+	if mark.mark.Bounds().Dx() <= mark.mark.Bounds().Dy() {
+		t.Errorf("Unexpected watermark text bounds: %s", mark.mark.Bounds())
+	}
+
+	invalidAttributes := []common.Attribute{
+		common.Attribute{Key: common.TemplateAttributeWatermarkPosition, Value: []string{"middle"}},
+		common.Attribute{Key: common.TemplateAttributeWatermarkOpacity, Value: []string{"1.5"}},
+		common.Attribute{Key: common.TemplateAttributeWatermarkScale, Value: []string{"0"}},
+		common.Attribute{Key: common.TemplateAttributeForeground, Value: []string{"white"}},
+	}
+	for _, attribute := range invalidAttributes {
+		_, err = newWatermark(newWatermarkTemplate(common.Attribute{Key: common.TemplateAttributeWatermarkText, Value: []string{"Trial"}}, attribute), images)
+		if err == nil {
+			t.Errorf("Expected an error for the %s attribute", attribute.Key)
+		}
+	}
+}
+
+func TestWatermarkImage(t *testing.T) {
+	directory, err := ioutil.TempDir("", "watermark")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	markImage := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(markImage, markImage.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.ZP, draw.Src)
+	err = encodeImageFile(markImage, filepath.Join(directory, "mark.png"), "png")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	images := newWatermarkImageCache(directory)
+	template := newWatermarkTemplate(
+		common.Attribute{Key: common.TemplateAttributeWatermarkImage, Value: []string{"mark.png"}},
+		common.Attribute{Key: common.TemplateAttributeWatermarkPosition, Value: []string{common.TemplateWatermarkPositionTopLeft}},
+		common.Attribute{Key: common.TemplateAttributeWatermarkOpacity, Value: []string{"1"}},
+		common.Attribute{Key: common.TemplateAttributeWatermarkScale, Value: []string{"0.5"}},
+	)
+	mark, err := newWatermark(template, images)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	render := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(render, render.Bounds(), image.NewUniform(color.White), image.ZP, draw.Src)
+	stamped := mark.apply(render)
+	if stamped.Bounds() != render.Bounds() {
+		t.Errorf("Unexpected bounds: %s", stamped.Bounds())
+	}
+	// The watermark is 100 pixels wide and starts 3 pixels from the edges.
+	if r, g, b, _ := stamped.At(50, 50).RGBA(); r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("Expected the watermark to be stamped: %d %d %d", r>>8, g>>8, b>>8)
+	}
+	if r, g, b, _ := stamped.At(150, 50).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Errorf("Expected the render to be unchanged outside the watermark: %d %d %d", r>>8, g>>8, b>>8)
+	}
+
+	os.Remove(filepath.Join(directory, "mark.png"))
+	_, err = images.load("mark.png")
+	if err != nil {
+		t.Error("Expected the watermark image to be cached")
+	}
+	_, err = images.load("../mark.png")
+	if err != errUnsafeWatermarkImage {
+		t.Error("Expected watermark images outside of the placeholder directory to be rejected")
+	}
+
+	var nilWatermark *watermark
+	if nilWatermark.apply(render) != image.Image(render) {
+		t.Error("Expected images to be unchanged without a watermark")
+	}
+}
+
+func TestWatermarkPositions(t *testing.T) {
+	bounds := image.Rect(0, 0, 200, 100)
+	markBounds := image.Rect(0, 0, 50, 20)
+	expected := map[string]image.Point{
+		common.TemplateWatermarkPositionCenter:      image.Pt(75, 40),
+		common.TemplateWatermarkPositionTopLeft:     image.Pt(3, 3),
+		common.TemplateWatermarkPositionTopRight:    image.Pt(147, 3),
+		common.TemplateWatermarkPositionBottomLeft:  image.Pt(3, 77),
+		common.TemplateWatermarkPositionBottomRight: image.Pt(147, 77),
+	}
+	for position, point := range expected {
+		mark := &watermark{position: position}
+		points := mark.positions(bounds, markBounds)
+		if len(points) != 1 || points[0] != point {
+			t.Errorf("Unexpected points for position %s: %v", position, points)
+		}
+	}
+
+	mark := &watermark{position: common.TemplateWatermarkPositionTile}
+	if points := mark.positions(bounds, markBounds); len(points) != 16 {
+		t.Errorf("Unexpected tiled points: %v", points)
+	}
+}
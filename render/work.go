@@ -1,12 +1,14 @@
 package render
 
 import (
-	"fmt"
-	"github.com/jherman3/zencoder"
+	"github.com/ngerakines/codederror"
 	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
 	"github.com/ngerakines/preview/util"
 	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,34 +16,47 @@ import (
 )
 
 type RenderAgentManager struct {
-	sourceAssetStorageManager     common.SourceAssetStorageManager
-	generatedAssetStorageManager  common.GeneratedAssetStorageManager
-	templateManager               common.TemplateManager
-	temporaryFileManager          common.TemporaryFileManager
-	uploader                      common.Uploader
-	workStatus                    RenderStatusChannel
-	workChannels                  map[string]RenderAgentWorkChannel
-	renderAgents                  map[string][]RenderAgent
-	activeWork                    map[string][]string
-	maxWork                       map[string]int
-	enabledRenderAgents           map[string]bool
-	renderAgentCount              map[string]int
-	documentSupportedFileTypes    []string
-	imageMagickSupportedFileTypes []string
-	videoSupportedFileTypes       []string
-
-	documentMetrics    *documentRenderAgentMetrics
-	imageMagickMetrics *imageMagickRenderAgentMetrics
-	videoMetrics       *videoRenderAgentMetrics
-
-	stop chan (chan bool)
-	mu   sync.Mutex
-	// I feel like there should be a way to do this without giving RenderAgentManager a Zencoder
-	zencoder                *zencoder.Zencoder
-	zencoderS3Bucket        string
-	zencoderNotificationUrl string
+	sourceAssetStorageManager    common.SourceAssetStorageManager
+	generatedAssetStorageManager common.GeneratedAssetStorageManager
+	templateManager              common.TemplateManager
+	temporaryFileManager         common.TemporaryFileManager
+	uploader                     common.Uploader
+	workStatus                   RenderStatusChannel
+	workChannels                 map[string]RenderAgentWorkChannel
+	priorityChannels             map[string]RenderAgentWorkChannel
+	renderAgents                 map[string][]RenderAgent
+	activeWork                   map[string][]string
+	maxWork                      map[string]int
+	factories                    []RenderAgentFactory
+	renderAgentConfigs           map[string]*config.RenderAgentConfig
+	renderAgentMetrics           map[string]*RenderAgentMetrics
+	eagerPages                   int
+	maxPages                     map[string]int
+	waiters                      map[string][]chan bool
+	workDispatcherEnabled        bool
+	watermarkImages              *watermarkImageCache
+	downloader                   common.Downloader
+	detectFileTypes              bool
+	rejectFileTypeMismatches     bool
+	detecting                    map[string]bool
+	detections                   sync.WaitGroup
+	sharedDownloads              map[string]*sharedDownload
+
+	stop        chan (chan bool)
+	mu          sync.Mutex
+	pagesMu     sync.Mutex
+	downloadsMu sync.Mutex
+}
+
+// sharedDownload is a file downloaded to detect its file type that is handed to the render agents rendering it instead of downloading it again.
+type sharedDownload struct {
+	file   common.TemporaryFile
+	claims int
 }
 
+// sharedDownloadTimeout is how long a shared download is kept for render agents that have not claimed it yet.
+const sharedDownloadTimeout = 10 * time.Minute
+
 func NewRenderAgentManager(
 	registry metrics.Registry,
 	sourceAssetStorageManager common.SourceAssetStorageManager,
@@ -50,12 +65,7 @@ func NewRenderAgentManager(
 	temporaryFileManager common.TemporaryFileManager,
 	uploader common.Uploader,
 	workDispatcherEnabled bool,
-	zencoder *zencoder.Zencoder,
-	s3bucket string,
-	notificationUrl string,
-	documentSupportedFileTypes []string,
-	imageMagickSupportedFileTypes []string,
-	videoSupportedFileTypes []string) *RenderAgentManager {
+	renderAgentConfigs map[string]*config.RenderAgentConfig) *RenderAgentManager {
 
 	agentManager := new(RenderAgentManager)
 	agentManager.sourceAssetStorageManager = sourceAssetStorageManager
@@ -66,35 +76,46 @@ func NewRenderAgentManager(
 	agentManager.temporaryFileManager = temporaryFileManager
 	agentManager.workStatus = make(RenderStatusChannel, 100)
 	agentManager.workChannels = make(map[string]RenderAgentWorkChannel)
-	for _, renderAgent := range common.RenderAgents {
-		agentManager.workChannels[renderAgent] = make(RenderAgentWorkChannel, 200)
-	}
+	agentManager.priorityChannels = make(map[string]RenderAgentWorkChannel)
 	agentManager.renderAgents = make(map[string][]RenderAgent)
 	agentManager.activeWork = make(map[string][]string)
 	agentManager.maxWork = make(map[string]int)
-	agentManager.enabledRenderAgents = make(map[string]bool)
-	agentManager.renderAgentCount = make(map[string]int)
+	agentManager.waiters = make(map[string][]chan bool)
+	agentManager.detecting = make(map[string]bool)
+	agentManager.sharedDownloads = make(map[string]*sharedDownload)
+	agentManager.watermarkImages = newWatermarkImageCache("")
 
-	agentManager.documentMetrics = newDocumentRenderAgentMetrics(registry, documentSupportedFileTypes)
-	agentManager.imageMagickMetrics = newImageMagickRenderAgentMetrics(registry, imageMagickSupportedFileTypes)
-	agentManager.videoMetrics = newVideoRenderAgentMetrics(registry, videoSupportedFileTypes)
-
-	agentManager.zencoder = zencoder
-	agentManager.zencoderS3Bucket = s3bucket
-	agentManager.zencoderNotificationUrl = notificationUrl
-
-	agentManager.documentSupportedFileTypes = documentSupportedFileTypes
-	agentManager.imageMagickSupportedFileTypes = imageMagickSupportedFileTypes
-	agentManager.videoSupportedFileTypes = videoSupportedFileTypes
+	agentManager.factories = RenderAgentFactories()
+	agentManager.renderAgentConfigs = make(map[string]*config.RenderAgentConfig)
+	agentManager.renderAgentMetrics = make(map[string]*RenderAgentMetrics)
+	for _, factory := range agentManager.factories {
+		renderAgentConfig, hasRenderAgentConfig := renderAgentConfigs[factory.Name()]
+		if !hasRenderAgentConfig {
+			renderAgentConfig = &config.RenderAgentConfig{Raw: []byte("{}")}
+		}
+		agentManager.renderAgentConfigs[factory.Name()] = renderAgentConfig
+		agentManager.renderAgentMetrics[factory.Name()] = newRenderAgentMetrics(registry, factory.ConfigSection(), renderAgentConfig.SupportedFileTypes)
+		agentManager.workChannels[factory.Name()] = make(RenderAgentWorkChannel, 200)
+		agentManager.priorityChannels[factory.Name()] = make(RenderAgentWorkChannel, 200)
+	}
 
 	agentManager.stop = make(chan (chan bool))
-	if workDispatcherEnabled {
-		go agentManager.run()
-	}
+	agentManager.workDispatcherEnabled = workDispatcherEnabled
+	// Status updates are always received so that waiters are notified, but work is only looked for when the work dispatcher is enabled.
+	go agentManager.run()
 
 	return agentManager
 }
 
+// RenderAgentNames returns the names of all of the render agents known to the render agent manager.
+func (agentManager *RenderAgentManager) RenderAgentNames() []string {
+	results := make([]string, 0, len(agentManager.factories))
+	for _, factory := range agentManager.factories {
+		results = append(results, factory.Name())
+	}
+	return results
+}
+
 func (agentManager *RenderAgentManager) ActiveWorkForRenderAgent(renderAgent string) (bool, int, []string) {
 	activeWork, hasActiveWork := agentManager.activeWork[renderAgent]
 	if hasActiveWork {
@@ -103,27 +124,59 @@ func (agentManager *RenderAgentManager) ActiveWorkForRenderAgent(renderAgent str
 	return agentManager.isRenderAgentEnabled(renderAgent), agentManager.getRenderAgentCount(renderAgent), []string{}
 }
 
-func (agentManager *RenderAgentManager) SetRenderAgentInfo(name string, value bool, count int) {
-	agentManager.enabledRenderAgents[name] = value
-	agentManager.renderAgentCount[name] = count
+// RenderAgentStatus returns the status of each render agent with the given name that reports one.
+func (agentManager *RenderAgentManager) RenderAgentStatus(name string) []interface{} {
+	agentManager.mu.Lock()
+	renderAgents := agentManager.renderAgents[name]
+	agentManager.mu.Unlock()
+
+	results := make([]interface{}, 0, 0)
+	for _, renderAgent := range renderAgents {
+		reporter, isReporter := renderAgent.(RenderAgentStatusReporter)
+		if isReporter {
+			results = append(results, reporter.Status())
+		}
+	}
+	return results
 }
 
 func (agentManager *RenderAgentManager) isRenderAgentEnabled(name string) bool {
-	value, hasValue := agentManager.enabledRenderAgents[name]
-	if hasValue {
-		return value
+	renderAgentConfig, hasRenderAgentConfig := agentManager.renderAgentConfigs[name]
+	if hasRenderAgentConfig {
+		return renderAgentConfig.Enabled
 	}
 	return false
 }
 
 func (agentManager *RenderAgentManager) getRenderAgentCount(name string) int {
-	value, hasValue := agentManager.renderAgentCount[name]
-	if hasValue {
-		return value
+	renderAgentConfig, hasRenderAgentConfig := agentManager.renderAgentConfigs[name]
+	if hasRenderAgentConfig {
+		return renderAgentConfig.Count
 	}
 	return 0
 }
 
+func (agentManager *RenderAgentManager) findFactory(name string) (RenderAgentFactory, error) {
+	for _, factory := range agentManager.factories {
+		if factory.Name() == name {
+			return factory, nil
+		}
+	}
+	return nil, common.ErrorNoRenderersSupportFileType
+}
+
+// location returns the location that a generated asset for the source asset and template will be stored at.
+func (agentManager *RenderAgentManager) location(sourceAsset *common.SourceAsset, template *common.Template) string {
+	factory, err := agentManager.findFactory(template.Renderer)
+	if err == nil {
+		locator, isLocator := factory.(GeneratedAssetLocator)
+		if isLocator {
+			return locator.Location(agentManager.renderAgentConfigs[factory.Name()], sourceAsset, template)
+		}
+	}
+	return agentManager.uploader.Url(sourceAsset, template, 0)
+}
+
 func (agentManager *RenderAgentManager) CreateWorkFromTemplates(sourceAssetId, url string, attributes map[string][]string, templateIds []string) {
 	sourceAsset, err := common.NewSourceAsset(sourceAssetId, common.SourceAssetTypeOrigin)
 	if err != nil {
@@ -135,9 +188,18 @@ func (agentManager *RenderAgentManager) CreateWorkFromTemplates(sourceAssetId, u
 	}
 	sourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{url})
 
+	declaredFileType := ""
 	fileType, hasType := attributes["type"]
 	if hasType {
 		sourceAsset.AddAttribute(common.SourceAssetAttributeType, fileType)
+		if len(fileType) > 0 {
+			declaredFileType = fileType[0]
+		}
+	}
+
+	detect := agentManager.detectFileTypes && agentManager.downloader != nil
+	if detect && declaredFileType != "" {
+		sourceAsset.AddAttribute(common.SourceAssetAttributeDeclaredType, []string{declaredFileType})
 	}
 
 	agentManager.sourceAssetStorageManager.Store(sourceAsset)
@@ -147,34 +209,19 @@ func (agentManager *RenderAgentManager) CreateWorkFromTemplates(sourceAssetId, u
 		return
 	}
 
-	status := common.DefaultGeneratedAssetStatus
-	for _, template := range templates {
-		var location string
-		if template.Id == common.VideoConversionTemplateId {
-			// Zencoder has to use S3 for an output
-			location = fmt.Sprintf("s3://%s/%s", agentManager.zencoderS3Bucket, sourceAssetId)
-		} else {
-			location = agentManager.uploader.Url(sourceAsset, template, 0)
-		}
-		ga, err := common.NewGeneratedAssetFromSourceAsset(sourceAsset, template.Id, location)
-
-		if err == nil {
-			status, dispatchFunc := agentManager.canDispatch(ga.Id, status, template)
-			if status != ga.Status {
-				ga.Status = status
-			}
-			agentManager.generatedAssetStorageManager.Store(ga)
-			if dispatchFunc != nil {
-				defer dispatchFunc()
-			}
-		} else {
-			log.Println("error creating generated asset from source asset", err)
-			return
-		}
+	if detect {
+		agentManager.createDetectedWork(sourceAsset, url, declaredFileType, templates, false)
+		return
 	}
+	agentManager.createWorkForTemplates(sourceAsset, templates, common.DefaultGeneratedAssetStatus, true)
 }
 
 func (agentManager *RenderAgentManager) CreateWork(sourceAssetId, url, fileType string, size int64) {
+	agentManager.CreateWorkWithAttributes(sourceAssetId, url, fileType, size, nil)
+}
+
+// CreateWorkWithAttributes creates the work for a source asset like CreateWork, adding the attributes to the source asset.
+func (agentManager *RenderAgentManager) CreateWorkWithAttributes(sourceAssetId, url, fileType string, size int64, attributes []common.Attribute) {
 	sourceAsset, err := common.NewSourceAsset(sourceAssetId, common.SourceAssetTypeOrigin)
 	if err != nil {
 		return
@@ -182,59 +229,252 @@ func (agentManager *RenderAgentManager) CreateWork(sourceAssetId, url, fileType
 	sourceAsset.AddAttribute(common.SourceAssetAttributeSize, []string{strconv.FormatInt(size, 10)})
 	sourceAsset.AddAttribute(common.SourceAssetAttributeSource, []string{url})
 	sourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{fileType})
+	for _, attribute := range attributes {
+		sourceAsset.AddAttribute(attribute.Key, attribute.Value)
+	}
+
+	if agentManager.detectFileTypes && agentManager.downloader != nil {
+		sourceAsset.AddAttribute(common.SourceAssetAttributeDeclaredType, []string{fileType})
+		agentManager.sourceAssetStorageManager.Store(sourceAsset)
+		// The declared file type may not be supported while the detected one is, so its generated assets are only failed once the file type is known.
+		templates, _, _ := agentManager.whichRenderAgent(fileType)
+		agentManager.createDetectedWork(sourceAsset, url, fileType, templates, true)
+		return
+	}
 
 	agentManager.sourceAssetStorageManager.Store(sourceAsset)
+	agentManager.createWorkForFileType(sourceAsset, fileType)
+}
 
-	templates, status, err := agentManager.whichRenderAgent(fileType)
+// createDetectedWork creates waiting generated assets for the templates of a source asset right away and detects the file type of the source asset in the background. The generated assets are not dispatched until the file type is known. When routeByFileType is true, the templates are replaced by those of the render agent for the detected file type.
+func (agentManager *RenderAgentManager) createDetectedWork(sourceAsset *common.SourceAsset, url, declaredFileType string, templates []*common.Template, routeByFileType bool) {
+	agentManager.setDetecting(sourceAsset.Id, true)
+	generatedAssets := agentManager.createWorkForTemplates(sourceAsset, templates, common.DefaultGeneratedAssetStatus, false)
+	agentManager.detections.Add(1)
+	go agentManager.finishDetectedWork(sourceAsset, url, declaredFileType, templates, generatedAssets, routeByFileType)
+}
+
+// finishDetectedWork downloads the file of a source asset, detects its file type from its contents and dispatches the waiting generated assets created for it. When the detected file type does not match the declared one and mismatches are rejected, the generated assets fail instead. The downloaded file is shared with the render agents so that they do not download it again.
+func (agentManager *RenderAgentManager) finishDetectedWork(sourceAsset *common.SourceAsset, url, declaredFileType string, templates []*common.Template, generatedAssets []*common.GeneratedAsset, routeByFileType bool) {
+	defer agentManager.detections.Done()
+	defer agentManager.setDetecting(sourceAsset.Id, false)
+
+	file, err := agentManager.downloader.Download(url, common.SourceAssetSource(sourceAsset))
 	if err != nil {
-		log.Println("error determining which render agent to use", err)
+		// The render agents will report that the file could not be downloaded.
+		log.Println("error downloading file to detect file type", err)
+		_, dispatchFuncs := agentManager.prepareDetectedWork(sourceAsset, declaredFileType, templates, generatedAssets, routeByFileType)
+		for _, dispatchFunc := range dispatchFuncs {
+			dispatchFunc()
+		}
 		return
 	}
+	defer file.Release()
 
-	placeholderSizes := make(map[string]string)
-	for _, template := range templates {
-		placeholderSize, err := common.GetFirstAttribute(template, common.TemplateAttributePlaceholderSize)
-		if err == nil {
-			placeholderSizes[template.Id] = placeholderSize
+	detectedFileType := detectFileType(file.Path())
+	fileType, mismatch := resolveFileType(declaredFileType, detectedFileType)
+	if detectedFileType != "" {
+		sourceAsset.AddAttribute(common.SourceAssetAttributeDetectedType, []string{detectedFileType})
+	}
+	if mismatch && agentManager.rejectFileTypeMismatches {
+		log.Println("file type", detectedFileType, "of", sourceAsset.Id, "does not match", declaredFileType)
+		agentManager.sourceAssetStorageManager.Update(sourceAsset)
+		agentManager.failWork(sourceAsset, generatedAssets, common.NewGeneratedAssetError(common.ErrorFileTypeMismatch))
+		return
+	}
+	if fileType != "" {
+		if sourceAsset.HasAttribute(common.SourceAssetAttributeType) {
+			for i, attribute := range sourceAsset.Attributes {
+				if attribute.Key == common.SourceAssetAttributeType {
+					sourceAsset.Attributes[i].Value = []string{fileType}
+				}
+			}
+		} else {
+			sourceAsset.AddAttribute(common.SourceAssetAttributeType, []string{fileType})
+		}
+	}
+	agentManager.sourceAssetStorageManager.Update(sourceAsset)
+
+	work, dispatchFuncs := agentManager.prepareDetectedWork(sourceAsset, fileType, templates, generatedAssets, routeByFileType)
+	agentManager.shareDownload(url, file, work)
+	for _, dispatchFunc := range dispatchFuncs {
+		dispatchFunc()
+	}
+}
+
+// prepareDetectedWork schedules the waiting generated assets of a source asset once its file type is known and returns how many generated assets will be rendered along with the functions that dispatch them. When routeByFileType is true, generated assets of templates that the render agent for the file type does not use fail and the missing ones are created.
+func (agentManager *RenderAgentManager) prepareDetectedWork(sourceAsset *common.SourceAsset, fileType string, templates []*common.Template, generatedAssets []*common.GeneratedAsset, routeByFileType bool) (int, []func()) {
+	if !routeByFileType {
+		return len(generatedAssets), agentManager.scheduleWork(generatedAssets, templates)
+	}
+
+	fileTypeTemplates, _, err := agentManager.whichRenderAgent(fileType)
+	if err != nil {
+		log.Println("error determining which render agent to use", err)
+		codedError, isCodedError := err.(codederror.CodedError)
+		if isCodedError {
+			agentManager.failWork(sourceAsset, generatedAssets, common.NewGeneratedAssetError(codedError))
 		}
+		return 0, nil
 	}
 
+	templateIds := make(map[string]bool)
+	for _, template := range fileTypeTemplates {
+		templateIds[template.Id] = true
+	}
+	work := make([]*common.GeneratedAsset, 0, len(fileTypeTemplates))
+	for _, generatedAsset := range generatedAssets {
+		if templateIds[generatedAsset.TemplateId] {
+			work = append(work, generatedAsset)
+			delete(templateIds, generatedAsset.TemplateId)
+			continue
+		}
+		generatedAsset.Status = common.NewGeneratedAssetError(common.ErrorFileTypeMismatch)
+		agentManager.generatedAssetStorageManager.Update(generatedAsset)
+	}
+	missingTemplates := make([]*common.Template, 0, len(templateIds))
+	for _, template := range fileTypeTemplates {
+		if templateIds[template.Id] {
+			missingTemplates = append(missingTemplates, template)
+		}
+	}
+	work = append(work, agentManager.createWorkForTemplates(sourceAsset, missingTemplates, common.DefaultGeneratedAssetStatus, false)...)
+	return len(work), agentManager.scheduleWork(work, fileTypeTemplates)
+}
+
+// scheduleWork marks the waiting generated assets that can be dispatched right away as scheduled and returns the functions that dispatch them. The others are left for the work dispatcher.
+func (agentManager *RenderAgentManager) scheduleWork(generatedAssets []*common.GeneratedAsset, templates []*common.Template) []func() {
+	templatesById := make(map[string]*common.Template)
 	for _, template := range templates {
-		var location string
-		if template.Id == common.VideoConversionTemplateId {
-			// Zencoder has to use S3 for an output
-			location = fmt.Sprintf("s3://%s/%s", agentManager.zencoderS3Bucket, sourceAssetId)
-		} else {
-			location = agentManager.uploader.Url(sourceAsset, template, 0)
+		templatesById[template.Id] = template
+	}
+	dispatchFuncs := make([]func(), 0, 0)
+	for _, generatedAsset := range generatedAssets {
+		template, hasTemplate := templatesById[generatedAsset.TemplateId]
+		if !hasTemplate {
+			continue
 		}
+		status, dispatchFunc := agentManager.canDispatch(generatedAsset.Id, generatedAsset.Status, template)
+		if dispatchFunc != nil {
+			generatedAsset.Status = status
+			agentManager.generatedAssetStorageManager.Update(generatedAsset)
+			dispatchFuncs = append(dispatchFuncs, dispatchFunc)
+		}
+	}
+	return dispatchFuncs
+}
+
+// failWork stores the generated assets of a source asset with a failed status. When the source asset has no generated assets, failed generated assets are created for the legacy default templates so that the failure is recorded.
+func (agentManager *RenderAgentManager) failWork(sourceAsset *common.SourceAsset, generatedAssets []*common.GeneratedAsset, failedStatus string) {
+	if len(generatedAssets) == 0 {
+		templates, err := agentManager.templateManager.FindByIds(common.LegacyDefaultTemplates)
+		if err != nil {
+			log.Println("error finding templates to record failed work", err)
+			return
+		}
+		agentManager.createWorkForTemplates(sourceAsset, templates, failedStatus, false)
+		return
+	}
+	for _, generatedAsset := range generatedAssets {
+		generatedAsset.Status = failedStatus
+		agentManager.generatedAssetStorageManager.Update(generatedAsset)
+	}
+}
+
+// createWorkForFileType creates and dispatches the generated assets of the templates of the render agent for a file type. When no render agent supports the file type, the failure is recorded with failed generated assets.
+func (agentManager *RenderAgentManager) createWorkForFileType(sourceAsset *common.SourceAsset, fileType string) {
+	templates, status, err := agentManager.whichRenderAgent(fileType)
+	if err != nil {
+		log.Println("error determining which render agent to use", err)
+		codedError, isCodedError := err.(codederror.CodedError)
+		if isCodedError {
+			agentManager.failWork(sourceAsset, nil, common.NewGeneratedAssetError(codedError))
+		}
+		return
+	}
+	agentManager.createWorkForTemplates(sourceAsset, templates, status, true)
+}
+
+// createWorkForTemplates stores a generated asset with the given status for each template. When dispatch is true, the generated assets that can be dispatched right away are dispatched once all of them are stored.
+func (agentManager *RenderAgentManager) createWorkForTemplates(sourceAsset *common.SourceAsset, templates []*common.Template, status string, dispatch bool) []*common.GeneratedAsset {
+	generatedAssets := make([]*common.GeneratedAsset, 0, len(templates))
+	for _, template := range templates {
+		location := agentManager.location(sourceAsset, template)
 		ga, err := common.NewGeneratedAssetFromSourceAsset(sourceAsset, template.Id, location)
 
-		if err == nil {
-			status, dispatchFunc := agentManager.canDispatch(ga.Id, status, template)
+		if err != nil {
+			log.Println("error creating generated asset from source asset", err)
+			return generatedAssets
+		}
+		ga.Status = status
+		if dispatch {
+			status, dispatchFunc := agentManager.canDispatch(ga.Id, ga.Status, template)
 			if status != ga.Status {
 				ga.Status = status
 			}
-			agentManager.generatedAssetStorageManager.Store(ga)
 			if dispatchFunc != nil {
 				defer dispatchFunc()
 			}
-		} else {
-			log.Println("error creating generated asset from source asset", err)
-			return
 		}
+		agentManager.generatedAssetStorageManager.Store(ga)
+		generatedAssets = append(generatedAssets, ga)
 	}
+	return generatedAssets
 }
 
-func (agentManager *RenderAgentManager) CreateDerivedWork(derivedSourceAsset *common.SourceAsset, templates []*common.Template, firstPage int, lastPage int) error {
-	placeholderSizes := make(map[string]string)
-	for _, template := range templates {
-		placeholderSize, err := common.GetFirstAttribute(template, common.TemplateAttributePlaceholderSize)
-		if err != nil {
-			return err
+func (agentManager *RenderAgentManager) setDetecting(sourceAssetId string, detecting bool) {
+	agentManager.mu.Lock()
+	defer agentManager.mu.Unlock()
+	if detecting {
+		agentManager.detecting[sourceAssetId] = true
+	} else {
+		delete(agentManager.detecting, sourceAssetId)
+	}
+}
+
+// shareDownload keeps a file downloaded to detect its file type for the render agents that render it. It is released once each of them has claimed it or after sharedDownloadTimeout.
+func (agentManager *RenderAgentManager) shareDownload(url string, file common.TemporaryFile, claims int) {
+	if claims == 0 || agentManager.temporaryFileManager == nil {
+		return
+	}
+	shared := &sharedDownload{agentManager.temporaryFileManager.Create(file.Path()), claims}
+	agentManager.downloadsMu.Lock()
+	previous, hasPrevious := agentManager.sharedDownloads[url]
+	agentManager.sharedDownloads[url] = shared
+	agentManager.downloadsMu.Unlock()
+	if hasPrevious {
+		previous.file.Release()
+	}
+	time.AfterFunc(sharedDownloadTimeout, func() {
+		agentManager.downloadsMu.Lock()
+		current, hasCurrent := agentManager.sharedDownloads[url]
+		if !hasCurrent || current != shared {
+			agentManager.downloadsMu.Unlock()
+			return
 		}
-		placeholderSizes[template.Id] = placeholderSize
+		delete(agentManager.sharedDownloads, url)
+		agentManager.downloadsMu.Unlock()
+		shared.file.Release()
+	})
+}
+
+// claimDownload returns a file shared by shareDownload for the url, or nil when there is none. The caller releases the returned file.
+func (agentManager *RenderAgentManager) claimDownload(url string) common.TemporaryFile {
+	agentManager.downloadsMu.Lock()
+	defer agentManager.downloadsMu.Unlock()
+	shared, hasShared := agentManager.sharedDownloads[url]
+	if !hasShared {
+		return nil
 	}
+	shared.claims = shared.claims - 1
+	if shared.claims > 0 {
+		return agentManager.temporaryFileManager.Create(shared.file.Path())
+	}
+	delete(agentManager.sharedDownloads, url)
+	return shared.file
+}
 
+func (agentManager *RenderAgentManager) CreateDerivedWork(derivedSourceAsset *common.SourceAsset, templates []*common.Template, firstPage int, lastPage int) error {
 	for page := firstPage; page < lastPage; page++ {
 		for _, template := range templates {
 			location := agentManager.uploader.Url(derivedSourceAsset, template, int32(page))
@@ -255,18 +495,269 @@ func (agentManager *RenderAgentManager) CreateDerivedWork(derivedSourceAsset *co
 	return nil
 }
 
+// SetPageLimits configures how the pages of multi-page source assets are rendered. Only the first eagerPages pages are rendered when a document is processed, the others are rendered when they are requested with RequestPage. When eagerPages is 0, every page is rendered. The maxPages map limits the number of pages rendered for a file type.
+func (agentManager *RenderAgentManager) SetPageLimits(eagerPages int, maxPages map[string]int) {
+	agentManager.eagerPages = eagerPages
+	agentManager.maxPages = maxPages
+}
+
+// SetFileTypeDetection configures whether the file types of new source assets are detected from their contents before work is created for them, and whether files whose contents do not match their declared file type are rejected.
+func (agentManager *RenderAgentManager) SetFileTypeDetection(enabled, rejectMismatches bool) {
+	agentManager.detectFileTypes = enabled
+	agentManager.rejectFileTypeMismatches = rejectMismatches
+}
+
+// SetWatermarkBasePath sets the directory that the watermark images of templates are loaded from.
+func (agentManager *RenderAgentManager) SetWatermarkBasePath(basePath string) {
+	agentManager.watermarkImages = newWatermarkImageCache(basePath)
+}
+
+// CreatePagedWork records the number of pages of a multi-page source asset that have previews and creates the work for the pages after the first that are rendered eagerly. The number of pages with previews is returned.
+func (agentManager *RenderAgentManager) CreatePagedWork(sourceAsset *common.SourceAsset, templates []*common.Template, pages int) int {
+	pages, lastPage := agentManager.eagerPageRange(sourceAsset, pages)
+	agentManager.CreateDerivedWork(sourceAsset, templates, 1, lastPage)
+	return pages
+}
+
+// eagerPageRange records the number of pages of a multi-page source asset that have previews and returns it along with the page after the last one that is rendered eagerly.
+func (agentManager *RenderAgentManager) eagerPageRange(sourceAsset *common.SourceAsset, pages int) (int, int) {
+	pages = agentManager.pageLimit(sourceAsset, pages)
+	agentManager.recordPreviewPages(sourceAsset, pages)
+
+	lastPage := pages
+	if agentManager.eagerPages > 0 && agentManager.eagerPages < lastPage {
+		lastPage = agentManager.eagerPages
+	}
+	return pages, lastPage
+}
+
+// RequestPage creates the work for a page of a multi-page source asset that was not rendered eagerly, using the templates of the first page. It returns true if work was created, and false if the page does not exist or already has generated assets.
+func (agentManager *RenderAgentManager) RequestPage(sourceAssetId string, page int) bool {
+	agentManager.pagesMu.Lock()
+	defer agentManager.pagesMu.Unlock()
+
+	sourceAssets, err := agentManager.sourceAssetStorageManager.FindBySourceAssetId(sourceAssetId)
+	if err != nil {
+		return false
+	}
+	generatedAssets, err := agentManager.generatedAssetStorageManager.FindBySourceAssetId(sourceAssetId)
+	if err != nil {
+		return false
+	}
+	for _, sourceAsset := range sourceAssets {
+		previewPages, err := strconv.Atoi(firstAttribute(sourceAsset, common.SourceAssetAttributePreviewPages))
+		if err != nil || page < 1 || page >= previewPages {
+			continue
+		}
+		templateIds := make([]string, 0, 0)
+		for _, generatedAsset := range generatedAssets {
+			if generatedAsset.SourceAssetType != sourceAsset.IdType {
+				continue
+			}
+			generatedAssetPage := firstAttribute(generatedAsset, common.GeneratedAssetAttributePage)
+			if generatedAssetPage == strconv.Itoa(page) {
+				return false
+			}
+			if (generatedAssetPage == "" || generatedAssetPage == "0") && !util.Contains(templateIds, generatedAsset.TemplateId) {
+				templateIds = append(templateIds, generatedAsset.TemplateId)
+			}
+		}
+		templates, err := agentManager.templateManager.FindByIds(templateIds)
+		if err != nil || len(templates) == 0 {
+			return false
+		}
+		agentManager.CreateDerivedWork(sourceAsset, templates, page, page+1)
+		return true
+	}
+	return false
+}
+
+// ReadGeneratedAsset downloads a generated asset with the downloader of the render agents and returns its contents.
+func (agentManager *RenderAgentManager) ReadGeneratedAsset(generatedAsset *common.GeneratedAsset) ([]byte, error) {
+	if agentManager.downloader == nil {
+		return nil, common.ErrorNotImplemented
+	}
+	file, err := agentManager.downloader.Download(generatedAsset.Location, generatedAsset.SourceAssetId+":"+generatedAsset.SourceAssetType)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Release()
+	return ioutil.ReadFile(file.Path())
+}
+
+// PreviewPages returns the number of pages that have previews for a multi-page source asset, or 0 when it is not known.
+func (agentManager *RenderAgentManager) PreviewPages(sourceAssetId string) int {
+	sourceAssets, err := agentManager.sourceAssetStorageManager.FindBySourceAssetId(sourceAssetId)
+	if err != nil {
+		return 0
+	}
+	previewPages := 0
+	for _, sourceAsset := range sourceAssets {
+		pages, err := strconv.Atoi(firstAttribute(sourceAsset, common.SourceAssetAttributePreviewPages))
+		if err == nil && pages > previewPages {
+			previewPages = pages
+		}
+	}
+	return previewPages
+}
+
+// pageLimit returns the number of pages of a source asset that have previews. The limits configured for the file type of the source asset and of the file it was derived from apply.
+func (agentManager *RenderAgentManager) pageLimit(sourceAsset *common.SourceAsset, pages int) int {
+	fileTypes := []string{firstAttribute(sourceAsset, common.SourceAssetAttributeType)}
+	if sourceAsset.IdType != common.SourceAssetTypeOrigin {
+		sourceAssets, err := agentManager.sourceAssetStorageManager.FindBySourceAssetId(sourceAsset.Id)
+		if err == nil {
+			for _, otherSourceAsset := range sourceAssets {
+				if otherSourceAsset.IdType == common.SourceAssetTypeOrigin {
+					fileTypes = append(fileTypes, firstAttribute(otherSourceAsset, common.SourceAssetAttributeType))
+				}
+			}
+		}
+	}
+	for _, fileType := range fileTypes {
+		maxPages, hasMaxPages := agentManager.maxPages[strings.ToLower(fileType)]
+		if hasMaxPages && maxPages > 0 && maxPages < pages {
+			pages = maxPages
+		}
+	}
+	return pages
+}
+
+func (agentManager *RenderAgentManager) recordPreviewPages(sourceAsset *common.SourceAsset, pages int) {
+	agentManager.pagesMu.Lock()
+	defer agentManager.pagesMu.Unlock()
+	if sourceAsset.HasAttribute(common.SourceAssetAttributePreviewPages) {
+		return
+	}
+	attributes := []common.Attribute{common.Attribute{Key: common.SourceAssetAttributePreviewPages, Value: []string{strconv.Itoa(pages)}}}
+	err := addSourceAssetAttributes(agentManager.sourceAssetStorageManager, sourceAsset, attributes)
+	if err != nil {
+		log.Println("error storing preview pages", err)
+	}
+}
+
+// recordContentHash stores the hash of the contents of a downloaded source file as an attribute of its source asset, unless that has already been done by the render of another template.
+func (agentManager *RenderAgentManager) recordContentHash(sourceAsset *common.SourceAsset, path string) {
+	if sourceAsset.HasAttribute(common.SourceAssetAttributeHash) {
+		return
+	}
+	hash, err := util.HashFile(path)
+	if err != nil {
+		log.Println("error hashing source file", err)
+		return
+	}
+	attributes := []common.Attribute{common.Attribute{Key: common.SourceAssetAttributeHash, Value: []string{hash}}}
+	err = addSourceAssetAttributes(agentManager.sourceAssetStorageManager, sourceAsset, attributes)
+	if err != nil {
+		log.Println("error storing source file hash", err)
+	}
+}
+
+// addSourceAssetAttributes stores attributes of a source asset without replacing the attributes stored by the renders of other templates in the meantime, and refreshes the attributes of the source asset with the stored ones.
+func addSourceAssetAttributes(sasm common.SourceAssetStorageManager, sourceAsset *common.SourceAsset, attributes []common.Attribute) error {
+	storedSourceAsset, err := sasm.AddAttributes(sourceAsset.Id, sourceAsset.IdType, attributes)
+	if err != nil {
+		return err
+	}
+	sourceAsset.Attributes = storedSourceAsset.Attributes
+	return nil
+}
+
+// findPreviousRender returns a complete generated asset of another source asset with the same contents, template and page as a generated asset, or nil when the contents have not been rendered with the template before.
+func (agentManager *RenderAgentManager) findPreviousRender(sourceAsset *common.SourceAsset, generatedAsset *common.GeneratedAsset) *common.GeneratedAsset {
+	hash := firstAttribute(sourceAsset, common.SourceAssetAttributeHash)
+	if hash == "" {
+		return nil
+	}
+	sourceAssets, err := agentManager.sourceAssetStorageManager.FindByHash(hash)
+	if err != nil {
+		log.Println("error finding source assets by hash", err)
+		return nil
+	}
+	page := generatedAssetPage(generatedAsset)
+	for _, otherSourceAsset := range sourceAssets {
+		if otherSourceAsset.Id == sourceAsset.Id || otherSourceAsset.IdType != sourceAsset.IdType {
+			continue
+		}
+		generatedAssets, err := agentManager.generatedAssetStorageManager.FindBySourceAssetId(otherSourceAsset.Id)
+		if err != nil {
+			continue
+		}
+		for _, otherGeneratedAsset := range generatedAssets {
+			if otherGeneratedAsset.SourceAssetType == otherSourceAsset.IdType &&
+				otherGeneratedAsset.TemplateId == generatedAsset.TemplateId &&
+				otherGeneratedAsset.Status == common.GeneratedAssetStatusComplete &&
+				generatedAssetPage(otherGeneratedAsset) == page {
+				return otherGeneratedAsset
+			}
+		}
+	}
+	return nil
+}
+
+// copyPreviousRender downloads the render of another source asset with the same contents, template and page as a generated asset to the destination so that it does not have to be rendered again. The copied render is returned, or nil when there is no such render or it could not be downloaded.
+func (agentManager *RenderAgentManager) copyPreviousRender(downloader common.Downloader, sourceAsset *common.SourceAsset, generatedAsset *common.GeneratedAsset, destination string) *common.GeneratedAsset {
+	previousRender := agentManager.findPreviousRender(sourceAsset, generatedAsset)
+	if previousRender == nil {
+		return nil
+	}
+	previousFile, err := downloader.Download(previousRender.Location, common.SourceAssetSource(sourceAsset))
+	if err != nil {
+		log.Println("error downloading previous render", previousRender.Id, err)
+		return nil
+	}
+	defer previousFile.Release()
+
+	err = os.Rename(previousFile.Path(), destination)
+	if err != nil {
+		log.Println("error copying previous render", previousRender.Id, err)
+		return nil
+	}
+	log.Println("Reusing render", previousRender.Id, "for generated asset", generatedAsset.Id)
+	return previousRender
+}
+
+// generatedAssetPage returns the page of a generated asset. Generated assets without the page attribute are for the first page.
+func generatedAssetPage(generatedAsset *common.GeneratedAsset) int {
+	page, err := strconv.Atoi(firstAttribute(generatedAsset, common.GeneratedAssetAttributePage))
+	if err != nil {
+		return 0
+	}
+	return page
+}
+
+// firstAttribute returns the first value of an attribute or an empty string.
+func firstAttribute(attributed common.Attributed, key string) string {
+	value, err := common.GetFirstAttribute(attributed, key)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
 func (agentManager *RenderAgentManager) whichRenderAgent(fileType string) ([]*common.Template, string, error) {
 	fileType = strings.ToLower(fileType)
+	// Enabled render agents are preferred so that render agents supporting the same file types can be toggled through configuration.
 	var templateIds []string
-	if util.Contains(agentManager.documentSupportedFileTypes, fileType) {
-		templateIds = []string{common.DocumentConversionTemplateId}
-	} else if util.Contains(agentManager.videoSupportedFileTypes, fileType) {
-		templateIds = []string{common.VideoConversionTemplateId}
-	} else if util.Contains(agentManager.imageMagickSupportedFileTypes, fileType) {
-		templateIds = common.LegacyDefaultTemplates
-	} else {
+	for _, factory := range agentManager.factories {
+		if isSupplemental(factory) {
+			continue
+		}
+		renderAgentConfig := agentManager.renderAgentConfigs[factory.Name()]
+		if util.Contains(renderAgentConfig.SupportedFileTypes, fileType) {
+			if renderAgentConfig.Enabled {
+				templateIds = factory.TemplateIds()
+				break
+			}
+			if templateIds == nil {
+				templateIds = factory.TemplateIds()
+			}
+		}
+	}
+	if templateIds == nil {
 		return nil, common.GeneratedAssetStatusFailed, common.ErrorNoRenderersSupportFileType
 	}
+	templateIds = append(append([]string{}, templateIds...), agentManager.supplementalTemplateIds(fileType)...)
 	templates, err := agentManager.templateManager.FindByIds(templateIds)
 	for _, t := range templates {
 		log.Println(t.Id, t.Renderer)
@@ -277,6 +768,23 @@ func (agentManager *RenderAgentManager) whichRenderAgent(fileType string) ([]*co
 	return templates, common.DefaultGeneratedAssetStatus, nil
 }
 
+// supplementalTemplateIds returns the ids of the templates of the enabled supplemental render agents that support the file type.
+func (agentManager *RenderAgentManager) supplementalTemplateIds(fileType string) []string {
+	templateIds := make([]string, 0, 0)
+	for _, factory := range agentManager.factories {
+		renderAgentConfig := agentManager.renderAgentConfigs[factory.Name()]
+		if isSupplemental(factory) && renderAgentConfig.Enabled && util.Contains(renderAgentConfig.SupportedFileTypes, strings.ToLower(fileType)) {
+			templateIds = append(templateIds, factory.TemplateIds()...)
+		}
+	}
+	return templateIds
+}
+
+func isSupplemental(factory RenderAgentFactory) bool {
+	supplemental, isSupplementalFactory := factory.(SupplementalRenderAgentFactory)
+	return isSupplementalFactory && supplemental.IsSupplemental()
+}
+
 func (agentManager *RenderAgentManager) canDispatch(generatedAssetId, status string, template *common.Template) (string, func()) {
 	agentManager.mu.Lock()
 	defer agentManager.mu.Unlock()
@@ -328,6 +836,9 @@ func (agentManager *RenderAgentManager) Stop() {
 	for _, workChannel := range agentManager.workChannels {
 		close(workChannel)
 	}
+	for _, priorityChannel := range agentManager.priorityChannels {
+		close(priorityChannel)
+	}
 
 	callback := make(chan bool)
 	agentManager.stop <- callback
@@ -338,25 +849,56 @@ func (agentManager *RenderAgentManager) Stop() {
 	close(agentManager.stop)
 }
 
-func (agentManager *RenderAgentManager) AddImageMagickRenderAgent(downloader common.Downloader, uploader common.Uploader, maxWorkIncrease int) RenderAgent {
-	renderAgent := newImageMagickRenderAgent(agentManager.imageMagickMetrics, agentManager, agentManager.sourceAssetStorageManager, agentManager.generatedAssetStorageManager, agentManager.templateManager, agentManager.temporaryFileManager, downloader, uploader, agentManager.workChannels[common.RenderAgentImageMagick])
-	renderAgent.AddStatusListener(agentManager.workStatus)
-	agentManager.AddRenderAgent(common.RenderAgentImageMagick, renderAgent, maxWorkIncrease)
-	return renderAgent
-}
-
-func (agentManager *RenderAgentManager) AddDocumentRenderAgent(downloader common.Downloader, uploader common.Uploader, docCachePath string, maxWorkIncrease int) RenderAgent {
-	renderAgent := newDocumentRenderAgent(agentManager.documentMetrics, agentManager, agentManager.sourceAssetStorageManager, agentManager.generatedAssetStorageManager, agentManager.templateManager, agentManager.temporaryFileManager, downloader, uploader, docCachePath, agentManager.workChannels[common.RenderAgentDocument])
-	renderAgent.AddStatusListener(agentManager.workStatus)
-	agentManager.AddRenderAgent(common.RenderAgentDocument, renderAgent, maxWorkIncrease)
-	return renderAgent
+// StartRenderAgents creates the configured number of render agents for every enabled render agent.
+func (agentManager *RenderAgentManager) StartRenderAgents(downloader common.Downloader, uploader common.Uploader, maxWorkIncrease int) error {
+	agentManager.downloader = downloader
+	for _, factory := range agentManager.factories {
+		renderAgentConfig := agentManager.renderAgentConfigs[factory.Name()]
+		if !renderAgentConfig.Enabled {
+			continue
+		}
+		validator, isValidator := factory.(RenderAgentConfigValidator)
+		if isValidator {
+			err := validator.ValidateConfig(renderAgentConfig)
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < renderAgentConfig.Count; i++ {
+			_, err := agentManager.NewRenderAgent(factory.Name(), downloader, uploader, maxWorkIncrease)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-func (agentManager *RenderAgentManager) AddVideoRenderAgent(maxWorkIncrease int) RenderAgent {
-	renderAgent := newVideoRenderAgent(agentManager.videoMetrics, agentManager, agentManager.sourceAssetStorageManager, agentManager.generatedAssetStorageManager, agentManager.templateManager, agentManager.workChannels[common.RenderAgentVideo], agentManager.zencoder, agentManager.zencoderS3Bucket, agentManager.zencoderNotificationUrl)
+// NewRenderAgent creates a render agent using the registered render agent factory with the given name and adds it to the render agent manager.
+func (agentManager *RenderAgentManager) NewRenderAgent(name string, downloader common.Downloader, uploader common.Uploader, maxWorkIncrease int) (RenderAgent, error) {
+	factory, err := agentManager.findFactory(name)
+	if err != nil {
+		return nil, err
+	}
+	context := &RenderAgentContext{
+		AgentManager:                 agentManager,
+		Metrics:                      agentManager.renderAgentMetrics[name],
+		Config:                       agentManager.renderAgentConfigs[name],
+		SourceAssetStorageManager:    agentManager.sourceAssetStorageManager,
+		GeneratedAssetStorageManager: agentManager.generatedAssetStorageManager,
+		TemplateManager:              agentManager.templateManager,
+		TemporaryFileManager:         agentManager.temporaryFileManager,
+		Downloader:                   downloader,
+		Uploader:                     uploader,
+		WorkChannel:                  agentManager.workChannels[name],
+	}
+	renderAgent, err := factory.NewRenderAgent(context)
+	if err != nil {
+		return nil, err
+	}
 	renderAgent.AddStatusListener(agentManager.workStatus)
-	agentManager.AddRenderAgent(common.RenderAgentVideo, renderAgent, maxWorkIncrease)
-	return renderAgent
+	agentManager.AddRenderAgent(name, renderAgent, maxWorkIncrease)
+	return renderAgent, nil
 }
 
 func (agentManager *RenderAgentManager) AddRenderAgent(name string, renderAgent RenderAgent, maxWorkIncrease int) {
@@ -401,7 +943,9 @@ func (agentManager *RenderAgentManager) run() {
 			}
 		case <-time.After(5 * time.Second):
 			{
-				agentManager.dispatchMoreWork()
+				if agentManager.workDispatcherEnabled {
+					agentManager.dispatchMoreWork()
+				}
 			}
 		}
 	}
@@ -423,6 +967,16 @@ func (agentManager *RenderAgentManager) dispatchMoreWork() {
 			if err == nil {
 				log.Println("Found", len(generatedAssets), "for", name)
 				for _, generatedAsset := range generatedAssets {
+					if util.Contains(agentManager.activeWork[name], generatedAsset.Id) {
+						// The generated asset was prioritized.
+						continue
+					}
+					if agentManager.detecting[generatedAsset.SourceAssetId] {
+						// The file type of the source asset is still being detected.
+						generatedAsset.Status = common.GeneratedAssetStatusWaiting
+						agentManager.generatedAssetStorageManager.Update(generatedAsset)
+						continue
+					}
 					generatedAsset.Status = common.GeneratedAssetStatusScheduled
 					err := agentManager.generatedAssetStorageManager.Update(generatedAsset)
 					if err == nil {
@@ -440,12 +994,110 @@ func (agentManager *RenderAgentManager) dispatchMoreWork() {
 func (agentManager *RenderAgentManager) handleStatus(renderStatus RenderStatus) {
 	agentManager.mu.Lock()
 	defer agentManager.mu.Unlock()
-	if renderStatus.Status == common.GeneratedAssetStatusComplete || strings.HasPrefix(renderStatus.Status, common.GeneratedAssetStatusFailed) {
+	if isFinishedStatus(renderStatus.Status) {
 		activeWork, hasActiveWork := agentManager.activeWork[renderStatus.Service]
 		if hasActiveWork {
 			agentManager.activeWork[renderStatus.Service] = listWithout(activeWork, renderStatus.GeneratedAssetId)
 		}
+		for _, waiter := range agentManager.waiters[renderStatus.GeneratedAssetId] {
+			select {
+			case waiter <- true:
+			default:
+			}
+		}
+	}
+}
+
+// Prioritize dispatches a waiting generated asset to a render agent right away instead of waiting for the work dispatcher to find it. Prioritized work is sent on a separate channel that render agents receive from before their work channel. It returns false if the generated asset is not waiting or its render agents already have as much work as they are allowed.
+func (agentManager *RenderAgentManager) Prioritize(generatedAssetId string) bool {
+	generatedAsset, err := agentManager.generatedAssetStorageManager.FindById(generatedAssetId)
+	if err != nil || generatedAsset.Status != common.GeneratedAssetStatusWaiting {
+		return false
+	}
+	templates, err := agentManager.templateManager.FindByIds([]string{generatedAsset.TemplateId})
+	if err != nil || len(templates) == 0 {
+		return false
+	}
+	renderer := templates[0].Renderer
+	if !agentManager.reservePriorityWork(renderer, generatedAssetId) {
+		return false
+	}
+
+	generatedAsset.Status = common.GeneratedAssetStatusScheduled
+	err = agentManager.generatedAssetStorageManager.Update(generatedAsset)
+	if err != nil {
+		agentManager.RemoveWork(renderer, generatedAssetId)
+		return false
+	}
+	priorityChannel := agentManager.priorityChannels[renderer]
+	go func() {
+		priorityChannel <- generatedAssetId
+	}()
+	return true
+}
+
+// reservePriorityWork adds a generated asset to the active work of a render agent unless it is already there, there are no render agents of that kind or they already have as much work as they are allowed.
+func (agentManager *RenderAgentManager) reservePriorityWork(renderer, generatedAssetId string) bool {
+	agentManager.mu.Lock()
+	defer agentManager.mu.Unlock()
+
+	if len(agentManager.renderAgents[renderer]) == 0 {
+		return false
+	}
+	activeWork := agentManager.activeWork[renderer]
+	if util.Contains(activeWork, generatedAssetId) || len(activeWork) >= agentManager.maxWork[renderer] {
+		return false
+	}
+	agentManager.activeWork[renderer] = uniqueListWith(activeWork, generatedAssetId)
+	return true
+}
+
+// priorityChannel returns the channel that prioritized work for a render agent is sent on.
+func (agentManager *RenderAgentManager) priorityChannel(name string) RenderAgentWorkChannel {
+	return agentManager.priorityChannels[name]
+}
+
+// WaitForGeneratedAsset waits until a generated asset is complete or has failed. It returns false if the generated asset was not finished before the timeout.
+func (agentManager *RenderAgentManager) WaitForGeneratedAsset(generatedAssetId string, timeout time.Duration) bool {
+	waiter := make(chan bool, 1)
+	agentManager.mu.Lock()
+	agentManager.waiters[generatedAssetId] = append(agentManager.waiters[generatedAssetId], waiter)
+	agentManager.mu.Unlock()
+
+	defer func() {
+		agentManager.mu.Lock()
+		defer agentManager.mu.Unlock()
+		waiters := make([]chan bool, 0, 0)
+		for _, otherWaiter := range agentManager.waiters[generatedAssetId] {
+			if otherWaiter != waiter {
+				waiters = append(waiters, otherWaiter)
+			}
+		}
+		if len(waiters) == 0 {
+			delete(agentManager.waiters, generatedAssetId)
+		} else {
+			agentManager.waiters[generatedAssetId] = waiters
+		}
+	}()
+
+	// The generated asset may have finished before the waiter was added.
+	generatedAsset, err := agentManager.generatedAssetStorageManager.FindById(generatedAssetId)
+	if err != nil {
+		return false
+	}
+	if isFinishedStatus(generatedAsset.Status) {
+		return true
 	}
+	select {
+	case <-waiter:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func isFinishedStatus(status string) bool {
+	return status == common.GeneratedAssetStatusComplete || strings.HasPrefix(status, common.GeneratedAssetStatusFailed)
 }
 
 func (agentManager *RenderAgentManager) RemoveWork(service, id string) {
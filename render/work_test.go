@@ -0,0 +1,433 @@
+package render
+
+import (
+	"github.com/ngerakines/preview/common"
+	"github.com/ngerakines/preview/config"
+	"github.com/ngerakines/preview/util"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPagedWork(t *testing.T) {
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	uploader := common.NewLocalUploader("")
+
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentImageMagick: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, common.NewTemporaryFileManager(), uploader, false, renderAgentConfigs)
+	rm.SetPageLimits(2, map[string]int{"pdf": 5})
+
+	sourceAssetId := "9B4E2C71-5A3D-4F86-B0E9-1D7C6A2F8E53"
+	rm.CreateWork(sourceAssetId, "file:///tmp/report.pdf", "pdf", 12)
+
+	sourceAssets, err := sasm.FindBySourceAssetId(sourceAssetId)
+	if err != nil || len(sourceAssets) != 1 {
+		t.Errorf("Unexpected source assets: %v %s", sourceAssets, err)
+		return
+	}
+	generatedAssets, err := gasm.FindBySourceAssetId(sourceAssetId)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	templateIds := make([]string, 0, 0)
+	for _, generatedAsset := range generatedAssets {
+		templateIds = append(templateIds, generatedAsset.TemplateId)
+	}
+	templates, err := tm.FindByIds(templateIds)
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+
+	if pages := rm.CreatePagedWork(sourceAssets[0], templates, 20); pages != 5 {
+		t.Error("Expected the pages to be limited for the file type:", pages)
+	}
+	if rm.PreviewPages(sourceAssetId) != 5 {
+		t.Error("Expected the preview pages to be recorded:", rm.PreviewPages(sourceAssetId))
+	}
+	generatedAssets, _ = gasm.FindBySourceAssetId(sourceAssetId)
+	if len(generatedAssets) != len(templates)*2 {
+		t.Error("Expected generated assets for the eager pages:", len(generatedAssets))
+	}
+
+	if !rm.RequestPage(sourceAssetId, 3) {
+		t.Error("Expected work to be created for a requested page")
+	}
+	if rm.RequestPage(sourceAssetId, 3) {
+		t.Error("Expected work to be created once for a page")
+	}
+	if rm.RequestPage(sourceAssetId, 1) {
+		t.Error("Expected no work to be created for an eager page")
+	}
+	if rm.RequestPage(sourceAssetId, 5) || rm.RequestPage(sourceAssetId, 0) {
+		t.Error("Expected no work to be created for pages without previews")
+	}
+	generatedAssets, _ = gasm.FindBySourceAssetId(sourceAssetId)
+	if len(generatedAssets) != len(templates)*3 {
+		t.Error("Expected generated assets for the requested page:", len(generatedAssets))
+	}
+}
+
+type testRenderAgent struct {
+	workChannel RenderAgentWorkChannel
+}
+
+func (renderAgent *testRenderAgent) Stop() {
+}
+
+func (renderAgent *testRenderAgent) AddStatusListener(listener RenderStatusChannel) {
+}
+
+func (renderAgent *testRenderAgent) Dispatch() RenderAgentWorkChannel {
+	return renderAgent.workChannel
+}
+
+func TestPrioritizeAndWait(t *testing.T) {
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	uploader := common.NewLocalUploader("")
+
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentImageMagick: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, common.NewTemporaryFileManager(), uploader, false, renderAgentConfigs)
+
+	sourceAssetId := "E27A4C90-3D1B-4F68-9A5E-6C8B0D2F7E14"
+	rm.CreateWork(sourceAssetId, "file:///tmp/report.pdf", "pdf", 12)
+	generatedAssets, err := gasm.FindBySourceAssetId(sourceAssetId)
+	if err != nil || len(generatedAssets) == 0 {
+		t.Errorf("Unexpected generated assets: %v %s", generatedAssets, err)
+		return
+	}
+	generatedAssetId := generatedAssets[0].Id
+
+	renderAgent := &testRenderAgent{make(RenderAgentWorkChannel, 10)}
+	rm.AddRenderAgent(common.RenderAgentImageMagick, renderAgent, 1)
+
+	if !rm.Prioritize(generatedAssetId) {
+		t.Error("Expected the generated asset to be dispatched")
+	}
+	select {
+	case id := <-rm.priorityChannel(common.RenderAgentImageMagick):
+		if id != generatedAssetId {
+			t.Error("Unexpected generated asset dispatched:", id)
+		}
+	case <-renderAgent.workChannel:
+		t.Error("Expected the generated asset to be sent on the priority channel")
+	case <-time.After(time.Second):
+		t.Error("Expected the generated asset to be dispatched to the render agent")
+	}
+	if rm.Prioritize(generatedAssetId) {
+		t.Error("Expected a scheduled generated asset not to be dispatched again")
+	}
+	if len(generatedAssets) > 1 && rm.Prioritize(generatedAssets[1].Id) {
+		t.Error("Expected prioritized work not to exceed the maximum work of the render agents")
+	}
+
+	if rm.WaitForGeneratedAsset(generatedAssetId, 50*time.Millisecond) {
+		t.Error("Expected the wait to time out")
+	}
+
+	finished := make(chan bool)
+	go func() {
+		finished <- rm.WaitForGeneratedAsset(generatedAssetId, 5*time.Second)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	generatedAsset, _ := gasm.FindById(generatedAssetId)
+	generatedAsset.Status = common.GeneratedAssetStatusComplete
+	gasm.Update(generatedAsset)
+	rm.handleStatus(RenderStatus{generatedAssetId, common.GeneratedAssetStatusComplete, common.RenderAgentImageMagick})
+	select {
+	case done := <-finished:
+		if !done {
+			t.Error("Expected the generated asset to be finished")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Expected waiters to be notified when the generated asset is finished")
+	}
+}
+
+// testDownloader copies files with file urls into a directory.
+type testDownloader struct {
+	tfm       common.TemporaryFileManager
+	directory string
+}
+
+func (downloader *testDownloader) Download(url, source string) (common.TemporaryFile, error) {
+	content, err := ioutil.ReadFile(strings.TrimPrefix(url, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(downloader.directory, "download")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	_, err = file.Write(content)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.tfm.Create(file.Name()), nil
+}
+
+func TestCopyPreviousRender(t *testing.T) {
+	directory, err := ioutil.TempDir("", "reuse")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	tfm := common.NewTemporaryFileManager()
+	downloader := &testDownloader{tfm, directory}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, tfm, common.NewLocalUploader(directory), false, map[string]*config.RenderAgentConfig{})
+
+	sourcePath := filepath.Join(directory, "logo.png")
+	renderPath := filepath.Join(directory, "render.jpg")
+	ioutil.WriteFile(sourcePath, []byte("logo"), 0644)
+	ioutil.WriteFile(renderPath, []byte("render"), 0644)
+
+	previousSourceAsset, _ := common.NewSourceAsset("1E8C4A7B-5D20-4F93-B6A1-0C9E3D7F2B58", common.SourceAssetTypeOrigin)
+	sasm.Store(previousSourceAsset)
+	rm.recordContentHash(previousSourceAsset, sourcePath)
+	previousGeneratedAsset, _ := common.NewGeneratedAssetFromSourceAsset(previousSourceAsset, common.DocumentConversionTemplateId, "file://"+renderPath)
+	previousGeneratedAsset.Status = common.GeneratedAssetStatusComplete
+	gasm.Store(previousGeneratedAsset)
+
+	sourceAsset, _ := common.NewSourceAsset("9D3B7E1C-0A64-4B85-8F2E-6C1A5D9B3E70", common.SourceAssetTypeOrigin)
+	sasm.Store(sourceAsset)
+	rm.recordContentHash(sourceAsset, sourcePath)
+	if firstAttribute(sourceAsset, common.SourceAssetAttributeHash) != util.Hash([]byte("logo")) {
+		t.Errorf("Unexpected source file hash: %q", sourceAsset.GetAttribute(common.SourceAssetAttributeHash))
+	}
+	generatedAsset, _ := common.NewGeneratedAssetFromSourceAsset(sourceAsset, common.DocumentConversionTemplateId, "file://"+filepath.Join(directory, "copy.jpg"))
+	gasm.Store(generatedAsset)
+
+	destination := filepath.Join(directory, "destination.jpg")
+	if rm.copyPreviousRender(downloader, sourceAsset, generatedAsset, destination) == nil {
+		t.Error("Expected the previous render to be copied")
+		return
+	}
+	content, err := ioutil.ReadFile(destination)
+	if err != nil || string(content) != "render" {
+		t.Errorf("Unexpected copied render: %q %v", content, err)
+	}
+
+	otherPageAsset, _ := common.NewGeneratedAssetFromSourceAsset(sourceAsset, common.DocumentConversionTemplateId, "file://"+filepath.Join(directory, "page.jpg"))
+	otherPageAsset.AddAttribute(common.GeneratedAssetAttributePage, []string{"1"})
+	if rm.copyPreviousRender(downloader, sourceAsset, otherPageAsset, destination) != nil {
+		t.Error("Expected renders of other pages not to be copied")
+	}
+
+	previousGeneratedAsset.Status = common.GeneratedAssetStatusProcessing
+	gasm.Update(previousGeneratedAsset)
+	if rm.copyPreviousRender(downloader, sourceAsset, generatedAsset, destination) != nil {
+		t.Error("Expected incomplete renders not to be copied")
+	}
+}
+
+func findGeneratedAssets(gasm common.GeneratedAssetStorageManager, sourceAssetId string) []*common.GeneratedAsset {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		generatedAssets, err := gasm.FindBySourceAssetId(sourceAssetId)
+		if err == nil && len(generatedAssets) > 0 {
+			return generatedAssets
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestDetectedWork(t *testing.T) {
+	directory, err := ioutil.TempDir("", "detect")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	sourcePath := filepath.Join(directory, "report.jpg")
+	ioutil.WriteFile(sourcePath, []byte("%PDF-1.4\n"), 0644)
+
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	tfm := common.NewTemporaryFileManager()
+	renderAgentConfigs := map[string]*config.RenderAgentConfig{
+		common.RenderAgentImageMagick: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"pdf"}, Raw: []byte("{}")},
+		common.RenderAgentNativeImage: &config.RenderAgentConfig{Enabled: true, SupportedFileTypes: []string{"jpg"}, Raw: []byte("{}")},
+	}
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, tfm, common.NewLocalUploader(directory), false, renderAgentConfigs)
+	rm.downloader = &testDownloader{tfm, directory}
+	rm.SetFileTypeDetection(true, false)
+
+	sourceAssetId := "5A0E7C3B-1D94-4F26-8B7E-3C9F2A6D0E81"
+	rm.CreateWork(sourceAssetId, "file://"+sourcePath, "jpg", 9)
+	generatedAssets, _ := gasm.FindBySourceAssetId(sourceAssetId)
+	if len(generatedAssets) == 0 {
+		t.Error("Expected work to be created for the declared file type right away")
+		return
+	}
+	for _, generatedAsset := range generatedAssets {
+		if generatedAsset.Status != common.GeneratedAssetStatusWaiting {
+			t.Errorf("Unexpected generated asset status: %s", generatedAsset.Status)
+		}
+	}
+	rm.detections.Wait()
+
+	generatedAssets, _ = gasm.FindBySourceAssetId(sourceAssetId)
+	rendered := 0
+	for _, generatedAsset := range generatedAssets {
+		templates, _ := tm.FindByIds([]string{generatedAsset.TemplateId})
+		if len(templates) != 1 {
+			t.Errorf("Unexpected template for generated asset: %s", generatedAsset.TemplateId)
+			continue
+		}
+		switch templates[0].Renderer {
+		case common.RenderAgentImageMagick:
+			rendered++
+			if generatedAsset.Status != common.GeneratedAssetStatusWaiting {
+				t.Errorf("Unexpected generated asset status: %s", generatedAsset.Status)
+			}
+		default:
+			if generatedAsset.Status != common.NewGeneratedAssetError(common.ErrorFileTypeMismatch) {
+				t.Errorf("Unexpected generated asset status: %s", generatedAsset.Status)
+			}
+		}
+	}
+	if rendered == 0 {
+		t.Error("Expected work to be created for the detected file type")
+	}
+	sourceAssets, _ := sasm.FindBySourceAssetId(sourceAssetId)
+	if len(sourceAssets) != 1 ||
+		firstAttribute(sourceAssets[0], common.SourceAssetAttributeType) != "pdf" ||
+		firstAttribute(sourceAssets[0], common.SourceAssetAttributeDeclaredType) != "jpg" ||
+		firstAttribute(sourceAssets[0], common.SourceAssetAttributeDetectedType) != "pdf" {
+		t.Errorf("Unexpected source asset attributes: %v", sourceAssets)
+	}
+
+	rm.SetFileTypeDetection(true, true)
+	sourceAssetId = "D62B9F04-7E31-4C5A-A0D8-1F4E8B3C7A92"
+	rm.CreateWork(sourceAssetId, "file://"+sourcePath, "jpg", 9)
+	rm.detections.Wait()
+	generatedAssets, _ = gasm.FindBySourceAssetId(sourceAssetId)
+	if len(generatedAssets) == 0 {
+		t.Error("Expected failed work to be created for the declared file type")
+		return
+	}
+	for _, generatedAsset := range generatedAssets {
+		if generatedAsset.Status != common.NewGeneratedAssetError(common.ErrorFileTypeMismatch) {
+			t.Errorf("Unexpected generated asset status: %s", generatedAsset.Status)
+		}
+	}
+
+	sourceAssetId = "8C1E4F7A-2B5D-4E90-A3C6-9D0F1B2E4A57"
+	rm.CreateWorkFromTemplates(sourceAssetId, "file://"+sourcePath, map[string][]string{"type": []string{"jpg"}}, []string{common.DocumentConversionTemplateId})
+	rm.detections.Wait()
+	generatedAssets, _ = gasm.FindBySourceAssetId(sourceAssetId)
+	if len(generatedAssets) != 1 || generatedAssets[0].Status != common.NewGeneratedAssetError(common.ErrorFileTypeMismatch) {
+		t.Errorf("Expected the generated asset of the template to fail: %v", generatedAssets)
+	}
+}
+
+func TestUnsupportedWork(t *testing.T) {
+	directory, err := ioutil.TempDir("", "unsupported")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	sourcePath := filepath.Join(directory, "notes.xyz")
+	ioutil.WriteFile(sourcePath, []byte("notes"), 0644)
+
+	tm := common.NewTemplateManager()
+	sasm := common.NewSourceAssetStorageManager()
+	gasm := common.NewGeneratedAssetStorageManager(tm)
+	tfm := common.NewTemporaryFileManager()
+	rm := NewRenderAgentManager(metrics.NewRegistry(), sasm, gasm, tm, tfm, common.NewLocalUploader(directory), false, map[string]*config.RenderAgentConfig{})
+	rm.downloader = &testDownloader{tfm, directory}
+
+	expectedStatus := common.NewGeneratedAssetError(common.ErrorNoRenderersSupportFileType)
+	sourceAssetIds := map[bool]string{
+		false: "F3A7C2E9-5B18-4D06-8E4F-1A9B7C3D5E21",
+		true:  "0B6D8E2F-4A91-4C37-B5E0-7F2A9C1D3E64",
+	}
+	for detect, sourceAssetId := range sourceAssetIds {
+		rm.SetFileTypeDetection(detect, false)
+		rm.CreateWork(sourceAssetId, "file://"+sourcePath, "xyz", 5)
+		rm.detections.Wait()
+		generatedAssets, _ := gasm.FindBySourceAssetId(sourceAssetId)
+		if len(generatedAssets) != len(common.LegacyDefaultTemplates) {
+			t.Errorf("Expected failed work to be recorded: %v", generatedAssets)
+		}
+		for _, generatedAsset := range generatedAssets {
+			if generatedAsset.Status != expectedStatus {
+				t.Errorf("Unexpected generated asset status: %s", generatedAsset.Status)
+			}
+		}
+	}
+}
+
+func TestSharedDownload(t *testing.T) {
+	directory, err := ioutil.TempDir("", "shared")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	sourcePath := filepath.Join(directory, "source")
+	ioutil.WriteFile(sourcePath, []byte("source"), 0644)
+
+	tfm := common.NewTemporaryFileManager()
+	rm := NewRenderAgentManager(metrics.NewRegistry(), nil, nil, common.NewTemplateManager(), tfm, nil, false, map[string]*config.RenderAgentConfig{})
+	rm.shareDownload("file:///source", tfm.Create(sourcePath), 2)
+
+	for i := 0; i < 2; i++ {
+		file := rm.claimDownload("file:///source")
+		if file == nil || file.Path() != sourcePath {
+			t.Errorf("Expected the shared download to be claimed: %v", file)
+		}
+	}
+	if rm.claimDownload("file:///source") != nil {
+		t.Error("Expected the shared download to be released once it was claimed")
+	}
+}
+
+func TestReadGeneratedAsset(t *testing.T) {
+	directory, err := ioutil.TempDir("", "read")
+	if err != nil {
+		t.Errorf("Unexpected error returned: %s", err)
+		return
+	}
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "listing.json"), []byte(`{"format":"zip"}`), 0644)
+
+	tfm := common.NewTemporaryFileManager()
+	rm := NewRenderAgentManager(metrics.NewRegistry(), nil, nil, common.NewTemplateManager(), tfm, nil, false, map[string]*config.RenderAgentConfig{})
+	generatedAsset := &common.GeneratedAsset{SourceAssetId: "archive", SourceAssetType: common.SourceAssetTypeOrigin, TemplateId: common.ArchiveListingTemplateId, Location: "local:///listing.json"}
+	_, err = rm.ReadGeneratedAsset(generatedAsset)
+	if err == nil {
+		t.Error("Expected an error before the render agents are started")
+	}
+
+	rm.downloader = common.NewDownloader(directory, directory, tfm, false, []string{}, nil)
+	payload, err := rm.ReadGeneratedAsset(generatedAsset)
+	if err != nil || string(payload) != `{"format":"zip"}` {
+		t.Errorf("Unexpected contents: %s %v", payload, err)
+	}
+}
@@ -1,11 +1,7 @@
 package util
 
 import (
-	"log"
 	"os"
-	"os/exec"
-	"regexp"
-	"strconv"
 )
 
 // CanLoadFile returns true if a file can be opened or false if otherwise.
@@ -40,24 +36,3 @@ func Cwd() string {
 	}
 	return pwd
 }
-
-var pdfPageCount = regexp.MustCompile(`Pages:\s+(\d+)`)
-
-// pdfinfo ~/Desktop/ChefConf2014schedule.pdf
-func GetPdfPageCount(file string) (int, error) {
-	_, err := exec.LookPath("pdfinfo")
-	if err != nil {
-		log.Println("pdfinfo command not found")
-		return 0, err
-	}
-	out, err := exec.Command("pdfinfo", file).Output()
-	if err != nil {
-		log.Fatal(err)
-		return 0, err
-	}
-	matches := pdfPageCount.FindStringSubmatch(string(out))
-	if len(matches) == 2 {
-		return strconv.Atoi(matches[1])
-	}
-	return 0, nil
-}
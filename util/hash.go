@@ -5,6 +5,8 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"os"
 )
 
 // ComputeHmac256 returns a base64 encoded hash of a message using a secret.
@@ -21,3 +23,19 @@ func Hash(bytes []byte) string {
 	hasher.Write(bytes)
 	return fmt.Sprintf("%x", hasher.Sum(nil))
 }
+
+// HashFile returns a hex encoded sha1 hash of the contents of a file, in the same format as Hash.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha1.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}